@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/erpc-go/erpc/codec"
+	"github.com/erpc-go/erpc/compress"
 	"github.com/erpc-go/erpc/protocol"
-	"github.com/erpc-go/erpc/protocol/test"
+	erpc "github.com/erpc-go/erpc/protocol/erpc"
+	"github.com/erpc-go/erpc/protocol/grpc"
 	"github.com/erpc-go/erpc/utils"
 	"github.com/erpc-go/log"
 )
@@ -20,9 +24,10 @@ const (
 
 // 应用层协议类型
 const (
-	AppProtocolTME = "tme" // tme协议
-	AppProtocolPDU = "pdu" // pdu协议
-	AppProtocolQZA = "qza" // qza协议
+	AppProtocolTME  = "tme"  // tme协议
+	AppProtocolPDU  = "pdu"  // pdu协议
+	AppProtocolQZA  = "qza"  // qza协议
+	AppProtocolGrpc = "grpc" // gRPC协议
 )
 
 // context关键属性
@@ -36,6 +41,9 @@ var (
 	Env               = "env"                 // env(devops id,string类型)
 )
 
+// peerDicts 被调服务已有的预置字典，从回包首部获知，被调服务名 -> []uint32
+var peerDicts sync.Map
+
 // Client 框架客户端实例
 type Client struct {
 	Request                    // 网络底层
@@ -43,15 +51,18 @@ type Client struct {
 	rspBody  interface{}       // 响应包
 	protocol protocol.Protocol // 应用协议首部
 	authInfo protocol.AuthInfo // AuthInfo
+	compress compress.Policy   // 请求 body 压缩策略
 }
 
 // CallDesc RPC参数
 type CallDesc struct {
-	LocalServiceName string        // <非必填>本次请求主调服务名
-	ServiceName      string        // <必填>本次请求被调服务名, 对应toml配置文件中的一段
-	Protocol         string        // <非必填>应用层协议(qza/pdu/tme), 默认tme
-	Address          string        // <非必填>
-	Timeout          time.Duration // <非必填>RPC超时时间
+	LocalServiceName string          // <非必填>本次请求主调服务名
+	ServiceName      string          // <必填>本次请求被调服务名, 对应toml配置文件中的一段
+	Protocol         string          // <非必填>应用层协议(qza/pdu/tme/grpc), 默认tme
+	Address          string          // <非必填>
+	Timeout          time.Duration   // <非必填>RPC超时时间
+	Codec            uint8           // <非必填>body 编码方式，取值同 erpc 协议首部 codec 字段，默认按请求 body 类型自动选择
+	Compress         compress.Policy // <非必填>请求 body 压缩策略，同时声明回包可接受该压缩方式，默认不压缩
 }
 
 // New 构造支持tme/qdu/qza协议的client
@@ -62,6 +73,7 @@ func New(desc CallDesc, authInfo protocol.AuthInfo, reqBody, rspBody interface{}
 		reqBody:  reqBody,
 		rspBody:  rspBody,
 		authInfo: authInfo,
+		compress: desc.Compress,
 	}
 
 	// step 2. 解析mesh配置
@@ -77,8 +89,22 @@ func New(desc CallDesc, authInfo protocol.AuthInfo, reqBody, rspBody interface{}
 	}
 
 	// step 3. 初始化协议首部
-	c.protocol = &test.TestProtocol{}
+	if desc.Protocol == AppProtocolGrpc {
+		head := grpc.NewRequest(desc.ServiceName)
+		head.SetServiceName(desc.ServiceName)
+		c.protocol = head
+	} else {
+		head := erpc.NewRequest(desc.ServiceName)
+		head.SetServiceName(desc.ServiceName)
+		c.protocol = head
+	}
 	c.protocol.SetLocalServiceName(localServiceName)
+	// 未指定编码方式时按请求 body 类型选择，见 codec.AutoCodec
+	if desc.Codec != 0 {
+		c.protocol.SetProtoType(desc.Codec)
+	} else if reqBody != nil {
+		c.protocol.SetProtoType(uint8(codec.DefaultAutoCodec.Select(reqBody)))
+	}
 
 	// step 4. 默认与localhost,65001端口建立tcp长连接
 	address := fmt.Sprintf("ip://%s:%d", DefaultEnvoyHost, DefaultEnvoyPort)
@@ -158,7 +184,6 @@ func (c *Client) doRequest(ctx context.Context, opt ...map[string]string) error
 		c.protocol.SetTraceID(traceID)
 		c.authInfo.TraceID = traceID
 	}
-	fmt.Println(c == nil)
 	// Remote Serivce Name
 	addrs := strings.Split(c.Address, "://")
 	if len(addrs) > 1 {
@@ -191,11 +216,56 @@ func (c *Client) doRequest(ctx context.Context, opt ...map[string]string) error
 			c.protocol.SetExtKv(k, opt[0][k])
 		}
 	}
-	fmt.Println(c)
+	if head, ok := c.protocol.(*grpc.Package); ok {
+		c.invokeGrpc(ctx, head)
+		return nil
+	}
 	DoRequests(ctx, c)
 	return nil
 }
 
+// invokeGrpc 以 gRPC 协议发起调用，寻址及错误码同 DoRequests
+func (c *Client) invokeGrpc(ctx context.Context, head *grpc.Package) {
+	if done := isDone(ctx); done > 0 {
+		c.Finish(done, "", 0)
+		return
+	}
+	addressing, err := NewAddress(c.Address)
+	if err != nil {
+		log.Error("addressing:%s fail:%s", c.Address, err)
+		c.Finish(ErrAddressingFail, "", 0)
+		return
+	}
+	addr := addressing.Address()
+
+	head.SetAuthInfo(&c.authInfo)
+
+	subCtx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	ec := ErrOK
+	if err := grpc.Invoke(subCtx, addr, head, c.reqBody, c.rspBody); err != nil {
+		log.Error("grpc invoke %s fail:%s", addr, err)
+		switch subCtx.Err() {
+		case context.DeadlineExceeded:
+			ec = ErrRecvTimeout
+		case context.Canceled:
+			ec = ErrContextCanceled
+		default:
+			ec = ErrRecvFail
+		}
+	} else {
+		c.ServiceErrCode = int(head.GetResultCode())
+		c.ServiceErrMsg = head.GetResultMsg()
+	}
+	c.Finish(ec, addr, addressing.Cost())
+
+	err = nil
+	if ec == ErrRecvTimeout || ec == ErrRecvFail {
+		err = fmt.Errorf("[%d,%s]", ec, ErrMsg[ec])
+	}
+	addressing.Update(err)
+}
+
 // ReqBody 获取reqbody interface
 func (c *Client) ReqBody() interface{} {
 	return c.reqBody
@@ -208,92 +278,85 @@ func (c *Client) RspBody() interface{} {
 
 // Marshal 打包函数
 func (c *Client) Marshal() ([]byte, error) {
-	// if head, ok := c.Head.(*th.TmeHeader); ok {
-	// 	// tme协议打包
-	// 	bodyBuf, err := th.TMEBodyMarshal(head, c.reqBody)
-	// 	if err != nil {
-	// 		return bodyBuf, err
-	// 	}
-	// 	head.SetBodyLen(uint32(len(bodyBuf)))
-	// 	pkgBuf := make([]byte, head.Len()+head.GetBodyLen())
-	// 	headBuf, _ := head.Marshal()
-	// 	copy(pkgBuf[:head.Len()], headBuf)
-	// 	copy(pkgBuf[head.Len():], bodyBuf)
-	// 	return pkgBuf, nil
-	// }
-	// if head, ok := c.Head.(*th.QzaHeader); ok {
-	// 	// qza协议打包
-	// 	bodyBuf, err := th.QZABodyMarshal(head, c.reqBody)
-	// 	if err != nil {
-	// 		return bodyBuf, err
-	// 	}
-	// 	head.SetPackLen(uint32(head.GetHeadLen()) + uint32(len(bodyBuf)))
-	// 	headBuf, _ := head.Marshal()
-	// 	pkgBuf := make([]byte, head.GetPackLen())
-	// 	// buffer copy
-	// 	copy(pkgBuf[:head.GetPackLen()], headBuf)
-	// 	copy(pkgBuf[head.GetHeadLen():], bodyBuf)
-	// 	return pkgBuf, nil
-	// }
-	// if head, ok := c.Head.(*th.PduHeader); ok {
-	// 	// pdu协议打包
-	// 	bodyBuf, err := th.PDUBodyMarshal(head, c.reqBody)
-	// 	if err != nil {
-	// 		return bodyBuf, err
-	// 	}
-	// 	pkgLen := 2 + th.PduProtoHeaderSize + len(bodyBuf) // SOH + 包头 + 包体 + EOT 长度
-	// 	head.SetPackLen(uint32(pkgLen))
-	// 	headBuf, _ := head.Marshal()
-	// 	pkgBuf := make([]byte, pkgLen)
-	// 	// buffer copy
-	// 	pkgBuf[0] = byte(th.PDUSOH)
-	// 	copy(pkgBuf[1:1+th.PduProtoHeaderSize], headBuf)
-	// 	copy(pkgBuf[1+th.PduProtoHeaderSize:pkgLen-1], bodyBuf)
-	// 	pkgBuf[pkgLen-1] = byte(th.PDUEOT)
-	// 	return pkgBuf, nil
-	// }
-	return nil, fmt.Errorf("Client.Marshal(), invalid protocol")
+	c.protocol.SetAuthInfo(&c.authInfo)
+	// 未达到压缩阈值时 MarshalBody 会将压缩方式置为 None，每次打包重新设置
+	if p, ok := c.protocol.(protocol.Compressible); ok && c.compress.Type != compress.None {
+		p.SetCompress(c.compress.Type)
+		p.SetCompressThreshold(c.compress.Threshold)
+		p.SetAcceptCompress(c.compress.Type)
+	}
+	c.setCompressDict()
+
+	// 首部及 body 编码到同一个缓冲区
+	if a, ok := c.protocol.(protocol.Appender); ok {
+		return a.AppendPackage(nil, c.reqBody)
+	}
+
+	bodyBuf, err := c.protocol.MarshalBody(c.reqBody)
+	if err != nil {
+		return nil, err
+	}
+	c.protocol.SetBodyLen(uint32(len(bodyBuf)))
+	headBuf, err := c.protocol.MarshalHeader()
+	if err != nil {
+		return nil, err
+	}
+	pkgBuf := make([]byte, len(headBuf)+len(bodyBuf))
+	copy(pkgBuf[:len(headBuf)], headBuf)
+	copy(pkgBuf[len(headBuf):], bodyBuf)
+	return pkgBuf, nil
 }
 
 // Unmarshal 解包函数
 func (c *Client) Unmarshal(data []byte) error {
-	// if head, ok := c.Head.(*th.TmeHeader); ok {
-	// 	// tme协议解包
-	// 	err := head.Unmarshal(data)
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// 	c.ServiceErrCode = int(head.GetResultCode())
-	// 	if c.rspBody != nil && head.GetBodyLen() > 0 {
-	// 		return th.TMEBodyUnmarshal(head, data, c.rspBody)
-	// 	}
-	// 	return nil
-	// }
-	// if head, ok := c.Head.(*th.QzaHeader); ok {
-	// 	// qza协议解包
-	// 	err := head.Unmarshal(data)
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// 	c.ServiceErrCode = int(head.GetResultCode())
-	// 	if c.rspBody != nil && head.GetBodyStartIndex() < int16(len(data)) {
-	// 		return th.QZABodyUnmarshal(head, data, c.rspBody)
-	// 	}
-	// 	return nil
-	// }
-	// if head, ok := c.Head.(*th.PduHeader); ok {
-	// 	// pdu协议解包
-	// 	err := head.Unmarshal(data)
-	// 	if err != nil {
-	// 		return err
-	// 	}
-	// 	c.ServiceErrCode = int(head.GetResultCode())
-	// 	if c.rspBody != nil && len(data) > 25 {
-	// 		return th.PDUBodyUnmarshal(head, data, c.rspBody)
-	// 	}
-	// 	return nil
-	// }
-	return nil
+	rsp := c.protocol.CloneEmpty()
+	if err := rsp.UnmarshalHeader(data); err != nil {
+		return err
+	}
+	// 校验序列号，防止串包
+	if req, ok := c.protocol.(*erpc.Package); ok {
+		if r, ok := rsp.(*erpc.Package); ok && r.GetSequence() != req.GetSequence() {
+			return fmt.Errorf("Client.Unmarshal(), sequence mismatch, req:%d, rsp:%d", req.GetSequence(), r.GetSequence())
+		}
+	}
+	c.ServiceErrCode = int(rsp.GetResultCode())
+	c.ServiceErrMsg = rsp.GetResultMsg()
+	c.updatePeerDict(rsp)
+
+	return rsp.UnmarshalBody(data, c.rspBody)
+}
+
+// setCompressDict 使用预置字典压缩时，只在被调服务已有本端字典时使用，并声明本端的字典
+func (c *Client) setCompressDict() {
+	d, ok := c.protocol.(protocol.DictCompressible)
+	if !ok || c.compress.Type != compress.ZlibDict {
+		return
+	}
+	service := c.protocol.GetServiceName()
+	var peer []uint32
+	if v, ok := peerDicts.Load(service); ok {
+		peer = v.([]uint32)
+	}
+	d.SetCompressDict(compress.SelectDictionary(service, peer))
+	if own, ok := compress.ServiceDictionary(service); ok {
+		d.SetAcceptDict(own.ID)
+	}
+}
+
+// updatePeerDict 根据回包更新被调服务已有的字典
+// 被调服务不支持请求的压缩方式时忘记其字典，后续请求不使用字典压缩
+func (c *Client) updatePeerDict(rsp protocol.Protocol) {
+	d, ok := rsp.(protocol.DictCompressible)
+	if !ok || c.compress.Type != compress.ZlibDict {
+		return
+	}
+	service := c.protocol.GetServiceName()
+	ids := d.GetAcceptDict()
+	if rsp.GetResultCode() == protocol.StatusUnknownCompress || len(ids) == 0 {
+		peerDicts.Delete(service)
+		return
+	}
+	peerDicts.Store(service, append([]uint32(nil), ids...))
 }
 
 // GetLastCallee 获取被调服务信息
@@ -303,7 +366,7 @@ func (c *Client) GetLastCallee() string {
 
 // Check 包完整性校验
 func (c *Client) Check(data []byte) (int, error) {
-	return len(data), nil
+	return erpc.Check(data)
 }
 
 func isValidService(service string) (b bool) {
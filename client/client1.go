@@ -11,12 +11,13 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/erpc-go/erpc/utils/bufpool"
 )
 
 var (
 	uint64seq uint64 = 1
 	uint32Seq uint32 = 1
-	bufPool          = sync.Pool{New: func() interface{} { return make([]byte, maxRspDataLen) }}
 )
 
 // NewUint32Seq 生成全局唯一的uint32 seq
@@ -279,10 +280,10 @@ func doNetworkRequest(ctx context.Context, r Requestor, addr string, reqInfo *Re
 		return ErrOK
 	}
 
-	buf := bufPool.Get()
-	rspData, _ := buf.([]byte)
+	rspData := bufpool.Get(maxRspDataLen)
+	rspData = rspData[:cap(rspData)]
 	defer func() {
-		bufPool.Put(rspData) // tcp包过大扩充时会重新赋值，所以defer必须放在闭包里面
+		bufpool.Put(rspData) // tcp包过大扩充时会重新赋值，所以defer必须放在闭包里面
 	}()
 
 	recvNum := 0
@@ -304,9 +305,8 @@ func doNetworkRequest(ctx context.Context, r Requestor, addr string, reqInfo *Re
 				return ErrRspDataTooLarge
 			}
 			fmt.Println("recv rsp data too big, expand twice cap, recv num:", recvNum)
-			tmpRspData := make([]byte, recvNum*2)
-			copy(tmpRspData, rspData[:recvNum])
-			rspData = tmpRspData
+			rspData = bufpool.Grow(rspData[:recvNum], recvNum)
+			rspData = rspData[:cap(rspData)]
 		}
 
 		// check if done after read
@@ -385,9 +385,9 @@ func doUDPRequest(ctx context.Context, r Requestor, addr string, reqInfo *ReqInf
 		return ErrOK
 	}
 
-	buf := bufPool.Get()
-	rspData, _ := buf.([]byte)
-	defer bufPool.Put(rspData)
+	rspData := bufpool.Get(maxRspDataLen)
+	rspData = rspData[:cap(rspData)]
+	defer bufpool.Put(rspData)
 
 	tryTimes := retryTimesWhenUDPCheckFail + 1
 	recvNum := 0
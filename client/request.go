@@ -108,6 +108,9 @@ func (r *Request) Unmarshal(data []byte) error {
 
 // Finish set error code, address, cost time when request finish
 func (r *Request) Finish(ec int, addr string, cost time.Duration) {
+	r.ErrCode = ec
+	r.IPPort = addr
+	r.Cost = cost
 }
 
 // Success check if error code is ok
@@ -2,6 +2,7 @@ package client
 
 import (
 	"errors"
+	"net"
 	"sort"
 	"sync"
 	"time"
@@ -19,6 +20,10 @@ var (
 	lock      = sync.RWMutex{}
 )
 
+func init() {
+	Register("ip", &IPSelector{})
+}
+
 // Register 注册selector，如l5 dns cmlb tseer
 func Register(name string, s Selector) {
 	lock.Lock()
@@ -59,3 +64,17 @@ func (noop *NoopSelector) Select(serviceName string) (*Node, error) {
 func (noop *NoopSelector) Update(node *Node, cost time.Duration, err error) error {
 	return ErrNotImplement
 }
+
+// IPSelector ip直连寻址，如 ip://127.0.0.1:8888
+type IPSelector struct{}
+
+func (s *IPSelector) Select(serviceName string) (*Node, error) {
+	if _, _, err := net.SplitHostPort(serviceName); err != nil {
+		return nil, err
+	}
+	return &Node{Address: serviceName}, nil
+}
+
+func (s *IPSelector) Update(node *Node, cost time.Duration, err error) error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package codec
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/apache/thrift/lib/go/thrift"
+	jce2 "github.com/erpc-go/jce-codec"
+	"github.com/gogo/protobuf/proto"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// AutoCodec 按消息类型自动选择编码方式，选择结果按 reflect.Type 缓存
+// 依次匹配: proto.Message -> pb, jce.Messager -> jce, thrift.TStruct -> thrift,
+// msgp.Marshaler -> msgpack, []byte -> raw，其他类型使用 json
+// 实际编解码由注册表中对应 id 的 Codec 完成，RegisterCodec 替换实现后同样生效
+type AutoCodec struct {
+	types sync.Map // reflect.Type -> ID
+}
+
+// DefaultAutoCodec 默认的自动编码方式，client 未指定编码方式时使用
+var DefaultAutoCodec = NewAutoCodec()
+
+func NewAutoCodec() *AutoCodec {
+	return &AutoCodec{}
+}
+
+var bytesType = reflect.TypeOf([]byte(nil))
+
+// Select 返回 v 对应的编码方式 id，即报文中的编码方式标识
+func (a *AutoCodec) Select(v any) ID {
+	if v == nil {
+		return IDJson
+	}
+	t := reflect.TypeOf(v)
+	if id, ok := a.types.Load(t); ok {
+		return id.(ID)
+	}
+	id := selectID(v, t)
+	a.types.Store(t, id)
+	return id
+}
+
+func selectID(v any, t reflect.Type) ID {
+	switch v.(type) {
+	case proto.Message:
+		return IDPb
+	case jce2.Messager:
+		return IDJce
+	case thrift.TStruct:
+		return IDThrift
+	case msgp.Marshaler:
+		return IDMsgpack
+	}
+	if t == bytesType || t.Kind() == reflect.Ptr && t.Elem() == bytesType {
+		return IDNone
+	}
+	return IDJson
+}
+
+// codec 查找 v 对应的已注册编码方式
+func (a *AutoCodec) codec(v any) (Codec, error) {
+	id := a.Select(v)
+	r, ok := Get(id)
+	if !ok {
+		return nil, fmt.Errorf("auto codec: codec %d for %T not registered", id, v)
+	}
+	return r.Codec, nil
+}
+
+func (a *AutoCodec) Marshal(v any) ([]byte, error) {
+	c, err := a.codec(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.Marshal(v)
+}
+
+func (a *AutoCodec) MarshalAppend(dst []byte, v any) ([]byte, error) {
+	c, err := a.codec(v)
+	if err != nil {
+		return dst, err
+	}
+	return MarshalAppend(c, dst, v)
+}
+
+func (a *AutoCodec) MarshalTo(v any, w io.Writer) error {
+	c, err := a.codec(v)
+	if err != nil {
+		return err
+	}
+	return c.MarshalTo(v, w)
+}
+
+func (a *AutoCodec) Unmarshal(data []byte, v any) error {
+	c, err := a.codec(v)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(data, v)
+}
+
+func (a *AutoCodec) UnmarshalFrom(r io.Reader, v any) error {
+	c, err := a.codec(v)
+	if err != nil {
+		return err
+	}
+	return c.UnmarshalFrom(r, v)
+}
+
+func (a *AutoCodec) String() string {
+	return "auto"
+}
@@ -0,0 +1,87 @@
+package codec
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// jceMessage 实现 jce.Messager
+type jceMessage struct{}
+
+func (m *jceMessage) ReadFrom(r io.Reader) (int64, error) { return 0, nil }
+func (m *jceMessage) WriteTo(w io.Writer) (int64, error)  { return 0, nil }
+
+// thriftMessage 实现 thrift.TStruct
+type thriftMessage struct{}
+
+func (m *thriftMessage) Write(ctx context.Context, p thrift.TProtocol) error { return nil }
+func (m *thriftMessage) Read(ctx context.Context, p thrift.TProtocol) error  { return nil }
+
+// msgpMessage 实现 msgp.Marshaler
+type msgpMessage struct{}
+
+func (m *msgpMessage) MarshalMsg(b []byte) ([]byte, error) { return b, nil }
+
+// pbJceMessage 同时实现 proto.Message 及 jce.Messager，优先使用 pb
+type pbJceMessage struct {
+	pbPerson
+	jceMessage
+}
+
+func TestAutoCodecSelect(t *testing.T) {
+	raw := []byte("raw")
+	tests := []struct {
+		v    any
+		want ID
+	}{
+		{&pbPerson{}, IDPb},
+		{&jceMessage{}, IDJce},
+		{&thriftMessage{}, IDThrift},
+		{&msgpMessage{}, IDMsgpack},
+		{&pbJceMessage{}, IDPb},
+		{raw, IDNone},
+		{&raw, IDNone},
+		{NewPerson("lily", 18), IDJson},
+		{map[string]int{}, IDJson},
+		{nil, IDJson},
+	}
+	a := NewAutoCodec()
+	for _, tt := range tests {
+		// 第二次命中缓存
+		for i := 0; i < 2; i++ {
+			if got := a.Select(tt.v); got != tt.want {
+				t.Errorf("Select(%T) = %d, want %d", tt.v, got, tt.want)
+			}
+		}
+	}
+	if id, ok := a.types.Load(reflect.TypeOf(&pbPerson{})); !ok || id.(ID) != IDPb {
+		t.Errorf("select result not cached")
+	}
+}
+
+func TestAutoCodec(t *testing.T) {
+	a := NewAutoCodec()
+	for _, v := range []any{NewPerson("lily", 18), &pbPerson{Name: "lily", Age: 18}} {
+		data, err := a.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal %T failed: %v", v, err)
+		}
+		// 与直接使用选中的编码方式结果一致
+		r, _ := Get(a.Select(v))
+		want, _ := r.Codec.Marshal(v)
+		if string(data) != string(want) {
+			t.Fatalf("marshal %T by %s, got %q, want %q", v, r.Codec, data, want)
+		}
+		if data, err = a.MarshalAppend([]byte("head"), v); err != nil || string(data[4:]) != string(want) {
+			t.Fatalf("marshal append %T got %q, err:%v", v, data, err)
+		}
+		got := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+		if err := a.Unmarshal(data[4:], got); err != nil || !reflect.DeepEqual(got, v) {
+			t.Fatalf("unmarshal %T got %+v, err:%v", v, got, err)
+		}
+	}
+}
@@ -23,16 +23,28 @@ func (b *BinaryCoder) Marshal(v any) ([]byte, error) {
 	return buf.Bytes(), err
 }
 
+func (b *BinaryCoder) MarshalAppend(dst []byte, v any) ([]byte, error) {
+	return appendTo(dst, func(w io.Writer) error {
+		return binary.Write(w, b.order, v)
+	})
+}
+
 func (b *BinaryCoder) MarshalTo(v any, w io.Writer) error {
 	return binary.Write(w, b.order, v)
 }
 
 func (b *BinaryCoder) Unmarshal(data []byte, v any) error {
+	if err := checkTarget(v); err != nil {
+		return err
+	}
 	buf := bytes.NewBuffer(data)
 	return binary.Read(buf, b.order, v)
 }
 
 func (b *BinaryCoder) UnmarshalFrom(r io.Reader, v any) error {
+	if err := checkTarget(v); err != nil {
+		return err
+	}
 	return binary.Read(r, b.order, v)
 }
 
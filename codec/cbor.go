@@ -0,0 +1,250 @@
+package codec
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/erpc-go/erpc/utils/bufpool"
+	"github.com/fxamacker/cbor/v2"
+)
+
+// DefaultCBORMaxItemSize UnmarshalFrom 默认读取的单个数据项最大长度
+const DefaultCBORMaxItemSize = 16 << 20
+
+// cbor 编码(RFC 8949)，基于 fxamacker/cbor
+// 结构体 tag 使用 `cbor:"name,omitempty"`，`cbor:"1,keyasint"` 以整数作为 map 键，未设置时使用 json tag
+// time.Time 默认编码为带标签 0 的 RFC3339 字符串，解码同时支持标签 0、1 及不带标签的值
+// MarshalTo、UnmarshalFrom 为 CBOR 序列(RFC 8742)，即数据项直接拼接，每次只读取一个数据项
+type CBORCoder struct {
+	enc     cbor.EncMode
+	dec     cbor.DecMode
+	maxSize int
+}
+
+func NewCBORCoder() *CBORCoder {
+	c, err := NewCBORCoderOptions(defaultCBOREncOptions(cbor.EncOptions{}), defaultCBORDecOptions())
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewCBORCanonicalCoder 确定性编码(RFC 8949 4.2.1 Core Deterministic Encoding)
+// map 键按字节序排序、使用最短的整数及浮点数编码、不使用不定长编码，相同的值编码结果相同，可用于签名、去重
+func NewCBORCanonicalCoder() *CBORCoder {
+	c, err := NewCBORCoderOptions(defaultCBOREncOptions(cbor.CoreDetEncOptions()), defaultCBORDecOptions())
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// NewCBORCoderOptions 指定编解码选项，如时间的编码格式 EncOptions.Time、EncOptions.TimeTag
+func NewCBORCoderOptions(enc cbor.EncOptions, dec cbor.DecOptions) (*CBORCoder, error) {
+	em, err := enc.EncMode()
+	if err != nil {
+		return nil, err
+	}
+	dm, err := dec.DecMode()
+	if err != nil {
+		return nil, err
+	}
+	return &CBORCoder{enc: em, dec: dm, maxSize: DefaultCBORMaxItemSize}, nil
+}
+
+func defaultCBOREncOptions(o cbor.EncOptions) cbor.EncOptions {
+	o.Time = cbor.TimeRFC3339Nano
+	o.TimeTag = cbor.EncTagRequired
+	return o
+}
+
+func defaultCBORDecOptions() cbor.DecOptions {
+	return cbor.DecOptions{TimeTag: cbor.DecTagOptional}
+}
+
+// SetMaxItemSize 设置 UnmarshalFrom 读取的单个数据项最大长度
+func (c *CBORCoder) SetMaxItemSize(n int) {
+	c.maxSize = n
+}
+
+func (c *CBORCoder) Marshal(v any) ([]byte, error) {
+	return c.enc.Marshal(v)
+}
+
+func (c *CBORCoder) MarshalAppend(dst []byte, v any) ([]byte, error) {
+	b, err := c.enc.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, b...), nil
+}
+
+// MarshalTo 写入一个数据项
+func (c *CBORCoder) MarshalTo(v any, w io.Writer) error {
+	b, err := c.enc.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (c *CBORCoder) Unmarshal(data []byte, v any) error {
+	return c.dec.Unmarshal(data, v)
+}
+
+// UnmarshalFrom 按数据项的首部读取完整的一个数据项后解码，不多读 r 上后续的数据项
+func (c *CBORCoder) UnmarshalFrom(r io.Reader, v any) error {
+	s := cborScanner{r: r, buf: bufpool.Get(512), max: c.maxSize}
+	err := s.item(0)
+	if err == nil {
+		err = c.dec.Unmarshal(s.buf, v)
+	}
+	bufpool.Put(s.buf)
+	return err
+}
+
+func (c *CBORCoder) String() string {
+	return "cbor"
+}
+
+// cborMaxNested 数据项最大嵌套层数，同 cbor.DecOptions.MaxNestedLevels 默认值
+const cborMaxNested = 32
+
+// cborScanner 从 r 读取一个完整的数据项到 buf，只校验结构，不解析内容
+type cborScanner struct {
+	r   io.Reader
+	buf []byte
+	max int
+}
+
+// read 读取 n 字节追加到 buf，返回读取的数据
+func (s *cborScanner) read(n uint64) ([]byte, error) {
+	if n > uint64(s.max-len(s.buf)) {
+		return nil, fmt.Errorf("cbor: data item exceeds %d bytes", s.max)
+	}
+	s.buf = bufpool.Grow(s.buf, int(n))
+	start := len(s.buf)
+	s.buf = s.buf[:start+int(n)]
+	if _, err := io.ReadFull(s.r, s.buf[start:]); err != nil {
+		if err == io.EOF && start > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return s.buf[start:], nil
+}
+
+// head 读取数据项首部，返回主类型、附加信息及参数
+func (s *cborScanner) head() (major, info byte, arg uint64, err error) {
+	p, err := s.read(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, info = p[0]>>5, p[0]&0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		if p, err = s.read(1 << (info - 24)); err != nil {
+			return 0, 0, 0, s.unexpected(err)
+		}
+		for _, b := range p {
+			arg = arg<<8 | uint64(b)
+		}
+	case info == 31:
+		if major < 2 || major == 6 {
+			return 0, 0, 0, fmt.Errorf("cbor: invalid indefinite length for major type %d", major)
+		}
+	default:
+		return 0, 0, 0, fmt.Errorf("cbor: invalid additional information %d", info)
+	}
+	return major, info, arg, nil
+}
+
+// item 读取一个数据项，不定长的字符串、数组、map 读取到 break(0xff) 为止
+func (s *cborScanner) item(depth int) error {
+	major, info, arg, err := s.head()
+	if err != nil {
+		return err
+	}
+	if major == 7 && info == 31 {
+		return fmt.Errorf("cbor: unexpected break")
+	}
+	return s.body(major, info, arg, depth)
+}
+
+func (s *cborScanner) body(major, info byte, arg uint64, depth int) error {
+	if depth > cborMaxNested {
+		return fmt.Errorf("cbor: exceeded max nested level %d", cborMaxNested)
+	}
+	switch major {
+	case 2, 3:
+		if info != 31 {
+			_, err := s.read(arg)
+			return s.unexpected(err)
+		}
+		// 不定长字符串由同类型的定长分段组成
+		for {
+			m, i, n, err := s.head()
+			if err != nil {
+				return s.unexpected(err)
+			}
+			if m == 7 && i == 31 {
+				return nil
+			}
+			if m != major || i == 31 {
+				return fmt.Errorf("cbor: invalid chunk of indefinite length string")
+			}
+			if _, err := s.read(n); err != nil {
+				return s.unexpected(err)
+			}
+		}
+	case 4, 5:
+		if info == 31 {
+			return s.until(major, depth)
+		}
+		// 每个元素至少 1 字节，超过最大长度的直接报错
+		if arg > uint64(s.max) {
+			return fmt.Errorf("cbor: data item exceeds %d bytes", s.max)
+		}
+		if major == 5 {
+			arg *= 2
+		}
+		for i := uint64(0); i < arg; i++ {
+			if err := s.item(depth + 1); err != nil {
+				return s.unexpected(err)
+			}
+		}
+	case 6:
+		return s.unexpected(s.item(depth + 1))
+	}
+	return nil
+}
+
+// until 读取不定长数组、map 的元素直到 break
+func (s *cborScanner) until(major byte, depth int) error {
+	for n := 0; ; n++ {
+		m, i, arg, err := s.head()
+		if err != nil {
+			return s.unexpected(err)
+		}
+		if m == 7 && i == 31 {
+			if major == 5 && n%2 != 0 {
+				return fmt.Errorf("cbor: indefinite length map with odd number of items")
+			}
+			return nil
+		}
+		if err := s.body(m, i, arg, depth+1); err != nil {
+			return s.unexpected(err)
+		}
+	}
+}
+
+// unexpected 数据项读取到一半时遇到 EOF
+func (s *cborScanner) unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
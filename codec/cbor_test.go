@@ -0,0 +1,154 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type cborSensor struct {
+	ID      uint32            `cbor:"1,keyasint"`
+	Name    string            `cbor:"2,keyasint,omitempty"`
+	Values  []float64         `cbor:"3,keyasint"`
+	Labels  map[string]string `cbor:"4,keyasint,omitempty"`
+	Updated time.Time         `cbor:"5,keyasint"`
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCBORCoder(t *testing.T) {
+	c := NewCBORCoder()
+	want := &cborSensor{
+		ID:      7,
+		Values:  []float64{1.5, -2},
+		Labels:  map[string]string{"room": "a"},
+		Updated: time.Date(2023, 5, 6, 7, 8, 9, 10, time.UTC),
+	}
+	data, err := c.Marshal(want)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	got := &cborSensor{}
+	if err := c.Unmarshal(data, got); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("unmarshal got %+v, err:%v", got, err)
+	}
+
+	// 整数键、omitempty
+	var m map[int]any
+	if err := c.Unmarshal(data, &m); err != nil || len(m) != 4 || m[1] != uint64(7) {
+		t.Fatalf("decode as map got %v, err:%v", m, err)
+	}
+
+	// 未设置 tag 时以字段名作为键
+	p := NewPerson("lily", 18)
+	if data, err = c.Marshal(p); err != nil || !bytes.Equal(data, mustHex(t, "a263416765126"+"44e616d65646c696c79")) {
+		t.Fatalf("marshal person got %x, err:%v", data, err)
+	}
+}
+
+func TestCBORVectors(t *testing.T) {
+	// RFC 8949 附录 A
+	c := NewCBORCoder()
+	tests := []struct {
+		hex  string
+		v    any
+		want any
+	}{
+		{"1a000f4240", new(int), 1000000},
+		{"6449455446", new(string), "IETF"},
+		{"8301820203820405", new([]any), []any{uint64(1), []any{uint64(2), uint64(3)}, []any{uint64(4), uint64(5)}}},
+		{"9f018202039f0405ffff", new([]any), []any{uint64(1), []any{uint64(2), uint64(3)}, []any{uint64(4), uint64(5)}}},
+		{"5f42010243030405ff", new([]byte), []byte{1, 2, 3, 4, 5}},
+		{"c074323031332d30332d32315432303a30343a30305a", new(time.Time), time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)},
+		{"c11a514b67b0", new(time.Time), time.Unix(1363896240, 0)},
+	}
+	for _, tt := range tests {
+		err := c.Unmarshal(mustHex(t, tt.hex), tt.v)
+		got := reflect.ValueOf(tt.v).Elem().Interface()
+		if tm, ok := got.(time.Time); ok {
+			if err != nil || !tm.Equal(tt.want.(time.Time)) {
+				t.Errorf("%s: got %v, err:%v", tt.hex, got, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v, err:%v", tt.hex, got, tt.want, err)
+		}
+	}
+
+	// 时间编码为带标签 0 的 RFC3339 字符串
+	data, err := c.Marshal(time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC))
+	if err != nil || !bytes.Equal(data, mustHex(t, "c074323031332d30332d32315432303a30343a30305a")) {
+		t.Fatalf("marshal time got %x, err:%v", data, err)
+	}
+}
+
+func TestCBORCanonical(t *testing.T) {
+	c := NewCBORCanonicalCoder()
+	v := map[string]any{"b": []int{2, 3}, "a": 1, "aa": 1.5}
+	want := mustHex(t, "a3616101616282020362616"+"1f93e00")
+	for i := 0; i < 10; i++ {
+		data, err := c.Marshal(v)
+		if err != nil || !bytes.Equal(data, want) {
+			t.Fatalf("canonical got %x, want %x, err:%v", data, want, err)
+		}
+	}
+}
+
+func TestCBORStream(t *testing.T) {
+	c := NewCBORCoder()
+	var buf bytes.Buffer
+	c.MarshalTo(NewPerson("lily", 18), &buf)
+	// 不定长 map {"Name": "bob", "Age": [..]} 之后的数据项
+	buf.Write(mustHex(t, "bf644e616d656362"+"6f62634167651819ff"))
+	c.MarshalTo("tail", &buf)
+	data := buf.Bytes()
+
+	// 非 io.ByteReader 同样逐项读取
+	r := io.MultiReader(bytes.NewReader(data))
+	first, second := &Person{}, &Person{}
+	if err := c.UnmarshalFrom(r, first); err != nil || !equal(first, NewPerson("lily", 18)) {
+		t.Fatalf("read first item got %+v, err:%v", first, err)
+	}
+	if err := c.UnmarshalFrom(r, second); err != nil || !equal(second, NewPerson("bob", 25)) {
+		t.Fatalf("read indefinite item got %+v, err:%v", second, err)
+	}
+	var tail string
+	if err := c.UnmarshalFrom(r, &tail); err != nil || tail != "tail" {
+		t.Fatalf("read tail got %q, err:%v", tail, err)
+	}
+	if err := c.UnmarshalFrom(r, &tail); err != io.EOF {
+		t.Fatalf("read after last item got %v", err)
+	}
+
+	// 读取到一半的数据项
+	for i := 1; i < 16; i++ {
+		if err := c.UnmarshalFrom(bytes.NewReader(data[:i]), &Person{}); err != io.ErrUnexpectedEOF {
+			t.Fatalf("read truncated item %d got %v", i, err)
+		}
+	}
+
+	small := NewCBORCoder()
+	small.SetMaxItemSize(8)
+	if err := small.UnmarshalFrom(bytes.NewReader(data), &Person{}); err == nil {
+		t.Fatalf("read item larger than max size should fail")
+	}
+	// 伪造的长度不读取、不分配
+	if err := c.UnmarshalFrom(bytes.NewReader(mustHex(t, "9b7fffffffffffffff")), &[]int{}); err == nil {
+		t.Fatalf("read huge array should fail")
+	}
+	for _, bad := range []string{"ff", "1f", "bf01ff", "5f01ff"} {
+		if err := c.UnmarshalFrom(bytes.NewReader(mustHex(t, bad)), new(any)); err == nil || err == io.EOF {
+			t.Errorf("read malformed %s got %v", bad, err)
+		}
+	}
+}
@@ -2,7 +2,11 @@ package codec
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"reflect"
+	"sync"
 )
 
 // codec 接口
@@ -14,6 +18,65 @@ type Codec interface {
 	String() string
 }
 
+// Appender 可选接口，将 v 编码后追加到 dst 并返回追加后的切片
+// dst 容量足够时直接在 dst 上编码，避免 Marshal 分配新的缓冲区
+type Appender interface {
+	MarshalAppend(dst []byte, v any) ([]byte, error)
+}
+
+// MarshalAppend 使用 c 将 v 编码后追加到 dst，c 未实现 Appender 时退化为 Marshal 后复制
+func MarshalAppend(c Codec, dst []byte, v any) ([]byte, error) {
+	if a, ok := c.(Appender); ok {
+		return a.MarshalAppend(dst, v)
+	}
+	b, err := c.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, b...), nil
+}
+
+// appendWriter 将写入的数据追加到 b，供只支持 io.Writer 的编码器实现 MarshalAppend
+type appendWriter struct {
+	b []byte
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.b = append(w.b, p...)
+	return len(p), nil
+}
+
+var appendWriters = sync.Pool{New: func() any { return new(appendWriter) }}
+
+// appendTo 调用 marshal 将数据写入 dst 之后，出错时返回原 dst
+func appendTo(dst []byte, marshal func(w io.Writer) error) ([]byte, error) {
+	w := appendWriters.Get().(*appendWriter)
+	w.b = dst
+	err := marshal(w)
+	b := w.b
+	w.b = nil
+	appendWriters.Put(w)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
+
+// ErrUnsupportedType 值的类型不支持该编码方式，如 pb 编码非 proto.Message 的值
+var ErrUnsupportedType = errors.New("codec: unsupported type")
+
+// checkTarget 编解码的值不能为 nil 或 nil 指针
+func checkTarget(v any) error {
+	if v == nil {
+		return errors.New("codec: nil value")
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return fmt.Errorf("codec: nil %T", v)
+	}
+	return nil
+}
+
+// CodecType 编码方式名称
 type CodecType string
 
 const (
@@ -25,6 +88,11 @@ const (
 	CodeTypePb      CodecType = "code/pb"
 	CodeTypeThrift  CodecType = "code/thrift"
 	CodeTypeMsgpack CodecType = "code/msgpack"
+
+	CodeTypeThriftCompact CodecType = "code/thrift-compact"
+	CodeTypeThriftJSON    CodecType = "code/thrift-json"
+	CodeTypeVarbin        CodecType = "code/varbin"
+	CodeTypeCBOR          CodecType = "code/cbor"
 )
 
 func (t CodecType) String() string {
@@ -36,23 +104,3 @@ func (t CodecType) String() string {
 var (
 	defaultOrder = binary.LittleEndian
 )
-
-var Codecs = map[CodecType]Codec{
-	CodeTypeNone:    NewRawCoder(),
-	CodeTypeBinary:  NewBinaryCoder(),
-	CodeTypeGob:     NewGobCoder(),
-	CodeTypeJce:     NewJceCoder(),
-	CodeTypeJson:    NewJsonCoder(),
-	CodeTypePb:      NewPbCoder(),
-	CodeTypeThrift:  NewThriftCoder(),
-	CodeTypeMsgpack: NewMsgpackCoder(),
-}
-
-// 自定义注册编码方案
-func RegisterCodec(t CodecType, c Codec) {
-	Codecs[t] = c
-}
-
-func UnRegisterCodec(t CodecType, c Codec) {
-	delete(Codecs, t)
-}
@@ -1,8 +1,11 @@
 package codec
 
 import (
-	"fmt"
+	"io"
+	"reflect"
 	"testing"
+
+	jce2 "github.com/erpc-go/jce-codec"
 )
 
 type Person struct {
@@ -22,29 +25,164 @@ func equal(p1, p2 *Person) bool {
 }
 
 func TestCodec(t *testing.T) {
-	codecs := []Codec{
-		NewBinaryCoder(), NewGobCoder(), NewJceCoder(), NewJsonCoder(), NewMsgpackCoder(), NewPbCoder(), NewThriftCoder(), NewRawCoder(),
+	raw := []byte("raw body")
+	tests := []struct {
+		c         Codec
+		want, got any
+	}{
+		{NewBinaryCoder(), &fixedPerson{Age: 18, Code: 7}, &fixedPerson{}},
+		{NewGobCoder(), NewPerson("lily", 18), &Person{}},
+		{NewJceCoder(), &jcePerson{Name: "lily", Age: 18}, &jcePerson{}},
+		{NewJsonCoder(), NewPerson("lily", 18), &Person{}},
+		{NewMsgpackCoder(), NewPerson("lily", 18), &Person{}},
+		{NewPbCoder(), &pbPerson{Name: "lily", Age: 18}, &pbPerson{}},
+		{NewThriftCoder(), newThriftPerson(), &thriftPerson{}},
+		{NewRawCoder(), &raw, new([]byte)},
 	}
 
-	f := func(c Codec) {
-		want := NewPerson("lily", 18)
+	f := func(c Codec, want, got any) {
 		b, err := c.Marshal(want)
 		if err != nil {
-			panic(err)
+			t.Fatalf("%s: marshal failed: %v", c, err)
 		}
-		got := &Person{}
 
 		if err = c.Unmarshal(b, got); err != nil {
-			panic(err)
+			t.Fatalf("%s: unmarshal failed: %v", c, err)
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%s: got %v, but want %v", c, got, want)
 		}
+	}
+
+	for _, tt := range tests {
+		f(tt.c, tt.want, tt.got)
+	}
+
+}
+
+// fixedPerson binary 编码只支持定长类型
+type fixedPerson struct {
+	Age  int32
+	Code uint16
+}
+
+// jcePerson 手写的 jce 结构体，等价于 struct Person { 0 require string name; 1 optional int age; }
+type jcePerson struct {
+	Name string
+	Age  int32
+}
+
+func (m *jcePerson) WriteTo(w io.Writer) (int64, error) {
+	e := jce2.NewEncoder(w)
+	if err := e.WriteString(m.Name, 0); err != nil {
+		return 0, err
+	}
+	if err := e.WriteInt32(m.Age, 1); err != nil {
+		return 0, err
+	}
+	return 0, e.Flush()
+}
+
+func (m *jcePerson) ReadFrom(r io.Reader) (int64, error) {
+	d := jce2.NewDecoder(r)
+	if err := d.ReadString(&m.Name, 0, true); err != nil {
+		return 0, err
+	}
+	return 0, d.ReadInt32(&m.Age, 1, false)
+}
 
-		if !equal(want, got) {
-			panic(fmt.Errorf("got %v, but want %v", want, got))
+// pbPerson 测试用 pb 消息
+type pbPerson struct {
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Age  int32  `protobuf:"varint,2,opt,name=age,proto3" json:"age,omitempty"`
+}
+
+func (m *pbPerson) Reset()         { *m = pbPerson{} }
+func (m *pbPerson) String() string { return m.Name }
+func (*pbPerson) ProtoMessage()    {}
+
+// marshalOnly 隐藏 Appender，测试 MarshalAppend 的退化路径
+type marshalOnly struct {
+	Codec
+}
+
+func TestMarshalAppend(t *testing.T) {
+	type fixed struct {
+		Age  int32
+		Code uint16
+	}
+	raw := []byte("raw body")
+	tests := []struct {
+		c Codec
+		v any
+	}{
+		{NewJsonCoder(), NewPerson("lily", 18)},
+		{NewBinaryCoder(), &fixed{Age: 18, Code: 7}},
+		{NewRawCoder(), raw},
+		{NewRawCoder(), &raw},
+		{NewMsgpackCoder(), NewPerson("lily", 18)},
+		{NewPbCoder(), &pbPerson{Name: "lily", Age: 18}},
+		{NewGobCoder(), NewPerson("lily", 18)},
+		{NewVarbinCoder(), NewPerson("lily", 18)},
+		{NewCBORCanonicalCoder(), NewPerson("lily", 18)},
+		{marshalOnly{NewJsonCoder()}, NewPerson("lily", 18)}, // 未实现 Appender
+	}
+	prefix := []byte("head")
+	for _, tt := range tests {
+		want, err := tt.c.Marshal(tt.v)
+		if err != nil {
+			t.Fatalf("%s: marshal failed: %v", tt.c, err)
+		}
+		// 容量足够时原地编码，保留 dst 原有内容
+		dst := append(make([]byte, 0, 1024), prefix...)
+		got, err := MarshalAppend(tt.c, dst, tt.v)
+		if err != nil {
+			t.Fatalf("%s: marshal append failed: %v", tt.c, err)
 		}
+		if string(got[:len(prefix)]) != string(prefix) || string(got[len(prefix):]) != string(want) {
+			t.Errorf("%s: got %q, want %q", tt.c, got, append(prefix, want...))
+		}
+		if _, ok := tt.c.(Appender); ok && &got[0] != &dst[0] {
+			t.Errorf("%s: marshal append reallocated with enough capacity", tt.c)
+		}
+		// 容量不足时扩容
+		if got, err = MarshalAppend(tt.c, prefix[:len(prefix):len(prefix)], tt.v); err != nil ||
+			string(got[len(prefix):]) != string(want) {
+			t.Errorf("%s: marshal append to full slice, got %q, err:%v", tt.c, got, err)
+		}
+	}
+
+	if _, err := MarshalAppend(NewRawCoder(), prefix, 1); err == nil {
+		t.Errorf("raw coder should reject non []byte")
 	}
+}
 
-	for _, c := range codecs {
-		f(c)
+func TestRawUnmarshalCopy(t *testing.T) {
+	data := []byte("pooled")
+	var got []byte
+	if err := NewRawCoder().Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	data[0] = 'X'
+	if string(got) != "pooled" {
+		t.Fatalf("raw unmarshal should copy data, got %q", got)
 	}
+}
 
+func BenchmarkJsonMarshal(b *testing.B) {
+	c, v := NewJsonCoder(), NewPerson("lily", 18)
+	b.Run("Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			c.Marshal(v)
+		}
+	})
+	b.Run("MarshalAppend", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, 1024)
+		for i := 0; i < b.N; i++ {
+			c.MarshalAppend(buf, v)
+		}
+	})
 }
@@ -0,0 +1,392 @@
+// Package codectest 编码方式的一致性测试
+// 内置及用户注册的 codec.Codec 均可使用，检查编解码往返、MarshalAppend、MarshalTo/UnmarshalFrom、
+// 并发安全、非法及截断输入的处理，并提供 fuzz 的种子数据
+//
+//	func TestMyCodec(t *testing.T) {
+//		codectest.Run(t, codectest.Suite{
+//			Codec: NewMyCodec(),
+//			Cases: []codectest.Case{{Name: "user", Value: &User{Name: "lily"}, New: func() any { return &User{} }}},
+//		})
+//	}
+package codectest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/erpc-go/erpc/codec"
+)
+
+// Case 一个测试值
+type Case struct {
+	Name  string
+	Value any        // 编码的值
+	New   func() any // 返回解码的目标，需为指针
+	// Equal 比较编码的值与解码结果，参数均已解引用，为 nil 时使用 reflect.DeepEqual
+	Equal func(want, got any) bool
+}
+
+// Suite 一个编码方式的测试集
+type Suite struct {
+	Codec codec.Codec
+	Cases []Case
+	// Delimited MarshalTo 写入的值自带边界，同一个流上可连续 UnmarshalFrom，
+	// r 实现 io.ByteScanner 时不多读后续的数据
+	Delimited bool
+	// Lenient 截断在字段边界上的数据仍是合法的编码(如 pb、jce、raw)，截断时只要求不 panic
+	Lenient bool
+	// Goroutines 并发测试的协程数，默认为 8
+	Goroutines int
+}
+
+// Run 依次执行各项检查，每项为一个子测试
+func Run(t *testing.T, s Suite) {
+	t.Helper()
+	if s.Codec == nil || len(s.Cases) == 0 {
+		t.Fatal("codectest: suite needs a codec and at least one case")
+	}
+	checks := []struct {
+		name  string
+		check func(Suite, Case) error
+	}{
+		{"RoundTrip", checkRoundTrip},
+		{"MarshalAppend", checkAppend},
+		{"Stream", checkStream},
+		{"Delimited", checkDelimited},
+		{"Retain", checkRetain},
+		{"Truncated", checkTruncated},
+	}
+	for _, c := range checks {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			for _, tc := range s.Cases {
+				if err := c.check(s, tc); err != nil {
+					t.Errorf("%s: %s", tc.Name, err)
+				}
+			}
+		})
+	}
+	t.Run("Invalid", func(t *testing.T) {
+		if err := checkInvalid(s); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("Concurrent", func(t *testing.T) {
+		if err := checkConcurrent(s); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// Seeds 各测试值的编码结果，用作 fuzz 的种子
+func Seeds(s Suite) [][]byte {
+	var seeds [][]byte
+	for _, tc := range s.Cases {
+		if b, err := s.Codec.Marshal(tc.Value); err == nil {
+			seeds = append(seeds, b)
+		}
+	}
+	return seeds
+}
+
+// Fuzz 以 Seeds 为种子，检查任意输入解码到各测试值的类型时不 panic，解码成功的值可以重新编码
+func Fuzz(f *testing.F, s Suite) {
+	f.Helper()
+	for _, seed := range Seeds(s) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, tc := range s.Cases {
+			if err := checkDecode(s, tc, data); err != nil {
+				t.Errorf("%s: %s", tc.Name, err)
+			}
+		}
+	})
+}
+
+func checkDecode(s Suite, tc Case, data []byte) error {
+	v := tc.New()
+	err := call(func() error { return s.Codec.Unmarshal(data, v) })
+	if isPanic(err) {
+		return fmt.Errorf("Unmarshal(%x): %w", data, err)
+	}
+	if err == nil {
+		if err = call(func() error { _, err := s.Codec.Marshal(v); return err }); err != nil {
+			return fmt.Errorf("Marshal after Unmarshal(%x): %w", data, err)
+		}
+	}
+	err = call(func() error { return s.Codec.UnmarshalFrom(bytes.NewReader(data), tc.New()) })
+	if isPanic(err) {
+		return fmt.Errorf("UnmarshalFrom(%x): %w", data, err)
+	}
+	return nil
+}
+
+// checkRoundTrip Marshal、Unmarshal 往返后与原值相等，解码结果重新编码后同样可以往返
+func checkRoundTrip(s Suite, tc Case) error {
+	data, err := marshal(s.Codec, tc.Value)
+	if err != nil {
+		return err
+	}
+	if err := unmarshalEqual(s.Codec, tc, data); err != nil {
+		return err
+	}
+	got := tc.New()
+	if err := call(func() error { return s.Codec.Unmarshal(data, got) }); err != nil {
+		return err
+	}
+	data2, err := marshal(s.Codec, got)
+	if err != nil {
+		return fmt.Errorf("Marshal decoded value: %w", err)
+	}
+	if err := unmarshalEqual(s.Codec, tc, data2); err != nil {
+		return fmt.Errorf("second round trip: %w", err)
+	}
+	return nil
+}
+
+// checkAppend MarshalAppend 保留 dst 的内容，追加的数据可以解码
+func checkAppend(s Suite, tc Case) error {
+	prefix := []byte("codectest")
+	for _, dst := range [][]byte{nil, append([]byte(nil), prefix...), append(make([]byte, 0, 4096), prefix...)} {
+		n := len(dst)
+		var b []byte
+		err := call(func() (err error) {
+			b, err = codec.MarshalAppend(s.Codec, dst, tc.Value)
+			return
+		})
+		if err != nil {
+			return fmt.Errorf("MarshalAppend: %w", err)
+		}
+		if len(b) < n || !bytes.Equal(b[:n], prefix[:n]) {
+			return fmt.Errorf("MarshalAppend overwrote dst: %x", b)
+		}
+		if err := unmarshalEqual(s.Codec, tc, b[n:]); err != nil {
+			return fmt.Errorf("MarshalAppend: %w", err)
+		}
+	}
+	return nil
+}
+
+// checkStream MarshalTo 写入的数据可由 UnmarshalFrom 解码，且写入及读取的数据完整
+func checkStream(s Suite, tc Case) error {
+	var buf bytes.Buffer
+	if err := call(func() error { return s.Codec.MarshalTo(tc.Value, &buf) }); err != nil {
+		return fmt.Errorf("MarshalTo: %w", err)
+	}
+	if buf.Len() == 0 {
+		if data, _ := s.Codec.Marshal(tc.Value); len(data) > 0 {
+			return errors.New("MarshalTo wrote nothing")
+		}
+	}
+	got := tc.New()
+	// 隐藏 bytes.Buffer 的其他方法，按普通的 io.Reader 读取
+	r := struct{ io.Reader }{&buf}
+	if err := call(func() error { return s.Codec.UnmarshalFrom(r, got) }); err != nil {
+		return fmt.Errorf("UnmarshalFrom: %w", err)
+	}
+	return equal(tc, got)
+}
+
+// checkDelimited 同一个流上连续写入的值可以依次读出，读完后没有多余的数据
+func checkDelimited(s Suite, tc Case) error {
+	if !s.Delimited {
+		return nil
+	}
+	var buf bytes.Buffer
+	for i := 0; i < 3; i++ {
+		if err := call(func() error { return s.Codec.MarshalTo(tc.Value, &buf) }); err != nil {
+			return fmt.Errorf("MarshalTo: %w", err)
+		}
+	}
+	r := bytes.NewReader(buf.Bytes())
+	for i := 0; i < 3; i++ {
+		got := tc.New()
+		if err := call(func() error { return s.Codec.UnmarshalFrom(r, got) }); err != nil {
+			return fmt.Errorf("UnmarshalFrom value %d: %w", i, err)
+		}
+		if err := equal(tc, got); err != nil {
+			return fmt.Errorf("value %d: %w", i, err)
+		}
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d bytes left after reading all values", r.Len())
+	}
+	return nil
+}
+
+// checkRetain 解码结果不引用输入的数据，输入可能来自缓冲池，解码后会被复用
+func checkRetain(s Suite, tc Case) error {
+	data, err := marshal(s.Codec, tc.Value)
+	if err != nil {
+		return err
+	}
+	// Marshal 的结果可能引用编码的值(如 raw)，复制后再修改
+	data = append([]byte(nil), data...)
+	got := tc.New()
+	if err := call(func() error { return s.Codec.Unmarshal(data, got) }); err != nil {
+		return fmt.Errorf("Unmarshal: %w", err)
+	}
+	for i := range data {
+		data[i] = ^data[i]
+	}
+	if err := equal(tc, got); err != nil {
+		return fmt.Errorf("decoded value changed with input: %w", err)
+	}
+	return nil
+}
+
+// checkTruncated 截断的数据不 panic，非 Lenient 时返回错误，
+// 只截掉末尾的分隔符(如 json 的换行)等不影响结果的数据时可以成功
+func checkTruncated(s Suite, tc Case) error {
+	data, err := marshal(s.Codec, tc.Value)
+	if err != nil {
+		return err
+	}
+	for n := 0; n < len(data); n++ {
+		p := data[:n:n]
+		got := tc.New()
+		err := call(func() error { return s.Codec.Unmarshal(p, got) })
+		if isPanic(err) || err == nil && !s.Lenient && equal(tc, got) != nil {
+			return fmt.Errorf("Unmarshal truncated at %d/%d: got %v, want error", n, len(data), err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := call(func() error { return s.Codec.MarshalTo(tc.Value, &buf) }); err != nil {
+		return fmt.Errorf("MarshalTo: %w", err)
+	}
+	stream := buf.Bytes()
+	for n := 0; n < len(stream); n++ {
+		r := struct{ io.Reader }{bytes.NewReader(stream[:n])}
+		got := tc.New()
+		err := call(func() error { return s.Codec.UnmarshalFrom(r, got) })
+		if isPanic(err) || err == nil && !s.Lenient && equal(tc, got) != nil {
+			return fmt.Errorf("UnmarshalFrom truncated at %d/%d: got %v, want error", n, len(stream), err)
+		}
+	}
+	return nil
+}
+
+// checkInvalid 不支持的值、nil 及非指针的解码目标返回错误，不 panic
+func checkInvalid(s Suite) error {
+	c := s.Codec
+	data, err := marshal(c, s.Cases[0].Value)
+	if err != nil {
+		return err
+	}
+	for _, tt := range []struct {
+		name string
+		f    func() error
+	}{
+		{"Marshal(chan)", func() error { _, err := c.Marshal(make(chan int)); return err }},
+		{"MarshalTo(chan)", func() error { return c.MarshalTo(make(chan int), io.Discard) }},
+		{"Unmarshal(nil)", func() error { return c.Unmarshal(data, nil) }},
+		{"Unmarshal(non-pointer)", func() error {
+			return c.Unmarshal(data, reflect.Indirect(reflect.ValueOf(s.Cases[0].New())).Interface())
+		}},
+		{"UnmarshalFrom(nil)", func() error { return c.UnmarshalFrom(bytes.NewReader(data), nil) }},
+	} {
+		if err := call(tt.f); err == nil || isPanic(err) {
+			return fmt.Errorf("%s: got %v, want error", tt.name, err)
+		}
+	}
+	return nil
+}
+
+// checkConcurrent 多个协程同时使用同一个 Codec 编解码
+func checkConcurrent(s Suite) error {
+	n := s.Goroutines
+	if n <= 0 {
+		n = 8
+	}
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				for _, tc := range s.Cases {
+					err := checkRoundTrip(s, tc)
+					if err == nil {
+						err = checkAppend(s, tc)
+					}
+					if err == nil {
+						err = checkStream(s, tc)
+					}
+					if err != nil {
+						once.Do(func() { first = fmt.Errorf("%s: %w", tc.Name, err) })
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return first
+}
+
+func marshal(c codec.Codec, v any) (data []byte, err error) {
+	err = call(func() error {
+		data, err = c.Marshal(v)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Marshal: %w", err)
+	}
+	return data, nil
+}
+
+func unmarshalEqual(c codec.Codec, tc Case, data []byte) error {
+	got := tc.New()
+	if err := call(func() error { return c.Unmarshal(data, got) }); err != nil {
+		return fmt.Errorf("Unmarshal: %w", err)
+	}
+	return equal(tc, got)
+}
+
+func equal(tc Case, got any) error {
+	want := reflect.Indirect(reflect.ValueOf(tc.Value)).Interface()
+	g := reflect.Indirect(reflect.ValueOf(got)).Interface()
+	eq := reflect.DeepEqual
+	if tc.Equal != nil {
+		eq = tc.Equal
+	}
+	if !eq(want, g) {
+		return fmt.Errorf("got %+v, want %+v", g, want)
+	}
+	return nil
+}
+
+// panicError f 中发生的 panic
+type panicError struct {
+	v any
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.v)
+}
+
+func isPanic(err error) bool {
+	var p *panicError
+	return errors.As(err, &p)
+}
+
+// call 调用 f，将 panic 转为错误
+func call(f func() error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &panicError{v: v}
+		}
+	}()
+	return f()
+}
@@ -0,0 +1,90 @@
+package codectest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/erpc-go/erpc/codec"
+)
+
+// lossyCoder 修改前 RawCoder 的行为: MarshalTo 不写入 w，UnmarshalFrom 不读取数据，解码引用输入
+type lossyCoder struct{}
+
+func (lossyCoder) Marshal(v any) ([]byte, error) {
+	if p, ok := v.(*[]byte); ok {
+		return *p, nil
+	}
+	return nil, errors.New("not *[]byte")
+}
+
+func (c lossyCoder) MarshalTo(v any, w io.Writer) error {
+	_, err := c.Marshal(v)
+	return err
+}
+
+func (lossyCoder) Unmarshal(data []byte, v any) error {
+	*v.(*[]byte) = data
+	return nil
+}
+
+func (c lossyCoder) UnmarshalFrom(r io.Reader, v any) error {
+	return c.Unmarshal(nil, v)
+}
+
+func (lossyCoder) String() string {
+	return "lossy"
+}
+
+func bytesCase() Case {
+	return Case{Name: "bytes", Value: &[]byte{1, 2, 3}, New: func() any { return new([]byte) }}
+}
+
+func TestChecks(t *testing.T) {
+	s := Suite{Codec: lossyCoder{}, Lenient: true, Cases: []Case{bytesCase()}}
+	for _, tt := range []struct {
+		name  string
+		check func(Suite, Case) error
+		want  string
+	}{
+		{"RoundTrip", checkRoundTrip, ""},
+		{"MarshalAppend", checkAppend, ""},
+		{"Stream", checkStream, "MarshalTo wrote nothing"},
+		{"Retain", checkRetain, "changed with input"},
+		{"Truncated", checkTruncated, ""},
+	} {
+		err := tt.check(s, s.Cases[0])
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Fatalf("%s: got %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if err := checkInvalid(s); err == nil || !strings.Contains(err.Error(), "panic") {
+		t.Fatalf("Invalid: got %v", err)
+	}
+
+	// 截断的数据解码成功且结果不同
+	s.Lenient = false
+	if err := checkTruncated(s, s.Cases[0]); err == nil {
+		t.Fatal("Truncated: want error")
+	}
+}
+
+func TestRun(t *testing.T) {
+	Run(t, Suite{Codec: codec.NewRawCoder(), Lenient: true, Cases: []Case{bytesCase()}})
+}
+
+func TestSeeds(t *testing.T) {
+	seeds := Seeds(Suite{Codec: codec.NewJsonCoder(), Cases: []Case{
+		{Name: "string", Value: "a"},
+		{Name: "chan", Value: make(chan int)},
+	}})
+	if len(seeds) != 1 || !bytes.Equal(seeds[0], []byte(`"a"`)) {
+		t.Fatalf("got %q", seeds)
+	}
+}
+
+func FuzzRaw(f *testing.F) {
+	Fuzz(f, Suite{Codec: codec.NewRawCoder(), Cases: []Case{bytesCase()}})
+}
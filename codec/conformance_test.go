@@ -0,0 +1,138 @@
+package codec_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/erpc-go/erpc/codec"
+	"github.com/erpc-go/erpc/codec/codectest"
+)
+
+// sample 通用的测试结构体，用于不依赖 IDL 的编码方式
+type sample struct {
+	Name  string
+	Age   int
+	Score float64
+	Tags  []string
+	Attrs map[string]int
+	Data  []byte
+	Next  *sample
+}
+
+func sampleCases() []codectest.Case {
+	newSample := func() any { return &sample{} }
+	return []codectest.Case{
+		{Name: "full", Value: &sample{
+			Name: "lily", Age: -18, Score: 99.5, Tags: []string{"a", "中文"},
+			Attrs: map[string]int{"x": 1}, Data: []byte{0, 1, 2}, Next: &sample{Name: "next", Age: 1},
+		}, New: newSample},
+		{Name: "name", Value: &sample{Name: "lucy"}, New: newSample},
+	}
+}
+
+// fixed binary 编码只支持定长类型
+type fixed struct {
+	Age   int32
+	Code  uint16
+	Ok    bool
+	Ratio float64
+	Tag   [4]byte
+}
+
+func TestConformance(t *testing.T) {
+	thriftCases := []codectest.Case{{
+		Name:  "person",
+		Value: codec.NewThriftPerson(),
+		New:   func() any { return &codec.ThriftPerson{} },
+	}}
+	cborCases := append(sampleCases(), codectest.Case{
+		Name:  "time",
+		Value: &struct{ At time.Time }{time.Date(2023, 5, 6, 7, 8, 9, 10, time.UTC)},
+		New:   func() any { return &struct{ At time.Time }{} },
+		Equal: func(want, got any) bool {
+			return reflect.ValueOf(want).Field(0).Interface().(time.Time).Equal(reflect.ValueOf(got).Field(0).Interface().(time.Time))
+		},
+	})
+
+	suites := []codectest.Suite{
+		{Codec: codec.NewRawCoder(), Lenient: true, Cases: []codectest.Case{
+			{Name: "bytes", Value: []byte("raw body"), New: func() any { return new([]byte) }},
+			{Name: "pointer", Value: &[]byte{0, 1}, New: func() any { return new([]byte) }},
+		}},
+		{Codec: codec.NewBinaryCoder(), Delimited: true, Cases: []codectest.Case{
+			{Name: "fixed", Value: &fixed{Age: -18, Code: 7, Ok: true, Ratio: 0.5, Tag: [4]byte{1, 2, 3, 4}}, New: func() any { return &fixed{} }},
+		}},
+		{Codec: codec.NewGobCoder(), Delimited: true, Cases: sampleCases()},
+		{Codec: codec.NewJceCoder(), Lenient: true, Cases: []codectest.Case{
+			{Name: "person", Value: &codec.JcePerson{Name: "lily", Age: 18}, New: func() any { return &codec.JcePerson{} }},
+		}},
+		{Codec: codec.NewJsonCoder(), Cases: sampleCases()},
+		{Codec: codec.NewPbCoder(), Lenient: true, Cases: []codectest.Case{
+			{Name: "person", Value: &codec.PbPerson{Name: "lily", Age: 18}, New: func() any { return &codec.PbPerson{} }},
+		}},
+		{Codec: codec.NewThriftCoder(), Delimited: true, Cases: thriftCases},
+		{Codec: codec.NewThriftCompactCoder(), Delimited: true, Cases: thriftCases},
+		{Codec: codec.NewThriftJSONCoder(), Delimited: true, Cases: thriftCases},
+		{Codec: codec.NewMsgpackCoder(), Delimited: true, Cases: sampleCases()},
+		{Codec: codec.NewVarbinCoder(), Delimited: true, Cases: sampleCases()},
+		{Codec: codec.NewCBORCoder(), Delimited: true, Cases: cborCases},
+		{Codec: codec.NewCBORCanonicalCoder(), Delimited: true, Cases: cborCases},
+	}
+	for _, s := range suites {
+		s := s
+		t.Run(s.Codec.String(), func(t *testing.T) {
+			codectest.Run(t, s)
+		})
+	}
+}
+
+// TestUnsupportedType 不依赖 IDL 的编码方式可以直接编解码普通结构体，其余编码方式返回错误而不是 panic
+func TestUnsupportedType(t *testing.T) {
+	for _, c := range []codec.Codec{
+		codec.NewGobCoder(), codec.NewJsonCoder(), codec.NewMsgpackCoder(), codec.NewVarbinCoder(), codec.NewCBORCoder(), codec.NewCBORCanonicalCoder(),
+	} {
+		want := codec.NewPerson("lily", 18)
+		b, err := c.Marshal(want)
+		if err != nil {
+			t.Fatalf("%s: marshal failed: %v", c, err)
+		}
+		got := &codec.Person{}
+		if err = c.Unmarshal(b, got); err != nil || *got != *want {
+			t.Errorf("%s: got %v, want %v, err:%v", c, got, want, err)
+		}
+	}
+
+	// binary 只支持定长类型，jce、pb、thrift、raw 需要对应的类型
+	tests := []struct {
+		c        codec.Codec
+		sentinel bool
+	}{
+		{codec.NewBinaryCoder(), false},
+		{codec.NewJceCoder(), false},
+		{codec.NewPbCoder(), true},
+		{codec.NewThriftCoder(), true},
+		{codec.NewRawCoder(), true},
+	}
+	for _, tt := range tests {
+		_, err := tt.c.Marshal(codec.NewPerson("lily", 18))
+		if err == nil {
+			t.Fatalf("%s: marshal should fail", tt.c)
+		}
+		if tt.sentinel && !errors.Is(err, codec.ErrUnsupportedType) {
+			t.Errorf("%s: marshal error %v should wrap ErrUnsupportedType", tt.c, err)
+		}
+		if err := tt.c.Unmarshal([]byte{0}, &codec.Person{}); err == nil {
+			t.Errorf("%s: unmarshal should fail", tt.c)
+		}
+	}
+}
+
+func FuzzVarbin(f *testing.F) {
+	codectest.Fuzz(f, codectest.Suite{Codec: codec.NewVarbinCoder(), Cases: sampleCases()})
+}
+
+func FuzzCBOR(f *testing.F) {
+	codectest.Fuzz(f, codectest.Suite{Codec: codec.NewCBORCoder(), Cases: sampleCases()})
+}
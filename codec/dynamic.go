@@ -0,0 +1,456 @@
+package codec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Kind 动态值的类型
+type Kind uint8
+
+const (
+	KindNull   Kind = iota // 空值，msgpack nil
+	KindBool               // Bool
+	KindInt                // 有符号整数 Int
+	KindUint               // 无符号整数 Uint
+	KindFloat              // 浮点数 Float
+	KindString             // 字符串 Str
+	KindBytes              // 字节数组 Bytes
+	KindList               // 列表 List
+	KindMap                // 键值对 Map，保持编码中的顺序
+	KindStruct             // 按 tag 编号的字段 Fields，保持编码中的顺序，同一 tag 可出现多次
+	KindExt                // msgpack 扩展类型 ExtType，数据为 Bytes
+)
+
+var kindNames = [...]string{"null", "bool", "int", "uint", "float", "string", "bytes", "list", "map", "struct", "ext"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Value 通用的消息值，不依赖生成代码
+// Wire 为原始编码的类型，重编码时按原类型写入以保证与原数据一致，为 0 时按值选择最短的编码，
+// 取值与编码方式相关: jce 为类型+1，pb 为 wire type+1，msgpack 为非 fix 格式的首字节
+type Value struct {
+	Kind    Kind
+	Bool    bool
+	Int     int64
+	Uint    uint64
+	Float   float64
+	Str     string
+	Bytes   []byte
+	List    []Value
+	Map     []MapEntry
+	Fields  []Field
+	ExtType int8
+	Wire    uint8
+}
+
+// MapEntry map 的一个键值对
+type MapEntry struct {
+	Key   Value
+	Value Value
+}
+
+// Field 结构体字段，Name 来自 Descriptor，没有描述时为空
+type Field struct {
+	Tag   uint32
+	Name  string
+	Value Value
+}
+
+// Field 返回第一个 tag 为 tag 的字段值
+func (v *Value) Field(tag uint32) (*Value, bool) {
+	for i := range v.Fields {
+		if v.Fields[i].Tag == tag {
+			return &v.Fields[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// FieldByName 返回第一个名称为 name 的字段值，msgpack 的 map 按字符串键查找
+func (v *Value) FieldByName(name string) (*Value, bool) {
+	for i := range v.Fields {
+		if v.Fields[i].Name == name {
+			return &v.Fields[i].Value, true
+		}
+	}
+	for i := range v.Map {
+		if k := v.Map[i].Key; k.Kind == KindString && k.Str == name {
+			return &v.Map[i].Value, true
+		}
+	}
+	return nil, false
+}
+
+// FieldType 字段类型，jce、pb 的编码中不包含完整的类型信息，由 Descriptor 补充
+type FieldType uint8
+
+const (
+	TypeUnknown  FieldType = iota // 按编码推断
+	TypeBool                      // bool
+	TypeInt8                      // jce byte
+	TypeInt16                     // jce short
+	TypeInt32                     // int32、jce int
+	TypeInt64                     // int64、jce long
+	TypeUint32                    // uint32
+	TypeUint64                    // uint64
+	TypeSint32                    // pb sint32，zigzag 编码
+	TypeSint64                    // pb sint64，zigzag 编码
+	TypeFixed32                   // pb fixed32
+	TypeFixed64                   // pb fixed64
+	TypeSfixed32                  // pb sfixed32
+	TypeSfixed64                  // pb sfixed64
+	TypeFloat                     // float
+	TypeDouble                    // double
+	TypeString                    // string
+	TypeBytes                     // bytes
+	TypeEnum                      // 枚举，同 int32
+	TypeMessage                   // 嵌套消息，由 Message 描述
+)
+
+// signed 是否为有符号整数，返回位数
+func (t FieldType) signed() (bits uint, ok bool) {
+	switch t {
+	case TypeInt8:
+		return 8, true
+	case TypeInt16:
+		return 16, true
+	case TypeInt32, TypeSint32, TypeSfixed32, TypeEnum:
+		return 32, true
+	case TypeInt64, TypeSint64, TypeSfixed64:
+		return 64, true
+	}
+	return 0, false
+}
+
+// Descriptor 消息描述，为字段提供名称及类型
+type Descriptor struct {
+	Name   string
+	Fields []*FieldDescriptor
+}
+
+// FieldDescriptor 字段描述
+// Type、Message 描述字段的值，字段为 list 时描述元素，为 map 时描述 value，Key 描述 map 的 key
+// pb 的 map 与 repeated 消息编码相同，设置 Key 后按 map 解码
+type FieldDescriptor struct {
+	Tag      uint32
+	Name     string
+	Type     FieldType
+	Key      FieldType
+	Message  *Descriptor
+	Repeated bool // pb repeated 字段，渲染 JSON 时只出现一次也输出为数组
+}
+
+// Field 按 tag 查找字段描述，d 为 nil 时返回 nil
+func (d *Descriptor) Field(tag uint32) *FieldDescriptor {
+	if d == nil {
+		return nil
+	}
+	for _, f := range d.Fields {
+		if f.Tag == tag {
+			return f
+		}
+	}
+	return nil
+}
+
+func (f *FieldDescriptor) name() string {
+	if f == nil {
+		return ""
+	}
+	return f.Name
+}
+
+func (f *FieldDescriptor) typ() FieldType {
+	if f == nil {
+		return TypeUnknown
+	}
+	return f.Type
+}
+
+func (f *FieldDescriptor) key() FieldType {
+	if f == nil {
+		return TypeUnknown
+	}
+	return f.Key
+}
+
+func (f *FieldDescriptor) message() *Descriptor {
+	if f == nil {
+		return nil
+	}
+	return f.Message
+}
+
+// Dynamic 动态消息，无需生成代码即可解码 jce、pb、msgpack，重编码并渲染为 JSON，用于网关、抓包、命令行工具
+// Value 为消息的通用树，jce、pb 为 KindStruct，msgpack 为任意类型
+// Desc 可选，提供字段名及类型；没有描述时 jce、pb 的字段只有 tag，整数按无符号数解码，
+// pb 的 length-delimited 字段为合法 UTF-8 文本时解码为字符串，否则为字节数组
+// JceCoder、PbCoder、MsgpackCoder 可直接编解码 *Dynamic，编码时使用 Codec 对应的格式，解码时设置 Format
+type Dynamic struct {
+	Format ID
+	Desc   *Descriptor
+	Value  Value
+}
+
+// NewDynamic format 为 IDJce、IDPb、IDMsgpack，desc 可为 nil
+func NewDynamic(format ID, desc *Descriptor) *Dynamic {
+	return &Dynamic{Format: format, Desc: desc}
+}
+
+// Unmarshal 按 Format 解码，覆盖原有的 Value
+func (d *Dynamic) Unmarshal(data []byte) (err error) {
+	switch d.Format {
+	case IDJce:
+		d.Value, err = decodeJceDynamic(data, d.Desc)
+	case IDPb:
+		d.Value, err = decodePbDynamic(data, d.Desc)
+	case IDMsgpack:
+		d.Value, err = decodeMsgpackDynamic(data)
+	default:
+		err = fmt.Errorf("dynamic: unsupported format %d", d.Format)
+	}
+	return
+}
+
+func (d *Dynamic) Marshal() ([]byte, error) {
+	return d.MarshalAppend(nil)
+}
+
+// MarshalAppend 按 Format 编码后追加到 dst，解码得到的 Value 重编码结果与原数据一致
+func (d *Dynamic) MarshalAppend(dst []byte) ([]byte, error) {
+	return d.appendAs(dst, d.Format)
+}
+
+func (d *Dynamic) appendAs(dst []byte, format ID) ([]byte, error) {
+	switch format {
+	case IDJce:
+		return appendJceDynamic(dst, &d.Value, d.Desc)
+	case IDPb:
+		return appendPbDynamic(dst, &d.Value, d.Desc)
+	case IDMsgpack:
+		return appendMsgpackDynamic(dst, &d.Value)
+	}
+	return dst, fmt.Errorf("dynamic: unsupported format %d", format)
+}
+
+// marshalDynamic v 为 *Dynamic 时按 format 编码，供对应的 Codec 使用
+func marshalDynamic(dst []byte, v any, format ID) ([]byte, bool, error) {
+	d, ok := v.(*Dynamic)
+	if !ok {
+		return dst, false, nil
+	}
+	b, err := d.appendAs(dst, format)
+	return b, true, err
+}
+
+// marshalDynamicTo v 为 *Dynamic 时按 format 编码后写入 w
+func marshalDynamicTo(v any, w io.Writer, format ID) (bool, error) {
+	b, ok, err := marshalDynamic(nil, v, format)
+	if !ok || err != nil {
+		return ok, err
+	}
+	_, err = w.Write(b)
+	return true, err
+}
+
+// unmarshalDynamic v 为 *Dynamic 时按 format 解码并设置 Format
+func unmarshalDynamic(data []byte, v any, format ID) (bool, error) {
+	d, ok := v.(*Dynamic)
+	if !ok {
+		return false, nil
+	}
+	d.Format = format
+	return true, d.Unmarshal(data)
+}
+
+// unmarshalDynamicFrom 读取 r 的全部数据后解码
+func unmarshalDynamicFrom(r io.Reader, v any, format ID) (bool, error) {
+	if _, ok := v.(*Dynamic); !ok {
+		return false, nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return true, err
+	}
+	return unmarshalDynamic(data, v, format)
+}
+
+// MarshalJSON 渲染为 JSON，字段以名称为键，没有名称时以 tag 为键，同一 tag 出现多次时合并为数组
+func (d *Dynamic) MarshalJSON() ([]byte, error) {
+	return appendDynamicJSON(nil, &d.Value, d.Desc)
+}
+
+// MarshalJSON 渲染为 JSON，同 Dynamic.MarshalJSON
+func (v *Value) MarshalJSON() ([]byte, error) {
+	return appendDynamicJSON(nil, v, nil)
+}
+
+// appendDynamicJSON desc 只用于 KindStruct 的 repeated 字段
+func appendDynamicJSON(b []byte, v *Value, desc *Descriptor) ([]byte, error) {
+	var err error
+	switch v.Kind {
+	case KindNull:
+		return append(b, "null"...), nil
+	case KindBool:
+		return strconv.AppendBool(b, v.Bool), nil
+	case KindInt:
+		return strconv.AppendInt(b, v.Int, 10), nil
+	case KindUint:
+		return strconv.AppendUint(b, v.Uint, 10), nil
+	case KindFloat:
+		if math.IsNaN(v.Float) || math.IsInf(v.Float, 0) {
+			return appendJSONString(b, strconv.FormatFloat(v.Float, 'g', -1, 64)), nil
+		}
+		return strconv.AppendFloat(b, v.Float, 'g', -1, 64), nil
+	case KindString:
+		return appendJSONString(b, v.Str), nil
+	case KindBytes:
+		return appendJSONString(b, base64.StdEncoding.EncodeToString(v.Bytes)), nil
+	case KindExt:
+		if t, ok := msgpackTimestamp(v); ok {
+			return appendJSONString(b, t.Format(time.RFC3339Nano)), nil
+		}
+		b = append(b, `{"type":`...)
+		b = strconv.AppendInt(b, int64(v.ExtType), 10)
+		b = append(b, `,"data":`...)
+		b = appendJSONString(b, base64.StdEncoding.EncodeToString(v.Bytes))
+		return append(b, '}'), nil
+	case KindList:
+		b = append(b, '[')
+		for i := range v.List {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if b, err = appendDynamicJSON(b, &v.List[i], desc); err != nil {
+				return b, err
+			}
+		}
+		return append(b, ']'), nil
+	case KindMap:
+		return appendMapJSON(b, v, desc)
+	case KindStruct:
+		return appendStructJSON(b, v, desc)
+	}
+	return b, fmt.Errorf("dynamic: invalid kind %s", v.Kind)
+}
+
+// appendMapJSON 键为标量时输出为对象，否则输出为 [{"key":..,"value":..}] 数组
+func appendMapJSON(b []byte, v *Value, desc *Descriptor) (_ []byte, err error) {
+	scalar := true
+	for i := range v.Map {
+		if k := v.Map[i].Key.Kind; k == KindList || k == KindMap || k == KindStruct || k == KindExt || k == KindBytes {
+			scalar = false
+			break
+		}
+	}
+	open, close := byte('{'), byte('}')
+	if !scalar {
+		open, close = '[', ']'
+	}
+	b = append(b, open)
+	for i := range v.Map {
+		e := &v.Map[i]
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if scalar {
+			if e.Key.Kind == KindString {
+				b = appendJSONString(b, e.Key.Str)
+			} else {
+				k, _ := appendDynamicJSON(nil, &e.Key, nil)
+				b = appendJSONString(b, string(k))
+			}
+			b = append(b, ':')
+			if b, err = appendDynamicJSON(b, &e.Value, desc); err != nil {
+				return b, err
+			}
+			continue
+		}
+		b = append(b, `{"key":`...)
+		if b, err = appendDynamicJSON(b, &e.Key, desc); err != nil {
+			return b, err
+		}
+		b = append(b, `,"value":`...)
+		if b, err = appendDynamicJSON(b, &e.Value, desc); err != nil {
+			return b, err
+		}
+		b = append(b, '}')
+	}
+	return append(b, close), nil
+}
+
+// appendStructJSON 按字段首次出现的顺序输出，同一 tag 的多个值合并为数组
+func appendStructJSON(b []byte, v *Value, desc *Descriptor) (_ []byte, err error) {
+	b = append(b, '{')
+	first := true
+	for i := range v.Fields {
+		f := &v.Fields[i]
+		seen := false
+		for j := 0; j < i; j++ {
+			if v.Fields[j].Tag == f.Tag {
+				seen = true
+				break
+			}
+		}
+		if seen {
+			continue
+		}
+		if !first {
+			b = append(b, ',')
+		}
+		first = false
+		fd := desc.Field(f.Tag)
+		if f.Name != "" {
+			b = appendJSONString(b, f.Name)
+		} else {
+			b = append(b, '"')
+			b = strconv.AppendUint(b, uint64(f.Tag), 10)
+			b = append(b, '"')
+		}
+		b = append(b, ':')
+
+		n := 0
+		for j := i; j < len(v.Fields); j++ {
+			if v.Fields[j].Tag == f.Tag {
+				n++
+			}
+		}
+		repeated := n > 1 || fd != nil && fd.Repeated && f.Value.Kind != KindList
+		if !repeated {
+			if b, err = appendDynamicJSON(b, &f.Value, fd.message()); err != nil {
+				return b, err
+			}
+			continue
+		}
+		b = append(b, '[')
+		for j, k := i, 0; j < len(v.Fields); j++ {
+			if v.Fields[j].Tag != f.Tag {
+				continue
+			}
+			if k > 0 {
+				b = append(b, ',')
+			}
+			k++
+			if b, err = appendDynamicJSON(b, &v.Fields[j].Value, fd.message()); err != nil {
+				return b, err
+			}
+		}
+		b = append(b, ']')
+	}
+	return append(b, '}'), nil
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	data, _ := json.Marshal(s)
+	return append(b, data...)
+}
@@ -0,0 +1,393 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// jce 编码类型，同 jce.JceEncodeType
+const (
+	jceInt1 byte = iota
+	jceInt2
+	jceInt4
+	jceInt8
+	jceFloat4
+	jceFloat8
+	jceZero
+	jceString
+	jceMap
+	jceSimpleList
+	jceList
+	jceStructBegin
+	jceStructEnd
+)
+
+// dynamicMaxDepth 动态解码的最大嵌套层数
+const dynamicMaxDepth = 64
+
+// jceReader 按 jce 的 head(type|tag) 格式读取
+type jceReader struct {
+	b []byte
+}
+
+func (r *jceReader) next(n int) ([]byte, error) {
+	if n < 0 || n > len(r.b) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p, nil
+}
+
+func (r *jceReader) head() (typ byte, tag uint32, err error) {
+	p, err := r.next(1)
+	if err != nil {
+		return 0, 0, err
+	}
+	typ, tag = p[0]>>4, uint32(p[0]&0x0f)
+	if tag == 15 {
+		if p, err = r.next(1); err != nil {
+			return 0, 0, err
+		}
+		tag = uint32(p[0])
+	}
+	return typ, tag, nil
+}
+
+// length 最高位为 0 时为 1 字节，否则为 4 字节并去掉最高位
+func (r *jceReader) length() (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if r.b[0] <= 127 {
+		n := int(r.b[0])
+		r.b = r.b[1:]
+		return n, nil
+	}
+	p, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return int(binary.BigEndian.Uint32(p) & 0x7fffffff), nil
+}
+
+func decodeJceDynamic(data []byte, desc *Descriptor) (Value, error) {
+	r := &jceReader{b: data}
+	fields, err := r.fields(desc, false, 0)
+	return Value{Kind: KindStruct, Fields: fields}, err
+}
+
+// fields 读取结构体字段，nested 为 true 时读取到 StructEnd，否则读取到数据结束
+func (r *jceReader) fields(desc *Descriptor, nested bool, depth int) ([]Field, error) {
+	if depth > dynamicMaxDepth {
+		return nil, fmt.Errorf("dynamic: exceeded max depth %d", dynamicMaxDepth)
+	}
+	var fields []Field
+	for nested || len(r.b) > 0 {
+		typ, tag, err := r.head()
+		if err != nil {
+			return fields, err
+		}
+		if typ == jceStructEnd {
+			if !nested {
+				return fields, fmt.Errorf("dynamic: unexpected jce struct end")
+			}
+			return fields, nil
+		}
+		fd := desc.Field(tag)
+		v, err := r.value(typ, fd.typ(), fd.message(), fd, depth)
+		if err != nil {
+			return fields, fmt.Errorf("dynamic: jce tag %d: %w", tag, err)
+		}
+		fields = append(fields, Field{Tag: tag, Name: fd.name(), Value: v})
+	}
+	return fields, nil
+}
+
+// value 读取 head 之后的数据，t、msg 描述该值，fd 用于 list 元素、map 的 key
+func (r *jceReader) value(typ byte, t FieldType, msg *Descriptor, fd *FieldDescriptor, depth int) (Value, error) {
+	v := Value{Wire: typ + 1}
+	switch typ {
+	case jceZero:
+		jceNumber(&v, 0, t)
+	case jceInt1, jceInt2, jceInt4, jceInt8:
+		size := 1 << typ
+		p, err := r.next(size)
+		if err != nil {
+			return v, err
+		}
+		var x uint64
+		for _, c := range p {
+			x = x<<8 | uint64(c)
+		}
+		jceNumber(&v, x, t)
+	case jceFloat4:
+		p, err := r.next(4)
+		if err != nil {
+			return v, err
+		}
+		v.Kind, v.Float = KindFloat, float64(math.Float32frombits(binary.BigEndian.Uint32(p)))
+	case jceFloat8:
+		p, err := r.next(8)
+		if err != nil {
+			return v, err
+		}
+		v.Kind, v.Float = KindFloat, math.Float64frombits(binary.BigEndian.Uint64(p))
+	case jceString:
+		n, err := r.length()
+		if err != nil {
+			return v, err
+		}
+		p, err := r.next(n)
+		if err != nil {
+			return v, err
+		}
+		if t == TypeBytes {
+			v.Kind, v.Bytes = KindBytes, append([]byte(nil), p...)
+		} else {
+			v.Kind, v.Str = KindString, string(p)
+		}
+	case jceSimpleList:
+		p, err := r.next(5)
+		if err != nil {
+			return v, err
+		}
+		if p[4] != jceInt1 {
+			return v, fmt.Errorf("simple list item type %d", p[4])
+		}
+		if p, err = r.next(int(binary.BigEndian.Uint32(p))); err != nil {
+			return v, err
+		}
+		v.Kind, v.Bytes = KindBytes, append([]byte(nil), p...)
+	case jceList:
+		n, err := r.length()
+		if err != nil {
+			return v, err
+		}
+		if n > len(r.b) {
+			return v, io.ErrUnexpectedEOF
+		}
+		v.Kind, v.List = KindList, make([]Value, 0, n)
+		for i := 0; i < n; i++ {
+			typ, _, err := r.head()
+			if err != nil {
+				return v, err
+			}
+			e, err := r.value(typ, t, msg, nil, depth+1)
+			if err != nil {
+				return v, err
+			}
+			v.List = append(v.List, e)
+		}
+	case jceMap:
+		n, err := r.length()
+		if err != nil {
+			return v, err
+		}
+		if n > len(r.b) {
+			return v, io.ErrUnexpectedEOF
+		}
+		kt := fd.key()
+		v.Kind, v.Map = KindMap, make([]MapEntry, 0, n)
+		for i := 0; i < n; i++ {
+			var e MapEntry
+			typ, _, err := r.head()
+			if err != nil {
+				return v, err
+			}
+			if e.Key, err = r.value(typ, kt, nil, nil, depth+1); err != nil {
+				return v, err
+			}
+			if typ, _, err = r.head(); err != nil {
+				return v, err
+			}
+			if e.Value, err = r.value(typ, t, msg, nil, depth+1); err != nil {
+				return v, err
+			}
+			v.Map = append(v.Map, e)
+		}
+	case jceStructBegin:
+		fields, err := r.fields(msg, true, depth+1)
+		if err != nil {
+			return v, err
+		}
+		v.Kind, v.Fields = KindStruct, fields
+	default:
+		return v, fmt.Errorf("invalid jce type %d", typ)
+	}
+	return v, nil
+}
+
+// jceNumber jce 的整数转为对应宽度的无符号数后写入最短的类型，按描述的类型还原
+func jceNumber(v *Value, x uint64, t FieldType) {
+	switch t {
+	case TypeBool:
+		v.Kind, v.Bool = KindBool, x != 0
+	case TypeFloat, TypeDouble:
+		v.Kind = KindFloat
+	default:
+		if n, ok := t.signed(); ok {
+			v.Kind, v.Int = KindInt, int64(x<<(64-n))>>(64-n)
+			return
+		}
+		v.Kind, v.Uint = KindUint, x
+	}
+}
+
+func appendJceDynamic(dst []byte, v *Value, desc *Descriptor) ([]byte, error) {
+	if v.Kind != KindStruct {
+		return dst, fmt.Errorf("dynamic: jce message must be a struct, got %s", v.Kind)
+	}
+	return appendJceFields(dst, v.Fields, desc)
+}
+
+func appendJceFields(b []byte, fields []Field, desc *Descriptor) (_ []byte, err error) {
+	for i := range fields {
+		f := &fields[i]
+		if f.Tag > math.MaxUint8 {
+			return b, fmt.Errorf("dynamic: jce tag %d out of range", f.Tag)
+		}
+		fd := desc.Field(f.Tag)
+		if b, err = appendJceValue(b, byte(f.Tag), &f.Value, fd.typ(), fd.message()); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+func appendJceHead(b []byte, typ, tag byte) []byte {
+	if tag < 15 {
+		return append(b, typ<<4|tag)
+	}
+	return append(b, typ<<4|15, tag)
+}
+
+func appendJceLength(b []byte, n int) []byte {
+	if n <= 127 {
+		return append(b, byte(n))
+	}
+	return binary.BigEndian.AppendUint32(b, uint32(n)|0x80000000)
+}
+
+// appendJceValue Wire 为 0 时与 jce 编码器一致，按值写入最短的类型
+func appendJceValue(b []byte, tag byte, v *Value, t FieldType, msg *Descriptor) (_ []byte, err error) {
+	switch v.Kind {
+	case KindBool:
+		x := uint64(0)
+		if v.Bool {
+			x = 1
+		}
+		return appendJceInt(b, tag, x, v.Wire), nil
+	case KindInt:
+		x := uint64(v.Int)
+		// 与 jce 编码器一致，有符号数先转为对应宽度的无符号数
+		if n, ok := t.signed(); ok && n < 64 {
+			x &= 1<<n - 1
+		}
+		return appendJceInt(b, tag, x, v.Wire), nil
+	case KindUint:
+		return appendJceInt(b, tag, v.Uint, v.Wire), nil
+	case KindFloat:
+		wire := v.Wire
+		if wire == 0 || wire == jceZero+1 && v.Float != 0 {
+			wire = jceFloat8 + 1
+			if t == TypeFloat {
+				wire = jceFloat4 + 1
+			}
+			if v.Float == 0 {
+				wire = jceZero + 1
+			}
+		}
+		switch wire - 1 {
+		case jceZero:
+			return appendJceHead(b, jceZero, tag), nil
+		case jceFloat4:
+			return binary.BigEndian.AppendUint32(appendJceHead(b, jceFloat4, tag), math.Float32bits(float32(v.Float))), nil
+		}
+		return binary.BigEndian.AppendUint64(appendJceHead(b, jceFloat8, tag), math.Float64bits(v.Float)), nil
+	case KindString:
+		b = appendJceLength(appendJceHead(b, jceString, tag), len(v.Str))
+		return append(b, v.Str...), nil
+	case KindBytes:
+		if v.Wire == jceString+1 {
+			b = appendJceLength(appendJceHead(b, jceString, tag), len(v.Bytes))
+			return append(b, v.Bytes...), nil
+		}
+		b = binary.BigEndian.AppendUint32(appendJceHead(b, jceSimpleList, tag), uint32(len(v.Bytes)))
+		return append(append(b, jceInt1), v.Bytes...), nil
+	case KindList:
+		b = appendJceLength(appendJceHead(b, jceList, tag), len(v.List))
+		for i := range v.List {
+			if b, err = appendJceValue(b, 0, &v.List[i], t, msg); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	case KindMap:
+		b = appendJceLength(appendJceHead(b, jceMap, tag), len(v.Map))
+		for i := range v.Map {
+			if b, err = appendJceValue(b, 0, &v.Map[i].Key, TypeUnknown, nil); err != nil {
+				return b, err
+			}
+			if b, err = appendJceValue(b, 1, &v.Map[i].Value, t, msg); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	case KindStruct:
+		if b, err = appendJceFields(appendJceHead(b, jceStructBegin, tag), v.Fields, msg); err != nil {
+			return b, err
+		}
+		return appendJceHead(b, jceStructEnd, 0), nil
+	}
+	return b, fmt.Errorf("dynamic: jce does not support %s", v.Kind)
+}
+
+// appendJceInt 按 wire 写入，wire 为 0 或容纳不下 x 时按值选择最短的类型，0 写为 Zero
+func appendJceInt(b []byte, tag byte, x uint64, wire uint8) []byte {
+	typ := wire - 1
+	if wire == 0 || !jceIntFits(typ, x) {
+		switch {
+		case x == 0:
+			typ = jceZero
+		case x <= math.MaxUint8:
+			typ = jceInt1
+		case x <= math.MaxUint16:
+			typ = jceInt2
+		case x <= math.MaxUint32:
+			typ = jceInt4
+		default:
+			typ = jceInt8
+		}
+	}
+	b = appendJceHead(b, typ, tag)
+	switch typ {
+	case jceInt1:
+		return append(b, byte(x))
+	case jceInt2:
+		return binary.BigEndian.AppendUint16(b, uint16(x))
+	case jceInt4:
+		return binary.BigEndian.AppendUint32(b, uint32(x))
+	case jceInt8:
+		return binary.BigEndian.AppendUint64(b, x)
+	}
+	return b
+}
+
+func jceIntFits(typ byte, x uint64) bool {
+	switch typ {
+	case jceZero:
+		return x == 0
+	case jceInt1:
+		return x <= math.MaxUint8
+	case jceInt2:
+		return x <= math.MaxUint16
+	case jceInt4:
+		return x <= math.MaxUint32
+	case jceInt8:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,379 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+)
+
+// msgpack 格式首字节
+const (
+	mpNil      = 0xc0
+	mpFalse    = 0xc2
+	mpTrue     = 0xc3
+	mpBin8     = 0xc4
+	mpBin16    = 0xc5
+	mpBin32    = 0xc6
+	mpExt8     = 0xc7
+	mpExt16    = 0xc8
+	mpExt32    = 0xc9
+	mpFloat32  = 0xca
+	mpFloat64  = 0xcb
+	mpUint8    = 0xcc
+	mpUint16   = 0xcd
+	mpUint32   = 0xce
+	mpUint64   = 0xcf
+	mpInt8     = 0xd0
+	mpInt16    = 0xd1
+	mpInt32    = 0xd2
+	mpInt64    = 0xd3
+	mpFixExt1  = 0xd4
+	mpFixExt16 = 0xd8
+	mpStr8     = 0xd9
+	mpStr16    = 0xda
+	mpStr32    = 0xdb
+	mpArray16  = 0xdc
+	mpArray32  = 0xdd
+	mpMap16    = 0xde
+	mpMap32    = 0xdf
+)
+
+type msgpackReader struct {
+	b []byte
+}
+
+func (r *msgpackReader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(r.b)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p, nil
+}
+
+// uint 读取 n 字节的大端无符号数
+func (r *msgpackReader) uint(n uint64) (uint64, error) {
+	p, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var x uint64
+	for _, c := range p {
+		x = x<<8 | uint64(c)
+	}
+	return x, nil
+}
+
+func decodeMsgpackDynamic(data []byte) (Value, error) {
+	r := &msgpackReader{b: data}
+	v, err := r.value(0)
+	if err == nil && len(r.b) != 0 {
+		err = fmt.Errorf("dynamic: %d bytes left over after msgpack value", len(r.b))
+	}
+	return v, err
+}
+
+func (r *msgpackReader) value(depth int) (v Value, err error) {
+	if depth > dynamicMaxDepth {
+		return v, fmt.Errorf("dynamic: exceeded max depth %d", dynamicMaxDepth)
+	}
+	p, err := r.next(1)
+	if err != nil {
+		return v, err
+	}
+	c := p[0]
+	switch {
+	case c <= 0x7f:
+		return Value{Kind: KindInt, Int: int64(c)}, nil
+	case c >= 0xe0:
+		return Value{Kind: KindInt, Int: int64(int8(c))}, nil
+	case c <= 0x8f:
+		return r.mapValue(uint64(c&0x0f), 0, depth)
+	case c <= 0x9f:
+		return r.list(uint64(c&0x0f), 0, depth)
+	case c <= 0xbf:
+		p, err := r.next(uint64(c & 0x1f))
+		return Value{Kind: KindString, Str: string(p)}, err
+	}
+
+	v.Wire = c
+	switch c {
+	case mpNil:
+		v.Kind, v.Wire = KindNull, 0
+	case mpFalse, mpTrue:
+		v.Kind, v.Bool, v.Wire = KindBool, c == mpTrue, 0
+	case mpFloat32:
+		x, err := r.uint(4)
+		v.Kind, v.Float = KindFloat, float64(math.Float32frombits(uint32(x)))
+		return v, err
+	case mpFloat64:
+		x, err := r.uint(8)
+		v.Kind, v.Float = KindFloat, math.Float64frombits(x)
+		return v, err
+	case mpUint8, mpUint16, mpUint32, mpUint64:
+		v.Kind = KindUint
+		v.Uint, err = r.uint(1 << (c - mpUint8))
+	case mpInt8, mpInt16, mpInt32, mpInt64:
+		n := uint(8) << (c - mpInt8)
+		x, err := r.uint(uint64(n / 8))
+		v.Kind, v.Int = KindInt, int64(x<<(64-n))>>(64-n)
+		return v, err
+	case mpStr8, mpStr16, mpStr32:
+		n, err := r.uint(1 << (c - mpStr8))
+		if err != nil {
+			return v, err
+		}
+		p, err := r.next(n)
+		v.Kind, v.Str = KindString, string(p)
+		return v, err
+	case mpBin8, mpBin16, mpBin32:
+		n, err := r.uint(1 << (c - mpBin8))
+		if err != nil {
+			return v, err
+		}
+		p, err := r.next(n)
+		v.Kind, v.Bytes = KindBytes, append([]byte(nil), p...)
+		return v, err
+	case mpArray16, mpArray32:
+		n, err := r.uint(2 << (c - mpArray16))
+		if err != nil {
+			return v, err
+		}
+		return r.list(n, c, depth)
+	case mpMap16, mpMap32:
+		n, err := r.uint(2 << (c - mpMap16))
+		if err != nil {
+			return v, err
+		}
+		return r.mapValue(n, c, depth)
+	case mpExt8, mpExt16, mpExt32:
+		n, err := r.uint(1 << (c - mpExt8))
+		if err != nil {
+			return v, err
+		}
+		return r.ext(n, c)
+	default:
+		if c >= mpFixExt1 && c <= mpFixExt16 {
+			return r.ext(1<<(c-mpFixExt1), 0)
+		}
+		return v, fmt.Errorf("dynamic: invalid msgpack format 0x%x", c)
+	}
+	return v, err
+}
+
+func (r *msgpackReader) list(n uint64, wire byte, depth int) (Value, error) {
+	// 每个元素至少 1 字节
+	if n > uint64(len(r.b)) {
+		return Value{}, io.ErrUnexpectedEOF
+	}
+	v := Value{Kind: KindList, List: make([]Value, n), Wire: wire}
+	for i := range v.List {
+		e, err := r.value(depth + 1)
+		if err != nil {
+			return v, err
+		}
+		v.List[i] = e
+	}
+	return v, nil
+}
+
+func (r *msgpackReader) mapValue(n uint64, wire byte, depth int) (Value, error) {
+	if n > uint64(len(r.b)) {
+		return Value{}, io.ErrUnexpectedEOF
+	}
+	v := Value{Kind: KindMap, Map: make([]MapEntry, n), Wire: wire}
+	for i := range v.Map {
+		k, err := r.value(depth + 1)
+		if err != nil {
+			return v, err
+		}
+		e, err := r.value(depth + 1)
+		if err != nil {
+			return v, err
+		}
+		v.Map[i] = MapEntry{Key: k, Value: e}
+	}
+	return v, nil
+}
+
+func (r *msgpackReader) ext(n uint64, wire byte) (Value, error) {
+	p, err := r.next(n + 1)
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{Kind: KindExt, ExtType: int8(p[0]), Bytes: append([]byte(nil), p[1:]...), Wire: wire}, nil
+}
+
+// msgpackTimestamp 解析 msgpack 时间戳扩展(类型 -1)
+func msgpackTimestamp(v *Value) (time.Time, bool) {
+	if v.ExtType != -1 {
+		return time.Time{}, false
+	}
+	b := v.Bytes
+	switch len(b) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), 0).UTC(), true
+	case 8:
+		x := binary.BigEndian.Uint64(b)
+		return time.Unix(int64(x&(1<<34-1)), int64(x>>34)).UTC(), true
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(binary.BigEndian.Uint32(b))).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// appendMsgpackDynamic Wire 为 0 时使用最短的格式，KindStruct 编码为以字段名(没有名称时为 tag)为键的 map
+func appendMsgpackDynamic(b []byte, v *Value) (_ []byte, err error) {
+	switch v.Kind {
+	case KindNull:
+		return append(b, mpNil), nil
+	case KindBool:
+		if v.Bool {
+			return append(b, mpTrue), nil
+		}
+		return append(b, mpFalse), nil
+	case KindInt:
+		return appendMsgpackInt(b, v.Int, v.Wire), nil
+	case KindUint:
+		return appendMsgpackUint(b, v.Uint, v.Wire), nil
+	case KindFloat:
+		if v.Wire == mpFloat32 {
+			return binary.BigEndian.AppendUint32(append(b, mpFloat32), math.Float32bits(float32(v.Float))), nil
+		}
+		return binary.BigEndian.AppendUint64(append(b, mpFloat64), math.Float64bits(v.Float)), nil
+	case KindString:
+		n := uint64(len(v.Str))
+		if n <= 31 && v.Wire == 0 {
+			b = append(b, 0xa0|byte(n))
+		} else {
+			b = appendMsgpackLen(b, n, v.Wire, mpStr8, 1)
+		}
+		return append(b, v.Str...), nil
+	case KindBytes:
+		return append(appendMsgpackLen(b, uint64(len(v.Bytes)), v.Wire, mpBin8, 1), v.Bytes...), nil
+	case KindExt:
+		n := uint64(len(v.Bytes))
+		switch {
+		case v.Wire == 0 && (n == 1 || n == 2 || n == 4 || n == 8 || n == 16):
+			b = append(b, mpFixExt1+byte(bits.Len64(n)-1))
+		default:
+			b = appendMsgpackLen(b, n, v.Wire, mpExt8, 1)
+		}
+		return append(append(b, byte(v.ExtType)), v.Bytes...), nil
+	case KindList:
+		n := uint64(len(v.List))
+		if n <= 15 && v.Wire == 0 {
+			b = append(b, 0x90|byte(n))
+		} else {
+			b = appendMsgpackLen(b, n, v.Wire, mpArray16, 2)
+		}
+		for i := range v.List {
+			if b, err = appendMsgpackDynamic(b, &v.List[i]); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	case KindMap:
+		b = appendMsgpackMapHead(b, uint64(len(v.Map)), v.Wire)
+		for i := range v.Map {
+			if b, err = appendMsgpackDynamic(b, &v.Map[i].Key); err != nil {
+				return b, err
+			}
+			if b, err = appendMsgpackDynamic(b, &v.Map[i].Value); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	case KindStruct:
+		b = appendMsgpackMapHead(b, uint64(len(v.Fields)), v.Wire)
+		for i := range v.Fields {
+			f := &v.Fields[i]
+			key := Value{Kind: KindUint, Uint: uint64(f.Tag)}
+			if f.Name != "" {
+				key = Value{Kind: KindString, Str: f.Name}
+			}
+			if b, err = appendMsgpackDynamic(b, &key); err != nil {
+				return b, err
+			}
+			if b, err = appendMsgpackDynamic(b, &f.Value); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	}
+	return b, fmt.Errorf("dynamic: msgpack does not support %s", v.Kind)
+}
+
+func appendMsgpackMapHead(b []byte, n uint64, wire byte) []byte {
+	if n <= 15 && wire == 0 {
+		return append(b, 0x80|byte(n))
+	}
+	return appendMsgpackLen(b, n, wire, mpMap16, 2)
+}
+
+// appendMsgpackLen first 为最短长度格式的首字节，之后的格式依次使用 size<<i 字节的长度，
+// str、bin、ext 有 1、2、4 字节三种，array、map 有 2、4 字节两种
+// wire 为同一类格式且能容纳 n 时使用 wire
+func appendMsgpackLen(b []byte, n uint64, wire, first byte, size uint64) []byte {
+	last := byte(2)
+	if size == 2 {
+		last = 1
+	}
+	fits := func(i byte) bool { return bits.Len64(n) <= int(8*size<<i) }
+	i := byte(0)
+	if wire >= first && wire <= first+last && fits(wire-first) {
+		i = wire - first
+	} else {
+		for i < last && !fits(i) {
+			i++
+		}
+	}
+	b = append(b, first+i)
+	return appendBigEndian(b, n, int(size<<i))
+}
+
+func appendMsgpackUint(b []byte, x uint64, wire byte) []byte {
+	if wire < mpUint8 || wire > mpUint64 || bits.Len64(x) > 8<<(wire-mpUint8) {
+		if x <= 0x7f {
+			return append(b, byte(x))
+		}
+		wire = mpUint8
+		for bits.Len64(x) > 8<<(wire-mpUint8) {
+			wire++
+		}
+	}
+	return appendBigEndian(append(b, wire), x, 1<<(wire-mpUint8))
+}
+
+func appendMsgpackInt(b []byte, x int64, wire byte) []byte {
+	if wire >= mpUint8 && wire <= mpUint64 && x >= 0 {
+		return appendMsgpackUint(b, uint64(x), wire)
+	}
+	if wire < mpInt8 || wire > mpInt64 || !intFits(x, 8<<(wire-mpInt8)) {
+		if x >= 0 {
+			return appendMsgpackUint(b, uint64(x), 0)
+		}
+		if x >= -32 {
+			return append(b, byte(x))
+		}
+		wire = mpInt8
+		for !intFits(x, 8<<(wire-mpInt8)) {
+			wire++
+		}
+	}
+	return appendBigEndian(append(b, wire), uint64(x), 1<<(wire-mpInt8))
+}
+
+func appendBigEndian(b []byte, x uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(x>>(8*i)))
+	}
+	return b
+}
+
+func intFits(x int64, bits int) bool {
+	return bits == 64 || x >= -1<<(bits-1) && x < 1<<(bits-1)
+}
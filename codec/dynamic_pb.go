@@ -0,0 +1,331 @@
+package codec
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"unicode/utf8"
+)
+
+// pb wire type
+const (
+	pbVarint byte = iota
+	pbFixed64
+	pbBytes
+	pbStartGroup
+	pbEndGroup
+	pbFixed32
+)
+
+func decodePbDynamic(data []byte, desc *Descriptor) (Value, error) {
+	fields, _, err := decodePbFields(data, desc, 0, 0)
+	return Value{Kind: KindStruct, Fields: fields}, err
+}
+
+// decodePbFields 解码字段直到数据结束，group 不为 0 时解码到对应的 end group，返回剩余数据
+func decodePbFields(b []byte, desc *Descriptor, group uint32, depth int) ([]Field, []byte, error) {
+	if depth > dynamicMaxDepth {
+		return nil, b, fmt.Errorf("dynamic: exceeded max depth %d", dynamicMaxDepth)
+	}
+	var fields []Field
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fields, b, fmt.Errorf("dynamic: invalid pb field key")
+		}
+		b = b[n:]
+		tag, wire := key>>3, byte(key&7)
+		if tag == 0 || tag > math.MaxUint32 {
+			return fields, b, fmt.Errorf("dynamic: invalid pb field number %d", tag)
+		}
+		if wire == pbEndGroup {
+			if uint32(tag) != group {
+				return fields, b, fmt.Errorf("dynamic: unexpected pb end group %d", tag)
+			}
+			return fields, b, nil
+		}
+		fd := desc.Field(uint32(tag))
+		v, rest, err := decodePbValue(b, wire, uint32(tag), fd, depth)
+		if err != nil {
+			return fields, b, fmt.Errorf("dynamic: pb field %d: %w", tag, err)
+		}
+		b = rest
+		// map 的每个键值对为一个字段，连续的合并为一个 map
+		if n := len(fields); v.Kind == KindMap && n > 0 && fields[n-1].Tag == uint32(tag) && fields[n-1].Value.Kind == KindMap {
+			fields[n-1].Value.Map = append(fields[n-1].Value.Map, v.Map...)
+			continue
+		}
+		fields = append(fields, Field{Tag: uint32(tag), Name: fd.name(), Value: v})
+	}
+	if group != 0 {
+		return fields, b, io.ErrUnexpectedEOF
+	}
+	return fields, b, nil
+}
+
+func decodePbValue(b []byte, wire byte, tag uint32, fd *FieldDescriptor, depth int) (Value, []byte, error) {
+	v := Value{Wire: wire + 1}
+	t := fd.typ()
+	switch wire {
+	case pbVarint:
+		x, n := binary.Uvarint(b)
+		if n <= 0 {
+			return v, b, io.ErrUnexpectedEOF
+		}
+		pbNumber(&v, x, t)
+		return v, b[n:], nil
+	case pbFixed64:
+		if len(b) < 8 {
+			return v, b, io.ErrUnexpectedEOF
+		}
+		pbNumber(&v, binary.LittleEndian.Uint64(b), t)
+		return v, b[8:], nil
+	case pbFixed32:
+		if len(b) < 4 {
+			return v, b, io.ErrUnexpectedEOF
+		}
+		pbNumber(&v, uint64(binary.LittleEndian.Uint32(b)), t)
+		return v, b[4:], nil
+	case pbBytes:
+		x, n := binary.Uvarint(b)
+		if n <= 0 || x > uint64(len(b)-n) {
+			return v, b, io.ErrUnexpectedEOF
+		}
+		p, rest := b[n:n+int(x)], b[n+int(x):]
+		switch {
+		case fd.key() != TypeUnknown:
+			fields, _, err := decodePbFields(p, fd.entry(), 0, depth+1)
+			if err != nil {
+				return v, b, err
+			}
+			// 缺少的键、值为 KindNull，重编码时省略
+			var e MapEntry
+			for _, f := range fields {
+				switch f.Tag {
+				case 1:
+					e.Key = f.Value
+				case 2:
+					e.Value = f.Value
+				}
+			}
+			v.Kind, v.Map = KindMap, []MapEntry{e}
+		case t == TypeMessage:
+			fields, _, err := decodePbFields(p, fd.message(), 0, depth+1)
+			if err != nil {
+				return v, b, err
+			}
+			v.Kind, v.Fields = KindStruct, fields
+		case t == TypeBytes:
+			v.Kind, v.Bytes = KindBytes, append([]byte(nil), p...)
+		case t == TypeString || t == TypeUnknown && isText(p):
+			v.Kind, v.Str = KindString, string(p)
+		case t == TypeUnknown:
+			v.Kind, v.Bytes = KindBytes, append([]byte(nil), p...)
+		default:
+			// 数值类型的 repeated 字段使用 packed 编码
+			list, err := decodePbPacked(p, t)
+			if err != nil {
+				return v, b, err
+			}
+			v.Kind, v.List = KindList, list
+		}
+		return v, rest, nil
+	case pbStartGroup:
+		fields, rest, err := decodePbFields(b, fd.message(), tag, depth+1)
+		if err != nil {
+			return v, b, err
+		}
+		v.Kind, v.Fields = KindStruct, fields
+		return v, rest, nil
+	}
+	return v, b, fmt.Errorf("invalid wire type %d", wire)
+}
+
+// decodePbPacked packed 编码的元素没有 key，wire type 由字段类型决定
+func decodePbPacked(b []byte, t FieldType) ([]Value, error) {
+	wire := pbWireOf(t)
+	var list []Value
+	for len(b) > 0 {
+		v, rest, err := decodePbValue(b, wire, 0, &FieldDescriptor{Type: t}, 0)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		b = rest
+	}
+	return list, nil
+}
+
+// pbNumber 按描述的类型还原数值，没有描述时为无符号数
+func pbNumber(v *Value, x uint64, t FieldType) {
+	switch t {
+	case TypeBool:
+		v.Kind, v.Bool = KindBool, x != 0
+	case TypeFloat:
+		v.Kind, v.Float = KindFloat, float64(math.Float32frombits(uint32(x)))
+	case TypeDouble:
+		v.Kind, v.Float = KindFloat, math.Float64frombits(x)
+	case TypeSint32, TypeSint64:
+		v.Kind, v.Int = KindInt, int64(x>>1)^-int64(x&1)
+	case TypeInt32, TypeEnum, TypeSfixed32:
+		v.Kind, v.Int = KindInt, int64(int32(x))
+	case TypeInt64, TypeSfixed64:
+		v.Kind, v.Int = KindInt, int64(x)
+	default:
+		v.Kind, v.Uint = KindUint, x
+	}
+}
+
+// pbWireOf 数值类型对应的 wire type
+func pbWireOf(t FieldType) byte {
+	switch t {
+	case TypeFixed64, TypeSfixed64, TypeDouble:
+		return pbFixed64
+	case TypeFixed32, TypeSfixed32, TypeFloat:
+		return pbFixed32
+	case TypeString, TypeBytes, TypeMessage:
+		return pbBytes
+	}
+	return pbVarint
+}
+
+// isText 合法的 UTF-8 且不包含除空白外的控制字符
+func isText(p []byte) bool {
+	if !utf8.Valid(p) {
+		return false
+	}
+	for _, c := range p {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func appendPbDynamic(dst []byte, v *Value, desc *Descriptor) ([]byte, error) {
+	if v.Kind != KindStruct {
+		return dst, fmt.Errorf("dynamic: pb message must be a struct, got %s", v.Kind)
+	}
+	return appendPbFields(dst, v.Fields, desc)
+}
+
+func appendPbFields(b []byte, fields []Field, desc *Descriptor) (_ []byte, err error) {
+	for i := range fields {
+		f := &fields[i]
+		if b, err = appendPbField(b, f.Tag, &f.Value, desc.Field(f.Tag)); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+func appendPbKey(b []byte, tag uint32, wire byte) []byte {
+	return binary.AppendUvarint(b, uint64(tag)<<3|uint64(wire))
+}
+
+// appendPbField Wire 为 0 时按描述的类型选择 wire type，没有描述时数值使用 varint，浮点数使用 double
+func appendPbField(b []byte, tag uint32, v *Value, fd *FieldDescriptor) (_ []byte, err error) {
+	t := fd.typ()
+	switch v.Kind {
+	case KindNull:
+		return b, nil
+	case KindBool, KindInt, KindUint, KindFloat:
+		wire := pbScalarWire(v, t)
+		return appendPbScalar(appendPbKey(b, tag, wire), v, wire, t), nil
+	case KindString:
+		b = binary.AppendUvarint(appendPbKey(b, tag, pbBytes), uint64(len(v.Str)))
+		return append(b, v.Str...), nil
+	case KindBytes:
+		b = binary.AppendUvarint(appendPbKey(b, tag, pbBytes), uint64(len(v.Bytes)))
+		return append(b, v.Bytes...), nil
+	case KindList:
+		// packed 编码
+		var p []byte
+		for i := range v.List {
+			e := &v.List[i]
+			switch e.Kind {
+			case KindBool, KindInt, KindUint, KindFloat:
+				p = appendPbScalar(p, e, pbScalarWire(e, t), t)
+			default:
+				return b, fmt.Errorf("dynamic: pb packed field %d does not support %s", tag, e.Kind)
+			}
+		}
+		b = binary.AppendUvarint(appendPbKey(b, tag, pbBytes), uint64(len(p)))
+		return append(b, p...), nil
+	case KindStruct:
+		if v.Wire == pbStartGroup+1 {
+			if b, err = appendPbFields(appendPbKey(b, tag, pbStartGroup), v.Fields, fd.message()); err != nil {
+				return b, err
+			}
+			return appendPbKey(b, tag, pbEndGroup), nil
+		}
+		p, err := appendPbFields(nil, v.Fields, fd.message())
+		if err != nil {
+			return b, err
+		}
+		b = binary.AppendUvarint(appendPbKey(b, tag, pbBytes), uint64(len(p)))
+		return append(b, p...), nil
+	case KindMap:
+		// map 编码为 key = 1、value = 2 的 repeated 消息
+		for i := range v.Map {
+			e := &v.Map[i]
+			entry := []Field{{Tag: 1, Value: e.Key}, {Tag: 2, Value: e.Value}}
+			p, err := appendPbFields(nil, entry, fd.entry())
+			if err != nil {
+				return b, err
+			}
+			b = binary.AppendUvarint(appendPbKey(b, tag, pbBytes), uint64(len(p)))
+			b = append(b, p...)
+		}
+		return b, nil
+	}
+	return b, fmt.Errorf("dynamic: pb does not support %s", v.Kind)
+}
+
+// entry map 键值对消息的描述
+func (f *FieldDescriptor) entry() *Descriptor {
+	return &Descriptor{Fields: []*FieldDescriptor{{Tag: 1, Type: f.key()}, {Tag: 2, Type: f.typ(), Message: f.message()}}}
+}
+
+// pbScalarWire 优先使用原始的 wire type
+func pbScalarWire(v *Value, t FieldType) byte {
+	switch v.Wire {
+	case pbVarint + 1, pbFixed64 + 1, pbFixed32 + 1:
+		return v.Wire - 1
+	}
+	if t == TypeUnknown && v.Kind == KindFloat {
+		return pbFixed64
+	}
+	return pbWireOf(t)
+}
+
+func appendPbScalar(b []byte, v *Value, wire byte, t FieldType) []byte {
+	var x uint64
+	switch v.Kind {
+	case KindBool:
+		if v.Bool {
+			x = 1
+		}
+	case KindInt:
+		x = uint64(v.Int)
+		if t == TypeSint32 || t == TypeSint64 {
+			x = uint64(v.Int<<1 ^ v.Int>>63)
+		}
+	case KindUint:
+		x = v.Uint
+	case KindFloat:
+		if wire == pbFixed32 {
+			x = uint64(math.Float32bits(float32(v.Float)))
+		} else {
+			x = math.Float64bits(v.Float)
+		}
+	}
+	switch wire {
+	case pbFixed64:
+		return binary.LittleEndian.AppendUint64(b, x)
+	case pbFixed32:
+		return binary.LittleEndian.AppendUint32(b, uint32(x))
+	}
+	return binary.AppendUvarint(b, x)
+}
@@ -0,0 +1,494 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	jce2 "github.com/erpc-go/jce-codec"
+	"github.com/gogo/protobuf/proto"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// pbTeam 测试用 pb 消息，覆盖嵌套消息、packed、zigzag、fixed64、bytes 及 map
+type pbTeam struct {
+	Name    string           `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Members []*pbPerson      `protobuf:"bytes,2,rep,name=members,proto3" json:"members,omitempty"`
+	Scores  []int32          `protobuf:"varint,3,rep,packed,name=scores,proto3" json:"scores,omitempty"`
+	Delta   int64            `protobuf:"zigzag64,4,opt,name=delta,proto3" json:"delta,omitempty"`
+	Ratio   float64          `protobuf:"fixed64,5,opt,name=ratio,proto3" json:"ratio,omitempty"`
+	Data    []byte           `protobuf:"bytes,6,opt,name=data,proto3" json:"data,omitempty"`
+	Labels  map[string]int32 `protobuf:"bytes,7,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"`
+}
+
+func (m *pbTeam) Reset()         { *m = pbTeam{} }
+func (m *pbTeam) String() string { return m.Name }
+func (*pbTeam) ProtoMessage()    {}
+
+var (
+	pbPersonDesc = &Descriptor{Name: "Person", Fields: []*FieldDescriptor{
+		{Tag: 1, Name: "name", Type: TypeString},
+		{Tag: 2, Name: "age", Type: TypeInt32},
+	}}
+	pbTeamDesc = &Descriptor{Name: "Team", Fields: []*FieldDescriptor{
+		{Tag: 1, Name: "name", Type: TypeString},
+		{Tag: 2, Name: "members", Type: TypeMessage, Message: pbPersonDesc, Repeated: true},
+		{Tag: 3, Name: "scores", Type: TypeInt32, Repeated: true},
+		{Tag: 4, Name: "delta", Type: TypeSint64},
+		{Tag: 5, Name: "ratio", Type: TypeDouble},
+		{Tag: 6, Name: "data", Type: TypeBytes},
+		{Tag: 7, Name: "labels", Key: TypeString, Type: TypeInt32},
+	}}
+)
+
+func newPbTeam() *pbTeam {
+	return &pbTeam{
+		Name:    "core",
+		Members: []*pbPerson{{Name: "lily", Age: 18}, {Name: "lucy", Age: -1}},
+		Scores:  []int32{-1, 0, 300},
+		Delta:   -42,
+		Ratio:   0.5,
+		Data:    []byte{0, 1, 2},
+		Labels:  map[string]int32{"level": 3},
+	}
+}
+
+func TestDynamicPb(t *testing.T) {
+	want := newPbTeam()
+	data, err := proto.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, desc := range []*Descriptor{nil, pbTeamDesc} {
+		d := NewDynamic(IDPb, desc)
+		if err := d.Unmarshal(data); err != nil {
+			t.Fatal(err)
+		}
+		b, err := d.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatalf("desc %v: re-encode got %x, want %x", desc != nil, b, data)
+		}
+	}
+
+	d := NewDynamic(IDPb, pbTeamDesc)
+	if err := d.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := d.Value.FieldByName("delta"); !ok || v.Kind != KindInt || v.Int != -42 {
+		t.Fatalf("delta got %+v", v)
+	}
+	if v, ok := d.Value.Field(3); !ok || v.Kind != KindList || len(v.List) != 3 || v.List[0].Int != -1 || v.List[2].Int != 300 {
+		t.Fatalf("scores got %+v", v)
+	}
+	if v, ok := d.Value.Field(2); !ok || v.Kind != KindStruct {
+		t.Fatalf("members got %+v", v)
+	} else if age, _ := v.FieldByName("age"); age == nil || age.Int != 18 {
+		t.Fatalf("member age got %+v", age)
+	}
+
+	// 修改后重编码，用生成代码解码
+	name, _ := d.Value.FieldByName("name")
+	*name = Value{Kind: KindString, Str: "infra"}
+	delta, _ := d.Value.FieldByName("delta")
+	delta.Int = 7
+	b, err := d.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &pbTeam{}
+	if err := proto.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "infra" || got.Delta != 7 || len(got.Members) != 2 || got.Members[1].Age != -1 || got.Labels["level"] != 3 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestDynamicPbGroup(t *testing.T) {
+	// 1: group { 2: varint 5 }
+	data := []byte{0x0b, 0x10, 0x05, 0x0c}
+	d := NewDynamic(IDPb, nil)
+	if err := d.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := d.Value.Field(1); !ok || v.Kind != KindStruct || v.Fields[0].Value.Uint != 5 {
+		t.Fatalf("got %+v", d.Value)
+	}
+	b, err := d.Marshal()
+	if err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("got %x, %v", b, err)
+	}
+}
+
+// jceWriter 实现 jce.Messager，按 jce 编码器写入字段
+type jceWriter func(e *jce2.Encoder) error
+
+func (f jceWriter) ReadFrom(r io.Reader) (int64, error) { return 0, nil }
+
+func (f jceWriter) WriteTo(w io.Writer) (int64, error) {
+	e := jce2.NewEncoder(w)
+	if err := f(e); err != nil {
+		return 0, err
+	}
+	return 0, e.Flush()
+}
+
+func writeJceSample(e *jce2.Encoder) error {
+	steps := []func() error{
+		func() error { return e.WriteInt8(-1, 0) },
+		func() error { return e.WriteString("lily", 1) },
+		func() error { return e.WriteInt32(0, 2) },
+		func() error { return e.WriteInt16(-300, 3) },
+		func() error { return e.WriteInt64(1<<40, 4) },
+		func() error { return e.WriteFloat32(1.5, 5) },
+		func() error { return e.WriteFloat64(-0.25, 6) },
+		func() error { return e.WriteSliceUint8([]byte{1, 2, 3}, 7) },
+		func() error { return e.WriteBool(true, 8) },
+		// struct
+		func() error { return e.WriteHead(jce2.StructBegin, 9) },
+		func() error { return e.WriteInt32(18, 0) },
+		func() error { return e.WriteString("inner", 1) },
+		func() error { return e.WriteHead(jce2.StructEnd, 0) },
+		// list<int32>
+		func() error { return e.WriteHead(jce2.List, 10) },
+		func() error { return e.WriteLength(2) },
+		func() error { return e.WriteInt32(7, 0) },
+		func() error { return e.WriteInt32(100000, 0) },
+		// map<string, int64>
+		func() error { return e.WriteHead(jce2.Map, 11) },
+		func() error { return e.WriteLength(1) },
+		func() error { return e.WriteString("k", 0) },
+		func() error { return e.WriteInt64(-2, 1) },
+		func() error { return e.WriteString(strings.Repeat("x", 200), 20) },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var jceSampleDesc = &Descriptor{Name: "Sample", Fields: []*FieldDescriptor{
+	{Tag: 0, Name: "a", Type: TypeInt8},
+	{Tag: 1, Name: "name", Type: TypeString},
+	{Tag: 2, Name: "zero", Type: TypeInt32},
+	{Tag: 3, Name: "short", Type: TypeInt16},
+	{Tag: 4, Name: "long", Type: TypeInt64},
+	{Tag: 5, Name: "f", Type: TypeFloat},
+	{Tag: 6, Name: "d", Type: TypeDouble},
+	{Tag: 7, Name: "raw", Type: TypeBytes},
+	{Tag: 8, Name: "ok", Type: TypeBool},
+	{Tag: 9, Name: "inner", Type: TypeMessage, Message: &Descriptor{Fields: []*FieldDescriptor{
+		{Tag: 0, Name: "age", Type: TypeInt32},
+		{Tag: 1, Name: "name", Type: TypeString},
+	}}},
+	{Tag: 10, Name: "list", Type: TypeInt32},
+	{Tag: 11, Name: "map", Key: TypeString, Type: TypeInt64},
+	{Tag: 20, Name: "long_tag", Type: TypeString},
+}}
+
+func TestDynamicJce(t *testing.T) {
+	data, err := NewJceCoder().Marshal(jceWriter(writeJceSample))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, desc := range []*Descriptor{nil, jceSampleDesc} {
+		d := NewDynamic(IDJce, desc)
+		if err := d.Unmarshal(data); err != nil {
+			t.Fatal(err)
+		}
+		b, err := d.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatalf("desc %v: re-encode got %x, want %x", desc != nil, b, data)
+		}
+	}
+
+	d := NewDynamic(IDJce, jceSampleDesc)
+	if err := d.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	check := func(name string, ok bool) {
+		t.Helper()
+		if !ok {
+			v, _ := d.Value.FieldByName(name)
+			t.Fatalf("%s got %+v", name, v)
+		}
+	}
+	v, _ := d.Value.FieldByName("a")
+	check("a", v.Kind == KindInt && v.Int == -1)
+	v, _ = d.Value.FieldByName("short")
+	check("short", v.Kind == KindInt && v.Int == -300)
+	v, _ = d.Value.FieldByName("zero")
+	check("zero", v.Kind == KindInt && v.Int == 0)
+	v, _ = d.Value.FieldByName("f")
+	check("f", v.Kind == KindFloat && v.Float == 1.5)
+	v, _ = d.Value.FieldByName("raw")
+	check("raw", v.Kind == KindBytes && bytes.Equal(v.Bytes, []byte{1, 2, 3}))
+	v, _ = d.Value.FieldByName("ok")
+	check("ok", v.Kind == KindBool && v.Bool)
+	v, _ = d.Value.FieldByName("inner")
+	check("inner", v.Kind == KindStruct && v.Fields[0].Name == "age" && v.Fields[0].Value.Int == 18)
+	v, _ = d.Value.FieldByName("list")
+	check("list", v.Kind == KindList && len(v.List) == 2 && v.List[1].Int == 100000)
+	v, _ = d.Value.FieldByName("map")
+	check("map", v.Kind == KindMap && v.Map[0].Key.Str == "k" && v.Map[0].Value.Int == -2)
+	v, _ = d.Value.FieldByName("long_tag")
+	check("long_tag", v.Kind == KindString && len(v.Str) == 200)
+
+	// 修改后的值按最短的类型编码
+	short, _ := d.Value.FieldByName("short")
+	short.Int = -1
+	b, err := d.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2 := NewDynamic(IDJce, jceSampleDesc)
+	if err := d2.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := d2.Value.FieldByName("short"); v.Int != -1 || v.Wire != jceInt2+1 {
+		t.Fatalf("short got %+v", v)
+	}
+	*short = Value{Kind: KindInt, Int: 5}
+	if b, err = d.Marshal(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d2.Unmarshal(b); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := d2.Value.FieldByName("short"); v.Int != 5 || v.Wire != jceInt1+1 {
+		t.Fatalf("short got %+v", v)
+	}
+}
+
+func TestDynamicMsgpack(t *testing.T) {
+	type item struct {
+		ID      uint64            `msgpack:"id"`
+		Name    string            `msgpack:"name"`
+		Score   float64           `msgpack:"score"`
+		Tags    []string          `msgpack:"tags"`
+		Attrs   map[string]int    `msgpack:"attrs"`
+		Data    []byte            `msgpack:"data"`
+		Created time.Time         `msgpack:"created"`
+		Next    *item             `msgpack:"next"`
+		Extra   map[string]string `msgpack:"extra"`
+	}
+	created := time.Date(2022, 10, 1, 8, 0, 0, 123, time.UTC)
+	want := &item{ID: 1 << 40, Name: "lily", Score: -0.5, Tags: []string{"a", "b"}, Attrs: map[string]int{"n": -300},
+		Data: []byte{0xff}, Created: created}
+	data, err := msgpack.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDynamic(IDMsgpack, nil)
+	if err := d.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.Marshal()
+	if err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("re-encode got %x, %v, want %x", b, err, data)
+	}
+	if v, ok := d.Value.FieldByName("created"); !ok || v.Kind != KindExt {
+		t.Fatalf("created got %+v", v)
+	} else if ts, ok := msgpackTimestamp(v); !ok || !ts.Equal(created) {
+		t.Fatalf("created got %v", ts)
+	}
+	if v, ok := d.Value.FieldByName("next"); !ok || v.Kind != KindNull {
+		t.Fatalf("next got %+v", v)
+	}
+
+	got := &item{}
+	if err := msgpack.Unmarshal(b, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != want.ID || got.Attrs["n"] != -300 || !got.Created.Equal(created) {
+		t.Fatalf("got %+v", got)
+	}
+
+	// 非最短编码原样保留，修改后超出原宽度时改用最短编码
+	for _, tt := range []struct {
+		data, modified []byte
+		x              uint64
+	}{
+		{[]byte{0xcd, 0x00, 0x05}, []byte{0xcd, 0x00, 0x06}, 6},
+		{[]byte{0xcc, 0x05}, []byte{0xcd, 0x01, 0x2c}, 300},
+	} {
+		if err := d.Unmarshal(tt.data); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := d.Marshal(); err != nil || !bytes.Equal(b, tt.data) {
+			t.Fatalf("got %x, %v, want %x", b, err, tt.data)
+		}
+		d.Value.Uint = tt.x
+		if b, err := d.Marshal(); err != nil || !bytes.Equal(b, tt.modified) {
+			t.Fatalf("got %x, %v, want %x", b, err, tt.modified)
+		}
+	}
+}
+
+func TestDynamicJSON(t *testing.T) {
+	data, err := proto.Marshal(newPbTeam())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDynamic(IDPb, pbTeamDesc)
+	if err := d.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewJsonCoder().Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"name":"core","members":[{"name":"lily","age":18},{"name":"lucy","age":-1}],"scores":[-1,0,300],` +
+		`"delta":-42,"ratio":0.5,"data":"AAEC","labels":{"level":3}}`
+	if string(b) != want {
+		t.Fatalf("got %s\nwant %s", b, want)
+	}
+
+	// 没有描述时以 tag 为键，同一 tag 的多个值合并为数组
+	d = &Dynamic{Format: IDPb, Value: Value{Kind: KindStruct, Fields: []Field{
+		{Tag: 1, Value: Value{Kind: KindString, Str: "a"}},
+		{Tag: 2, Value: Value{Kind: KindUint, Uint: 1}},
+		{Tag: 1, Value: Value{Kind: KindString, Str: "b"}},
+	}}}
+	if b, err = d.MarshalJSON(); err != nil || string(b) != `{"1":["a","b"],"2":1}` {
+		t.Fatalf("got %s, %v", b, err)
+	}
+
+	v := Value{Kind: KindList, List: []Value{
+		{Kind: KindNull},
+		{Kind: KindFloat, Float: math.Inf(1)},
+		{Kind: KindExt, ExtType: 5, Bytes: []byte{1}},
+		{Kind: KindMap, Map: []MapEntry{{Key: Value{Kind: KindInt, Int: -1}, Value: Value{Kind: KindBool, Bool: true}}}},
+		{Kind: KindMap, Map: []MapEntry{{Key: Value{Kind: KindBytes, Bytes: []byte{1}}, Value: Value{Kind: KindString, Str: "\"x\""}}}},
+	}}
+	want = `[null,"+Inf",{"type":5,"data":"AQ=="},{"-1":true},[{"key":"AQ==","value":"\"x\""}]]`
+	if b, err = v.MarshalJSON(); err != nil || string(b) != want {
+		t.Fatalf("got %s, %v\nwant %s", b, err, want)
+	}
+}
+
+func TestDynamicCodec(t *testing.T) {
+	pbData, _ := proto.Marshal(&pbPerson{Name: "lily", Age: 18})
+	jceData, _ := NewJceCoder().Marshal(jceWriter(writeJceSample))
+	mpData, _ := msgpack.Marshal(map[string]any{"name": "lily"})
+
+	for _, tt := range []struct {
+		c    Codec
+		id   ID
+		data []byte
+	}{
+		{NewPbCoder(), IDPb, pbData},
+		{NewJceCoder(), IDJce, jceData},
+		{NewMsgpackCoder(), IDMsgpack, mpData},
+	} {
+		d := &Dynamic{}
+		if err := tt.c.Unmarshal(tt.data, d); err != nil || d.Format != tt.id {
+			t.Fatalf("%s: unmarshal format %d, %v", tt.c, d.Format, err)
+		}
+		if b, err := tt.c.Marshal(d); err != nil || !bytes.Equal(b, tt.data) {
+			t.Fatalf("%s: marshal got %x, %v", tt.c, b, err)
+		}
+		if b, err := MarshalAppend(tt.c, []byte("x"), d); err != nil || !bytes.Equal(b, append([]byte("x"), tt.data...)) {
+			t.Fatalf("%s: marshal append got %x, %v", tt.c, b, err)
+		}
+
+		var buf bytes.Buffer
+		if err := tt.c.MarshalTo(d, &buf); err != nil {
+			t.Fatal(err)
+		}
+		d2 := &Dynamic{}
+		if err := tt.c.UnmarshalFrom(&buf, d2); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := d2.Marshal(); !bytes.Equal(b, tt.data) {
+			t.Fatalf("%s: stream got %x", tt.c, b)
+		}
+	}
+}
+
+func TestDynamicErrors(t *testing.T) {
+	pbData, _ := proto.Marshal(newPbTeam())
+	jceData, _ := NewJceCoder().Marshal(jceWriter(writeJceSample))
+	mpData, _ := msgpack.Marshal([]any{"a", map[string]int{"b": 1}})
+
+	// 截断的数据都应返回错误
+	for _, tt := range []struct {
+		id   ID
+		data []byte
+	}{
+		{IDPb, pbData},
+		{IDJce, jceData},
+		{IDMsgpack, mpData},
+	} {
+		for n := 1; n < len(tt.data); n++ {
+			d := NewDynamic(tt.id, nil)
+			if d.Unmarshal(tt.data[:n]) == nil {
+				// pb、jce 在字段边界截断时是合法的消息
+				if tt.id == IDMsgpack {
+					t.Fatalf("format %d: truncated at %d want error", tt.id, n)
+				}
+				if b, _ := d.Marshal(); !bytes.Equal(b, tt.data[:n]) {
+					t.Fatalf("format %d: truncated at %d got %x", tt.id, n, b)
+				}
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		id   ID
+		data []byte
+	}{
+		{"pb field 0", IDPb, []byte{0x00, 0x01}},
+		{"pb wire type", IDPb, []byte{0x0e}},
+		{"pb end group", IDPb, []byte{0x0c}},
+		{"pb open group", IDPb, []byte{0x0b, 0x10, 0x05}},
+		{"jce struct end", IDJce, []byte{0xc0}},
+		{"jce type", IDJce, []byte{0xd0}},
+		{"jce simple list", IDJce, []byte{0x90, 0, 0, 0, 1, 0x01, 0x00}},
+		{"msgpack trailing", IDMsgpack, []byte{0x01, 0x02}},
+		{"msgpack never used", IDMsgpack, []byte{0xc1}},
+		{"msgpack depth", IDMsgpack, bytes.Repeat([]byte{0x91}, dynamicMaxDepth+2)},
+		{"unsupported", IDJson, []byte("{}")},
+	} {
+		if err := NewDynamic(tt.id, nil).Unmarshal(tt.data); err == nil {
+			t.Fatalf("%s: want error", tt.name)
+		}
+	}
+
+	if _, err := (&Dynamic{Format: IDPb, Value: Value{Kind: KindString}}).Marshal(); err == nil {
+		t.Fatal("pb non struct want error")
+	}
+	if _, err := (&Dynamic{Format: IDJce, Value: Value{Kind: KindStruct, Fields: []Field{{Tag: 256}}}}).Marshal(); err == nil {
+		t.Fatal("jce tag 256 want error")
+	}
+}
+
+func BenchmarkDynamicPb(b *testing.B) {
+	data, _ := proto.Marshal(newPbTeam())
+	d := NewDynamic(IDPb, pbTeamDesc)
+	buf := make([]byte, 0, len(data))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := d.Unmarshal(data); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := d.MarshalAppend(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package codec
+
+// 导出测试用的消息类型，供 codec_test 包的一致性测试使用
+type (
+	JcePerson    = jcePerson
+	PbPerson     = pbPerson
+	ThriftPerson = thriftPerson
+)
+
+var NewThriftPerson = newThriftPerson
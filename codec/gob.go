@@ -21,12 +21,22 @@ func (g *GobCoder) Marshal(v any) ([]byte, error) {
 	return b.Bytes(), err
 }
 
+func (g *GobCoder) MarshalAppend(dst []byte, v any) ([]byte, error) {
+	return appendTo(dst, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(v)
+	})
+}
+
 func (g *GobCoder) MarshalTo(v any, w io.Writer) error {
 	e := gob.NewEncoder(w)
 	return e.Encode(v)
 }
 
+// Unmarshal v 为 nil 时 gob 会丢弃解码的值，这里返回错误
 func (g *GobCoder) Unmarshal(data []byte, v any) error {
+	if err := checkTarget(v); err != nil {
+		return err
+	}
 	b := bytes.NewBuffer(data)
 	e := gob.NewDecoder(b)
 	err := e.Decode(v)
@@ -34,6 +44,9 @@ func (g *GobCoder) Unmarshal(data []byte, v any) error {
 }
 
 func (g *GobCoder) UnmarshalFrom(r io.Reader, v any) error {
+	if err := checkTarget(v); err != nil {
+		return err
+	}
 	d := gob.NewDecoder(r)
 	return d.Decode(v)
 }
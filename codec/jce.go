@@ -7,6 +7,7 @@ import (
 )
 
 // jce 协议
+// 支持 *Dynamic 无需生成代码解码任意的 jce 数据
 type JceCoder struct {
 }
 
@@ -15,18 +16,39 @@ func NewJceCoder() *JceCoder {
 }
 
 func (jc *JceCoder) Marshal(v any) ([]byte, error) {
+	if b, ok, err := marshalDynamic(nil, v, IDJce); ok {
+		return b, err
+	}
 	return jce2.Marshal(v)
 }
 
+func (jc *JceCoder) MarshalAppend(dst []byte, v any) ([]byte, error) {
+	if b, ok, err := marshalDynamic(dst, v, IDJce); ok {
+		return b, err
+	}
+	return appendTo(dst, func(w io.Writer) error {
+		return jce2.MarshalTo(v, w)
+	})
+}
+
 func (jc *JceCoder) MarshalTo(v any, w io.Writer) error {
+	if ok, err := marshalDynamicTo(v, w, IDJce); ok {
+		return err
+	}
 	return jce2.MarshalTo(v, w)
 }
 
 func (jc *JceCoder) Unmarshal(data []byte, v any) error {
+	if ok, err := unmarshalDynamic(data, v, IDJce); ok {
+		return err
+	}
 	return jce2.Unmarshal(data, v)
 }
 
 func (jc *JceCoder) UnmarshalFrom(r io.Reader, v any) error {
+	if ok, err := unmarshalDynamicFrom(r, v, IDJce); ok {
+		return err
+	}
 	return jce2.UnmarshalFrom(r, v)
 }
 
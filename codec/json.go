@@ -19,6 +19,20 @@ func (js *JsonCoder) Marshal(v any) ([]byte, error) {
 	return json.Marshal(v)
 }
 
+// MarshalAppend 直接编码到 dst，编码器复用 jsoniter 的 Stream 对象池
+func (js *JsonCoder) MarshalAppend(dst []byte, v any) ([]byte, error) {
+	stream := json.BorrowStream(nil)
+	defer json.ReturnStream(stream)
+	stream.SetBuffer(dst)
+	stream.WriteVal(v)
+	b := stream.Buffer()
+	stream.SetBuffer(nil)
+	if stream.Error != nil {
+		return dst, stream.Error
+	}
+	return b, nil
+}
+
 func (js *JsonCoder) MarshalTo(v any, w io.Writer) error {
 	e := json.NewEncoder(w)
 	return e.Encode(v)
@@ -30,9 +44,9 @@ func (js *JsonCoder) Unmarshal(data []byte, v any) error {
 
 func (js *JsonCoder) UnmarshalFrom(r io.Reader, v any) error {
 	d := json.NewDecoder(r)
-	return d.Decode(r)
+	return d.Decode(v)
 }
 
 func (js *JsonCoder) String() string {
-	return "jce"
+	return "json"
 }
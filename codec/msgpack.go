@@ -9,6 +9,7 @@ import (
 )
 
 // msgpack 协议
+// *Dynamic 按一个 msgpack 值解码，UnmarshalFrom 读取 r 的全部数据
 type MsgpackCoder struct {
 }
 
@@ -17,6 +18,9 @@ func NewMsgpackCoder() *MsgpackCoder {
 }
 
 func (m *MsgpackCoder) Marshal(v any) ([]byte, error) {
+	if b, ok, err := marshalDynamic(nil, v, IDMsgpack); ok {
+		return b, err
+	}
 	if m, ok := v.(msgp.Marshaler); ok {
 		return m.MarshalMsg(nil)
 	}
@@ -28,12 +32,31 @@ func (m *MsgpackCoder) Marshal(v any) ([]byte, error) {
 	return buf.Bytes(), err
 }
 
+func (m *MsgpackCoder) MarshalAppend(dst []byte, v any) ([]byte, error) {
+	if b, ok, err := marshalDynamic(dst, v, IDMsgpack); ok {
+		return b, err
+	}
+	if m, ok := v.(msgp.Marshaler); ok {
+		return m.MarshalMsg(dst)
+	}
+
+	return appendTo(dst, func(w io.Writer) error {
+		return msgpack.NewEncoder(w).Encode(v)
+	})
+}
+
 func (m *MsgpackCoder) MarshalTo(v any, w io.Writer) (err error) {
+	if ok, err := marshalDynamicTo(v, w, IDMsgpack); ok {
+		return err
+	}
 	enc := msgpack.NewEncoder(w)
 	return enc.Encode(v)
 }
 
 func (m *MsgpackCoder) Unmarshal(data []byte, v any) (err error) {
+	if ok, err := unmarshalDynamic(data, v, IDMsgpack); ok {
+		return err
+	}
 	if m, ok := v.(msgp.Unmarshaler); ok {
 		_, err = m.UnmarshalMsg(data)
 		return
@@ -44,6 +67,9 @@ func (m *MsgpackCoder) Unmarshal(data []byte, v any) (err error) {
 }
 
 func (m *MsgpackCoder) UnmarshalFrom(r io.Reader, v any) (err error) {
+	if ok, err := unmarshalDynamicFrom(r, v, IDMsgpack); ok {
+		return err
+	}
 	dec := msgpack.NewDecoder(r)
 	return dec.Decode(v)
 }
@@ -2,12 +2,15 @@ package codec
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"sync"
 
 	"github.com/gogo/protobuf/proto"
 )
 
 // pb 协议
+// 支持 *Dynamic 无需生成代码解码任意的 pb 数据
 type PbCoder struct {
 }
 
@@ -16,11 +19,56 @@ func NewPbCoder() *PbCoder {
 }
 
 func (pb *PbCoder) Marshal(v any) ([]byte, error) {
-	return proto.Marshal(v.(proto.Message))
+	if b, ok, err := marshalDynamic(nil, v, IDPb); ok {
+		return b, err
+	}
+	m, err := pbMessage(v)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(m)
+}
+
+// pbMessage v 需为非 nil 的 proto.Message
+func pbMessage(v any) (proto.Message, error) {
+	if err := checkTarget(v); err != nil {
+		return nil, err
+	}
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T is not a proto.Message", ErrUnsupportedType, v)
+	}
+	return m, nil
+}
+
+// pbBuffers proto.Buffer 对象池，用于 MarshalAppend
+var pbBuffers = sync.Pool{New: func() any { return proto.NewBuffer(nil) }}
+
+func (pb *PbCoder) MarshalAppend(dst []byte, v any) ([]byte, error) {
+	if b, ok, err := marshalDynamic(dst, v, IDPb); ok {
+		return b, err
+	}
+	m, err := pbMessage(v)
+	if err != nil {
+		return dst, err
+	}
+	buf := pbBuffers.Get().(*proto.Buffer)
+	defer pbBuffers.Put(buf)
+	buf.SetBuf(dst)
+	err = buf.Marshal(m)
+	b := buf.Bytes()
+	buf.SetBuf(nil)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
 }
 
 func (pb *PbCoder) MarshalTo(v any, w io.Writer) (err error) {
-	b, err := proto.Marshal(v.(proto.Message))
+	if ok, err := marshalDynamicTo(v, w, IDPb); ok {
+		return err
+	}
+	b, err := pb.Marshal(v)
 	if err != nil {
 		return
 	}
@@ -29,16 +77,30 @@ func (pb *PbCoder) MarshalTo(v any, w io.Writer) (err error) {
 }
 
 func (pb *PbCoder) Unmarshal(data []byte, v any) error {
-	return proto.Unmarshal(data, v.(proto.Message))
+	if ok, err := unmarshalDynamic(data, v, IDPb); ok {
+		return err
+	}
+	m, err := pbMessage(v)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, m)
 }
 
 func (pb *PbCoder) UnmarshalFrom(r io.Reader, v any) (err error) {
+	if ok, err := unmarshalDynamicFrom(r, v, IDPb); ok {
+		return err
+	}
+	m, err := pbMessage(v)
+	if err != nil {
+		return err
+	}
 	b := bytes.NewBuffer(make([]byte, 0))
 	if _, err = b.ReadFrom(r); err != nil {
 		return
 	}
 
-	return proto.Unmarshal(b.Bytes(), v.(proto.Message))
+	return proto.Unmarshal(b.Bytes(), m)
 }
 
 func (pb *PbCoder) String() string {
@@ -1,11 +1,9 @@
 package codec
 
 import (
-	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
-	"reflect"
 )
 
 // 裸编码，即默认不编码，只支持原生为 []byte 类型
@@ -27,31 +25,44 @@ func (b *RawCoder) Marshal(v any) ([]byte, error) {
 		return *data, nil
 	}
 
-	return nil, fmt.Errorf("%T is not a []byte", v)
+	return nil, fmt.Errorf("%w: %T is not a []byte", ErrUnsupportedType, v)
+}
+
+func (b *RawCoder) MarshalAppend(dst []byte, v any) ([]byte, error) {
+	data, err := b.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, data...), nil
 }
 
 func (b *RawCoder) MarshalTo(v any, w io.Writer) (err error) {
-	buf := bytes.NewBuffer(make([]byte, 0))
-	b2, err := b.Marshal(v)
+	data, err := b.Marshal(v)
 	if err != nil {
 		return
 	}
-	_, err = buf.Write(b2)
+	_, err = w.Write(data)
 	return
 }
 
+// Unmarshal 复制 data，data 可能来自缓冲池，解码后会被复用
 func (b *RawCoder) Unmarshal(data []byte, v any) (err error) {
-	reflect.Indirect(reflect.ValueOf(v)).SetBytes(data)
+	p, ok := v.(*[]byte)
+	if !ok || p == nil {
+		return fmt.Errorf("%w: %T is not a non-nil *[]byte", ErrUnsupportedType, v)
+	}
+	*p = append([]byte(nil), data...)
 	return
 }
 
+// UnmarshalFrom 读取 r 的全部数据
 func (b *RawCoder) UnmarshalFrom(r io.Reader, v any) (err error) {
-	buf := make([]byte, 0)
-	_, err = io.ReadFull(r, buf)
-	if err != nil {
-		return
+	p, ok := v.(*[]byte)
+	if !ok || p == nil {
+		return fmt.Errorf("%w: %T is not a non-nil *[]byte", ErrUnsupportedType, v)
 	}
-	return b.Unmarshal(buf, v)
+	*p, err = io.ReadAll(r)
+	return
 }
 
 func (b *RawCoder) String() string {
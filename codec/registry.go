@@ -0,0 +1,242 @@
+package codec
+
+import (
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ID 编码方式在报文中的标识，占 1 个字节，取值一经分配不再变更
+type ID uint8
+
+const (
+	IDNone ID = iota
+	IDBinary
+	IDGob
+	IDJce
+	IDJson
+	IDPb
+	IDThrift
+	IDMsgpack
+	IDThriftCompact
+	IDThriftJSON
+	IDVarbin
+	IDCBOR
+)
+
+// Registration 编码方式注册信息
+type Registration struct {
+	ID      ID        // 报文中的标识
+	Name    CodecType // 名称
+	MIME    string    // MIME 类型，用于 HTTP Content-Type 等
+	Aliases []string  // 其他可识别的 MIME 类型
+	Codec   Codec
+}
+
+// registry 并发安全的编码方式注册表，可按 id、名称、MIME 类型查找
+type registry struct {
+	mutex sync.RWMutex
+	ids   map[ID]*Registration
+	names map[CodecType]*Registration
+	mimes map[string]*Registration
+}
+
+// Codecs 按名称索引的已注册编码方式，注册、注销时同步更新
+//
+// Deprecated: 仅为兼容保留，只读，与注册并发读取不安全，请使用 GetByName、List
+var Codecs = map[CodecType]Codec{}
+
+var codecs = &registry{
+	ids:   make(map[ID]*Registration),
+	names: make(map[CodecType]*Registration),
+	mimes: make(map[string]*Registration),
+}
+
+func init() {
+	for _, r := range []Registration{
+		{ID: IDNone, Name: CodeTypeNone, MIME: "application/octet-stream", Codec: NewRawCoder()},
+		{ID: IDBinary, Name: CodeTypeBinary, MIME: "application/x-erpc-binary", Codec: NewBinaryCoder()},
+		{ID: IDGob, Name: CodeTypeGob, MIME: "application/x-gob", Codec: NewGobCoder()},
+		{ID: IDJce, Name: CodeTypeJce, MIME: "application/jce", Aliases: []string{"application/x-jce"}, Codec: NewJceCoder()},
+		{ID: IDJson, Name: CodeTypeJson, MIME: "application/json", Aliases: []string{"text/json"}, Codec: NewJsonCoder()},
+		{ID: IDPb, Name: CodeTypePb, MIME: "application/x-protobuf", Aliases: []string{"application/protobuf", "application/pb"}, Codec: NewPbCoder()},
+		{ID: IDThrift, Name: CodeTypeThrift, MIME: "application/x-thrift", Aliases: []string{"application/vnd.apache.thrift.binary"}, Codec: NewThriftCoder()},
+		{ID: IDMsgpack, Name: CodeTypeMsgpack, MIME: "application/msgpack", Aliases: []string{"application/x-msgpack"}, Codec: NewMsgpackCoder()},
+		{ID: IDThriftCompact, Name: CodeTypeThriftCompact, MIME: "application/vnd.apache.thrift.compact", Codec: NewThriftCompactCoder()},
+		{ID: IDThriftJSON, Name: CodeTypeThriftJSON, MIME: "application/vnd.apache.thrift.json", Codec: NewThriftJSONCoder()},
+		{ID: IDVarbin, Name: CodeTypeVarbin, MIME: "application/x-erpc-varbin", Codec: NewVarbinCoder()},
+		{ID: IDCBOR, Name: CodeTypeCBOR, MIME: "application/cbor", Codec: NewCBORCoder()},
+	} {
+		if err := Register(r); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Register 注册编码方式，id、名称、MIME 类型均不能与已注册的重复
+func Register(r Registration) error {
+	if r.Codec == nil || r.Name == "" {
+		return fmt.Errorf("codec %q: name and codec must be set", r.Name)
+	}
+	mimes := append([]string{r.MIME}, r.Aliases...)
+	for i, m := range mimes {
+		mimes[i] = normalizeMIME(m)
+	}
+
+	codecs.mutex.Lock()
+	defer codecs.mutex.Unlock()
+	if old, ok := codecs.ids[r.ID]; ok {
+		return fmt.Errorf("codec %q: id %d already registered by %q", r.Name, r.ID, old.Name)
+	}
+	if _, ok := codecs.names[r.Name]; ok {
+		return fmt.Errorf("codec %q already registered", r.Name)
+	}
+	for _, m := range mimes {
+		if old, ok := codecs.mimes[m]; ok && m != "" {
+			return fmt.Errorf("codec %q: mime %q already registered by %q", r.Name, m, old.Name)
+		}
+	}
+
+	reg := r
+	reg.Aliases = append([]string(nil), r.Aliases...)
+	codecs.ids[r.ID] = &reg
+	codecs.names[r.Name] = &reg
+	for _, m := range mimes {
+		if m != "" {
+			codecs.mimes[m] = &reg
+		}
+	}
+	Codecs[r.Name] = r.Codec
+	return nil
+}
+
+// Unregister 按 id 注销编码方式
+func Unregister(id ID) {
+	codecs.mutex.Lock()
+	defer codecs.mutex.Unlock()
+	r, ok := codecs.ids[id]
+	if !ok {
+		return
+	}
+	delete(codecs.ids, id)
+	delete(codecs.names, r.Name)
+	delete(Codecs, r.Name)
+	for m, v := range codecs.mimes {
+		if v == r {
+			delete(codecs.mimes, m)
+		}
+	}
+}
+
+// RegisterCodec 注册或替换编码方式的实现，已注册时保留 id 及 MIME 类型
+// 未注册时自动分配未使用的 id(从 255 向下)，需要指定 id、MIME 类型时请使用 Register
+func RegisterCodec(t CodecType, c Codec) error {
+	codecs.mutex.Lock()
+	r, ok := codecs.names[t]
+	if !ok {
+		id, free := codecs.freeID()
+		codecs.mutex.Unlock()
+		if !free {
+			return fmt.Errorf("codec %q: no free id", t)
+		}
+		return Register(Registration{ID: id, Name: t, Codec: c})
+	}
+	defer codecs.mutex.Unlock()
+	reg := *r
+	reg.Codec = c
+	codecs.ids[reg.ID] = &reg
+	codecs.names[t] = &reg
+	for m, v := range codecs.mimes {
+		if v == r {
+			codecs.mimes[m] = &reg
+		}
+	}
+	Codecs[t] = c
+	return nil
+}
+
+// freeID 未使用的最大 id，调用方需持有锁
+func (r *registry) freeID() (ID, bool) {
+	for id := 255; id > int(IDNone); id-- {
+		if _, ok := r.ids[ID(id)]; !ok {
+			return ID(id), true
+		}
+	}
+	return 0, false
+}
+
+// UnRegisterCodec 按名称注销编码方式
+func UnRegisterCodec(t CodecType, c Codec) {
+	if r, ok := GetByName(t); ok {
+		Unregister(r.ID)
+	}
+}
+
+// Get 按报文中的 id 查找
+func Get(id ID) (Registration, bool) {
+	codecs.mutex.RLock()
+	defer codecs.mutex.RUnlock()
+	return lookup(codecs.ids[id])
+}
+
+// GetByName 按名称查找
+func GetByName(name CodecType) (Registration, bool) {
+	codecs.mutex.RLock()
+	defer codecs.mutex.RUnlock()
+	return lookup(codecs.names[name])
+}
+
+// GetByMIME 按 MIME 类型查找，忽略大小写及参数，如 "application/json; charset=utf-8"
+// 未注册时按结构化后缀查找，如 "application/vnd.api+json" 对应 "application/json"
+func GetByMIME(v string) (Registration, bool) {
+	m := normalizeMIME(v)
+	codecs.mutex.RLock()
+	defer codecs.mutex.RUnlock()
+	if r, ok := codecs.mimes[m]; ok {
+		return lookup(r)
+	}
+	if i := strings.LastIndexByte(m, '+'); i >= 0 {
+		return lookup(codecs.mimes["application/"+m[i+1:]])
+	}
+	return Registration{}, false
+}
+
+// Lookup 按名称或 MIME 类型查找
+func Lookup(v string) (Registration, bool) {
+	if r, ok := GetByName(CodecType(v)); ok {
+		return r, true
+	}
+	return GetByMIME(v)
+}
+
+// List 所有已注册的编码方式，按 id 排序
+func List() []Registration {
+	codecs.mutex.RLock()
+	list := make([]Registration, 0, len(codecs.ids))
+	for _, r := range codecs.ids {
+		list = append(list, *r)
+	}
+	codecs.mutex.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func lookup(r *Registration) (Registration, bool) {
+	if r == nil {
+		return Registration{}, false
+	}
+	return *r, true
+}
+
+func normalizeMIME(v string) string {
+	v = strings.TrimSpace(v)
+	if mt, _, err := mime.ParseMediaType(v); err == nil {
+		return mt
+	}
+	if i := strings.IndexByte(v, ';'); i >= 0 {
+		v = v[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(v))
+}
@@ -0,0 +1,128 @@
+package codec
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRegistryLookup(t *testing.T) {
+	tests := []struct {
+		key  string
+		want ID
+	}{
+		{"code/json", IDJson},
+		{"application/json", IDJson},
+		{"Application/JSON; charset=utf-8", IDJson},
+		{"application/vnd.api+json", IDJson},
+		{"application/pb", IDPb},
+		{"application/x-protobuf", IDPb},
+		{"application/x-jce", IDJce},
+		{"application/x-msgpack", IDMsgpack},
+		{"application/vnd.apache.thrift.compact", IDThriftCompact},
+		{"code/thrift-json", IDThriftJSON},
+		{"application/x-erpc-varbin", IDVarbin},
+		{"application/cbor", IDCBOR},
+		{"application/senml+cbor", IDCBOR},
+	}
+	for _, tt := range tests {
+		r, ok := Lookup(tt.key)
+		if !ok || r.ID != tt.want || r.Codec == nil {
+			t.Errorf("Lookup(%q) = %d, %v, want %d", tt.key, r.ID, ok, tt.want)
+		}
+	}
+	if _, ok := Lookup("text/html"); ok {
+		t.Errorf("text/html should not be found")
+	}
+
+	r, ok := Get(IDPb)
+	if !ok || r.Name != CodeTypePb || r.MIME != "application/x-protobuf" {
+		t.Fatalf("Get(IDPb) = %+v, %v", r, ok)
+	}
+	if r, ok := GetByName(CodeTypeThrift); !ok || r.ID != IDThrift {
+		t.Fatalf("GetByName(thrift) = %+v, %v", r, ok)
+	}
+	list := List()
+	if len(list) < 8 || list[0].ID != IDNone || list[IDMsgpack].ID != IDMsgpack {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	const id ID = 200
+	r := Registration{ID: id, Name: "code/test", MIME: "application/x-test", Aliases: []string{"text/test"}, Codec: NewJsonCoder()}
+	if err := Register(r); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+	defer Unregister(id)
+
+	dups := []Registration{
+		{ID: id, Name: "code/test2", Codec: NewJsonCoder()},
+		{ID: id + 1, Name: "code/test", Codec: NewJsonCoder()},
+		{ID: id + 1, Name: "code/test2", MIME: "Text/Test", Codec: NewJsonCoder()},
+		{ID: id + 1, Name: "code/test2"},
+	}
+	for _, d := range dups {
+		if err := Register(d); err == nil {
+			t.Errorf("register %+v should fail", d)
+		}
+	}
+	if got, ok := GetByMIME("text/test"); !ok || got.ID != id {
+		t.Fatalf("GetByMIME(text/test) = %+v, %v", got, ok)
+	}
+
+	// 替换实现后 id、MIME 不变
+	raw := NewRawCoder()
+	RegisterCodec("code/test", raw)
+	if got, ok := GetByMIME("application/x-test"); !ok || got.Codec != raw || got.ID != id {
+		t.Fatalf("codec not replaced: %+v", got)
+	}
+
+	if Codecs["code/test"] != raw {
+		t.Fatalf("Codecs not updated")
+	}
+
+	UnRegisterCodec("code/test", nil)
+	if _, ok := Get(id); ok {
+		t.Fatalf("codec not unregistered")
+	}
+	if _, ok := Codecs["code/test"]; ok {
+		t.Fatalf("Codecs not updated on unregister")
+	}
+	if _, ok := GetByMIME("text/test"); ok {
+		t.Fatalf("mime not unregistered")
+	}
+}
+
+func TestRegisterCodecNew(t *testing.T) {
+	c := NewJsonCoder()
+	if err := RegisterCodec("code/new", c); err != nil {
+		t.Fatalf("register new codec failed: %v", err)
+	}
+	defer UnRegisterCodec("code/new", nil)
+	got, ok := GetByName("code/new")
+	if !ok || got.Codec != c || got.ID != 255 {
+		t.Fatalf("GetByName(code/new) = %+v, %v", got, ok)
+	}
+	if Codecs["code/new"] != c || Codecs[CodeTypeCBOR] == nil {
+		t.Fatalf("Codecs should list registered codecs")
+	}
+}
+
+func TestRegistryConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := ID(210 + i)
+			for j := 0; j < 100; j++ {
+				Register(Registration{ID: id, Name: CodecType("code/c" + string(rune('a'+i))), Codec: NewJsonCoder()})
+				Get(IDJson)
+				GetByMIME("application/json")
+				List()
+				Unregister(id)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -1,72 +1,233 @@
 package codec
 
 import (
-	"bytes"
 	"context"
-	"errors"
+	"encoding/binary"
+	"fmt"
 	"io"
+	"sync"
 
 	"github.com/apache/thrift/lib/go/thrift"
+	"github.com/erpc-go/erpc/utils/bufpool"
 )
 
-// thrift 协议
+// ThriftProtocol thrift 序列化协议
+type ThriftProtocol int
+
+const (
+	ThriftBinary  ThriftProtocol = iota // TBinaryProtocol
+	ThriftCompact                       // TCompactProtocol
+	ThriftJSON                          // TJSONProtocol
+)
+
+func (p ThriftProtocol) String() string {
+	switch p {
+	case ThriftBinary:
+		return "binary"
+	case ThriftCompact:
+		return "compact"
+	case ThriftJSON:
+		return "json"
+	}
+	return fmt.Sprintf("ThriftProtocol(%d)", int(p))
+}
+
+// thrift 协议，每种序列化协议注册为单独的编码方式
+// 序列化器通过对象池复用，直接读写调用方的 []byte，不经过 TMemoryBuffer 复制
+// MarshalTo、UnmarshalFrom 使用 TFramedTransport 的帧格式: 长度(4B 大端) | 数据，可与 thrift 服务直接互通
 type ThriftCoder struct {
+	protocol ThriftProtocol
+	conf     *thrift.TConfiguration
+	states   sync.Pool // *thriftState
+}
+
+// thriftState 绑定在同一个传输层上的序列化协议
+type thriftState struct {
+	trans thriftBuffer
+	proto thrift.TProtocol
 }
 
 func NewThriftCoder() *ThriftCoder {
-	return &ThriftCoder{}
+	return NewThriftCoderConf(ThriftBinary, nil)
 }
 
-func (t *ThriftCoder) Marshal(v any) ([]byte, error) {
-	b := thrift.NewTMemoryBufferLen(1024)
-	p := thrift.NewTBinaryProtocolFactoryConf(&thrift.TConfiguration{}).GetProtocol(b)
+func NewThriftCompactCoder() *ThriftCoder {
+	return NewThriftCoderConf(ThriftCompact, nil)
+}
+
+func NewThriftJSONCoder() *ThriftCoder {
+	return NewThriftCoderConf(ThriftJSON, nil)
+}
 
-	tt := &thrift.TSerializer{
-		Transport: b,
-		Protocol:  p,
+// NewThriftCoderConf 指定序列化协议及配置，conf 为 nil 时使用 thrift 默认配置
+// conf.MaxFrameSize 限制 UnmarshalFrom 读取的帧长度，conf.MaxMessageSize 限制单个字段的长度
+func NewThriftCoderConf(p ThriftProtocol, conf *thrift.TConfiguration) *ThriftCoder {
+	if conf == nil {
+		conf = &thrift.TConfiguration{}
+	}
+	t := &ThriftCoder{protocol: p, conf: conf}
+	t.states.New = func() any {
+		s := &thriftState{}
+		switch p {
+		case ThriftCompact:
+			s.proto = thrift.NewTCompactProtocolConf(&s.trans, conf)
+		case ThriftJSON:
+			s.proto = thrift.NewTJSONProtocol(&s.trans)
+		default:
+			s.proto = thrift.NewTBinaryProtocolConf(&s.trans, conf)
+		}
+		return s
 	}
+	return t
+}
 
-	tt.Transport.Close()
+// Protocol 序列化协议
+func (t *ThriftCoder) Protocol() ThriftProtocol {
+	return t.protocol
+}
 
-	if msg, ok := v.(thrift.TStruct); ok {
-		return tt.Write(context.Background(), msg)
+// getState 获取序列化器，出错的序列化器可能处于中间状态，不再归还对象池
+func (t *ThriftCoder) getState() *thriftState {
+	s := t.states.Get().(*thriftState)
+	if r, ok := s.proto.(interface{ Reset() }); ok {
+		r.Reset()
 	}
+	return s
+}
 
-	return nil, errors.New("type assertion failed")
+func (t *ThriftCoder) Marshal(v any) ([]byte, error) {
+	return t.MarshalAppend(nil, v)
+}
+
+func (t *ThriftCoder) MarshalAppend(dst []byte, v any) ([]byte, error) {
+	msg, ok := v.(thrift.TStruct)
+	if !ok {
+		return dst, fmt.Errorf("%w: %T is not a thrift.TStruct", ErrUnsupportedType, v)
+	}
+	s := t.getState()
+	s.trans.reset(dst)
+	ctx := context.Background()
+	if err := msg.Write(ctx, s.proto); err != nil {
+		return dst, err
+	}
+	if err := s.proto.Flush(ctx); err != nil {
+		return dst, err
+	}
+	b := s.trans.b
+	s.trans.reset(nil)
+	t.states.Put(s)
+	return b, nil
 }
 
-func (t *ThriftCoder) MarshalTo(v any, w io.Writer) (err error) {
-	b, err := t.Marshal(v)
+// MarshalTo 写入一帧
+func (t *ThriftCoder) MarshalTo(v any, w io.Writer) error {
+	buf := bufpool.Get(1024)
+	b, err := t.MarshalAppend(append(buf, 0, 0, 0, 0), v)
 	if err != nil {
-		return
+		bufpool.Put(buf)
+		return err
 	}
+	binary.BigEndian.PutUint32(b, uint32(len(b)-4))
 	_, err = w.Write(b)
-	return
+	bufpool.Put(b)
+	return err
 }
 
 func (t *ThriftCoder) Unmarshal(data []byte, v any) error {
-	tt := thrift.NewTMemoryBufferLen(1024)
-	p := thrift.NewTBinaryProtocolFactoryConf(&thrift.TConfiguration{}).GetProtocol(tt)
+	msg, ok := v.(thrift.TStruct)
+	if !ok {
+		return fmt.Errorf("%w: %T is not a thrift.TStruct", ErrUnsupportedType, v)
+	}
+	s := t.getState()
+	s.trans.reset(data)
+	if err := msg.Read(context.Background(), s.proto); err != nil {
+		return err
+	}
+	s.trans.reset(nil)
+	t.states.Put(s)
+	return nil
+}
 
-	d := &thrift.TDeserializer{
-		Transport: tt,
-		Protocol:  p,
+// UnmarshalFrom 读取一帧并解码，只读取该帧的数据，r 上的后续帧可继续读取
+func (t *ThriftCoder) UnmarshalFrom(r io.Reader, v any) error {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return err
 	}
-	d.Transport.Close()
+	size := binary.BigEndian.Uint32(head[:])
+	if int64(size) > int64(t.conf.GetMaxFrameSize()) {
+		return fmt.Errorf("thrift frame too large: %d", size)
+	}
+	buf := bufpool.Get(int(size))
+	defer bufpool.Put(buf)
+	buf = buf[:size]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return t.Unmarshal(buf, v)
+}
 
-	return d.Read(context.Background(), v.(thrift.TStruct), data)
+func (t *ThriftCoder) String() string {
+	if t.protocol == ThriftBinary {
+		return "Thrift"
+	}
+	return "Thrift-" + t.protocol.String()
 }
 
-func (t *ThriftCoder) UnmarshalFrom(r io.Reader, v any) (err error) {
-	b := bytes.NewBuffer(make([]byte, 0))
-	_, err = b.ReadFrom(r)
-	if err != nil {
-		return
+// thriftBuffer 基于 []byte 的 thrift 传输层，写入时追加到 b，读取时从 b[r:] 读取
+type thriftBuffer struct {
+	b []byte
+	r int
+}
+
+func (t *thriftBuffer) reset(b []byte) {
+	t.b, t.r = b, 0
+}
+
+func (t *thriftBuffer) Read(p []byte) (int, error) {
+	if t.r >= len(t.b) {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
 	}
+	n := copy(p, t.b[t.r:])
+	t.r += n
+	return n, nil
+}
+
+func (t *thriftBuffer) ReadByte() (byte, error) {
+	if t.r >= len(t.b) {
+		return 0, io.EOF
+	}
+	c := t.b[t.r]
+	t.r++
+	return c, nil
+}
 
-	return t.Unmarshal(b.Bytes(), v)
+func (t *thriftBuffer) Write(p []byte) (int, error) {
+	t.b = append(t.b, p...)
+	return len(p), nil
 }
 
-func (Thrift *ThriftCoder) String() string {
-	return "Thrift"
+func (t *thriftBuffer) WriteByte(c byte) error {
+	t.b = append(t.b, c)
+	return nil
 }
+
+func (t *thriftBuffer) WriteString(s string) (int, error) {
+	t.b = append(t.b, s...)
+	return len(s), nil
+}
+
+func (t *thriftBuffer) RemainingBytes() uint64 {
+	return uint64(len(t.b) - t.r)
+}
+
+func (t *thriftBuffer) Flush(ctx context.Context) error { return nil }
+func (t *thriftBuffer) Open() error                     { return nil }
+func (t *thriftBuffer) IsOpen() bool                    { return true }
+func (t *thriftBuffer) Close() error                    { return nil }
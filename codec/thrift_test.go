@@ -0,0 +1,264 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// thriftPerson 手写的 thrift 结构体，等价于 struct Person { 1: string name, 2: i32 age, 3: list<string> tags }
+type thriftPerson struct {
+	Name string
+	Age  int32
+	Tags []string
+}
+
+func (m *thriftPerson) Write(ctx context.Context, p thrift.TProtocol) error {
+	if err := p.WriteStructBegin(ctx, "Person"); err != nil {
+		return err
+	}
+	if err := p.WriteFieldBegin(ctx, "name", thrift.STRING, 1); err != nil {
+		return err
+	}
+	if err := p.WriteString(ctx, m.Name); err != nil {
+		return err
+	}
+	if err := p.WriteFieldEnd(ctx); err != nil {
+		return err
+	}
+	if err := p.WriteFieldBegin(ctx, "age", thrift.I32, 2); err != nil {
+		return err
+	}
+	if err := p.WriteI32(ctx, m.Age); err != nil {
+		return err
+	}
+	if err := p.WriteFieldEnd(ctx); err != nil {
+		return err
+	}
+	if err := p.WriteFieldBegin(ctx, "tags", thrift.LIST, 3); err != nil {
+		return err
+	}
+	if err := p.WriteListBegin(ctx, thrift.STRING, len(m.Tags)); err != nil {
+		return err
+	}
+	for _, tag := range m.Tags {
+		if err := p.WriteString(ctx, tag); err != nil {
+			return err
+		}
+	}
+	if err := p.WriteListEnd(ctx); err != nil {
+		return err
+	}
+	if err := p.WriteFieldEnd(ctx); err != nil {
+		return err
+	}
+	if err := p.WriteFieldStop(ctx); err != nil {
+		return err
+	}
+	return p.WriteStructEnd(ctx)
+}
+
+func (m *thriftPerson) Read(ctx context.Context, p thrift.TProtocol) error {
+	if _, err := p.ReadStructBegin(ctx); err != nil {
+		return err
+	}
+	for {
+		_, typ, id, err := p.ReadFieldBegin(ctx)
+		if err != nil {
+			return err
+		}
+		if typ == thrift.STOP {
+			break
+		}
+		switch {
+		case id == 1 && typ == thrift.STRING:
+			m.Name, err = p.ReadString(ctx)
+		case id == 2 && typ == thrift.I32:
+			m.Age, err = p.ReadI32(ctx)
+		case id == 3 && typ == thrift.LIST:
+			var n int
+			if _, n, err = p.ReadListBegin(ctx); err != nil {
+				return err
+			}
+			m.Tags = make([]string, n)
+			for i := range m.Tags {
+				if m.Tags[i], err = p.ReadString(ctx); err != nil {
+					return err
+				}
+			}
+			err = p.ReadListEnd(ctx)
+		default:
+			err = p.Skip(ctx, typ)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.ReadFieldEnd(ctx); err != nil {
+			return err
+		}
+	}
+	return p.ReadStructEnd(ctx)
+}
+
+func (m *thriftPerson) equal(o *thriftPerson) bool {
+	return m.Name == o.Name && m.Age == o.Age && fmt.Sprint(m.Tags) == fmt.Sprint(o.Tags)
+}
+
+// 官方 TSerializer 对应的协议，用于校验互通
+var thriftFactories = map[ThriftProtocol]thrift.TProtocolFactory{
+	ThriftBinary:  thrift.NewTBinaryProtocolFactoryConf(&thrift.TConfiguration{}),
+	ThriftCompact: thrift.NewTCompactProtocolFactoryConf(&thrift.TConfiguration{}),
+	ThriftJSON:    thrift.NewTJSONProtocolFactory(),
+}
+
+func newThriftPerson() *thriftPerson {
+	return &thriftPerson{Name: "lily", Age: 18, Tags: []string{"a", "bc", ""}}
+}
+
+func TestThriftCoder(t *testing.T) {
+	want := newThriftPerson()
+	for _, c := range []*ThriftCoder{NewThriftCoder(), NewThriftCompactCoder(), NewThriftJSONCoder()} {
+		data, err := c.Marshal(want)
+		if err != nil {
+			t.Fatalf("%s: marshal failed: %v", c, err)
+		}
+
+		// 与官方序列化结果一致
+		trans := thrift.NewTMemoryBuffer()
+		s := &thrift.TSerializer{Transport: trans, Protocol: thriftFactories[c.Protocol()].GetProtocol(trans)}
+		official, err := s.Write(context.Background(), want)
+		if err != nil || !bytes.Equal(data, official) {
+			t.Fatalf("%s: got %q, official %q, err:%v", c, data, official, err)
+		}
+
+		got := &thriftPerson{}
+		if err := c.Unmarshal(official, got); err != nil || !got.equal(want) {
+			t.Fatalf("%s: unmarshal got %+v, err:%v", c, got, err)
+		}
+
+		// 复用的序列化器不受上一次调用影响
+		for i := 0; i < 3; i++ {
+			if again, _ := c.Marshal(want); !bytes.Equal(again, data) {
+				t.Fatalf("%s: marshal again got %q", c, again)
+			}
+		}
+
+		if got, err := c.MarshalAppend([]byte("head"), want); err != nil || string(got) != "head"+string(data) {
+			t.Fatalf("%s: marshal append got %q, err:%v", c, got, err)
+		}
+
+		// 截断的数据
+		if err := c.Unmarshal(data[:len(data)/2], &thriftPerson{}); err == nil {
+			t.Fatalf("%s: unmarshal truncated data should fail", c)
+		}
+	}
+
+	c := NewThriftCoder()
+	if _, err := c.Marshal(NewPerson("lily", 18)); err == nil {
+		t.Fatalf("marshal non thrift struct should fail")
+	}
+	if err := c.Unmarshal([]byte{0}, NewPerson("lily", 18)); err == nil {
+		t.Fatalf("unmarshal non thrift struct should fail")
+	}
+}
+
+func TestThriftFramed(t *testing.T) {
+	for _, c := range []*ThriftCoder{NewThriftCoder(), NewThriftCompactCoder(), NewThriftJSONCoder()} {
+		// 与 TFramedTransport 写入的帧一致
+		var official bytes.Buffer
+		framed := thrift.NewTFramedTransportConf(thrift.NewStreamTransportW(&official), &thrift.TConfiguration{})
+		p := thriftFactories[c.Protocol()].GetProtocol(framed)
+		for _, m := range []*thriftPerson{newThriftPerson(), {Name: "bob"}} {
+			if err := m.Write(context.Background(), p); err != nil {
+				t.Fatalf("%s: official write failed: %v", c, err)
+			}
+			// 协议 Flush 时传输层写入一帧
+			if err := p.Flush(context.Background()); err != nil {
+				t.Fatalf("%s: official flush failed: %v", c, err)
+			}
+		}
+
+		var buf bytes.Buffer
+		c.MarshalTo(newThriftPerson(), &buf)
+		c.MarshalTo(&thriftPerson{Name: "bob"}, &buf)
+		if !bytes.Equal(buf.Bytes(), official.Bytes()) {
+			t.Fatalf("%s: frames mismatch\ngot  %q\nwant %q", c, buf.Bytes(), official.Bytes())
+		}
+
+		// 逐帧读取，不多读后续帧
+		r := bytes.NewReader(official.Bytes())
+		first, second := &thriftPerson{}, &thriftPerson{}
+		if err := c.UnmarshalFrom(r, first); err != nil || !first.equal(newThriftPerson()) {
+			t.Fatalf("%s: read first frame got %+v, err:%v", c, first, err)
+		}
+		if err := c.UnmarshalFrom(r, second); err != nil || second.Name != "bob" {
+			t.Fatalf("%s: read second frame got %+v, err:%v", c, second, err)
+		}
+		if err := c.UnmarshalFrom(r, &thriftPerson{}); err != io.EOF {
+			t.Fatalf("%s: read after last frame, err:%v", c, err)
+		}
+
+		data := official.Bytes()
+		if err := c.UnmarshalFrom(bytes.NewReader(data[:10]), &thriftPerson{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("%s: read truncated frame, err:%v", c, err)
+		}
+	}
+
+	// 帧长度超过限制
+	c := NewThriftCoderConf(ThriftBinary, &thrift.TConfiguration{MaxFrameSize: 16})
+	var buf bytes.Buffer
+	c.MarshalTo(newThriftPerson(), &buf)
+	if err := c.UnmarshalFrom(&buf, &thriftPerson{}); err == nil {
+		t.Fatalf("frame larger than max frame size should fail")
+	}
+}
+
+func TestThriftConcurrent(t *testing.T) {
+	c := NewThriftCompactCoder()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				want := &thriftPerson{Name: fmt.Sprint(i, "-", j), Age: int32(j)}
+				data, err := c.Marshal(want)
+				got := &thriftPerson{}
+				if err == nil {
+					err = c.Unmarshal(data, got)
+				}
+				if err != nil || !got.equal(want) {
+					t.Errorf("round trip got %+v, err:%v", got, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkThriftMarshal(b *testing.B) {
+	m := newThriftPerson()
+	b.Run("TSerializer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			trans := thrift.NewTMemoryBufferLen(1024)
+			s := &thrift.TSerializer{Transport: trans, Protocol: thrift.NewTBinaryProtocolConf(trans, &thrift.TConfiguration{})}
+			s.Write(context.Background(), m)
+		}
+	})
+	b.Run("ThriftCoder", func(b *testing.B) {
+		b.ReportAllocs()
+		c := NewThriftCoder()
+		buf := make([]byte, 0, 1024)
+		for i := 0; i < b.N; i++ {
+			c.MarshalAppend(buf, m)
+		}
+	})
+}
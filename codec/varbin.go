@@ -0,0 +1,676 @@
+package codec
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/erpc-go/erpc/utils/bufpool"
+)
+
+// DefaultVarbinMaxFrameSize UnmarshalFrom 默认读取的最大帧长度
+const DefaultVarbinMaxFrameSize = 16 << 20
+
+// VarbinCoder 变长二进制编码，无需 IDL，适用于两端均为 Go 的场景
+// 支持除 chan、func、interface 外的任意类型，编码规则:
+//
+//   - bool 1 字节，有符号整数为 zigzag varint，无符号整数为 varint，浮点数为小端定长
+//   - string 为长度前缀，slice、map 为长度+1 前缀，0 表示 nil
+//   - 指针为 1 字节的非 nil 标记，非 nil 时后跟指向的值
+//   - 数组、结构体依次编码各元素、字段，不写字段名
+//   - 实现 encoding.BinaryMarshaler 的类型(如 time.Time)为长度前缀的 MarshalBinary 结果
+//
+// 结构体只编码导出字段，按序号从小到大编码，序号默认为字段在结构体中的位置(从 1 开始)，
+// 可通过 tag `varbin:"3"` 指定序号，`varbin:"-"` 跳过该字段，序号重复时报错
+// map 的遍历顺序不固定，相同的值编码结果可能不同
+// 各类型的编解码函数在首次使用时生成并缓存，Marshal、Unmarshal 一个指针时编解码其指向的值
+type VarbinCoder struct {
+	// MaxFrameSize UnmarshalFrom 读取的最大帧长度，为 0 时使用 DefaultVarbinMaxFrameSize
+	MaxFrameSize int
+}
+
+func NewVarbinCoder() *VarbinCoder {
+	return &VarbinCoder{}
+}
+
+func (c *VarbinCoder) Marshal(v any) ([]byte, error) {
+	return c.MarshalAppend(nil, v)
+}
+
+func (c *VarbinCoder) MarshalAppend(dst []byte, v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return dst, fmt.Errorf("varbin: Marshal(nil %T)", v)
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return dst, fmt.Errorf("varbin: Marshal(nil)")
+	}
+	t, err := varbinTypeOf(rv.Type())
+	if err != nil {
+		return dst, err
+	}
+	b, err := t.enc(dst, rv)
+	if err != nil {
+		return dst, err
+	}
+	return b, nil
+}
+
+// MarshalTo 写入一帧: 长度(varint) | 数据
+func (c *VarbinCoder) MarshalTo(v any, w io.Writer) error {
+	// 预留最长的帧头，编码完成后将帧头写在数据之前
+	buf := bufpool.Get(1024)
+	b, err := c.MarshalAppend(append(buf, make([]byte, binary.MaxVarintLen64)...), v)
+	if err != nil {
+		bufpool.Put(buf)
+		return err
+	}
+	var head [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(head[:], uint64(len(b)-binary.MaxVarintLen64))
+	start := binary.MaxVarintLen64 - n
+	copy(b[start:], head[:n])
+	_, err = w.Write(b[start:])
+	bufpool.Put(b)
+	return err
+}
+
+func (c *VarbinCoder) Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("varbin: Unmarshal(non-pointer or nil %T)", v)
+	}
+	t, err := varbinTypeOf(rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+	d := varbinDecoder{b: data}
+	if err := t.dec(&d, rv.Elem()); err != nil {
+		return err
+	}
+	if len(d.b) != 0 {
+		return fmt.Errorf("varbin: %d bytes left over", len(d.b))
+	}
+	return nil
+}
+
+// UnmarshalFrom 读取一帧并解码，只读取该帧的数据，r 上的后续帧可继续读取
+func (c *VarbinCoder) UnmarshalFrom(r io.Reader, v any) error {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = &byteReader{r: r}
+	}
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	max := c.MaxFrameSize
+	if max <= 0 {
+		max = DefaultVarbinMaxFrameSize
+	}
+	if size > uint64(max) {
+		return fmt.Errorf("varbin: frame too large: %d", size)
+	}
+	buf := bufpool.Get(int(size))
+	defer bufpool.Put(buf)
+	buf = buf[:size]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return c.Unmarshal(buf, v)
+}
+
+func (c *VarbinCoder) String() string {
+	return "varbin"
+}
+
+// byteReader 逐字节读取帧头，不多读帧数据
+type byteReader struct {
+	r io.Reader
+	b [1]byte
+}
+
+func (r *byteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(r.r, r.b[:]); err != nil {
+		return 0, err
+	}
+	return r.b[0], nil
+}
+
+type (
+	varbinEncFunc func(b []byte, v reflect.Value) ([]byte, error)
+	varbinDecFunc func(d *varbinDecoder, v reflect.Value) error
+)
+
+// varbinType 类型对应的编解码函数
+// 递归类型在生成完成前即被引用，因此调用时才通过指针取 enc、dec
+type varbinType struct {
+	enc varbinEncFunc
+	dec varbinDecFunc
+}
+
+var (
+	varbinTypes sync.Map // reflect.Type -> *varbinType
+
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// varbinTypeOf 获取 t 的编解码函数，生成成功后才写入缓存，生成中途出错不影响缓存
+func varbinTypeOf(t reflect.Type) (*varbinType, error) {
+	if c, ok := varbinTypes.Load(t); ok {
+		return c.(*varbinType), nil
+	}
+	building := make(map[reflect.Type]*varbinType)
+	c, err := buildVarbin(t, building)
+	if err != nil {
+		return nil, err
+	}
+	for t, c := range building {
+		varbinTypes.LoadOrStore(t, c)
+	}
+	return c, nil
+}
+
+func buildVarbin(t reflect.Type, building map[reflect.Type]*varbinType) (*varbinType, error) {
+	if c, ok := varbinTypes.Load(t); ok {
+		return c.(*varbinType), nil
+	}
+	if c, ok := building[t]; ok {
+		return c, nil
+	}
+	c := &varbinType{}
+	building[t] = c
+	if err := c.build(t, building); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *varbinType) build(t reflect.Type, building map[reflect.Type]*varbinType) error {
+	if k := t.Kind(); k != reflect.Ptr && k != reflect.Interface && reflect.PtrTo(t).Implements(binaryUnmarshalerType) &&
+		(t.Implements(binaryMarshalerType) || reflect.PtrTo(t).Implements(binaryMarshalerType)) {
+		c.enc, c.dec = encBinaryMarshaler, decBinaryUnmarshaler
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		c.enc, c.dec = encBool, decBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		c.enc, c.dec = encInt, decInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		c.enc, c.dec = encUint, decUint
+	case reflect.Float32:
+		c.enc, c.dec = encFloat32, decFloat32
+	case reflect.Float64:
+		c.enc, c.dec = encFloat64, decFloat64
+	case reflect.Complex64:
+		c.enc, c.dec = encComplex64, decComplex64
+	case reflect.Complex128:
+		c.enc, c.dec = encComplex128, decComplex128
+	case reflect.String:
+		c.enc, c.dec = encString, decString
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			c.enc, c.dec = encBytes, decBytes
+			return nil
+		}
+		return c.buildSlice(t, building)
+	case reflect.Array:
+		return c.buildArray(t, building)
+	case reflect.Map:
+		return c.buildMap(t, building)
+	case reflect.Ptr:
+		return c.buildPtr(t, building)
+	case reflect.Struct:
+		return c.buildStruct(t, building)
+	default:
+		return fmt.Errorf("varbin: unsupported type %s", t)
+	}
+	return nil
+}
+
+func (c *varbinType) buildSlice(t reflect.Type, building map[reflect.Type]*varbinType) error {
+	elem, err := buildVarbin(t.Elem(), building)
+	if err != nil {
+		return err
+	}
+	sized := t.Elem().Size() > 0
+	c.enc = func(b []byte, v reflect.Value) (_ []byte, err error) {
+		if v.IsNil() {
+			return append(b, 0), nil
+		}
+		n := v.Len()
+		b = binary.AppendUvarint(b, uint64(n)+1)
+		for i := 0; i < n; i++ {
+			if b, err = elem.enc(b, v.Index(i)); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	}
+	c.dec = func(d *varbinDecoder, v reflect.Value) error {
+		n, isNil, err := d.length(sized)
+		if err != nil || isNil {
+			v.Set(reflect.Zero(v.Type()))
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := elem.dec(d, s.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return nil
+}
+
+func (c *varbinType) buildArray(t reflect.Type, building map[reflect.Type]*varbinType) error {
+	elem, err := buildVarbin(t.Elem(), building)
+	if err != nil {
+		return err
+	}
+	n := t.Len()
+	c.enc = func(b []byte, v reflect.Value) (_ []byte, err error) {
+		for i := 0; i < n; i++ {
+			if b, err = elem.enc(b, v.Index(i)); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	}
+	c.dec = func(d *varbinDecoder, v reflect.Value) error {
+		for i := 0; i < n; i++ {
+			if err := elem.dec(d, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+func (c *varbinType) buildMap(t reflect.Type, building map[reflect.Type]*varbinType) error {
+	key, err := buildVarbin(t.Key(), building)
+	if err != nil {
+		return err
+	}
+	elem, err := buildVarbin(t.Elem(), building)
+	if err != nil {
+		return err
+	}
+	sized := t.Key().Size()+t.Elem().Size() > 0
+	c.enc = func(b []byte, v reflect.Value) (_ []byte, err error) {
+		if v.IsNil() {
+			return append(b, 0), nil
+		}
+		b = binary.AppendUvarint(b, uint64(v.Len())+1)
+		for it := v.MapRange(); it.Next(); {
+			if b, err = key.enc(b, it.Key()); err != nil {
+				return b, err
+			}
+			if b, err = elem.enc(b, it.Value()); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	}
+	c.dec = func(d *varbinDecoder, v reflect.Value) error {
+		n, isNil, err := d.length(sized)
+		if err != nil || isNil {
+			v.Set(reflect.Zero(v.Type()))
+			return err
+		}
+		t := v.Type()
+		m := reflect.MakeMapWithSize(t, n)
+		for i := 0; i < n; i++ {
+			k, e := reflect.New(t.Key()).Elem(), reflect.New(t.Elem()).Elem()
+			if err := key.dec(d, k); err != nil {
+				return err
+			}
+			if err := elem.dec(d, e); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, e)
+		}
+		v.Set(m)
+		return nil
+	}
+	return nil
+}
+
+func (c *varbinType) buildPtr(t reflect.Type, building map[reflect.Type]*varbinType) error {
+	elem, err := buildVarbin(t.Elem(), building)
+	if err != nil {
+		return err
+	}
+	c.enc = func(b []byte, v reflect.Value) ([]byte, error) {
+		if v.IsNil() {
+			return append(b, 0), nil
+		}
+		return elem.enc(append(b, 1), v.Elem())
+	}
+	c.dec = func(d *varbinDecoder, v reflect.Value) error {
+		flag, err := d.byte()
+		if err != nil {
+			return err
+		}
+		switch flag {
+		case 0:
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		case 1:
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			return elem.dec(d, v.Elem())
+		}
+		return fmt.Errorf("varbin: invalid pointer flag %d", flag)
+	}
+	return nil
+}
+
+// varbinField 结构体字段，seq 为编码顺序
+type varbinField struct {
+	seq   int
+	index int
+	name  string
+	typ   *varbinType
+}
+
+func (c *varbinType) buildStruct(t reflect.Type, building map[reflect.Type]*varbinType) error {
+	var fields []varbinField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("varbin")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		seq := i + 1
+		if tag != "" {
+			n, err := strconv.Atoi(tag)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("varbin: invalid tag %q on %s.%s", tag, t, f.Name)
+			}
+			seq = n
+		}
+		ft, err := buildVarbin(f.Type, building)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, varbinField{seq: seq, index: i, name: f.Name, typ: ft})
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].seq < fields[j].seq })
+	for i := 1; i < len(fields); i++ {
+		if fields[i].seq == fields[i-1].seq {
+			return fmt.Errorf("varbin: %s.%s and %s.%s have the same seq %d",
+				t, fields[i-1].name, t, fields[i].name, fields[i].seq)
+		}
+	}
+
+	c.enc = func(b []byte, v reflect.Value) (_ []byte, err error) {
+		for _, f := range fields {
+			if b, err = f.typ.enc(b, v.Field(f.index)); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	}
+	c.dec = func(d *varbinDecoder, v reflect.Value) error {
+		for _, f := range fields {
+			if err := f.typ.dec(d, v.Field(f.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+func encBool(b []byte, v reflect.Value) ([]byte, error) {
+	if v.Bool() {
+		return append(b, 1), nil
+	}
+	return append(b, 0), nil
+}
+
+func decBool(d *varbinDecoder, v reflect.Value) error {
+	c, err := d.byte()
+	if err != nil {
+		return err
+	}
+	v.SetBool(c != 0)
+	return nil
+}
+
+func encInt(b []byte, v reflect.Value) ([]byte, error) {
+	return binary.AppendVarint(b, v.Int()), nil
+}
+
+func decInt(d *varbinDecoder, v reflect.Value) error {
+	x, n := binary.Varint(d.b)
+	if n <= 0 {
+		return d.varintErr(n)
+	}
+	if v.OverflowInt(x) {
+		return fmt.Errorf("varbin: %d overflows %s", x, v.Type())
+	}
+	d.b = d.b[n:]
+	v.SetInt(x)
+	return nil
+}
+
+func encUint(b []byte, v reflect.Value) ([]byte, error) {
+	return binary.AppendUvarint(b, v.Uint()), nil
+}
+
+func decUint(d *varbinDecoder, v reflect.Value) error {
+	x, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		return d.varintErr(n)
+	}
+	if v.OverflowUint(x) {
+		return fmt.Errorf("varbin: %d overflows %s", x, v.Type())
+	}
+	d.b = d.b[n:]
+	v.SetUint(x)
+	return nil
+}
+
+func encFloat32(b []byte, v reflect.Value) ([]byte, error) {
+	return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(v.Float()))), nil
+}
+
+func decFloat32(d *varbinDecoder, v reflect.Value) error {
+	p, err := d.next(4)
+	if err != nil {
+		return err
+	}
+	v.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(p))))
+	return nil
+}
+
+func encFloat64(b []byte, v reflect.Value) ([]byte, error) {
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v.Float())), nil
+}
+
+func decFloat64(d *varbinDecoder, v reflect.Value) error {
+	p, err := d.next(8)
+	if err != nil {
+		return err
+	}
+	v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(p)))
+	return nil
+}
+
+func encComplex64(b []byte, v reflect.Value) ([]byte, error) {
+	x := v.Complex()
+	b = binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(real(x))))
+	return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(imag(x)))), nil
+}
+
+func decComplex64(d *varbinDecoder, v reflect.Value) error {
+	p, err := d.next(8)
+	if err != nil {
+		return err
+	}
+	re := math.Float32frombits(binary.LittleEndian.Uint32(p))
+	im := math.Float32frombits(binary.LittleEndian.Uint32(p[4:]))
+	v.SetComplex(complex(float64(re), float64(im)))
+	return nil
+}
+
+func encComplex128(b []byte, v reflect.Value) ([]byte, error) {
+	x := v.Complex()
+	b = binary.LittleEndian.AppendUint64(b, math.Float64bits(real(x)))
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(imag(x))), nil
+}
+
+func decComplex128(d *varbinDecoder, v reflect.Value) error {
+	p, err := d.next(16)
+	if err != nil {
+		return err
+	}
+	re := math.Float64frombits(binary.LittleEndian.Uint64(p))
+	im := math.Float64frombits(binary.LittleEndian.Uint64(p[8:]))
+	v.SetComplex(complex(re, im))
+	return nil
+}
+
+func encString(b []byte, v reflect.Value) ([]byte, error) {
+	s := v.String()
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...), nil
+}
+
+func decString(d *varbinDecoder, v reflect.Value) error {
+	p, err := d.lengthBytes()
+	if err != nil {
+		return err
+	}
+	v.SetString(string(p))
+	return nil
+}
+
+func encBytes(b []byte, v reflect.Value) ([]byte, error) {
+	if v.IsNil() {
+		return append(b, 0), nil
+	}
+	p := v.Bytes()
+	b = binary.AppendUvarint(b, uint64(len(p))+1)
+	return append(b, p...), nil
+}
+
+// decBytes 复制数据，data 可能来自对象池
+func decBytes(d *varbinDecoder, v reflect.Value) error {
+	n, isNil, err := d.length(true)
+	if err != nil || isNil {
+		v.Set(reflect.Zero(v.Type()))
+		return err
+	}
+	p, _ := d.next(n)
+	s := reflect.MakeSlice(v.Type(), n, n)
+	copy(s.Bytes(), p)
+	v.Set(s)
+	return nil
+}
+
+func encBinaryMarshaler(b []byte, v reflect.Value) ([]byte, error) {
+	m, ok := v.Interface().(encoding.BinaryMarshaler)
+	if !ok {
+		// 只有指针实现了 MarshalBinary
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		m = p.Interface().(encoding.BinaryMarshaler)
+	}
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return b, err
+	}
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...), nil
+}
+
+// decBinaryUnmarshaler 复制数据，UnmarshalBinary 可能引用传入的数据
+func decBinaryUnmarshaler(d *varbinDecoder, v reflect.Value) error {
+	p, err := d.lengthBytes()
+	if err != nil {
+		return err
+	}
+	return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(append([]byte(nil), p...))
+}
+
+// varbinDecoder 解码时从 b 的头部依次读取
+type varbinDecoder struct {
+	b []byte
+}
+
+func (d *varbinDecoder) byte() (byte, error) {
+	if len(d.b) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c, nil
+}
+
+func (d *varbinDecoder) next(n int) ([]byte, error) {
+	if n > len(d.b) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	p := d.b[:n]
+	d.b = d.b[n:]
+	return p, nil
+}
+
+func (d *varbinDecoder) varintErr(n int) error {
+	if n == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("varbin: varint overflows 64 bits")
+}
+
+// lengthBytes 读取长度前缀的数据
+func (d *varbinDecoder) lengthBytes() ([]byte, error) {
+	x, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		return nil, d.varintErr(n)
+	}
+	d.b = d.b[n:]
+	if x > uint64(len(d.b)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return d.next(int(x))
+}
+
+// length 读取 slice、map 的长度+1 前缀
+// sized 为 true 时每个元素至少占 1 字节，长度超过剩余数据时直接报错，避免按伪造的长度分配内存
+func (d *varbinDecoder) length(sized bool) (n int, isNil bool, err error) {
+	x, w := binary.Uvarint(d.b)
+	if w <= 0 {
+		return 0, false, d.varintErr(w)
+	}
+	d.b = d.b[w:]
+	if x == 0 {
+		return 0, true, nil
+	}
+	x--
+	if sized && x > uint64(len(d.b)) || x > math.MaxInt32 {
+		return 0, false, io.ErrUnexpectedEOF
+	}
+	return int(x), false, nil
+}
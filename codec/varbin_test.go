@@ -0,0 +1,289 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type varbinAddress struct {
+	City string
+	Zip  [3]byte
+}
+
+type varbinUser struct {
+	Name     string
+	Age      int8
+	Score    float64
+	Ratio    float32
+	Flags    []bool
+	Tags     []string
+	Data     []byte
+	Attrs    map[string]int64
+	Addr     *varbinAddress
+	Backup   varbinAddress
+	Uids     []uint64
+	Nested   map[int32][]string
+	Created  time.Time
+	Point    complex128
+	Nil      *int
+	NilSlice []string
+	Empty    []string
+
+	Skip  string `varbin:"-"`
+	local string
+}
+
+func newVarbinUser() *varbinUser {
+	return &varbinUser{
+		Name:    "lily",
+		Age:     -18,
+		Score:   99.5,
+		Ratio:   0.25,
+		Flags:   []bool{true, false},
+		Tags:    []string{"a", "", "中文"},
+		Data:    []byte{0, 1, 2},
+		Attrs:   map[string]int64{"x": -1, "y": math.MaxInt64},
+		Addr:    &varbinAddress{City: "sz", Zip: [3]byte{5, 1, 8}},
+		Backup:  varbinAddress{City: "bj"},
+		Uids:    []uint64{0, 1, math.MaxUint64},
+		Nested:  map[int32][]string{-3: {"n"}, 4: nil},
+		Created: time.Date(2023, 5, 6, 7, 8, 9, 10, time.UTC),
+		Point:   complex(1.5, -2),
+		Empty:   []string{},
+		Skip:    "skip",
+		local:   "local",
+	}
+}
+
+// varbinNode 递归类型
+type varbinNode struct {
+	Value int
+	Next  *varbinNode
+	Kids  []varbinNode
+}
+
+func TestVarbinCoder(t *testing.T) {
+	c := NewVarbinCoder()
+	want := newVarbinUser()
+	data, err := c.Marshal(want)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	got := &varbinUser{}
+	if err := c.Unmarshal(data, got); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	want.Skip, want.local = "", ""
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v\nwant %+v", got, want)
+	}
+	if got.NilSlice != nil || got.Empty == nil {
+		t.Fatalf("nil and empty slice should be kept")
+	}
+
+	// 值与指针编码结果一致
+	p := NewPerson("lily", 18)
+	if v, _ := c.Marshal(*p); !bytes.Equal(v, mustMarshal(t, c, p)) {
+		t.Fatalf("marshal value and pointer mismatch")
+	}
+
+	list := &varbinNode{Value: 1, Next: &varbinNode{Value: 2}, Kids: []varbinNode{{Value: 3}}}
+	node := &varbinNode{}
+	if err := c.Unmarshal(mustMarshal(t, c, list), node); err != nil || !reflect.DeepEqual(node, list) {
+		t.Fatalf("recursive type got %+v, err:%v", node, err)
+	}
+
+	// 非结构体
+	var n uint16
+	if err := c.Unmarshal(mustMarshal(t, c, uint16(300)), &n); err != nil || n != 300 {
+		t.Fatalf("uint16 got %d, err:%v", n, err)
+	}
+}
+
+func mustMarshal(t *testing.T, c Codec, v any) []byte {
+	data, err := c.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal %T failed: %v", v, err)
+	}
+	return data
+}
+
+func TestVarbinEncoding(t *testing.T) {
+	c := NewVarbinCoder()
+	type small struct {
+		A int
+		B string
+		C []uint
+		D *bool
+	}
+	yes := true
+	tests := []struct {
+		v    any
+		want []byte
+	}{
+		{&small{A: -2, B: "hi"}, []byte{3, 2, 'h', 'i', 0, 0}},
+		{&small{A: 1, C: []uint{300}, D: &yes}, []byte{2, 0, 2, 0xac, 0x02, 1, 1}},
+		{[]byte{}, []byte{1}},
+		{map[string]bool{"k": true}, []byte{2, 1, 'k', 1}},
+	}
+	for _, tt := range tests {
+		if got := mustMarshal(t, c, tt.v); !bytes.Equal(got, tt.want) {
+			t.Errorf("marshal %+v got %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestVarbinTag(t *testing.T) {
+	type v1 struct {
+		Name string `varbin:"2"`
+		Age  int    `varbin:"1"`
+	}
+	type v2 struct {
+		Age   int    `varbin:"1"`
+		Email string `varbin:"3"`
+		Name  string `varbin:"2"`
+	}
+	c := NewVarbinCoder()
+	a, b := mustMarshal(t, c, &v1{Name: "lily", Age: 18}), mustMarshal(t, c, &v2{Name: "lily", Age: 18})
+	if !bytes.HasPrefix(b, a) {
+		t.Fatalf("tag order mismatch: %v %v", a, b)
+	}
+
+	type dup struct {
+		A int `varbin:"2"`
+		B int
+	}
+	type bad struct {
+		A int `varbin:"x"`
+	}
+	for _, v := range []any{&dup{}, &bad{}} {
+		if _, err := c.Marshal(v); err == nil {
+			t.Errorf("marshal %T should fail", v)
+		}
+	}
+}
+
+func TestVarbinErrors(t *testing.T) {
+	c := NewVarbinCoder()
+	type withChan struct {
+		C chan int
+	}
+	type withAny struct {
+		V any
+	}
+	for _, v := range []any{nil, (*Person)(nil), &withChan{}, &withAny{}, func() {}} {
+		if _, err := c.Marshal(v); err == nil {
+			t.Errorf("marshal %T should fail", v)
+		}
+	}
+
+	data := mustMarshal(t, c, newVarbinUser())
+	for i := 0; i < len(data); i++ {
+		if err := c.Unmarshal(data[:i], &varbinUser{}); err == nil {
+			t.Fatalf("unmarshal truncated data %d/%d should fail", i, len(data))
+		}
+	}
+	if err := c.Unmarshal(append(data, 0), &varbinUser{}); err == nil {
+		t.Fatalf("unmarshal trailing data should fail")
+	}
+	if err := c.Unmarshal(data, varbinUser{}); err == nil {
+		t.Fatalf("unmarshal non-pointer should fail")
+	}
+
+	var i8 int8
+	if err := c.Unmarshal(mustMarshal(t, c, 1000), &i8); err == nil {
+		t.Fatalf("unmarshal overflow should fail")
+	}
+	// 伪造的长度不分配内存
+	var s []int
+	if err := c.Unmarshal([]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, &s); err != io.ErrUnexpectedEOF {
+		t.Fatalf("unmarshal huge length got %v", err)
+	}
+}
+
+func TestVarbinFramed(t *testing.T) {
+	c := NewVarbinCoder()
+	var buf bytes.Buffer
+	long := &Person{Name: strings.Repeat("x", 300)}
+	for _, v := range []*Person{NewPerson("lily", 18), long} {
+		if err := c.MarshalTo(v, &buf); err != nil {
+			t.Fatalf("marshal to failed: %v", err)
+		}
+	}
+
+	// 非 io.ByteReader 同样逐帧读取
+	r := io.MultiReader(bytes.NewReader(buf.Bytes()))
+	first, second := &Person{}, &Person{}
+	if err := c.UnmarshalFrom(r, first); err != nil || !equal(first, NewPerson("lily", 18)) {
+		t.Fatalf("read first frame got %+v, err:%v", first, err)
+	}
+	if err := c.UnmarshalFrom(r, second); err != nil || !equal(second, long) {
+		t.Fatalf("read second frame got %+v, err:%v", second, err)
+	}
+	if err := c.UnmarshalFrom(r, &Person{}); err != io.EOF {
+		t.Fatalf("read after last frame got %v", err)
+	}
+
+	if err := c.UnmarshalFrom(bytes.NewReader(buf.Bytes()[:5]), &Person{}); err != io.ErrUnexpectedEOF {
+		t.Fatalf("read truncated frame got %v", err)
+	}
+	small := &VarbinCoder{MaxFrameSize: 10}
+	r = bytes.NewReader(buf.Bytes())
+	if err := small.UnmarshalFrom(r, &Person{}); err != nil {
+		t.Fatalf("read small frame failed: %v", err)
+	}
+	if err := small.UnmarshalFrom(r, &Person{}); err == nil {
+		t.Fatalf("read frame larger than max size should fail")
+	}
+}
+
+func TestVarbinConcurrent(t *testing.T) {
+	c := NewVarbinCoder()
+	type fresh struct {
+		M map[string][]*varbinAddress
+	}
+	want := &fresh{M: map[string][]*varbinAddress{"a": {{City: "sz"}, nil}}}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				data, err := c.Marshal(want)
+				got := &fresh{}
+				if err == nil {
+					err = c.Unmarshal(data, got)
+				}
+				if err != nil || !reflect.DeepEqual(got, want) {
+					t.Errorf("got %+v, err:%v", got, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkVarbinMarshal(b *testing.B) {
+	c, v := NewVarbinCoder(), NewPerson("lily", 18)
+	buf := make([]byte, 0, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, _ = c.MarshalAppend(buf[:0], v)
+	}
+}
+
+func BenchmarkVarbinUnmarshal(b *testing.B) {
+	c := NewVarbinCoder()
+	data, _ := c.Marshal(newVarbinUser())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.Unmarshal(data, &varbinUser{})
+	}
+}
@@ -1,5 +1,7 @@
 package compress
 
+import "sync"
+
 type CompressType byte
 
 const (
@@ -7,6 +9,9 @@ const (
 	Gzip
 	Zlib
 	Huffman
+	Snappy
+	Lz4
+	ZlibDict // 带预置字典的 zlib，见 DictCompressor
 )
 
 type Compressor interface {
@@ -14,6 +19,15 @@ type Compressor interface {
 	UnPack(data []byte) (res []byte, err error)
 }
 
+// Policy 压缩策略
+type Policy struct {
+	Type      CompressType // 压缩方式，None 为不主动压缩
+	Threshold int          // 编码后 body 不小于该长度才压缩
+}
+
+// Compressors 已注册的压缩方式
+//
+// Deprecated: 直接读取与注册并发时不安全，请使用 GetCompressor
 var Compressors = map[CompressType]Compressor{
 	None:    &RawCompressor{},
 	Gzip:    &GzipCompressor{},
@@ -21,11 +35,26 @@ var Compressors = map[CompressType]Compressor{
 	Huffman: &HuffmanCompressor{},
 }
 
+// compressorsMutex 保护 Compressors
+var compressorsMutex sync.RWMutex
+
 // 自定义注册编码方案
 func RegisterCompressor(t CompressType, c Compressor) {
+	compressorsMutex.Lock()
+	defer compressorsMutex.Unlock()
 	Compressors[t] = c
 }
 
 func UnRegisterCodec(t CompressType, c Compressor) {
+	compressorsMutex.Lock()
+	defer compressorsMutex.Unlock()
 	delete(Compressors, t)
 }
+
+// GetCompressor 查找已注册的压缩方式，可与注册并发调用
+func GetCompressor(t CompressType) (Compressor, bool) {
+	compressorsMutex.RLock()
+	defer compressorsMutex.RUnlock()
+	c, ok := Compressors[t]
+	return c, ok
+}
@@ -1,6 +1,9 @@
 package compress
 
 import (
+	"errors"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -91,3 +94,54 @@ func BenchmarkUnPack(b *testing.B) {
 	}
 
 }
+
+func TestStat(t *testing.T) {
+	data := []byte(strings.Repeat("compress", 64))
+	before := GetStat(Zlib)
+
+	packed, err := Pack(Zlib, data)
+	if err != nil {
+		t.Fatalf("failed to pack: %v", err)
+	}
+	if _, err := UnPack(Zlib, packed); err != nil {
+		t.Fatalf("failed to unpack: %v", err)
+	}
+	s := GetStat(Zlib)
+	if s.Packs-before.Packs != 1 || s.PackIn-before.PackIn != uint64(len(data)) || s.PackOut-before.PackOut != uint64(len(packed)) ||
+		s.UnPacks-before.UnPacks != 1 || s.UnPackOut-before.UnPackOut != uint64(len(data)) {
+		t.Fatalf("unexpected stat: %+v", s)
+	}
+	if r := s.Ratio(); r <= 0 || r >= 1 {
+		t.Fatalf("unexpected ratio: %v", r)
+	}
+
+	if _, err := Pack(200, data); !errors.Is(err, ErrNotRegistered) {
+		t.Fatalf("unregistered compressor should fail, got %v", err)
+	}
+}
+
+func TestRegisterConcurrent(t *testing.T) {
+	data := []byte(strings.Repeat("compress", 64))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				RegisterCompressor(200, &RawCompressor{})
+				UnRegisterCodec(200, nil)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := Pack(Gzip, data); err != nil {
+					t.Errorf("failed to pack: %v", err)
+					return
+				}
+				GetStat(Gzip)
+			}
+		}()
+	}
+	wg.Wait()
+}
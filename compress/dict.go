@@ -0,0 +1,356 @@
+package compress
+
+import (
+	"bytes"
+	"compress/zlib"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"io"
+	"sort"
+	"sync"
+)
+
+// MaxDictSize 预置字典的最大有效长度，即 deflate 的窗口大小，超出部分只使用末尾的 32K
+const MaxDictSize = 32 << 10
+
+// ErrDictNotFound 数据使用的预置字典未注册，包装 ErrNotRegistered，协议层按压缩方式不支持处理
+var ErrDictNotFound = fmt.Errorf("%w: dictionary not found", ErrNotRegistered)
+
+// Dictionary zlib 预置字典
+// ID 为字典内容的 adler32，与 zlib 首部的 DICTID 相同，报文中不需要另外携带
+type Dictionary struct {
+	ID   uint32
+	Data []byte
+}
+
+// NewDictionary 根据字典内容计算 ID，超过 MaxDictSize 时只保留末尾部分
+func NewDictionary(data []byte) *Dictionary {
+	if len(data) > MaxDictSize {
+		data = data[len(data)-MaxDictSize:]
+	}
+	data = append([]byte(nil), data...)
+	return &Dictionary{ID: adler32.Checksum(data), Data: data}
+}
+
+// dictionaries 字典注册表，按 ID 解压，按服务名选择压缩使用的字典
+// 服务更换字典后旧字典仍可按 ID 查找，用于解压尚未更新的对端的数据
+var dictionaries = struct {
+	sync.RWMutex
+	ids      map[uint32]*Dictionary
+	services map[string]*Dictionary
+}{
+	ids:      make(map[uint32]*Dictionary),
+	services: make(map[string]*Dictionary),
+}
+
+// RegisterDictionary 注册服务的预置字典，service 为空时只注册用于解压
+func RegisterDictionary(service string, d *Dictionary) {
+	dictionaries.Lock()
+	defer dictionaries.Unlock()
+	dictionaries.ids[d.ID] = d
+	if service != "" {
+		dictionaries.services[service] = d
+	}
+}
+
+// UnRegisterDictionary 删除字典，同时删除使用该字典的服务
+func UnRegisterDictionary(id uint32) {
+	dictionaries.Lock()
+	defer dictionaries.Unlock()
+	delete(dictionaries.ids, id)
+	for s, d := range dictionaries.services {
+		if d.ID == id {
+			delete(dictionaries.services, s)
+		}
+	}
+}
+
+// GetDictionary 按 ID 查找字典
+func GetDictionary(id uint32) (*Dictionary, bool) {
+	dictionaries.RLock()
+	defer dictionaries.RUnlock()
+	d, ok := dictionaries.ids[id]
+	return d, ok
+}
+
+// ServiceDictionary 查找服务当前使用的字典
+func ServiceDictionary(service string) (*Dictionary, bool) {
+	dictionaries.RLock()
+	defer dictionaries.RUnlock()
+	d, ok := dictionaries.services[service]
+	return d, ok
+}
+
+// SelectDictionary 选择压缩使用的字典，服务的字典在对端已有的字典 accept 中时返回其 ID，否则返回 0 即不使用字典
+func SelectDictionary(service string, accept []uint32) uint32 {
+	d, ok := ServiceDictionary(service)
+	if !ok {
+		return 0
+	}
+	for _, id := range accept {
+		if id == d.ID {
+			return id
+		}
+	}
+	return 0
+}
+
+// DictPacker 可选接口，由支持预置字典的压缩方式实现
+type DictPacker interface {
+	PackDict(data []byte, d *Dictionary) ([]byte, error)
+}
+
+// DictCompressor 带预置字典的 zlib 压缩，适用于服务名、字段名、枚举字符串大量重复的小包
+// 字典 ID 位于 zlib 首部，解压时按 ID 查找已注册的字典，不使用字典时即为普通的 zlib 数据
+// 零值使用 BestCompression 及 DefaultMaxSize，标准库 flate 在 7 级以下基本不会引用字典中的内容
+type DictCompressor struct {
+	level    int
+	hasLevel bool
+	maxSize  int64
+	writers  sync.Map // 字典 ID -> *sync.Pool，不使用字典时为 0
+	readers  sync.Pool
+}
+
+// NewDictCompressor 指定压缩等级及解压后最大长度，maxSize 为 0 时使用 DefaultMaxSize
+func NewDictCompressor(level int, maxSize int64) (*DictCompressor, error) {
+	if err := checkLevel(level); err != nil {
+		return nil, err
+	}
+	return &DictCompressor{level: level, hasLevel: true, maxSize: maxSize}, nil
+}
+
+// Pack 不使用字典压缩
+func (c *DictCompressor) Pack(data []byte) ([]byte, error) {
+	return c.PackDict(data, nil)
+}
+
+// PackDict 使用字典 d 压缩，d 为 nil 时不使用字典
+func (c *DictCompressor) PackDict(data []byte, d *Dictionary) ([]byte, error) {
+	var id uint32
+	var dict []byte
+	if d != nil {
+		id, dict = d.ID, d.Data
+	}
+	v, _ := c.writers.LoadOrStore(id, &sync.Pool{})
+	pool := v.(*sync.Pool)
+
+	var b bytes.Buffer
+	b.Grow(len(data)/2 + 64)
+	zw, ok := pool.Get().(*zlib.Writer)
+	if ok {
+		zw.Reset(&b)
+	} else {
+		level := BestCompression
+		if c.hasLevel {
+			level = c.level
+		}
+		var err error
+		if zw, err = zlib.NewWriterLevelDict(&b, level, dict); err != nil {
+			return nil, err
+		}
+	}
+	w := &pooledWriter{w: zw, pool: pool}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// UnPack 按 zlib 首部的 DICTID 查找字典后解压
+func (c *DictCompressor) UnPack(data []byte) ([]byte, error) {
+	id, hasDict, err := zlibDictID(data)
+	if err != nil {
+		return nil, err
+	}
+	var dict []byte
+	if hasDict {
+		d, ok := GetDictionary(id)
+		if !ok {
+			return nil, fmt.Errorf("%w: %08x", ErrDictNotFound, id)
+		}
+		dict = d.Data
+	}
+
+	src := bytes.NewReader(data)
+	zr, ok := c.readers.Get().(io.ReadCloser)
+	if ok {
+		if err := zr.(zlib.Resetter).Reset(src, dict); err != nil {
+			c.readers.Put(zr)
+			return nil, err
+		}
+	} else if zr, err = zlib.NewReaderDict(src, dict); err != nil {
+		return nil, err
+	}
+	r := &pooledReader{r: zr, n: maxSize(c.maxSize), pool: &c.readers}
+	defer r.Close()
+	var b bytes.Buffer
+	b.Grow(len(data) * 2)
+	if _, err := b.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// zlibDictID 解析 zlib 首部(RFC 1950)，FLG.FDICT 置位时其后 4 字节为字典的 adler32
+func zlibDictID(data []byte) (uint32, bool, error) {
+	if len(data) < 2 {
+		return 0, false, zlib.ErrHeader
+	}
+	if data[1]&0x20 == 0 {
+		return 0, false, nil
+	}
+	if len(data) < 6 {
+		return 0, false, zlib.ErrHeader
+	}
+	return binary.BigEndian.Uint32(data[2:6]), true, nil
+}
+
+// 训练字典时统计的片段长度
+const (
+	dictGramLen    = 6  // 以 6 字节片段统计出现频率
+	dictSegmentLen = 32 // 字典由若干 32 字节的片段组成
+)
+
+// TrainDictionary 从样本中训练预置字典，返回不超过 size 字节的字典内容
+// 统计在多个样本中出现的 6 字节片段，每轮从样本中选出所含高频片段最多的一段加入字典，
+// 已选中的片段不再计分；越常用的片段越靠近字典末尾，zlib 引用时距离更短
+// 样本应为真实的 RPC body，数量越多越有代表性，只在一个样本中出现的内容不会进入字典
+func TrainDictionary(samples [][]byte, size int) []byte {
+	if size > MaxDictSize {
+		size = MaxDictSize
+	}
+	if size <= 0 {
+		return nil
+	}
+	// 统计各片段出现在多少个样本中
+	freq := make(map[uint64]int)
+	seen := make(map[uint64]bool)
+	for _, s := range samples {
+		for k := range seen {
+			delete(seen, k)
+		}
+		for i := 0; i+dictGramLen <= len(s); i++ {
+			g := dictGram(s[i:])
+			if !seen[g] {
+				seen[g] = true
+				freq[g]++
+			}
+		}
+	}
+
+	// 样本的分数只会随片段被选中而降低，上次的分数是当前分数的上界，
+	// 按上次的分数从高到低重新计算，仍不低于下一个样本的上界时即为本轮最优
+	h := make(segmentHeap, 0, len(samples))
+	for _, s := range samples {
+		if seg, score := bestSegment(s, freq); score > 0 {
+			h = append(h, segment{sample: s, data: seg, score: score})
+		}
+	}
+	heap.Init(&h)
+	var segments []segment
+	total := 0
+	for total < size && len(h) > 0 {
+		top := &h[0]
+		data, score := bestSegment(top.sample, freq)
+		if score == 0 {
+			heap.Pop(&h)
+			continue
+		}
+		if score < top.score {
+			top.data, top.score = data, score
+			heap.Fix(&h, 0)
+			continue
+		}
+		for i := 0; i+dictGramLen <= len(data); i++ {
+			delete(freq, dictGram(data[i:]))
+		}
+		if n := size - total; len(data) > n {
+			data = data[len(data)-n:]
+		}
+		segments = append(segments, segment{data: data, score: score})
+		total += len(data)
+	}
+
+	// 分数高的放在末尾
+	sort.SliceStable(segments, func(i, j int) bool { return segments[i].score < segments[j].score })
+	dict := make([]byte, 0, total)
+	for _, s := range segments {
+		dict = append(dict, s.data...)
+	}
+	return dict
+}
+
+type segment struct {
+	sample []byte
+	data   []byte
+	score  int
+}
+
+// segmentHeap 按分数排序的大顶堆
+type segmentHeap []segment
+
+func (h segmentHeap) Len() int           { return len(h) }
+func (h segmentHeap) Less(i, j int) bool { return h[i].score > h[j].score }
+func (h segmentHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *segmentHeap) Push(x any)        { *h = append(*h, x.(segment)) }
+func (h *segmentHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// bestSegment 样本中所含片段分数之和最高的一段，只计出现在 2 个及以上样本中的片段
+func bestSegment(s []byte, freq map[uint64]int) ([]byte, int) {
+	grams := dictSegmentLen - dictGramLen + 1
+	if len(s) < dictSegmentLen {
+		grams = len(s) - dictGramLen + 1
+	}
+	if grams <= 0 {
+		return nil, 0
+	}
+	score := func(i int) int {
+		if f := freq[dictGram(s[i:])]; f > 1 {
+			return f
+		}
+		return 0
+	}
+	cur := 0
+	for i := 0; i < grams; i++ {
+		cur += score(i)
+	}
+	best, at := cur, 0
+	for i := grams; i+dictGramLen <= len(s); i++ {
+		cur += score(i) - score(i-grams)
+		if cur > best {
+			best, at = cur, i-grams+1
+		}
+	}
+	// 去掉首尾不计分的片段
+	end := at + grams - 1
+	for at < end && score(at) == 0 {
+		at++
+	}
+	for end > at && score(end) == 0 {
+		end--
+	}
+	return s[at : end+dictGramLen], best
+}
+
+func dictGram(b []byte) uint64 {
+	var g uint64
+	for _, c := range b[:dictGramLen] {
+		g = g<<8 | uint64(c)
+	}
+	return g
+}
+
+func init() {
+	RegisterCompressor(ZlibDict, &DictCompressor{})
+}
@@ -0,0 +1,134 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// dictSamples 模拟小而重复的 RPC body
+func dictSamples(n int) [][]byte {
+	status := []string{"STATUS_OK", "STATUS_PENDING", "STATUS_CANCELED"}
+	samples := make([][]byte, n)
+	for i := range samples {
+		samples[i] = []byte(fmt.Sprintf(`{"service":"demo.test.order.query","user_id":%d,"order_id":"o-%06d","status":"%s","region":"ap-guangzhou"}`,
+			1000+i*7, i*131, status[i%len(status)]))
+	}
+	return samples
+}
+
+func TestDictCompressor(t *testing.T) {
+	samples := dictSamples(200)
+	d := NewDictionary(TrainDictionary(samples[:100], 1024))
+	RegisterDictionary("demo.test.order", d)
+	defer UnRegisterDictionary(d.ID)
+
+	c := &DictCompressor{}
+	var plain, dict int
+	for _, s := range samples[100:] {
+		p, err := c.Pack(s)
+		if err != nil {
+			t.Fatalf("pack failed: %v", err)
+		}
+		b, err := c.PackDict(s, d)
+		if err != nil {
+			t.Fatalf("pack with dict failed: %v", err)
+		}
+		for _, data := range [][]byte{p, b} {
+			got, err := c.UnPack(data)
+			if err != nil || !bytes.Equal(got, s) {
+				t.Fatalf("unpack mismatch, err:%v", err)
+			}
+		}
+		plain += len(p)
+		dict += len(b)
+	}
+	t.Logf("plain:%d, dict:%d", plain, dict)
+	if dict*2 > plain {
+		t.Fatalf("dictionary should at least halve the size, plain:%d, dict:%d", plain, dict)
+	}
+
+	// 不使用字典时与 zlib 互通
+	p, _ := c.Pack(samples[0])
+	if got, err := (&ZlipCompressor{}).UnPack(p); err != nil || !bytes.Equal(got, samples[0]) {
+		t.Fatalf("plain data should be zlib compatible, err:%v", err)
+	}
+
+	if id := SelectDictionary("demo.test.order", []uint32{1, d.ID}); id != d.ID {
+		t.Fatalf("select dictionary got %08x", id)
+	}
+	if id := SelectDictionary("demo.test.order", []uint32{1}); id != 0 {
+		t.Fatalf("dictionary not accepted by peer, got %08x", id)
+	}
+}
+
+func TestDictNotFound(t *testing.T) {
+	d := NewDictionary([]byte(`"service":"demo.test.order.query","status":"STATUS_OK"`))
+	data, err := (&DictCompressor{}).PackDict(dictSamples(1)[0], d)
+	if err != nil {
+		t.Fatalf("pack failed: %v", err)
+	}
+	if _, err := UnPack(ZlibDict, data); !errors.Is(err, ErrDictNotFound) || !errors.Is(err, ErrNotRegistered) {
+		t.Fatalf("unpack without dictionary, got err:%v", err)
+	}
+
+	// 字典未注册时不使用字典压缩
+	data, err = PackDict(ZlibDict, d.ID, dictSamples(1)[0])
+	if err != nil {
+		t.Fatalf("pack failed: %v", err)
+	}
+	if id, ok, _ := zlibDictID(data); ok {
+		t.Fatalf("unregistered dictionary %08x should not be used", id)
+	}
+}
+
+func TestTrainDictionary(t *testing.T) {
+	if d := TrainDictionary(dictSamples(10), 0); d != nil {
+		t.Fatalf("empty dictionary expected")
+	}
+	// 只在一个样本中出现的内容不进入字典
+	if d := TrainDictionary([][]byte{[]byte("0123456789abcdef")}, 64); len(d) != 0 {
+		t.Fatalf("unexpected dictionary %q", d)
+	}
+	d := TrainDictionary(dictSamples(100), 64)
+	if len(d) != 64 || !bytes.Contains(d, []byte(`"region":"ap-guangzhou"`)) {
+		t.Fatalf("unexpected dictionary %q", d)
+	}
+	if d := TrainDictionary(dictSamples(100), 1<<20); len(d) > MaxDictSize {
+		t.Fatalf("dictionary too large: %d", len(d))
+	}
+}
+
+func TestDictConcurrent(t *testing.T) {
+	samples := dictSamples(64)
+	d := NewDictionary(TrainDictionary(samples, 512))
+	RegisterDictionary("", d)
+	defer UnRegisterDictionary(d.ID)
+
+	c := &DictCompressor{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j, s := range samples {
+				var dict *Dictionary
+				if j%2 == 0 {
+					dict = d
+				}
+				data, err := c.PackDict(s, dict)
+				if err != nil {
+					t.Errorf("pack failed: %v", err)
+					return
+				}
+				if got, err := c.UnPack(data); err != nil || !bytes.Equal(got, s) {
+					t.Errorf("unpack mismatch, err:%v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
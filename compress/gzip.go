@@ -1,37 +1,65 @@
 package compress
 
 import (
-	"bytes"
 	"compress/gzip"
 	"io"
+	"sync"
 )
 
-// Gzip 压缩算法
+// Gzip 压缩算法，编解码器通过对象池复用
+// 零值使用默认压缩等级及 DefaultMaxSize
 type GzipCompressor struct {
+	level    int
+	hasLevel bool
+	maxSize  int64 // 解压后最大长度
+	writers  sync.Pool
+	readers  sync.Pool
 }
 
-func (c *GzipCompressor) Pack(data []byte) (res []byte, err error) {
-	var b bytes.Buffer
-
-	w := gzip.NewWriter(&b)
-	if _, err = w.Write(data); err != nil {
-		return
-	}
-	if err = w.Flush(); err != nil {
-		return
-	}
-	if err = w.Close(); err != nil {
-		return
+// NewGzipCompressor 指定压缩等级及解压后最大长度，maxSize 为 0 时使用 DefaultMaxSize
+func NewGzipCompressor(level int, maxSize int64) (*GzipCompressor, error) {
+	if err := checkLevel(level); err != nil {
+		return nil, err
 	}
+	return &GzipCompressor{level: level, hasLevel: true, maxSize: maxSize}, nil
+}
+
+func (c *GzipCompressor) Pack(data []byte) ([]byte, error) {
+	return packStream(c, data)
+}
 
-	return b.Bytes(), err
+func (c *GzipCompressor) UnPack(data []byte) ([]byte, error) {
+	return unpackStream(c, data)
 }
 
-func (c *GzipCompressor) UnPack(data []byte) (res []byte, err error) {
-	r, err := gzip.NewReader(bytes.NewReader(data))
+func (c *GzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if gw, ok := c.writers.Get().(*gzip.Writer); ok {
+		gw.Reset(w)
+		return &pooledWriter{w: gw, pool: &c.writers}, nil
+	}
+	level := DefaultCompression
+	if c.hasLevel {
+		level = c.level
+	}
+	gw, err := gzip.NewWriterLevel(w, level)
 	if err != nil {
-		return
+		return nil, err
 	}
+	return &pooledWriter{w: gw, pool: &c.writers}, nil
+}
 
-	return io.ReadAll(r)
+func (c *GzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	gr, ok := c.readers.Get().(*gzip.Reader)
+	if ok {
+		if err := gr.Reset(r); err != nil {
+			c.readers.Put(gr)
+			return nil, err
+		}
+	} else {
+		var err error
+		if gr, err = gzip.NewReader(r); err != nil {
+			return nil, err
+		}
+	}
+	return &pooledReader{r: gr, n: maxSize(c.maxSize), pool: &c.readers}, nil
 }
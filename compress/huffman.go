@@ -1,13 +1,326 @@
 package compress
 
-// huffman 压缩算法
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrHuffmanCorrupt huffman 数据损坏
+var ErrHuffmanCorrupt = errors.New("corrupt huffman data")
+
+// huffman 压缩算法，范式 huffman 编码
+// 格式: 原始长度(uvarint) | 模式(1B) | 码长表 | 按位打包的编码数据
+// 模式为 stored 时直接存放原始数据，压缩后不小于原始数据时使用
+// 码长表有两种形式，取较短的一种:
+//   - dense: 最小符号(1B) | 最大符号(1B) | 区间内每个符号的码长，每个 4bit
+//   - sparse: 符号个数-1(1B) | 各符号(1B) | 各符号的码长，每个 4bit
+//
+// 编码数据低位在前，解码时一次查表得到符号及码长
 type HuffmanCompressor struct {
 }
 
+const (
+	huffmanStored byte = iota
+	huffmanDense
+	huffmanSparse
+)
+
+// 最大码长，解码表大小为 1<<huffmanMaxBits
+const huffmanMaxBits = 11
+
 func (c *HuffmanCompressor) Pack(data []byte) ([]byte, error) {
-	return data, nil
+	head := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+1), uint64(len(data)))
+	storedLen := len(head) + 1 + len(data)
+	if len(data) == 0 {
+		return append(head, huffmanStored), nil
+	}
+
+	var freq [256]int
+	for _, b := range data {
+		freq[b]++
+	}
+	lens := huffmanLengths(&freq)
+	var codes [256]uint16
+	huffmanCodes(&lens, &codes)
+
+	out := appendHuffmanTable(append(make([]byte, 0, len(data)/2+64), head...), &lens)
+	var acc uint64
+	var n uint
+	for _, b := range data {
+		acc |= uint64(codes[b]) << n
+		n += uint(lens[b])
+		if n >= 32 {
+			out = binary.LittleEndian.AppendUint32(out, uint32(acc))
+			acc >>= 32
+			n -= 32
+		}
+		if len(out) >= storedLen {
+			break
+		}
+	}
+	for i := uint(0); i < n; i += 8 {
+		out = append(out, byte(acc>>i))
+	}
+	if len(out) >= storedLen {
+		return append(append(head, huffmanStored), data...), nil
+	}
+	return out, nil
 }
 
 func (c *HuffmanCompressor) UnPack(data []byte) ([]byte, error) {
-	return data, nil
+	size, k := binary.Uvarint(data)
+	if k <= 0 || k >= len(data) {
+		return nil, ErrHuffmanCorrupt
+	}
+	data = data[k:]
+	mode := data[0]
+	data = data[1:]
+	if mode == huffmanStored {
+		if uint64(len(data)) != size {
+			return nil, ErrHuffmanCorrupt
+		}
+		return append([]byte(nil), data...), nil
+	}
+
+	var lens [256]uint8
+	data, err := readHuffmanTable(mode, data, &lens)
+	if err != nil {
+		return nil, err
+	}
+	// 每个符号至少 1bit
+	if size > uint64(len(data))*8 {
+		return nil, ErrHuffmanCorrupt
+	}
+	if size > uint64(DefaultMaxSize) {
+		return nil, ErrTooLarge
+	}
+	var table [1 << huffmanMaxBits]uint16
+	if err := huffmanTable(&lens, &table); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, size)
+	var acc uint64
+	var n uint
+	pos := 0
+	for i := range out {
+		if n < huffmanMaxBits {
+			for ; n <= 56 && pos < len(data); pos++ {
+				acc |= uint64(data[pos]) << n
+				n += 8
+			}
+		}
+		e := table[acc&(1<<huffmanMaxBits-1)]
+		l := uint(e & 0xf)
+		if l == 0 || l > n {
+			return nil, ErrHuffmanCorrupt
+		}
+		out[i] = byte(e >> 4)
+		acc >>= l
+		n -= l
+	}
+	return out, nil
+}
+
+type huffmanNode struct {
+	freq        int
+	sym         int // 叶子节点为符号，内部节点为 -1
+	left, right *huffmanNode
+}
+
+type huffmanHeap []*huffmanNode
+
+func (h huffmanHeap) Len() int { return len(h) }
+func (h huffmanHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].sym < h[j].sym
+}
+func (h huffmanHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *huffmanHeap) Push(x any)   { *h = append(*h, x.(*huffmanNode)) }
+func (h *huffmanHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// huffmanLengths 计算各符号码长，超过 huffmanMaxBits 时压平频率后重建
+func huffmanLengths(freq *[256]int) [256]uint8 {
+	f := *freq
+	for {
+		var lens [256]uint8
+		h := make(huffmanHeap, 0, 256)
+		for sym, n := range f {
+			if n > 0 {
+				h = append(h, &huffmanNode{freq: n, sym: sym})
+			}
+		}
+		if len(h) == 1 {
+			lens[h[0].sym] = 1
+			return lens
+		}
+		heap.Init(&h)
+		for h.Len() > 1 {
+			a := heap.Pop(&h).(*huffmanNode)
+			b := heap.Pop(&h).(*huffmanNode)
+			heap.Push(&h, &huffmanNode{freq: a.freq + b.freq, sym: -1, left: a, right: b})
+		}
+		if walkHuffman(h[0], 0, &lens) <= huffmanMaxBits {
+			return lens
+		}
+		for sym, n := range f {
+			if n > 0 {
+				f[sym] = n>>1 | 1
+			}
+		}
+	}
+}
+
+// walkHuffman 记录叶子节点深度，返回最大深度
+func walkHuffman(node *huffmanNode, depth int, lens *[256]uint8) int {
+	if node.sym >= 0 {
+		lens[node.sym] = uint8(depth)
+		return depth
+	}
+	l := walkHuffman(node.left, depth+1, lens)
+	if r := walkHuffman(node.right, depth+1, lens); r > l {
+		return r
+	}
+	return l
+}
+
+// huffmanCodes 按码长分配范式编码，码长相同时符号小的编码小，编码按位反转以低位在前输出
+func huffmanCodes(lens *[256]uint8, codes *[256]uint16) {
+	var count, next [huffmanMaxBits + 1]uint16
+	for _, l := range lens {
+		count[l]++
+	}
+	count[0] = 0
+	var code uint16
+	for l := 1; l <= huffmanMaxBits; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for sym, l := range lens {
+		if l == 0 {
+			continue
+		}
+		codes[sym] = reverseBits(next[l], l)
+		next[l]++
+	}
+}
+
+func reverseBits(v uint16, n uint8) uint16 {
+	var r uint16
+	for i := uint8(0); i < n; i++ {
+		r = r<<1 | v&1
+		v >>= 1
+	}
+	return r
+}
+
+// huffmanTable 构造解码表，表项为 符号<<4 | 码长，未使用的表项为 0
+func huffmanTable(lens *[256]uint8, table *[1 << huffmanMaxBits]uint16) error {
+	var codes [256]uint16
+	var kraft int
+	for _, l := range lens {
+		if l > huffmanMaxBits {
+			return ErrHuffmanCorrupt
+		}
+		if l > 0 {
+			kraft += 1 << (huffmanMaxBits - l)
+		}
+	}
+	if kraft == 0 || kraft > 1<<huffmanMaxBits {
+		return ErrHuffmanCorrupt
+	}
+	huffmanCodes(lens, &codes)
+	for sym, l := range lens {
+		if l == 0 {
+			continue
+		}
+		for i := int(codes[sym]); i < len(table); i += 1 << l {
+			table[i] = uint16(sym)<<4 | uint16(l)
+		}
+	}
+	return nil
+}
+
+// appendHuffmanTable 追加模式及码长表
+func appendHuffmanTable(b []byte, lens *[256]uint8) []byte {
+	var syms []int
+	for sym, l := range lens {
+		if l > 0 {
+			syms = append(syms, sym)
+		}
+	}
+	lo, hi := syms[0], syms[len(syms)-1]
+	if dense := 2 + (hi-lo+2)/2; dense <= 1+len(syms)+(len(syms)+1)/2 {
+		b = append(b, huffmanDense, byte(lo), byte(hi))
+		return appendNibbles(b, lens[lo:hi+1])
+	}
+	b = append(b, huffmanSparse, byte(len(syms)-1))
+	nibbles := make([]uint8, len(syms))
+	for i, sym := range syms {
+		b = append(b, byte(sym))
+		nibbles[i] = lens[sym]
+	}
+	return appendNibbles(b, nibbles)
+}
+
+func appendNibbles(b []byte, v []uint8) []byte {
+	for i := 0; i < len(v); i += 2 {
+		c := v[i]
+		if i+1 < len(v) {
+			c |= v[i+1] << 4
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// readHuffmanTable 解析码长表，返回剩余的编码数据
+func readHuffmanTable(mode byte, data []byte, lens *[256]uint8) ([]byte, error) {
+	nibble := func(p []byte, i int) uint8 {
+		return p[i/2] >> (4 * (i % 2)) & 0xf
+	}
+	switch mode {
+	case huffmanDense:
+		if len(data) < 2 || data[0] > data[1] {
+			return nil, ErrHuffmanCorrupt
+		}
+		lo, n := int(data[0]), int(data[1])-int(data[0])+1
+		data = data[2:]
+		if len(data) < (n+1)/2 {
+			return nil, ErrHuffmanCorrupt
+		}
+		for i := 0; i < n; i++ {
+			lens[lo+i] = nibble(data, i)
+		}
+		return data[(n+1)/2:], nil
+	case huffmanSparse:
+		if len(data) < 1 {
+			return nil, ErrHuffmanCorrupt
+		}
+		n := int(data[0]) + 1
+		data = data[1:]
+		if len(data) < n+(n+1)/2 {
+			return nil, ErrHuffmanCorrupt
+		}
+		syms := data[:n]
+		for i := 1; i < n; i++ {
+			if syms[i] <= syms[i-1] {
+				return nil, ErrHuffmanCorrupt
+			}
+		}
+		for i, sym := range syms {
+			lens[sym] = nibble(data[n:], i)
+		}
+		return data[n+(n+1)/2:], nil
+	default:
+		return nil, ErrHuffmanCorrupt
+	}
 }
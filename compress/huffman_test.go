@@ -0,0 +1,152 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func huffmanInputs(t testing.TB) map[string][]byte {
+	jce, err := os.ReadFile("testdata/a.jce")
+	if err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+	all := make([]byte, 256*4)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	// 斐波那契频率分布，未限制码长时最长码长远超 huffmanMaxBits
+	var fib []byte
+	for i, a, b := 0, 1, 1; i < 20; i, a, b = i+1, b, a+b {
+		fib = append(fib, bytes.Repeat([]byte{byte(i)}, a)...)
+	}
+	return map[string][]byte{
+		"empty":  {},
+		"single": {'a'},
+		"same":   bytes.Repeat([]byte{'x'}, 1000),
+		"two":    []byte("abababababbbbbbbbbbbbbbbbb"),
+		"text":   bytes.Repeat([]byte("hello huffman, canonical code lengths. "), 50),
+		"all":    all,
+		"random": random,
+		"fib":    fib,
+		"jce":    jce,
+	}
+}
+
+func TestHuffmanRoundTrip(t *testing.T) {
+	c := &HuffmanCompressor{}
+	for name, data := range huffmanInputs(t) {
+		packed, err := c.Pack(data)
+		if err != nil {
+			t.Fatalf("%s: failed to pack: %v", name, err)
+		}
+		got, err := c.UnPack(packed)
+		if err != nil {
+			t.Fatalf("%s: failed to unpack: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s: unpack data is wrong", name)
+		}
+		t.Logf("%s: %d -> %d", name, len(data), len(packed))
+	}
+
+	text := huffmanInputs(t)["text"]
+	if packed, _ := c.Pack(text); len(packed) >= len(text)*3/4 {
+		t.Fatalf("text should be compressed, %d -> %d", len(text), len(packed))
+	}
+	// 不可压缩的数据直接存放
+	random := huffmanInputs(t)["random"]
+	if packed, _ := c.Pack(random); packed[2] != huffmanStored {
+		t.Fatalf("random data should be stored")
+	}
+}
+
+func TestHuffmanLengthLimit(t *testing.T) {
+	var freq [256]int
+	for i, a, b := 0, 1, 1; i < 30; i, a, b = i+1, b, a+b {
+		freq[i] = a
+	}
+	lens := huffmanLengths(&freq)
+	var kraft int
+	for _, l := range lens {
+		if l > huffmanMaxBits {
+			t.Fatalf("code length %d exceeds %d", l, huffmanMaxBits)
+		}
+		if l > 0 {
+			kraft += 1 << (huffmanMaxBits - l)
+		}
+	}
+	if kraft != 1<<huffmanMaxBits {
+		t.Fatalf("code lengths not complete, kraft:%d", kraft)
+	}
+}
+
+func TestHuffmanCorrupt(t *testing.T) {
+	c := &HuffmanCompressor{}
+	packed, err := c.Pack(bytes.Repeat([]byte("hello huffman, canonical code lengths. "), 50))
+	if err != nil {
+		t.Fatalf("failed to pack: %v", err)
+	}
+
+	tests := map[string][]byte{
+		"empty":     {},
+		"no mode":   {5},
+		"bad mode":  {1, 9, 0},
+		"stored":    {3, huffmanStored, 'a'},
+		"dense":     {1, huffmanDense, 'b', 'a'},
+		"sparse":    {1, huffmanSparse, 1, 'b', 'a', 0x11},
+		"oversub":   {3, huffmanDense, 'a', 'c', 0x11, 0x01, 0},
+		"too large": append([]byte{0xff, 0xff, 0x03}, packed[2:]...),
+		"truncated": packed[:len(packed)-2],
+	}
+	for name, data := range tests {
+		if _, err := c.UnPack(data); !errors.Is(err, ErrHuffmanCorrupt) {
+			t.Errorf("%s: want corrupt error, got %v", name, err)
+		}
+	}
+
+	// 任意位翻转不能 panic
+	for i := 0; i < len(packed)*8; i++ {
+		data := append([]byte(nil), packed...)
+		data[i/8] ^= 1 << (i % 8)
+		c.UnPack(data)
+	}
+}
+
+func BenchmarkHuffmanPack(b *testing.B) {
+	data := huffmanInputs(b)["text"]
+	coms := map[string]Compressor{"gzip": &GzipCompressor{}, "zlib": &ZlipCompressor{}, "huffman": &HuffmanCompressor{}}
+	for name, c := range coms {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Pack(data); err != nil {
+					b.Fatalf("failed to pack: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHuffmanUnPack(b *testing.B) {
+	data := huffmanInputs(b)["text"]
+	coms := map[string]Compressor{"gzip": &GzipCompressor{}, "zlib": &ZlipCompressor{}, "huffman": &HuffmanCompressor{}}
+	for name, c := range coms {
+		packed, err := c.Pack(data)
+		if err != nil {
+			b.Fatalf("failed to pack: %v", err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := c.UnPack(packed); err != nil {
+					b.Fatalf("failed to unpack: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package compress
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// ErrLz4Corrupt lz4 数据损坏
+var ErrLz4Corrupt = errors.New("corrupt lz4 data")
+
+// lz4 block 压缩算法
+// 格式: 原始长度(4B 小端) | lz4 block，与 python-lz4 lz4.block 默认的 store_size 格式一致
+// block 由若干序列组成，每个序列为: token | 字面量长度扩展 | 字面量 | 偏移(2B 小端) | 匹配长度扩展
+// 最后一个序列只有字面量
+type Lz4Compressor struct {
+}
+
+const (
+	lz4MinMatch     = 4
+	lz4MfLimit      = 12 // 最后一个匹配须在块结尾 12 字节之前开始
+	lz4LastLiterals = 5  // 块结尾至少 5 字节为字面量
+	lz4MaxOffset    = 1<<16 - 1
+	lz4HashLog      = 14
+)
+
+// 哈希表记录位置+1，0 为空
+var lz4Tables = sync.Pool{
+	New: func() any { return new([1 << lz4HashLog]uint32) },
+}
+
+func lz4Hash(v uint32, log uint) uint32 {
+	return v * 2654435761 >> (32 - log)
+}
+
+func (c *Lz4Compressor) Pack(data []byte) ([]byte, error) {
+	n := len(data)
+	if uint64(n) > 1<<32-1 {
+		return nil, errors.New("lz4 input too large")
+	}
+	out := make([]byte, 4, 4+n+n/255+16)
+	binary.LittleEndian.PutUint32(out, uint32(n))
+	if n < lz4MfLimit+1 {
+		return lz4AppendSequence(out, data, 0, 0), nil
+	}
+
+	// 小包使用较小的哈希表，减少清理开销
+	log := uint(lz4HashLog)
+	for log > 8 && 1<<(log-2) > n {
+		log--
+	}
+	pooled := lz4Tables.Get().(*[1 << lz4HashLog]uint32)
+	table := pooled[:1<<log]
+	defer func() {
+		for i := range table {
+			table[i] = 0
+		}
+		lz4Tables.Put(pooled)
+	}()
+
+	anchor, i := 0, 0
+	limit := n - lz4MfLimit
+	for i < limit {
+		seq := binary.LittleEndian.Uint32(data[i:])
+		h := lz4Hash(seq, log)
+		ref := int(table[h]) - 1
+		table[h] = uint32(i + 1)
+		if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(data[ref:]) != seq {
+			// 长时间未匹配时加大步长
+			i += 1 + (i-anchor)>>6
+			continue
+		}
+		for i > anchor && ref > 0 && data[i-1] == data[ref-1] {
+			i--
+			ref--
+		}
+		ml := lz4MinMatch
+		for i+ml < n-lz4LastLiterals && data[i+ml] == data[ref+ml] {
+			ml++
+		}
+		out = lz4AppendSequence(out, data[anchor:i], i-ref, ml)
+		i += ml
+		anchor = i
+		// 记录匹配结尾附近的位置，提高后续匹配命中率
+		if p := i - 2; p < limit {
+			table[lz4Hash(binary.LittleEndian.Uint32(data[p:]), log)] = uint32(p + 1)
+		}
+	}
+	return lz4AppendSequence(out, data[anchor:], 0, 0), nil
+}
+
+// lz4AppendSequence 追加一个序列，offset 为 0 时为最后一个只有字面量的序列
+func lz4AppendSequence(b, literals []byte, offset, ml int) []byte {
+	lit := len(literals)
+	var token byte
+	if lit >= 15 {
+		token = 15 << 4
+	} else {
+		token = byte(lit) << 4
+	}
+	if offset > 0 {
+		if ml-lz4MinMatch >= 15 {
+			token |= 15
+		} else {
+			token |= byte(ml - lz4MinMatch)
+		}
+	}
+	b = append(b, token)
+	if lit >= 15 {
+		b = lz4AppendLen(b, lit-15)
+	}
+	b = append(b, literals...)
+	if offset == 0 {
+		return b
+	}
+	b = append(b, byte(offset), byte(offset>>8))
+	if ml-lz4MinMatch >= 15 {
+		b = lz4AppendLen(b, ml-lz4MinMatch-15)
+	}
+	return b
+}
+
+func lz4AppendLen(b []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		b = append(b, 255)
+	}
+	return append(b, byte(n))
+}
+
+func (c *Lz4Compressor) UnPack(data []byte) ([]byte, error) {
+	if len(data) < 4 {
+		return nil, ErrLz4Corrupt
+	}
+	size := int64(binary.LittleEndian.Uint32(data))
+	src := data[4:]
+	// 单个序列最多 1 字节展开为 255 字节
+	if size > int64(len(src))*255+16 {
+		return nil, ErrLz4Corrupt
+	}
+	if size > DefaultMaxSize {
+		return nil, ErrTooLarge
+	}
+	dst := make([]byte, 0, size)
+
+	readLen := func(si int, l int) (int, int, bool) {
+		if l != 15 {
+			return si, l, true
+		}
+		for si < len(src) {
+			b := src[si]
+			si++
+			l += int(b)
+			if b != 255 {
+				return si, l, true
+			}
+		}
+		return si, 0, false
+	}
+
+	si := 0
+	for si < len(src) {
+		token := src[si]
+		si++
+		var lit int
+		var ok bool
+		if si, lit, ok = readLen(si, int(token>>4)); !ok || lit > len(src)-si || int64(len(dst)+lit) > size {
+			return nil, ErrLz4Corrupt
+		}
+		dst = append(dst, src[si:si+lit]...)
+		si += lit
+		if si == len(src) {
+			break
+		}
+
+		if si+2 > len(src) {
+			return nil, ErrLz4Corrupt
+		}
+		offset := int(src[si]) | int(src[si+1])<<8
+		si += 2
+		var ml int
+		if si, ml, ok = readLen(si, int(token&15)); !ok {
+			return nil, ErrLz4Corrupt
+		}
+		ml += lz4MinMatch
+		if offset == 0 || offset > len(dst) || int64(len(dst)+ml) > size {
+			return nil, ErrLz4Corrupt
+		}
+		// 偏移小于匹配长度时源与目标重叠，已复制部分同样以 offset 为周期，每次复制长度翻倍
+		start := len(dst) - offset
+		for ml > 0 {
+			k := len(dst) - start
+			if k > ml {
+				k = ml
+			}
+			dst = append(dst, dst[start:start+k]...)
+			ml -= k
+		}
+	}
+	if int64(len(dst)) != size {
+		return nil, ErrLz4Corrupt
+	}
+	return dst, nil
+}
+
+func init() {
+	RegisterCompressor(Lz4, &Lz4Compressor{})
+}
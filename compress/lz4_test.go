@@ -0,0 +1,146 @@
+package compress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// lz4Inputs 测试及压测数据，lz4.txt 模拟文本类 RPC body
+func lz4Inputs(t testing.TB) map[string][]byte {
+	text, err := os.ReadFile("testdata/lz4.txt")
+	if err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+	random := make([]byte, 70000)
+	rand.New(rand.NewSource(1)).Read(random)
+	return map[string][]byte{
+		"empty":   {},
+		"short":   []byte("hello"),
+		"mflimit": []byte("abcdabcdabcdab"),
+		"run":     bytes.Repeat([]byte{'a'}, 100000),
+		"text":    text,
+		"random":  random,
+		"far":     append(append([]byte{}, random...), random[:1000]...),
+	}
+}
+
+func TestLz4RoundTrip(t *testing.T) {
+	c := &Lz4Compressor{}
+	for name, data := range lz4Inputs(t) {
+		packed, err := c.Pack(data)
+		if err != nil {
+			t.Fatalf("%s: failed to pack: %v", name, err)
+		}
+		got, err := c.UnPack(packed)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: unpack data is wrong, err:%v", name, err)
+		}
+		t.Logf("%s: %d -> %d", name, len(data), len(packed))
+	}
+}
+
+// TestLz4Reference 解码 lz4 命令行工具(lz4 -9 -l)生成的 block
+func TestLz4Reference(t *testing.T) {
+	text := lz4Inputs(t)["text"]
+	block, err := os.ReadFile("testdata/lz4.txt.block")
+	if err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+	data := binary.LittleEndian.AppendUint32(nil, uint32(len(text)))
+	got, err := (&Lz4Compressor{}).UnPack(append(data, block...))
+	if err != nil || !bytes.Equal(got, text) {
+		t.Fatalf("unpack reference block failed: %v", err)
+	}
+}
+
+func TestLz4Corrupt(t *testing.T) {
+	c := &Lz4Compressor{}
+	packed, _ := c.Pack(lz4Inputs(t)["text"])
+
+	tests := map[string][]byte{
+		"short":       {1, 0},
+		"size":        {9, 0, 0, 0, 0x10, 'a'},
+		"zero offset": {8, 0, 0, 0, 0x10, 'a', 0, 0},
+		"far offset":  {8, 0, 0, 0, 0x10, 'a', 2, 0},
+		"no offset":   {8, 0, 0, 0, 0x10, 'a', 1},
+		"literals":    {8, 0, 0, 0, 0xf0, 255},
+		"bomb":        {0xff, 0xff, 0xff, 0x0f, 0x1f, 'a', 1, 0, 255},
+		"truncated":   packed[:len(packed)-3],
+	}
+	for name, data := range tests {
+		if _, err := c.UnPack(data); !errors.Is(err, ErrLz4Corrupt) {
+			t.Errorf("%s: want corrupt error, got %v", name, err)
+		}
+	}
+	for i := 0; i < len(packed)*8; i += 7 {
+		data := append([]byte(nil), packed...)
+		data[i/8] ^= 1 << (i % 8)
+		c.UnPack(data)
+	}
+}
+
+func TestSnappy(t *testing.T) {
+	c := &SnappyCompressor{}
+	for name, data := range lz4Inputs(t) {
+		packed, err := c.Pack(data)
+		if err != nil {
+			t.Fatalf("%s: failed to pack: %v", name, err)
+		}
+		got, err := c.UnPack(packed)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: unpack data is wrong, err:%v", name, err)
+		}
+	}
+	// 原始长度 5 | 字面量 tag (5-1)<<2 | hello
+	if got, err := c.UnPack([]byte("\x05\x10hello")); err != nil || string(got) != "hello" {
+		t.Fatalf("unpack snappy literal failed: %q, %v", got, err)
+	}
+	if _, err := c.UnPack([]byte("\x05\x10hel")); err == nil {
+		t.Fatalf("truncated snappy data should fail")
+	}
+	if _, ok := GetCompressor(Snappy); !ok {
+		t.Fatalf("snappy not registered")
+	}
+}
+
+func BenchmarkBlockPack(b *testing.B) {
+	data := lz4Inputs(b)["text"]
+	coms := map[string]Compressor{
+		"gzip": &GzipCompressor{}, "zlib": &ZlipCompressor{}, "snappy": &SnappyCompressor{}, "lz4": &Lz4Compressor{},
+	}
+	for name, c := range coms {
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			var packed []byte
+			for i := 0; i < b.N; i++ {
+				packed, _ = c.Pack(data)
+			}
+			b.ReportMetric(float64(len(packed))/float64(len(data)), "ratio")
+		})
+	}
+}
+
+func BenchmarkBlockUnPack(b *testing.B) {
+	data := lz4Inputs(b)["text"]
+	coms := map[string]Compressor{
+		"gzip": &GzipCompressor{}, "zlib": &ZlipCompressor{}, "snappy": &SnappyCompressor{}, "lz4": &Lz4Compressor{},
+	}
+	for name, c := range coms {
+		packed, err := c.Pack(data)
+		if err != nil {
+			b.Fatalf("failed to pack: %v", err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := c.UnPack(packed); err != nil {
+					b.Fatalf("failed to unpack: %v", err)
+				}
+			}
+		})
+	}
+}
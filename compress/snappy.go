@@ -0,0 +1,29 @@
+package compress
+
+import (
+	"github.com/golang/snappy"
+)
+
+// snappy 压缩算法，snappy block 格式
+// 格式: 原始长度(uvarint) | snappy 编码数据，与 snappy 参考实现一致
+type SnappyCompressor struct {
+}
+
+func (c *SnappyCompressor) Pack(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+func (c *SnappyCompressor) UnPack(data []byte) ([]byte, error) {
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if int64(n) > DefaultMaxSize {
+		return nil, ErrTooLarge
+	}
+	return snappy.Decode(nil, data)
+}
+
+func init() {
+	RegisterCompressor(Snappy, &SnappyCompressor{})
+}
@@ -0,0 +1,117 @@
+package compress
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotRegistered 压缩方式未注册
+var ErrNotRegistered = errors.New("compressor not registered")
+
+// Stat 压缩统计，In/Out 分别为处理前后的字节数
+// 耗时为墙上时间，包含调度及阻塞的时间，不是 CPU 时间
+type Stat struct {
+	Packs          uint64        // 压缩次数
+	PackIn         uint64        // 压缩前字节数
+	PackOut        uint64        // 压缩后字节数
+	PackWallTime   time.Duration // 压缩耗时(墙上时间)
+	UnPacks        uint64        // 解压次数
+	UnPackIn       uint64        // 解压前字节数
+	UnPackOut      uint64        // 解压后字节数
+	UnPackWallTime time.Duration // 解压耗时(墙上时间)
+}
+
+// Ratio 压缩率，压缩后字节数 / 压缩前字节数，未压缩过返回 0
+func (s Stat) Ratio() float64 {
+	if s.PackIn == 0 {
+		return 0
+	}
+	return float64(s.PackOut) / float64(s.PackIn)
+}
+
+type counter struct {
+	packs, packIn, packOut, packTime         atomic.Uint64
+	unpacks, unpackIn, unpackOut, unpackTime atomic.Uint64
+}
+
+// 按压缩方式统计，CompressType 为 1 字节
+var counters [256]counter
+
+// Pack 使用已注册的压缩方式压缩并记录统计
+func Pack(t CompressType, data []byte) ([]byte, error) {
+	c, ok := GetCompressor(t)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrNotRegistered, t)
+	}
+	start := time.Now()
+	res, err := c.Pack(data)
+	if err != nil {
+		return nil, err
+	}
+	s := &counters[t]
+	s.packs.Add(1)
+	s.packIn.Add(uint64(len(data)))
+	s.packOut.Add(uint64(len(res)))
+	s.packTime.Add(uint64(time.Since(start)))
+	return res, nil
+}
+
+// PackDict 使用预置字典压缩并记录统计，压缩方式不支持字典或字典未注册时不使用字典
+func PackDict(t CompressType, dictID uint32, data []byte) ([]byte, error) {
+	c, ok := GetCompressor(t)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrNotRegistered, t)
+	}
+	p, ok := c.(DictPacker)
+	d, found := GetDictionary(dictID)
+	if !ok || !found {
+		return Pack(t, data)
+	}
+	start := time.Now()
+	res, err := p.PackDict(data, d)
+	if err != nil {
+		return nil, err
+	}
+	s := &counters[t]
+	s.packs.Add(1)
+	s.packIn.Add(uint64(len(data)))
+	s.packOut.Add(uint64(len(res)))
+	s.packTime.Add(uint64(time.Since(start)))
+	return res, nil
+}
+
+// UnPack 使用已注册的压缩方式解压并记录统计
+func UnPack(t CompressType, data []byte) ([]byte, error) {
+	c, ok := GetCompressor(t)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrNotRegistered, t)
+	}
+	start := time.Now()
+	res, err := c.UnPack(data)
+	if err != nil {
+		return nil, err
+	}
+	s := &counters[t]
+	s.unpacks.Add(1)
+	s.unpackIn.Add(uint64(len(data)))
+	s.unpackOut.Add(uint64(len(res)))
+	s.unpackTime.Add(uint64(time.Since(start)))
+	return res, nil
+}
+
+// GetStat 获取压缩方式的累计统计
+func GetStat(t CompressType) Stat {
+	s := &counters[t]
+	return Stat{
+		Packs:          s.packs.Load(),
+		PackIn:         s.packIn.Load(),
+		PackOut:        s.packOut.Load(),
+		PackWallTime:   time.Duration(s.packTime.Load()),
+		UnPacks:        s.unpacks.Load(),
+		UnPackIn:       s.unpackIn.Load(),
+		UnPackOut:      s.unpackOut.Load(),
+		UnPackWallTime: time.Duration(s.unpackTime.Load()),
+	}
+}
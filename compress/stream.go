@@ -0,0 +1,147 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// StreamCompressor 流式压缩，大包及流式 RPC 无需在内存中同时持有压缩前后的完整数据
+// Writer、Reader 关闭后编解码器归还对象池，不能再使用
+type StreamCompressor interface {
+	Compressor
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// DefaultMaxSize 未指定时解压后数据的最大长度，防止解压炸弹
+var DefaultMaxSize int64 = 64 << 20
+
+// ErrTooLarge 解压后数据超过最大长度
+var ErrTooLarge = errors.New("decompressed data too large")
+
+// 压缩等级，同 compress/flate
+const (
+	HuffmanOnly        = -2
+	DefaultCompression = -1
+	NoCompression      = 0
+	BestSpeed          = 1
+	BestCompression    = 9
+)
+
+func checkLevel(level int) error {
+	if level < HuffmanOnly || level > BestCompression {
+		return fmt.Errorf("invalid compression level: %d", level)
+	}
+	return nil
+}
+
+// resetWriter gzip.Writer、zlib.Writer 均支持 Reset 复用
+type resetWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// pooledWriter 关闭时将编码器归还对象池
+type pooledWriter struct {
+	w    resetWriter
+	pool *sync.Pool
+}
+
+func (w *pooledWriter) Write(p []byte) (int, error) {
+	if w.w == nil {
+		return 0, errors.New("write to closed compress writer")
+	}
+	return w.w.Write(p)
+}
+
+func (w *pooledWriter) Close() error {
+	if w.w == nil {
+		return nil
+	}
+	err := w.w.Close()
+	w.w.Reset(nil)
+	w.pool.Put(w.w)
+	w.w = nil
+	return err
+}
+
+// pooledReader 限制解压后的长度，关闭时将解码器归还对象池
+type pooledReader struct {
+	r    io.ReadCloser
+	n    int64 // 剩余可读长度
+	pool *sync.Pool
+}
+
+func (r *pooledReader) Read(p []byte) (int, error) {
+	if r.r == nil {
+		return 0, errors.New("read from closed compress reader")
+	}
+	if r.n <= 0 {
+		// 恰好读完时不算超长，gzip 等在读到结尾时校验 checksum
+		var b [1]byte
+		n, err := r.r.Read(b[:])
+		if n > 0 {
+			return 0, ErrTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n -= int64(n)
+	return n, err
+}
+
+func (r *pooledReader) Close() error {
+	if r.r == nil {
+		return nil
+	}
+	err := r.r.Close()
+	r.pool.Put(r.r)
+	r.r = nil
+	return err
+}
+
+func maxSize(n int64) int64 {
+	if n <= 0 {
+		return DefaultMaxSize
+	}
+	return n
+}
+
+// packStream 使用流式接口实现整块压缩
+func packStream(c StreamCompressor, data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	b.Grow(len(data)/2 + 64)
+	w, err := c.NewWriter(&b)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// unpackStream 使用流式接口实现整块解压
+func unpackStream(c StreamCompressor, data []byte) ([]byte, error) {
+	r, err := c.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var b bytes.Buffer
+	b.Grow(len(data) * 2)
+	if _, err := b.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,121 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	data := []byte(strings.Repeat("streaming compressor with pooled encoders. ", 2000))
+	for _, level := range []int{NoCompression, BestSpeed, DefaultCompression, BestCompression, HuffmanOnly} {
+		gz, err := NewGzipCompressor(level, 0)
+		if err != nil {
+			t.Fatalf("new gzip compressor failed: %v", err)
+		}
+		zl, err := NewZlibCompressor(level, 0)
+		if err != nil {
+			t.Fatalf("new zlib compressor failed: %v", err)
+		}
+		for _, c := range []StreamCompressor{gz, zl} {
+			// 多次调用以复用对象池中的编解码器
+			for i := 0; i < 3; i++ {
+				var b bytes.Buffer
+				w, err := c.NewWriter(&b)
+				if err != nil {
+					t.Fatalf("%T level %d: new writer failed: %v", c, level, err)
+				}
+				for p := data; len(p) > 0; p = p[1000:] {
+					w.Write(p[:1000])
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("%T level %d: close writer failed: %v", c, level, err)
+				}
+				r, err := c.NewReader(&b)
+				if err != nil {
+					t.Fatalf("%T level %d: new reader failed: %v", c, level, err)
+				}
+				got, err := io.ReadAll(r)
+				r.Close()
+				if err != nil || !bytes.Equal(got, data) {
+					t.Fatalf("%T level %d: unpack data is wrong, err:%v", c, level, err)
+				}
+			}
+		}
+	}
+
+	if _, err := NewGzipCompressor(10, 0); err == nil {
+		t.Fatalf("invalid level should fail")
+	}
+	if _, err := NewZlibCompressor(-3, 0); err == nil {
+		t.Fatalf("invalid level should fail")
+	}
+}
+
+func TestStreamMaxSize(t *testing.T) {
+	data := make([]byte, 1<<20)
+	gz, _ := NewGzipCompressor(BestSpeed, int64(len(data)))
+	zl, _ := NewZlibCompressor(BestSpeed, int64(len(data)-1))
+
+	packed, _ := gz.Pack(data)
+	if got, err := gz.UnPack(packed); err != nil || len(got) != len(data) {
+		t.Fatalf("data of max size should be unpacked, err:%v", err)
+	}
+	packed, _ = zl.Pack(data)
+	if _, err := zl.UnPack(packed); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("want ErrTooLarge, got %v", err)
+	}
+
+	// 超长后读取器仍可归还复用
+	if got, err := zl.UnPack(mustPack(t, zl, []byte("small"))); err != nil || string(got) != "small" {
+		t.Fatalf("unpack after too large failed: %v", err)
+	}
+}
+
+func TestStreamCorrupt(t *testing.T) {
+	for _, c := range []StreamCompressor{&GzipCompressor{}, &ZlipCompressor{}} {
+		packed := mustPack(t, c, []byte(strings.Repeat("corrupt", 100)))
+		packed[len(packed)-1] ^= 0xff
+		if _, err := c.UnPack(packed); err == nil {
+			t.Fatalf("%T: corrupt checksum should fail", c)
+		}
+		if _, err := c.UnPack([]byte("garbage")); err == nil {
+			t.Fatalf("%T: garbage should fail", c)
+		}
+	}
+}
+
+func TestStreamConcurrent(t *testing.T) {
+	c := &GzipCompressor{}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := []byte(strings.Repeat(string(rune('a'+i)), 1000))
+			for j := 0; j < 50; j++ {
+				packed, err := c.Pack(data)
+				if err != nil {
+					t.Errorf("failed to pack: %v", err)
+					return
+				}
+				if got, err := c.UnPack(packed); err != nil || !bytes.Equal(got, data) {
+					t.Errorf("unpack data is wrong, err:%v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func mustPack(t *testing.T, c Compressor, data []byte) []byte {
+	packed, err := c.Pack(data)
+	if err != nil {
+		t.Fatalf("failed to pack: %v", err)
+	}
+	return packed
+}
@@ -1,37 +1,65 @@
 package compress
 
 import (
-	"bytes"
 	"compress/zlib"
 	"io"
+	"sync"
 )
 
-// zlip 压缩算法
+// zlip 压缩算法，编解码器通过对象池复用
+// 零值使用默认压缩等级及 DefaultMaxSize
 type ZlipCompressor struct {
+	level    int
+	hasLevel bool
+	maxSize  int64 // 解压后最大长度
+	writers  sync.Pool
+	readers  sync.Pool
 }
 
-func (c *ZlipCompressor) Pack(data []byte) (res []byte, err error) {
-	var b bytes.Buffer
-
-	w := zlib.NewWriter(&b)
-	if _, err = w.Write(data); err != nil {
-		return
-	}
-	if err = w.Flush(); err != nil {
-		return
-	}
-	if err = w.Close(); err != nil {
-		return
+// NewZlibCompressor 指定压缩等级及解压后最大长度，maxSize 为 0 时使用 DefaultMaxSize
+func NewZlibCompressor(level int, maxSize int64) (*ZlipCompressor, error) {
+	if err := checkLevel(level); err != nil {
+		return nil, err
 	}
+	return &ZlipCompressor{level: level, hasLevel: true, maxSize: maxSize}, nil
+}
+
+func (c *ZlipCompressor) Pack(data []byte) ([]byte, error) {
+	return packStream(c, data)
+}
 
-	return b.Bytes(), err
+func (c *ZlipCompressor) UnPack(data []byte) ([]byte, error) {
+	return unpackStream(c, data)
 }
 
-func (c *ZlipCompressor) UnPack(data []byte) (res []byte, err error) {
-	r, err := zlib.NewReader(bytes.NewReader(data))
+func (c *ZlipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if zw, ok := c.writers.Get().(*zlib.Writer); ok {
+		zw.Reset(w)
+		return &pooledWriter{w: zw, pool: &c.writers}, nil
+	}
+	level := DefaultCompression
+	if c.hasLevel {
+		level = c.level
+	}
+	zw, err := zlib.NewWriterLevel(w, level)
 	if err != nil {
-		return
+		return nil, err
 	}
+	return &pooledWriter{w: zw, pool: &c.writers}, nil
+}
 
-	return io.ReadAll(r)
+func (c *ZlipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	zr, ok := c.readers.Get().(io.ReadCloser)
+	if ok {
+		if err := zr.(zlib.Resetter).Reset(r, nil); err != nil {
+			c.readers.Put(zr)
+			return nil, err
+		}
+	} else {
+		var err error
+		if zr, err = zlib.NewReader(r); err != nil {
+			return nil, err
+		}
+	}
+	return &pooledReader{r: zr, n: maxSize(c.maxSize), pool: &c.readers}, nil
 }
@@ -9,15 +9,17 @@ import (
 	"github.com/erpc-go/testjce2go/base"
 )
 
-func handleHello(c *server.Context) {
-	rsp := c.Rsp.(*base.AndroidRsp)
-	fmt.Println(rsp)
+func handleHello(c *server.Context, req *base.AndroidReq, rsp *base.AndroidRsp) error {
+	fmt.Println(req, rsp)
+	return nil
 }
 
 func main() {
 	log.DefaultLogger.SetLevel(log.DebugLevel)
 	erpc.GlobalServeMutex.ListenNet = "tcp"
 	erpc.GlobalServeMutex.Address = ":888"
-	erpc.HandleFunc("demo.test.hh.send", "", handleHello, (*base.AndroidReq)(nil), (*base.AndroidRsp)(nil))
-	erpc.ListenAndServe()
+	erpc.HandleTyped("demo.test.hh.send", handleHello)
+	if err := erpc.ListenAndServe(); err != nil {
+		log.Error("server exit: %v", err)
+	}
 }
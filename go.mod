@@ -9,12 +9,15 @@ require (
 	github.com/erpc-go/log v0.0.1
 	github.com/erpc-go/ratelimit v0.0.2
 	github.com/erpc-go/testjce2go v0.0.0-20231122133552-59363eba5b79
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/go-playground/assert/v2 v2.0.1
 	github.com/gogo/protobuf v1.3.2
 	github.com/golang/protobuf v1.5.3
+	github.com/golang/snappy v1.0.0
 	github.com/json-iterator/go v1.1.12
 	github.com/tinylib/msgp v1.1.9
 	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/net v0.17.0
 )
 
 require (
@@ -26,7 +29,9 @@ require (
 	github.com/tklauser/go-sysconf v0.3.12 // indirect
 	github.com/tklauser/numcpus v0.6.1 // indirect
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	github.com/yusufpapurcu/wmi v1.2.3 // indirect
 	golang.org/x/sys v0.14.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
 )
@@ -56,6 +56,11 @@ type AuthInfo struct {
 }
 
 func (a *AuthInfo) Marshal() ([]byte, error) {
+	return a.AppendMarshal(nil)
+}
+
+// AppendMarshal 序列化后追加到 dst
+func (a *AuthInfo) AppendMarshal(dst []byte) ([]byte, error) {
 	// buf总大小(first section和second section为必填)
 	firstSecLen, secondSecLen, thirdSecLen := 0, 0, 0
 	if len(a.OpenAppID) != 0 || len(a.OpenID) != 0 || len(a.Ticket) != 0 {
@@ -68,9 +73,11 @@ func (a *AuthInfo) Marshal() ([]byte, error) {
 		firstSecLen = 1
 	}
 	if firstSecLen+secondSecLen > MaxExtendLen {
-		return nil, errors.New(fmt.Sprintf("invalid length, first_len:%d, second_len:%d", firstSecLen, secondSecLen))
+		return dst, errors.New(fmt.Sprintf("invalid length, first_len:%d, second_len:%d", firstSecLen, secondSecLen))
 	}
-	buf := make([]byte, MaxExtendLen)
+	start := len(dst)
+	dst = append(dst, make([]byte, MaxExtendLen)...)
+	buf := dst[start:]
 
 	i := 0
 	// marshal section 1
@@ -139,7 +146,7 @@ func (a *AuthInfo) Marshal() ([]byte, error) {
 		}
 	}
 
-	return buf[0 : firstSecLen+secondSecLen+thirdSecLen], nil
+	return dst[:start+firstSecLen+secondSecLen+thirdSecLen], nil
 }
 
 func (a *AuthInfo) Unmarshal(buf []byte) error {
@@ -1 +1,26 @@
 package protocol
+
+import "github.com/erpc-go/erpc/codec"
+
+// body 编码方式在报文中的标识，占 1 个字节，即 codec.ID
+const (
+	CodecNone    = byte(codec.IDNone)
+	CodecBinary  = byte(codec.IDBinary)
+	CodecGob     = byte(codec.IDGob)
+	CodecJce     = byte(codec.IDJce)
+	CodecJson    = byte(codec.IDJson)
+	CodecPb      = byte(codec.IDPb)
+	CodecThrift  = byte(codec.IDThrift)
+	CodecMsgpack = byte(codec.IDMsgpack)
+
+	CodecThriftCompact = byte(codec.IDThriftCompact)
+	CodecThriftJSON    = byte(codec.IDThriftJSON)
+	CodecVarbin        = byte(codec.IDVarbin)
+	CodecCBOR          = byte(codec.IDCBOR)
+)
+
+// getCodec 根据报文中的编码标识获取对应的编码器
+func getCodec(id byte) (codec.Codec, bool) {
+	r, ok := codec.Get(codec.ID(id))
+	return r.Codec, ok
+}
@@ -0,0 +1,213 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/erpc-go/erpc/compress"
+)
+
+// 扩展首部中环境标识的 key
+const envKey = "env"
+
+// 变长首部字段 tag
+// 每个字段编码为: tag(1B) | len(uvarint) | value，整型 value 为 varint 编码
+const (
+	tagRoute byte = iota + 1
+	tagServiceName
+	tagLocalServiceName
+	tagUID
+	tagAppID
+	tagAuthInfo
+	tagResultCode
+	tagResultMsg
+	tagTraceID
+	tagSpanID
+	tagParentSpanID
+	tagFlag
+	tagExtKv          // value 为 keyLen(uvarint) | key | value
+	tagAcceptCompress // value 为可接受的压缩方式列表，每种 1 字节
+	tagAcceptDict     // value 为本端已有的预置字典 ID 列表，每个 4 字节
+)
+
+func appendField(b []byte, tag byte, v []byte) []byte {
+	b = append(b, tag)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, tag byte, s string) []byte {
+	if len(s) == 0 {
+		return b
+	}
+	b = append(b, tag)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendUvarint(b []byte, tag byte, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	var tmp [binary.MaxVarintLen64]byte
+	return appendField(b, tag, tmp[:binary.PutUvarint(tmp[:], v)])
+}
+
+func appendVarint(b []byte, tag byte, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	var tmp [binary.MaxVarintLen64]byte
+	return appendField(b, tag, tmp[:binary.PutVarint(tmp[:], v)])
+}
+
+// marshalHead 序列化变长首部，追加到 b 之后
+func (p *Package) marshalHead(b []byte) []byte {
+	b = appendString(b, tagRoute, p.route)
+	b = appendString(b, tagServiceName, p.serviceName)
+	b = appendString(b, tagLocalServiceName, p.localServiceName)
+	b = appendUvarint(b, tagUID, p.uid)
+	b = appendUvarint(b, tagAppID, uint64(p.appID))
+	b = p.appendAuthInfo(b)
+	b = appendVarint(b, tagResultCode, int64(p.resultCode))
+	b = appendString(b, tagResultMsg, p.resultMsg)
+	b = appendString(b, tagTraceID, p.traceID)
+	b = appendUvarint(b, tagSpanID, p.spanID)
+	b = appendUvarint(b, tagParentSpanID, p.parentSpanID)
+	b = appendUvarint(b, tagFlag, uint64(p.flag))
+	// 扩展 KV 及可接受的压缩方式直接追加到 b，避免分配临时切片
+	for k, v := range p.extends {
+		var tmp [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(tmp[:], uint64(len(k)))
+		b = append(b, tagExtKv)
+		b = binary.AppendUvarint(b, uint64(n+len(k)+len(v)))
+		b = append(b, tmp[:n]...)
+		b = append(b, k...)
+		b = append(b, v...)
+	}
+	if len(p.acceptCompress) > 0 {
+		b = append(b, tagAcceptCompress)
+		b = binary.AppendUvarint(b, uint64(len(p.acceptCompress)))
+		for _, t := range p.acceptCompress {
+			b = append(b, byte(t))
+		}
+	}
+	if len(p.acceptDict) > 0 {
+		b = append(b, tagAcceptDict)
+		b = binary.AppendUvarint(b, uint64(4*len(p.acceptDict)))
+		for _, id := range p.acceptDict {
+			b = binary.BigEndian.AppendUint32(b, id)
+		}
+	}
+	return b
+}
+
+// appendAuthInfo 登录态直接序列化到 b，预留 1 字节长度，超过 1 字节时后移
+func (p *Package) appendAuthInfo(b []byte) []byte {
+	start := len(b)
+	b = append(b, tagAuthInfo, 0)
+	v, err := p.authInfo.AppendMarshal(b)
+	n := len(v) - len(b)
+	if err != nil || n == 0 {
+		return b[:start]
+	}
+	var tmp [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(tmp[:], uint64(n))
+	if l > 1 {
+		v = append(v, tmp[:l-1]...)
+		copy(v[start+1+l:], v[start+2:start+2+n])
+	}
+	copy(v[start+1:], tmp[:l])
+	return v
+}
+
+// unmarshalHead 解析变长首部
+func (p *Package) unmarshalHead(b []byte) error {
+	if p.extends == nil {
+		p.extends = make(map[string]string)
+	}
+	for len(b) > 0 {
+		tag := b[0]
+		l, n := binary.Uvarint(b[1:])
+		if n <= 0 || uint64(len(b)-1-n) < l {
+			return fmt.Errorf("invalid erpc head field, tag:%d", tag)
+		}
+		v := b[1+n : 1+n+int(l)]
+		b = b[1+n+int(l):]
+
+		var err error
+		switch tag {
+		case tagRoute:
+			p.route = string(v)
+		case tagServiceName:
+			p.serviceName = string(v)
+		case tagLocalServiceName:
+			p.localServiceName = string(v)
+		case tagUID:
+			p.uid, err = uvarint(v)
+		case tagAppID:
+			var id uint64
+			id, err = uvarint(v)
+			p.appID = uint32(id)
+		case tagAuthInfo:
+			err = p.authInfo.Unmarshal(v)
+		case tagResultCode:
+			var code int64
+			code, err = varint(v)
+			p.resultCode = int32(code)
+		case tagResultMsg:
+			p.resultMsg = string(v)
+		case tagTraceID:
+			p.traceID = string(v)
+		case tagSpanID:
+			p.spanID, err = uvarint(v)
+		case tagParentSpanID:
+			p.parentSpanID, err = uvarint(v)
+		case tagFlag:
+			var flag uint64
+			flag, err = uvarint(v)
+			p.flag = uint32(flag)
+		case tagExtKv:
+			kl, kn := binary.Uvarint(v)
+			if kn <= 0 || uint64(len(v)-kn) < kl {
+				return fmt.Errorf("invalid erpc ext kv")
+			}
+			p.extends[string(v[kn:kn+int(kl)])] = string(v[kn+int(kl):])
+		case tagAcceptCompress:
+			p.acceptCompress = p.acceptCompress[:0]
+			for _, t := range v {
+				p.acceptCompress = append(p.acceptCompress, compress.CompressType(t))
+			}
+		case tagAcceptDict:
+			if len(v)%4 != 0 {
+				return fmt.Errorf("invalid erpc accept dict")
+			}
+			p.acceptDict = p.acceptDict[:0]
+			for ; len(v) > 0; v = v[4:] {
+				p.acceptDict = append(p.acceptDict, binary.BigEndian.Uint32(v))
+			}
+		default:
+			// 未知字段，兼容新版本直接跳过
+		}
+		if err != nil {
+			return fmt.Errorf("invalid erpc head field, tag:%d, err:%s", tag, err)
+		}
+	}
+	return nil
+}
+
+func uvarint(b []byte) (uint64, error) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 || n != len(b) {
+		return 0, fmt.Errorf("invalid uvarint")
+	}
+	return v, nil
+}
+
+func varint(b []byte) (int64, error) {
+	v, n := binary.Varint(b)
+	if n <= 0 || n != len(b) {
+		return 0, fmt.Errorf("invalid varint")
+	}
+	return v, nil
+}
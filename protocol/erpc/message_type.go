@@ -8,3 +8,18 @@ const (
 	MessageTypeRequest
 	MessageTypeResponse
 )
+
+func (t MessageType) String() string {
+	switch t {
+	case MessageTypeHeatBeat:
+		return "heartbeat"
+	case MessageTypeAuth:
+		return "auth"
+	case MessageTypeRequest:
+		return "request"
+	case MessageTypeResponse:
+		return "response"
+	default:
+		return "unknown"
+	}
+}
@@ -1,3 +1,493 @@
 package protocol
 
-type Package struct{}
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/erpc-go/erpc/codec"
+	"github.com/erpc-go/erpc/compress"
+	"github.com/erpc-go/erpc/protocol"
+)
+
+// Package erpc 二进制协议报文，实现 protocol.Protocol
+// 报文格式(大端序):
+// -------------------------------------------------------------------------------------------------------
+// | magic | version | type | sequence | codec | compress | headLen | bodyLen |    head     |    body     |
+// |  1B   |   1B    |  1B  |    4B    |  1B   |    1B    |   2B    |   4B    | headLen 字节 | bodyLen 字节 |
+// -------------------------------------------------------------------------------------------------------
+// head 为 tag-length-value 编码的路由、链路、返回码及扩展 KV 等字段，未知 tag 直接跳过
+type Package struct {
+	msgType  MessageType
+	sequence uint32
+	codec    byte
+	compress compress.CompressType
+	headLen  uint16
+	bodyLen  uint32
+
+	route            string
+	serviceName      string
+	localServiceName string
+	uid              uint64
+	appID            uint32
+	authInfo         protocol.AuthInfo
+	resultCode       int32
+	resultMsg        string
+	traceID          string
+	spanID           uint64
+	parentSpanID     uint64
+	flag             uint32
+	extends          map[string]string
+	acceptCompress   []compress.CompressType
+	acceptDict       []uint32
+
+	compressThreshold int    // body 编码后不小于该长度才压缩，不在报文中传输
+	compressDict      uint32 // 压缩使用的预置字典，字典 ID 位于压缩数据的首部
+}
+
+// NewPackage 创建空报文，默认为请求包
+func NewPackage() *Package {
+	return &Package{
+		msgType: MessageTypeRequest,
+		codec:   DefaultCodec,
+		extends: make(map[string]string),
+	}
+}
+
+// Check erpc 协议包完整性检查，约定同 server/net.Checker
+func Check(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if data[0] != magicNumber {
+		return 0, fmt.Errorf("invalid magic number: 0x%x", data[0])
+	}
+	if len(data) < FixedHeaderLen {
+		return 0, nil
+	}
+	if data[1] != frameVersion {
+		return 0, fmt.Errorf("unsupported frame version: %d", data[1])
+	}
+	total := FixedHeaderLen + int(binary.BigEndian.Uint16(data[9:11])) + int(binary.BigEndian.Uint32(data[11:15]))
+	if len(data) < total {
+		return 0, nil
+	}
+	return total, nil
+}
+
+// MarshalHeader 序列化定长首部及变长首部，需在 SetBodyLen 之后调用
+func (p *Package) MarshalHeader() ([]byte, error) {
+	head, err := p.appendHeader(make([]byte, 0, FixedHeaderLen+64))
+	if err != nil {
+		return nil, err
+	}
+	p.putFixedHeader(head)
+	return head, nil
+}
+
+// AppendPackage 实现 protocol.Appender，将完整报文追加到 dst
+// 变长首部不依赖 body，先预留定长首部并写入变长首部，body 原地编码后再回填定长首部
+func (p *Package) AppendPackage(dst []byte, m any) ([]byte, error) {
+	start := len(dst)
+	b, err := p.appendHeader(dst)
+	if err != nil {
+		return dst, err
+	}
+	bodyStart := len(b)
+	if b, err = p.appendBody(b, m); err != nil {
+		return dst, err
+	}
+	p.bodyLen = uint32(len(b) - bodyStart)
+	p.putFixedHeader(b[start:])
+	return b, nil
+}
+
+// appendHeader 预留定长首部并追加变长首部，定长首部由 putFixedHeader 填写
+func (p *Package) appendHeader(dst []byte) ([]byte, error) {
+	start := len(dst)
+	b := p.marshalHead(append(dst, make([]byte, FixedHeaderLen)...))
+	headLen := len(b) - start - FixedHeaderLen
+	if headLen > MaxHeadLen {
+		return dst, fmt.Errorf("erpc head too large: %d", headLen)
+	}
+	p.headLen = uint16(headLen)
+	return b, nil
+}
+
+// putFixedHeader 填写定长首部
+func (p *Package) putFixedHeader(head []byte) {
+	head[0] = magicNumber
+	head[1] = frameVersion
+	head[2] = byte(p.msgType)
+	binary.BigEndian.PutUint32(head[3:7], p.sequence)
+	head[7] = p.codec
+	head[8] = byte(p.compress)
+	binary.BigEndian.PutUint16(head[9:11], p.headLen)
+	binary.BigEndian.PutUint32(head[11:15], p.bodyLen)
+}
+
+// UnmarshalHeader 解析首部，data 为完整报文
+// 请求包解析完成后，同一个 Package 将直接用于回包，报文类型置为响应
+func (p *Package) UnmarshalHeader(data []byte) error {
+	if len(data) < FixedHeaderLen {
+		return fmt.Errorf("erpc header too short: %d", len(data))
+	}
+	if data[0] != magicNumber {
+		return fmt.Errorf("invalid magic number: 0x%x", data[0])
+	}
+	if data[1] != frameVersion {
+		return fmt.Errorf("unsupported frame version: %d", data[1])
+	}
+
+	p.msgType = MessageType(data[2])
+	p.sequence = binary.BigEndian.Uint32(data[3:7])
+	p.codec = data[7]
+	p.compress = compress.CompressType(data[8])
+	p.headLen = binary.BigEndian.Uint16(data[9:11])
+	p.bodyLen = binary.BigEndian.Uint32(data[11:15])
+
+	end := FixedHeaderLen + int(p.headLen)
+	if len(data) < end {
+		return fmt.Errorf("erpc head incomplete, want %d, got %d", end, len(data))
+	}
+	if err := p.unmarshalHead(data[FixedHeaderLen:end]); err != nil {
+		return err
+	}
+
+	if p.msgType == MessageTypeRequest {
+		p.msgType = MessageTypeResponse
+	}
+	return nil
+}
+
+// MarshalBody 按首部中的编码方式序列化 body
+func (p *Package) MarshalBody(m any) ([]byte, error) {
+	return p.appendBody(nil, m)
+}
+
+// appendBody 将 body 编码后追加到 dst，需要压缩时以压缩后的数据替换
+func (p *Package) appendBody(dst []byte, m any) ([]byte, error) {
+	if protocol.IsNil(m) {
+		return dst, nil
+	}
+	c, ok := getCodec(p.codec)
+	if !ok {
+		return dst, fmt.Errorf("%w: %d", protocol.ErrUnknownCodec, p.codec)
+	}
+	start := len(dst)
+	buf, err := codec.MarshalAppend(c, dst, m)
+	if err != nil {
+		return dst, err
+	}
+	if p.compress == compress.None {
+		return buf, nil
+	}
+	if len(buf)-start < p.compressThreshold {
+		p.compress = compress.None
+		return buf, nil
+	}
+	packed, err := compress.PackDict(p.compress, p.compressDict, buf[start:])
+	if errors.Is(err, compress.ErrNotRegistered) {
+		return dst, fmt.Errorf("%w: %d", protocol.ErrUnknownCompress, p.compress)
+	}
+	if err != nil {
+		return dst, err
+	}
+	return append(buf[:start], packed...), nil
+}
+
+// UnmarshalBody 按首部中的编码方式反序列化 body，data 为完整报文
+func (p *Package) UnmarshalBody(data []byte, m any) error {
+	if protocol.IsNil(m) {
+		return nil
+	}
+	c, ok := getCodec(p.codec)
+	if !ok {
+		return fmt.Errorf("%w: %d", protocol.ErrUnknownCodec, p.codec)
+	}
+	if p.bodyLen == 0 {
+		return nil
+	}
+	begin := FixedHeaderLen + int(p.headLen)
+	end := begin + int(p.bodyLen)
+	if len(data) < end {
+		return fmt.Errorf("erpc body incomplete, want %d, got %d", end, len(data))
+	}
+	body := data[begin:end]
+	if p.compress != compress.None {
+		var err error
+		if body, err = compress.UnPack(p.compress, body); err != nil {
+			if errors.Is(err, compress.ErrNotRegistered) {
+				return fmt.Errorf("%w: %d", protocol.ErrUnknownCompress, p.compress)
+			}
+			return err
+		}
+	}
+	return c.Unmarshal(body, m)
+}
+
+// Clone 深复制
+func (p *Package) Clone() protocol.Protocol {
+	newer := *p
+	newer.extends = make(map[string]string, len(p.extends))
+	for k, v := range p.extends {
+		newer.extends[k] = v
+	}
+	newer.acceptCompress = append([]compress.CompressType(nil), p.acceptCompress...)
+	newer.acceptDict = append([]uint32(nil), p.acceptDict...)
+	return &newer
+}
+
+// CloneEmpty 创建同协议的空报文
+func (p *Package) CloneEmpty() protocol.Protocol {
+	return NewPackage()
+}
+
+// Reset 重置为空报文，保留 extends 已分配的空间
+func (p *Package) Reset() {
+	extends := p.extends
+	for k := range extends {
+		delete(extends, k)
+	}
+	accept, dicts := p.acceptCompress[:0], p.acceptDict[:0]
+	*p = Package{
+		msgType: MessageTypeRequest,
+		codec:   DefaultCodec,
+		extends: extends,
+
+		acceptCompress: accept,
+		acceptDict:     dicts,
+	}
+	if p.extends == nil {
+		p.extends = make(map[string]string)
+	}
+}
+
+// GetCmdPattern 获取路由
+func (p *Package) GetCmdPattern() string {
+	return p.route
+}
+
+// SetCmdPattern 设置路由
+func (p *Package) SetCmdPattern(route string) {
+	p.route = route
+}
+
+// GetUid 获取Uid
+func (p *Package) GetUid() uint64 {
+	return p.uid
+}
+
+// SetUid 设置Uid
+func (p *Package) SetUid(uid uint64) {
+	p.uid = uid
+}
+
+// GetAppID 获取App ID
+func (p *Package) GetAppID() uint32 {
+	return p.appID
+}
+
+// SetAppID 设置App ID
+func (p *Package) SetAppID(id uint32) {
+	p.appID = id
+}
+
+// GetAuthInfo 获取AuthInfo
+func (p *Package) GetAuthInfo() protocol.AuthInfo {
+	return p.authInfo
+}
+
+// SetAuthInfo 设置AuthInfo
+func (p *Package) SetAuthInfo(a *protocol.AuthInfo) {
+	if a == nil {
+		p.authInfo = protocol.AuthInfo{}
+		return
+	}
+	p.authInfo = *a
+}
+
+// GetResultCode 获取业务错误码
+func (p *Package) GetResultCode() int32 {
+	return p.resultCode
+}
+
+// SetResultCode 设置业务错误码
+func (p *Package) SetResultCode(code int32) {
+	p.resultCode = code
+}
+
+// GetResultMsg 获取业务错误信息
+func (p *Package) GetResultMsg() string {
+	return p.resultMsg
+}
+
+// SetResultMsg 设置业务错误信息
+func (p *Package) SetResultMsg(msg string) {
+	p.resultMsg = msg
+}
+
+// GetLocalServiceName 获取主调服务名
+func (p *Package) GetLocalServiceName() string {
+	return p.localServiceName
+}
+
+// SetLocalServiceName 设置主调服务名
+func (p *Package) SetLocalServiceName(name string) {
+	p.localServiceName = name
+}
+
+// GetServiceName 获取被调服务名
+func (p *Package) GetServiceName() string {
+	return p.serviceName
+}
+
+// SetServiceName 设置被调服务名
+func (p *Package) SetServiceName(name string) {
+	p.serviceName = name
+}
+
+// GetProtoType 获取 body 编码方式
+func (p *Package) GetProtoType() uint8 {
+	return p.codec
+}
+
+// SetProtoType 设置 body 编码方式
+func (p *Package) SetProtoType(v uint8) {
+	p.codec = v
+}
+
+// GetTraceID 获取TraceID
+func (p *Package) GetTraceID() string {
+	return p.traceID
+}
+
+// SetTraceID 设置TraceID
+func (p *Package) SetTraceID(v string) {
+	p.traceID = v
+}
+
+// GetSpanID 获取Span ID
+func (p *Package) GetSpanID() uint64 {
+	return p.spanID
+}
+
+// SetSpanID 设置Span ID
+func (p *Package) SetSpanID(v uint64) {
+	p.spanID = v
+}
+
+// GetParentSpanID 获取Parent Span ID
+func (p *Package) GetParentSpanID() uint64 {
+	return p.parentSpanID
+}
+
+// SetParentSpanID 设置Parent Span ID
+func (p *Package) SetParentSpanID(v uint64) {
+	p.parentSpanID = v
+}
+
+// GetFlag 获取染色标志
+func (p *Package) GetFlag() uint32 {
+	return p.flag
+}
+
+// SetFlag 设置染色标志
+func (p *Package) SetFlag(v uint32) {
+	p.flag = v
+}
+
+// GetEnv 获取环境标识
+func (p *Package) GetEnv() string {
+	return p.extends[envKey]
+}
+
+// GetExtKv 获取扩展首部
+func (p *Package) GetExtKv(k string) (string, bool) {
+	v, ok := p.extends[k]
+	return v, ok
+}
+
+// SetExtKv 设置扩展首部
+func (p *Package) SetExtKv(k string, v string) bool {
+	if p.extends == nil {
+		p.extends = make(map[string]string)
+	}
+	p.extends[k] = v
+	return true
+}
+
+// GetExtends 获取所有扩展首部
+func (p *Package) GetExtends() map[string]string {
+	return p.extends
+}
+
+// SetBodyLen 设置 body 长度
+func (p *Package) SetBodyLen(l uint32) {
+	p.bodyLen = l
+}
+
+// GetBodyLen 获取 body 长度
+func (p *Package) GetBodyLen() uint32 {
+	return p.bodyLen
+}
+
+// GetMessageType 获取报文类型
+func (p *Package) GetMessageType() MessageType {
+	return p.msgType
+}
+
+// SetMessageType 设置报文类型
+func (p *Package) SetMessageType(t MessageType) {
+	p.msgType = t
+}
+
+// GetSequence 获取报文序列号
+func (p *Package) GetSequence() uint32 {
+	return p.sequence
+}
+
+// SetSequence 设置报文序列号
+func (p *Package) SetSequence(s uint32) {
+	p.sequence = s
+}
+
+// GetCompress 获取 body 压缩方式
+func (p *Package) GetCompress() compress.CompressType {
+	return p.compress
+}
+
+// SetCompress 设置 body 压缩方式
+func (p *Package) SetCompress(t compress.CompressType) {
+	p.compress = t
+}
+
+// GetAcceptCompress 获取对端可接受的回包压缩方式
+func (p *Package) GetAcceptCompress() []compress.CompressType {
+	return p.acceptCompress
+}
+
+// SetAcceptCompress 设置可接受的回包压缩方式
+func (p *Package) SetAcceptCompress(t ...compress.CompressType) {
+	p.acceptCompress = append(p.acceptCompress[:0], t...)
+}
+
+// SetCompressThreshold 设置压缩阈值，body 编码后小于该长度时不压缩
+func (p *Package) SetCompressThreshold(n int) {
+	p.compressThreshold = n
+}
+
+// SetCompressDict 设置压缩使用的预置字典，0 为不使用字典
+func (p *Package) SetCompressDict(id uint32) {
+	p.compressDict = id
+}
+
+// GetAcceptDict 获取对端已有的预置字典
+func (p *Package) GetAcceptDict() []uint32 {
+	return p.acceptDict
+}
+
+// SetAcceptDict 设置本端已有的预置字典，对端据此选择压缩使用的字典
+func (p *Package) SetAcceptDict(ids ...uint32) {
+	p.acceptDict = append(p.acceptDict[:0], ids...)
+}
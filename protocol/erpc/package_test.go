@@ -0,0 +1,242 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/erpc-go/erpc/compress"
+	"github.com/erpc-go/erpc/protocol"
+)
+
+func TestCheck(t *testing.T) {
+	data := marshalPackage(t, NewRequest("demo.test.hh.send"), &testMessage{data: []byte("hello")})
+
+	// 分包
+	for i := 0; i < len(data); i++ {
+		if n, err := Check(data[:i]); n != 0 || err != nil {
+			t.Fatalf("partial packet %d, got n:%d, err:%v", i, n, err)
+		}
+	}
+
+	// 粘包
+	stick := append(append([]byte{}, data...), data[:5]...)
+	if n, err := Check(stick); n != len(data) || err != nil {
+		t.Fatalf("stick packet, got n:%d, err:%v", n, err)
+	}
+
+	// 非法包
+	if _, err := Check([]byte("GET / HTTP/1.1\r\n")); err == nil {
+		t.Fatalf("invalid magic should fail")
+	}
+}
+
+func TestUnmarshalHeaderSkipUnknownTag(t *testing.T) {
+	p := NewRequest("demo.test.hh.send")
+	data := marshalPackage(t, p, nil)
+
+	// 在变长首部末尾追加一个未知字段
+	head := appendString(nil, 0xff, "future")
+	data = append(data, head...)
+	data[10] += byte(len(head))
+
+	got := NewPackage()
+	if err := got.UnmarshalHeader(data); err != nil {
+		t.Fatalf("unknown tag should be skipped, err:%v", err)
+	}
+	if got.GetCmdPattern() != "demo.test.hh.send" {
+		t.Fatalf("route mismatch, got %s", got.GetCmdPattern())
+	}
+}
+
+func TestUnknownCodec(t *testing.T) {
+	p := NewRequest("demo.test.hh.send")
+	p.SetProtoType(200)
+	if _, err := p.MarshalBody(&testMessage{}); !errors.Is(err, protocol.ErrUnknownCodec) {
+		t.Fatalf("marshal with unknown codec, got err:%v", err)
+	}
+	data := marshalPackage(t, NewRequest("demo.test.hh.send"), nil)
+	data[7] = 200
+
+	got := NewPackage()
+	if err := got.UnmarshalHeader(data); err != nil {
+		t.Fatalf("unmarshal header failed: %v", err)
+	}
+	if err := got.UnmarshalBody(data, &testMessage{}); !errors.Is(err, protocol.ErrUnknownCodec) {
+		t.Fatalf("unmarshal with unknown codec, got err:%v", err)
+	}
+}
+
+func TestCompressBody(t *testing.T) {
+	body := &testMessage{data: bytes.Repeat([]byte("hello"), 100)}
+
+	// 未达到阈值不压缩
+	p := NewRequest("demo.test.hh.send")
+	p.SetCompress(compress.Gzip)
+	p.SetCompressThreshold(len(body.data) + 1)
+	p.SetAcceptCompress(compress.Gzip, compress.Zlib)
+	if data := marshalPackage(t, p, body); p.GetCompress() != compress.None || data[8] != byte(compress.None) {
+		t.Fatalf("body below threshold should not be compressed")
+	}
+
+	p.SetCompress(compress.Gzip)
+	p.SetCompressThreshold(len(body.data))
+	data := marshalPackage(t, p, body)
+	if int(p.GetBodyLen()) >= len(body.data) {
+		t.Fatalf("body not compressed, len:%d", p.GetBodyLen())
+	}
+
+	got := NewPackage()
+	if err := got.UnmarshalHeader(data); err != nil {
+		t.Fatalf("unmarshal header failed: %v", err)
+	}
+	rsp := &testMessage{}
+	if err := got.UnmarshalBody(data, rsp); err != nil || !bytes.Equal(rsp.data, body.data) {
+		t.Fatalf("unmarshal compressed body failed: %v", err)
+	}
+	if accept := got.GetAcceptCompress(); len(accept) != 2 || accept[0] != compress.Gzip || accept[1] != compress.Zlib {
+		t.Fatalf("accept compress mismatch, got %v", accept)
+	}
+
+	// 压缩方式未注册
+	p.SetCompress(200)
+	if _, err := p.MarshalBody(body); !errors.Is(err, protocol.ErrUnknownCompress) {
+		t.Fatalf("marshal with unknown compress, got err:%v", err)
+	}
+	data[8] = 200
+	if err := got.UnmarshalHeader(data); err != nil {
+		t.Fatalf("unmarshal header failed: %v", err)
+	}
+	if err := got.UnmarshalBody(data, rsp); !errors.Is(err, protocol.ErrUnknownCompress) {
+		t.Fatalf("unmarshal with unknown compress, got err:%v", err)
+	}
+}
+
+func TestCompressDict(t *testing.T) {
+	body := &testMessage{data: []byte(`{"service":"demo.test.hh.send","status":"STATUS_OK"}`)}
+	d := compress.NewDictionary(body.data)
+	compress.RegisterDictionary("", d)
+
+	p := NewRequest("demo.test.hh.send")
+	p.SetCompress(compress.ZlibDict)
+	p.SetCompressDict(d.ID)
+	p.SetAcceptDict(d.ID, 7)
+	data := marshalPackage(t, p, body)
+
+	got := NewPackage()
+	if err := got.UnmarshalHeader(data); err != nil {
+		t.Fatalf("unmarshal header failed: %v", err)
+	}
+	if accept := got.GetAcceptDict(); len(accept) != 2 || accept[0] != d.ID || accept[1] != 7 {
+		t.Fatalf("accept dict mismatch, got %v", accept)
+	}
+	rsp := &testMessage{}
+	if err := got.UnmarshalBody(data, rsp); err != nil || !bytes.Equal(rsp.data, body.data) {
+		t.Fatalf("unmarshal body with dict failed: %v", err)
+	}
+	if c := got.Clone().(*Package); len(c.GetAcceptDict()) != 2 {
+		t.Fatalf("clone should copy accept dict")
+	}
+	got.Reset()
+	if len(got.GetAcceptDict()) != 0 {
+		t.Fatalf("reset should clear accept dict")
+	}
+
+	// 对端没有该字典
+	compress.UnRegisterDictionary(d.ID)
+	if err := got.UnmarshalHeader(data); err != nil {
+		t.Fatalf("unmarshal header failed: %v", err)
+	}
+	if err := got.UnmarshalBody(data, rsp); !errors.Is(err, protocol.ErrUnknownCompress) {
+		t.Fatalf("unmarshal without dict, got err:%v", err)
+	}
+}
+
+func TestAppendPackage(t *testing.T) {
+	body := &testMessage{data: bytes.Repeat([]byte("hello"), 100)}
+	for _, c := range []compress.CompressType{compress.None, compress.Gzip} {
+		p := NewRequest("demo.test.hh.send")
+		p.SetExtKv("k", "v")
+		p.SetCompress(c)
+		p.SetAcceptCompress(compress.Gzip)
+		want := marshalPackage(t, p, body)
+
+		p.SetCompress(c)
+		prefix := []byte("prefix")
+		dst := append(make([]byte, 0, 2048), prefix...)
+		got, err := p.AppendPackage(dst, body)
+		if err != nil {
+			t.Fatalf("append package failed: %v", err)
+		}
+		if !bytes.Equal(got[:len(prefix)], prefix) || !bytes.Equal(got[len(prefix):], want) {
+			t.Fatalf("compress %d: append package mismatch\ngot  %q\nwant %q", c, got[len(prefix):], want)
+		}
+		if &got[0] != &dst[0] {
+			t.Fatalf("append package reallocated with enough capacity")
+		}
+		if n, err := Check(got[len(prefix):]); err != nil || n != len(want) {
+			t.Fatalf("check appended package, n:%d, err:%v", n, err)
+		}
+	}
+
+	// 出错时返回原 dst
+	p := NewRequest("demo.test.hh.send")
+	p.SetProtoType(200)
+	dst := []byte("prefix")
+	if got, err := p.AppendPackage(dst, body); !errors.Is(err, protocol.ErrUnknownCodec) || !bytes.Equal(got, dst) {
+		t.Fatalf("append with unknown codec, got %q, err:%v", got, err)
+	}
+}
+
+func BenchmarkMarshalPackage(b *testing.B) {
+	body := &testMessage{data: bytes.Repeat([]byte("hello"), 20)}
+	p := NewRequest("demo.test.hh.send")
+	p.SetExtKv("k", "v")
+	b.Run("MarshalHeader", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			bodyBuf, _ := p.MarshalBody(body)
+			p.SetBodyLen(uint32(len(bodyBuf)))
+			head, _ := p.MarshalHeader()
+			pkg := make([]byte, len(head)+len(bodyBuf))
+			copy(pkg, head)
+			copy(pkg[len(head):], bodyBuf)
+		}
+	})
+	b.Run("AppendPackage", func(b *testing.B) {
+		b.ReportAllocs()
+		buf := make([]byte, 0, 4096)
+		for i := 0; i < b.N; i++ {
+			p.AppendPackage(buf, body)
+		}
+	})
+}
+
+func TestAuthInfoHead(t *testing.T) {
+	// 登录态序列化后长度分别占 1、2 字节
+	for _, n := range []int{10, 200} {
+		auth := protocol.AuthInfo{
+			OpenID:     "openid",
+			Ticket:     string(bytes.Repeat([]byte("t"), n)),
+			TraceID:    "trace",
+			CallerInfo: "caller",
+		}
+		p := NewRequest("demo.test.hh.send")
+		p.SetAuthInfo(&auth)
+		data := marshalPackage(t, p, &testMessage{data: []byte("hi")})
+
+		got := NewPackage()
+		if err := got.UnmarshalHeader(data); err != nil {
+			t.Fatalf("unmarshal header failed: %v", err)
+		}
+		a := got.GetAuthInfo()
+		if a.OpenID != auth.OpenID || a.Ticket != auth.Ticket || a.TraceID != auth.TraceID ||
+			a.CallerInfo != auth.CallerInfo || got.GetCmdPattern() != "demo.test.hh.send" {
+			t.Fatalf("auth info mismatch, got %+v", a)
+		}
+		rsp := &testMessage{}
+		if err := got.UnmarshalBody(data, rsp); err != nil || string(rsp.data) != "hi" {
+			t.Fatalf("unmarshal body failed: %v", err)
+		}
+	}
+}
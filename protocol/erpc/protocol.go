@@ -1,12 +1,28 @@
 package protocol
 
-import "github.com/erpc-go/erpc/codec"
+import "github.com/erpc-go/erpc/protocol"
 
 const (
-	defaultMagic = 0x3bef5c
+	// 定长首部长度
+	// magic(1) + version(1) + type(1) + sequence(4) + codec(1) + compress(1) + headLen(2) + bodyLen(4)
+	FixedHeaderLen = 15
+
+	// 变长首部最大长度
+	MaxHeadLen = 1<<16 - 1
 )
 
 var (
-	DefaultBodyCodec codec.Codec = codec.Codecs[codec.CodeTypePb]
-	DefaultCodec     codec.Codec = codec.Codecs[codec.CodeTypeGob]
+	// 默认 body 编码方式
+	DefaultCodec = CodecJce
 )
+
+func init() {
+	protocol.RegisterProtocol(protocol.ProtocolErpc, protocol.Registration{
+		Name:     "erpc",
+		Detector: protocol.MagicDetector(magicNumber),
+		Checker:  protocol.CheckerFunc(Check),
+		New: func() protocol.Protocol {
+			return NewPackage()
+		},
+	})
+}
@@ -1,8 +1,71 @@
 package protocol
 
 import (
+	"bytes"
+	"io"
 	"testing"
 )
 
+// testMessage 测试用 body，直接读写原始字节
+type testMessage struct {
+	data []byte
+}
+
+func (m *testMessage) ReadFrom(r io.Reader) (int64, error) {
+	b, err := io.ReadAll(r)
+	m.data = b
+	return int64(len(b)), err
+}
+
+func (m *testMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(m.data)
+	return int64(n), err
+}
+
+func marshalPackage(t *testing.T, p *Package, body *testMessage) []byte {
+	b, err := p.MarshalBody(body)
+	if err != nil {
+		t.Fatalf("marshal body failed: %v", err)
+	}
+	p.SetBodyLen(uint32(len(b)))
+	h, err := p.MarshalHeader()
+	if err != nil {
+		t.Fatalf("marshal header failed: %v", err)
+	}
+	return append(h, b...)
+}
+
 func TestNewRequest(t *testing.T) {
+	req := NewRequest("demo.test.hh.send")
+	req.SetTraceID("trace-1")
+	req.SetSpanID(7)
+	req.SetUid(10086)
+	req.SetExtKv("env", "test")
+	data := marshalPackage(t, req, &testMessage{data: []byte("hello")})
+
+	n, err := Check(data)
+	if err != nil || n != len(data) {
+		t.Fatalf("check failed, n:%d, len:%d, err:%v", n, len(data), err)
+	}
+
+	got := NewPackage()
+	if err := got.UnmarshalHeader(data); err != nil {
+		t.Fatalf("unmarshal header failed: %v", err)
+	}
+	body := &testMessage{}
+	if err := got.UnmarshalBody(data, body); err != nil {
+		t.Fatalf("unmarshal body failed: %v", err)
+	}
+
+	if got.GetCmdPattern() != "demo.test.hh.send" || got.GetTraceID() != "trace-1" ||
+		got.GetSpanID() != 7 || got.GetUid() != 10086 || got.GetEnv() != "test" ||
+		got.GetSequence() != req.GetSequence() {
+		t.Fatalf("header mismatch, got %+v, want %+v", got, req)
+	}
+	if !bytes.Equal(body.data, []byte("hello")) {
+		t.Fatalf("body mismatch, got %q", body.data)
+	}
+	if got.GetMessageType() != MessageTypeResponse {
+		t.Fatalf("decoded request should reply as response, got %s", got.GetMessageType())
+	}
 }
@@ -5,4 +5,18 @@ import (
 )
 
 func TestNewResponse(t *testing.T) {
+	req := NewRequest("demo.test.hh.send")
+	rsp := NewResponse(req)
+	rsp.SetResultCode(-1001)
+	rsp.SetResultMsg("failed")
+	data := marshalPackage(t, rsp, nil)
+
+	got := NewPackage()
+	if err := got.UnmarshalHeader(data); err != nil {
+		t.Fatalf("unmarshal header failed: %v", err)
+	}
+	if got.GetResultCode() != -1001 || got.GetResultMsg() != "failed" ||
+		got.GetSequence() != req.GetSequence() || got.GetMessageType() != MessageTypeResponse {
+		t.Fatalf("response mismatch, got %+v", got)
+	}
 }
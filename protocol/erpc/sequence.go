@@ -1,10 +1,11 @@
 package protocol
 
+import "sync/atomic"
+
 var (
-	seq = 885511
+	seq uint32 = 885511
 )
 
-func getSeq() int {
-	seq++
-	return seq
+func getSeq() uint32 {
+	return atomic.AddUint32(&seq, 1)
 }
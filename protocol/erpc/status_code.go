@@ -1,7 +1,13 @@
 package protocol
 
+import "github.com/erpc-go/erpc/protocol"
+
 const (
-	StatusOk            = 0
-	StatusError         = 1000
-	StatusServerTimeout = 1001
+	StatusOk              = protocol.StatusOk
+	StatusError           = protocol.StatusError
+	StatusServerTimeout   = protocol.StatusServerTimeout
+	StatusNotFound        = protocol.StatusNotFound
+	StatusBadRequest      = protocol.StatusBadRequest
+	StatusUnknownCodec    = protocol.StatusUnknownCodec
+	StatusUnknownCompress = protocol.StatusUnknownCompress
 )
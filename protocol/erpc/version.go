@@ -3,3 +3,12 @@ package protocol
 var (
 	Version = "v0.1"
 )
+
+// 报文格式版本号，报文格式不兼容变更时递增
+const (
+	frameVersion byte = 1
+)
+
+func FrameVersion() byte {
+	return frameVersion
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"testing"
 
-	"github.com/erpc-go/erpc/protocol"
+	protocol "github.com/erpc-go/erpc/protocol/erpc"
 )
 
 func TestVersion(t *testing.T) {
@@ -0,0 +1,142 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Client gRPC 客户端，以 h2c(明文 HTTP/2) 调用，同一地址复用连接
+type Client struct {
+	transport *http2.Transport
+}
+
+// DefaultClient 默认客户端
+var DefaultClient = NewClient()
+
+// NewClient 创建客户端
+func NewClient() *Client {
+	return &Client{
+		transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+// Invoke 使用默认客户端发起一元调用
+func Invoke(ctx context.Context, addr string, p *Package, req, rsp any) error {
+	return DefaultClient.Invoke(ctx, addr, p, req, rsp)
+}
+
+// Invoke 发起一元调用，addr 为 host:port，p 为请求报文
+// 返回的 error 仅表示通信失败，调用完成后 p 的返回码、返回信息及对端元数据为响应中的值
+func (c *Client) Invoke(ctx context.Context, addr string, p *Package, req, rsp any) error {
+	body, err := p.MarshalBody(req)
+	if err != nil {
+		return err
+	}
+	p.SetBodyLen(uint32(len(body)))
+	prefix, _ := p.MarshalHeader()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr+p.method, bytes.NewReader(append(prefix, body...)))
+	if err != nil {
+		return err
+	}
+	writeMetadata(r.Header, p.extends)
+	r.Header.Set(headerContentType, contentType(p.protoType))
+	r.Header.Set("te", "trailers")
+	r.Header.Set(headerAcceptEncoding, acceptEncoding)
+	if p.compressed {
+		r.Header.Set(headerEncoding, p.encoding)
+	}
+	if timeout := requestTimeout(ctx, p.timeout); timeout > 0 {
+		r.Header.Set(headerTimeout, formatTimeout(timeout))
+	}
+
+	resp, err := c.transport.RoundTrip(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("grpc: unexpected http status %d", resp.StatusCode)
+	}
+	data, err := readResponse(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// 对端元数据: 首部及 trailer
+	for k := range p.metadata {
+		delete(p.metadata, k)
+	}
+	for _, h := range []http.Header{resp.Header, resp.Trailer} {
+		for k, v := range h {
+			p.metadata[strings.ToLower(k)] = strings.Join(v, ",")
+		}
+	}
+
+	// 状态
+	v, ok := p.metadata[headerStatus]
+	if !ok {
+		return fmt.Errorf("grpc: missing %s", headerStatus)
+	}
+	status, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("grpc: invalid %s:%q", headerStatus, v)
+	}
+	p.resultCode = resultCode(status)
+	if v, ok := p.metadata[headerResultCode]; ok {
+		if code, err := strconv.ParseInt(v, 10, 32); err == nil {
+			p.resultCode = int32(code)
+		}
+	}
+	p.resultMsg = decodeMessage(p.metadata[headerMessage])
+	if status != CodeOK || len(data) == 0 {
+		return nil
+	}
+
+	// 消息
+	p.encoding = p.metadata[headerEncoding]
+	if err := p.UnmarshalHeader(data); err != nil {
+		return err
+	}
+	return p.UnmarshalBody(nil, rsp)
+}
+
+// CloseIdleConnections 关闭空闲连接
+func (c *Client) CloseIdleConnections() {
+	c.transport.CloseIdleConnections()
+}
+
+// requestTimeout 调用超时取报文超时与 ctx 剩余时间的较小值
+func requestTimeout(ctx context.Context, timeout time.Duration) time.Duration {
+	if d, ok := ctx.Deadline(); ok {
+		if left := time.Until(d); timeout <= 0 || left < timeout {
+			timeout = left
+		}
+	}
+	return timeout
+}
+
+// readResponse 读取一元调用的响应消息
+func readResponse(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(PrefixLen+MaxMessageSize+1)))
+	if err != nil {
+		return nil, fmt.Errorf("read grpc message failed: %s", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,98 @@
+package grpc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/erpc-go/erpc/codec"
+	"github.com/erpc-go/erpc/compress"
+	"github.com/erpc-go/erpc/protocol"
+)
+
+// body 编码方式，取值同 erpc 协议首部 codec 字段
+const (
+	ProtoTypeUnknown uint8 = 0
+	ProtoTypeJce           = uint8(codec.IDJce)
+	ProtoTypeJSON          = uint8(codec.IDJson)
+	ProtoTypePb            = uint8(codec.IDPb)
+)
+
+// ContentType gRPC 基础 Content-Type，content-subtype 以 + 或 ; 连接
+const ContentType = "application/grpc"
+
+var subtypes = map[string]uint8{
+	"":      ProtoTypePb,
+	"proto": ProtoTypePb,
+	"json":  ProtoTypeJSON,
+	"jce":   ProtoTypeJce,
+}
+
+// protoType 解析 Content-Type 中的 content-subtype，非 gRPC 请求返回 false
+func protoType(contentType string) (uint8, bool) {
+	ct := strings.ToLower(strings.TrimSpace(contentType))
+	if !strings.HasPrefix(ct, ContentType) {
+		return ProtoTypeUnknown, false
+	}
+	sub := ct[len(ContentType):]
+	if sub != "" {
+		if sub[0] != '+' && sub[0] != ';' {
+			return ProtoTypeUnknown, false
+		}
+		sub = sub[1:]
+	}
+	return subtypes[sub], true
+}
+
+// contentType body 编码方式对应的 Content-Type
+func contentType(t uint8) string {
+	switch t {
+	case ProtoTypeJSON:
+		return ContentType + "+json"
+	case ProtoTypeJce:
+		return ContentType + "+jce"
+	default:
+		return ContentType
+	}
+}
+
+func getCodec(t uint8) (codec.Codec, error) {
+	if t == ProtoTypeUnknown {
+		return nil, fmt.Errorf("%w: proto type %d", protocol.ErrUnknownCodec, t)
+	}
+	r, ok := codec.Get(codec.ID(t))
+	if !ok {
+		return nil, fmt.Errorf("%w: proto type %d not registered", protocol.ErrUnknownCodec, t)
+	}
+	return r.Codec, nil
+}
+
+const encodingIdentity = "identity"
+
+// 支持的消息压缩方式，deflate 为 zlib 格式
+var encodings = map[string]compress.CompressType{
+	"gzip":    compress.Gzip,
+	"deflate": compress.Zlib,
+}
+
+// acceptEncoding 支持的压缩方式，用于 grpc-accept-encoding
+const acceptEncoding = "gzip,deflate"
+
+func getCompressor(encoding string) (compress.Compressor, error) {
+	t, ok := encodings[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported grpc encoding:%q", encoding)
+	}
+	c, ok := compress.GetCompressor(t)
+	if !ok {
+		return nil, fmt.Errorf("compressor %d not registered", t)
+	}
+	return c, nil
+}
+
+// negotiateEncoding 回包压缩方式：请求使用的压缩方式对端一定支持，其余情况不压缩
+func negotiateEncoding(encoding string) string {
+	if _, ok := encodings[encoding]; ok {
+		return encoding
+	}
+	return ""
+}
@@ -0,0 +1,461 @@
+package grpc
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erpc-go/erpc/protocol"
+)
+
+// gRPC 扩展元数据，key 统一为小写
+const (
+	ServiceName      = "service-name"
+	LocalServiceName = "local-service-name"
+	TraceID          = "trace-id"
+	SpanID           = "span-id"
+	ParentSpanID     = "parent-span-id"
+	Flag             = "flag"
+	Env              = "env"
+	Uid              = "uid"
+	Appid            = "app-id"
+	AuthInfo         = "auth-info-bin" // -bin 后缀的元数据值为 base64 编码的二进制
+)
+
+// gRPC 协议保留首部
+const (
+	headerContentType    = "content-type"
+	headerEncoding       = "grpc-encoding"
+	headerAcceptEncoding = "grpc-accept-encoding"
+	headerTimeout        = "grpc-timeout"
+	headerStatus         = "grpc-status"
+	headerMessage        = "grpc-message"
+	headerResultCode     = "erpc-result-code" // 业务原始返回码，grpc-status 无法完整表示时携带
+)
+
+// PrefixLen 消息前缀长度: 压缩标志(1B) | 消息长度(4B 大端序)
+const PrefixLen = 5
+
+// MaxMessageSize 单个消息最大长度
+var MaxMessageSize = 4 << 20
+
+func init() {
+	protocol.RegisterProtocol(protocol.ProtocolGrpc, protocol.Registration{
+		Name:     "grpc",
+		Detector: protocol.HTTP2PrefaceDetector(),
+		New: func() protocol.Protocol {
+			return NewPackage()
+		},
+		ServeConn: ServeConn,
+	})
+}
+
+// Package gRPC 一元调用报文，实现 protocol.Protocol
+// 以下所有的API, Getter操作的都是对端发来的元数据, Setter操作的都是发往对端的元数据
+// 服务端对端元数据为请求首部，客户端对端元数据为响应首部及 trailer
+type Package struct {
+	method     string            // 调用方法: /package.Service/Method
+	metadata   map[string]string // 对端元数据
+	extends    map[string]string // 发往对端的元数据
+	protoType  uint8             // body 编码方式，由 content-subtype 决定
+	encoding   string            // 消息压缩方式，由 grpc-encoding 决定
+	timeout    time.Duration     // 调用超时，由 grpc-timeout 决定
+	compressed bool              // 消息是否压缩
+	message    []byte            // 解压后的消息
+	bodyLen    uint32
+	resultCode int32
+	resultMsg  string
+}
+
+// NewPackage 创建空报文
+func NewPackage() *Package {
+	return &Package{
+		metadata:  make(map[string]string),
+		extends:   make(map[string]string),
+		protoType: ProtoTypePb,
+	}
+}
+
+// NewRequest 创建请求报文，pattern 为 erpc 路由
+func NewRequest(pattern string) *Package {
+	p := NewPackage()
+	p.SetCmdPattern(pattern)
+	return p
+}
+
+// Check 消息完整性检查，约定同 server/net.Checker
+func Check(data []byte) (int, error) {
+	if len(data) < PrefixLen {
+		return 0, nil
+	}
+	if data[0] > 1 {
+		return 0, fmt.Errorf("invalid grpc compressed flag: %d", data[0])
+	}
+	length := binary.BigEndian.Uint32(data[1:PrefixLen])
+	if int64(length) > int64(MaxMessageSize) {
+		return 0, fmt.Errorf("grpc message too large: %d", length)
+	}
+	total := PrefixLen + int(length)
+	if len(data) < total {
+		return 0, nil
+	}
+	return total, nil
+}
+
+// MarshalHeader 序列化消息前缀，需在 MarshalBody、SetBodyLen 之后调用
+func (p *Package) MarshalHeader() ([]byte, error) {
+	b := make([]byte, PrefixLen)
+	if p.compressed {
+		b[0] = 1
+	}
+	binary.BigEndian.PutUint32(b[1:], p.bodyLen)
+	return b, nil
+}
+
+// UnmarshalHeader 解析消息前缀，data 为带前缀的完整消息，压缩的消息在此解压
+func (p *Package) UnmarshalHeader(data []byte) error {
+	n, err := Check(data)
+	if err != nil {
+		return err
+	}
+	if n == 0 || n != len(data) {
+		return fmt.Errorf("invalid grpc message length, want %d, got %d", n, len(data))
+	}
+	p.message = data[PrefixLen:n]
+	if data[0] == 1 {
+		c, err := getCompressor(p.encoding)
+		if err != nil {
+			return err
+		}
+		if p.message, err = c.UnPack(p.message); err != nil {
+			return fmt.Errorf("grpc message decompress failed: %s", err)
+		}
+	}
+	return nil
+}
+
+// MarshalBody 按 content-subtype 序列化消息，协商了压缩方式时一并压缩
+func (p *Package) MarshalBody(m any) ([]byte, error) {
+	var body []byte
+	if !protocol.IsNil(m) {
+		c, err := getCodec(p.protoType)
+		if err != nil {
+			return nil, err
+		}
+		if body, err = c.Marshal(m); err != nil {
+			return nil, err
+		}
+	}
+	p.compressed = false
+	if len(body) > 0 && p.encoding != "" && p.encoding != encodingIdentity {
+		c, err := getCompressor(p.encoding)
+		if err != nil {
+			return nil, err
+		}
+		if body, err = c.Pack(body); err != nil {
+			return nil, err
+		}
+		p.compressed = true
+	}
+	return body, nil
+}
+
+// UnmarshalBody 按 content-subtype 反序列化消息，data 参数未使用，消息已在 UnmarshalHeader 中解析
+func (p *Package) UnmarshalBody(_ []byte, m any) error {
+	if protocol.IsNil(m) || len(p.message) == 0 {
+		return nil
+	}
+	c, err := getCodec(p.protoType)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(p.message, m)
+}
+
+// Clone 深复制
+func (p *Package) Clone() protocol.Protocol {
+	newer := *p
+	newer.metadata = make(map[string]string, len(p.metadata))
+	for k, v := range p.metadata {
+		newer.metadata[k] = v
+	}
+	newer.extends = make(map[string]string, len(p.extends))
+	for k, v := range p.extends {
+		newer.extends[k] = v
+	}
+	return &newer
+}
+
+// CloneEmpty 创建同协议的空报文
+func (p *Package) CloneEmpty() protocol.Protocol {
+	return NewPackage()
+}
+
+// Reset 重置为空报文，保留元数据已分配的空间
+func (p *Package) Reset() {
+	metadata, extends := p.metadata, p.extends
+	for k := range metadata {
+		delete(metadata, k)
+	}
+	for k := range extends {
+		delete(extends, k)
+	}
+	*p = Package{
+		metadata:  metadata,
+		extends:   extends,
+		protoType: ProtoTypePb,
+	}
+	if p.metadata == nil {
+		p.metadata = make(map[string]string)
+	}
+	if p.extends == nil {
+		p.extends = make(map[string]string)
+	}
+}
+
+// GetMethod 获取 gRPC 调用方法
+func (p *Package) GetMethod() string {
+	return p.method
+}
+
+// SetMethod 设置 gRPC 调用方法，如 /demo.test.Echo/Send
+func (p *Package) SetMethod(method string) {
+	p.method = method
+}
+
+// GetCmdPattern 获取路由
+// /demo.test.echo/send 映射为 demo.test.echo.send
+func (p *Package) GetCmdPattern() string {
+	return strings.ReplaceAll(strings.TrimPrefix(p.method, "/"), "/", ".")
+}
+
+// SetCmdPattern 设置路由，最后一段作为方法名
+// demo.test.echo.send 映射为 /demo.test.echo/send
+func (p *Package) SetCmdPattern(pattern string) {
+	i := strings.LastIndexByte(pattern, '.')
+	if i < 0 {
+		p.method = "/" + pattern
+		return
+	}
+	p.method = "/" + pattern[:i] + "/" + pattern[i+1:]
+}
+
+// GetTimeout 获取对端声明的调用超时，未声明时为 0
+func (p *Package) GetTimeout() time.Duration {
+	return p.timeout
+}
+
+// SetTimeout 设置调用超时
+func (p *Package) SetTimeout(d time.Duration) {
+	p.timeout = d
+}
+
+// GetEncoding 获取消息压缩方式
+func (p *Package) GetEncoding() string {
+	return p.encoding
+}
+
+// SetEncoding 设置消息压缩方式，支持 gzip、deflate
+func (p *Package) SetEncoding(encoding string) {
+	p.encoding = encoding
+}
+
+// getUint 获取整型元数据
+func (p *Package) getUint(k string) uint64 {
+	v, _ := strconv.ParseUint(p.metadata[k], 10, 64)
+	return v
+}
+
+// GetUid 获取Uid
+func (p *Package) GetUid() uint64 {
+	return p.getUint(Uid)
+}
+
+// SetUid 设置Uid
+func (p *Package) SetUid(uid uint64) {
+	p.SetExtKv(Uid, strconv.FormatUint(uid, 10))
+}
+
+// GetAppID 获取App ID
+func (p *Package) GetAppID() uint32 {
+	return uint32(p.getUint(Appid))
+}
+
+// SetAppID 设置App ID
+func (p *Package) SetAppID(id uint32) {
+	p.SetExtKv(Appid, strconv.FormatUint(uint64(id), 10))
+}
+
+// GetAuthInfo 获取AuthInfo
+func (p *Package) GetAuthInfo() protocol.AuthInfo {
+	var a protocol.AuthInfo
+	if v, ok := p.GetExtKv(AuthInfo); ok {
+		_ = a.Unmarshal([]byte(v))
+	}
+	return a
+}
+
+// SetAuthInfo 设置AuthInfo
+func (p *Package) SetAuthInfo(a *protocol.AuthInfo) {
+	if a == nil {
+		delete(p.extends, AuthInfo)
+		return
+	}
+	if b, err := a.Marshal(); err == nil && len(b) > 0 {
+		p.SetExtKv(AuthInfo, string(b))
+	}
+}
+
+// GetResultCode 获取业务错误码
+func (p *Package) GetResultCode() int32 {
+	return p.resultCode
+}
+
+// SetResultCode 设置业务错误码
+func (p *Package) SetResultCode(code int32) {
+	p.resultCode = code
+}
+
+// GetResultMsg 获取业务错误信息
+func (p *Package) GetResultMsg() string {
+	return p.resultMsg
+}
+
+// SetResultMsg 设置业务错误信息
+func (p *Package) SetResultMsg(msg string) {
+	p.resultMsg = msg
+}
+
+// GetLocalServiceName 获取主调服务名
+func (p *Package) GetLocalServiceName() string {
+	return p.metadata[LocalServiceName]
+}
+
+// SetLocalServiceName 设置主调服务名
+func (p *Package) SetLocalServiceName(v string) {
+	p.SetExtKv(LocalServiceName, v)
+}
+
+// GetServiceName 获取被调服务名
+func (p *Package) GetServiceName() string {
+	return p.metadata[ServiceName]
+}
+
+// SetServiceName 设置被调服务名
+func (p *Package) SetServiceName(v string) {
+	p.SetExtKv(ServiceName, v)
+}
+
+// GetProtoType 获取 body 编码方式
+func (p *Package) GetProtoType() uint8 {
+	return p.protoType
+}
+
+// SetProtoType 设置 body 编码方式
+func (p *Package) SetProtoType(v uint8) {
+	p.protoType = v
+}
+
+// GetTraceID 获取TraceID
+func (p *Package) GetTraceID() string {
+	return p.metadata[TraceID]
+}
+
+// SetTraceID 设置TraceID
+func (p *Package) SetTraceID(v string) {
+	p.SetExtKv(TraceID, v)
+}
+
+// GetSpanID 获取Span ID
+func (p *Package) GetSpanID() uint64 {
+	return p.getUint(SpanID)
+}
+
+// SetSpanID 设置Span ID
+func (p *Package) SetSpanID(v uint64) {
+	p.SetExtKv(SpanID, strconv.FormatUint(v, 10))
+}
+
+// GetParentSpanID 获取Parent Span ID
+func (p *Package) GetParentSpanID() uint64 {
+	return p.getUint(ParentSpanID)
+}
+
+// SetParentSpanID 设置Parent Span ID
+func (p *Package) SetParentSpanID(v uint64) {
+	p.SetExtKv(ParentSpanID, strconv.FormatUint(v, 10))
+}
+
+// GetFlag 获取染色标志
+func (p *Package) GetFlag() uint32 {
+	return uint32(p.getUint(Flag))
+}
+
+// SetFlag 设置染色标志
+func (p *Package) SetFlag(v uint32) {
+	p.SetExtKv(Flag, strconv.FormatUint(uint64(v), 10))
+}
+
+// GetEnv 获取环境标识
+func (p *Package) GetEnv() string {
+	return p.metadata[Env]
+}
+
+// GetExtKv 获取对端元数据，-bin 后缀的元数据返回解码后的值
+func (p *Package) GetExtKv(k string) (string, bool) {
+	k = strings.ToLower(k)
+	v, ok := p.metadata[k]
+	if !ok || !strings.HasSuffix(k, "-bin") {
+		return v, ok
+	}
+	b, err := decodeBinHeader(v)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// SetExtKv 设置发往对端的元数据，-bin 后缀的元数据值可为任意二进制
+func (p *Package) SetExtKv(k string, v string) bool {
+	if p.extends == nil {
+		p.extends = make(map[string]string)
+	}
+	p.extends[strings.ToLower(k)] = v
+	return true
+}
+
+// GetExtends 获取所有发往对端的元数据
+func (p *Package) GetExtends() map[string]string {
+	return p.extends
+}
+
+// GetMetadata 获取所有对端元数据
+func (p *Package) GetMetadata() map[string]string {
+	return p.metadata
+}
+
+// SetBodyLen 设置消息长度
+func (p *Package) SetBodyLen(l uint32) {
+	p.bodyLen = l
+}
+
+// GetBodyLen 获取消息长度
+func (p *Package) GetBodyLen() uint32 {
+	return p.bodyLen
+}
+
+// decodeBinHeader -bin 元数据值为 base64，兼容有无 padding
+func decodeBinHeader(v string) ([]byte, error) {
+	if len(v)%4 == 0 {
+		return base64.StdEncoding.DecodeString(v)
+	}
+	return base64.RawStdEncoding.DecodeString(v)
+}
+
+// encodeBinHeader -bin 元数据值编码
+func encodeBinHeader(v string) string {
+	return base64.RawStdEncoding.EncodeToString([]byte(v))
+}
@@ -0,0 +1,255 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/erpc-go/erpc/protocol"
+)
+
+// pbMessage 测试用 pb body
+type pbMessage struct {
+	Msg string `protobuf:"bytes,1,opt,name=msg,proto3" json:"msg,omitempty"`
+}
+
+func (m *pbMessage) Reset()         { *m = pbMessage{} }
+func (m *pbMessage) String() string { return m.Msg }
+func (*pbMessage) ProtoMessage()    {}
+
+func (m *pbMessage) ReadFrom(r io.Reader) (int64, error) {
+	b, err := io.ReadAll(r)
+	m.Msg = string(b)
+	return int64(len(b)), err
+}
+
+func (m *pbMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, m.Msg)
+	return int64(n), err
+}
+
+// rawMessage 非 pb body
+type rawMessage struct{}
+
+func (m *rawMessage) ReadFrom(r io.Reader) (int64, error) { return 0, nil }
+func (m *rawMessage) WriteTo(w io.Writer) (int64, error)  { return 0, nil }
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		v    string
+		want time.Duration
+	}{
+		{"1S", time.Second},
+		{"100m", 100 * time.Millisecond},
+		{"5u", 5 * time.Microsecond},
+		{"2H", 2 * time.Hour},
+		{"99999999n", 99999999},
+	}
+	for _, tt := range tests {
+		if d, err := parseTimeout(tt.v); err != nil || d != tt.want {
+			t.Errorf("parseTimeout(%q) = %v, %v, want %v", tt.v, d, err, tt.want)
+		}
+	}
+	for _, v := range []string{"", "1", "1x", "-1S", "123456789S"} {
+		if _, err := parseTimeout(v); err == nil {
+			t.Errorf("parseTimeout(%q) should fail", v)
+		}
+	}
+	for _, d := range []time.Duration{time.Nanosecond, 1500 * time.Millisecond, 3 * time.Hour} {
+		if got, err := parseTimeout(formatTimeout(d)); err != nil || got < d {
+			t.Errorf("formatTimeout(%v) = %q", d, formatTimeout(d))
+		}
+	}
+}
+
+func TestMessageEncoding(t *testing.T) {
+	msg := "not found: 路由 100%"
+	encoded := encodeMessage(msg)
+	for i := 0; i < len(encoded); i++ {
+		if encoded[i] < ' ' || encoded[i] > '~' {
+			t.Fatalf("encoded message not printable: %q", encoded)
+		}
+	}
+	if got := decodeMessage(encoded); got != msg {
+		t.Fatalf("decodeMessage = %q, want %q", got, msg)
+	}
+}
+
+func TestPackageRoundTrip(t *testing.T) {
+	for _, encoding := range []string{"", "gzip", "deflate"} {
+		req := NewRequest("demo.test.echo.send")
+		req.SetEncoding(encoding)
+		body, err := req.MarshalBody(&pbMessage{Msg: "hello"})
+		if err != nil {
+			t.Fatalf("marshal body failed: %v", err)
+		}
+		req.SetBodyLen(uint32(len(body)))
+		prefix, _ := req.MarshalHeader()
+		data := append(prefix, body...)
+		if n, err := Check(data); n != len(data) || err != nil {
+			t.Fatalf("Check = %d, %v", n, err)
+		}
+
+		p := NewPackage()
+		p.SetEncoding(encoding)
+		if err := p.UnmarshalHeader(data); err != nil {
+			t.Fatalf("unmarshal header failed: %v", err)
+		}
+		m := &pbMessage{}
+		if err := p.UnmarshalBody(nil, m); err != nil || m.Msg != "hello" {
+			t.Fatalf("%q: unmarshal body = %q, %v", encoding, m.Msg, err)
+		}
+	}
+
+	p := NewPackage()
+	p.SetCmdPattern("demo.test.echo.send")
+	if p.GetMethod() != "/demo.test.echo/send" || p.GetCmdPattern() != "demo.test.echo.send" {
+		t.Fatalf("unexpected method %q, pattern %q", p.GetMethod(), p.GetCmdPattern())
+	}
+	if _, err := p.MarshalBody(&rawMessage{}); err == nil {
+		t.Fatalf("marshal non-proto message should fail")
+	}
+}
+
+// echoDispatcher 按路由回显请求
+type echoDispatcher struct{}
+
+func (echoDispatcher) Dispatch(ctx context.Context, p protocol.Protocol) ([]byte, error) {
+	if p.GetCmdPattern() != "demo.test.echo.send" {
+		p.SetResultCode(protocol.StatusNotFound)
+		p.SetResultMsg("invalid cmd pattern")
+		return nil, nil
+	}
+	req := &pbMessage{}
+	if err := p.UnmarshalBody(nil, req); err != nil {
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		p.SetResultCode(protocol.StatusBadRequest)
+		return nil, nil
+	}
+	if v, _ := p.GetExtKv("key-bin"); v != "\x00\x01" {
+		p.SetResultCode(1100)
+		p.SetResultMsg("metadata mismatch: " + v)
+		return nil, nil
+	}
+	p.SetExtKv("trace-id", p.GetTraceID())
+	return p.MarshalBody(&pbMessage{Msg: "echo:" + req.Msg})
+}
+
+func TestInvoke(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go ServeConn(context.Background(), conn, echoDispatcher{})
+		}
+	}()
+
+	c := NewClient()
+	defer c.CloseIdleConnections()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	for _, encoding := range []string{"", "gzip"} {
+		p := NewRequest("demo.test.echo.send")
+		p.SetEncoding(encoding)
+		p.SetTraceID("trace")
+		p.SetExtKv("key-bin", "\x00\x01")
+		rsp := &pbMessage{}
+		if err := c.Invoke(ctx, ln.Addr().String(), p, &pbMessage{Msg: "hi"}, rsp); err != nil {
+			t.Fatalf("invoke failed: %v", err)
+		}
+		if p.GetResultCode() != 0 || rsp.Msg != "echo:hi" || p.GetTraceID() != "trace" {
+			t.Fatalf("unexpected response: %d %q %q", p.GetResultCode(), rsp.Msg, p.GetTraceID())
+		}
+	}
+
+	p := NewRequest("demo.test.echo.none")
+	if err := c.Invoke(ctx, ln.Addr().String(), p, &pbMessage{Msg: "hi"}, &pbMessage{}); err != nil {
+		t.Fatalf("invoke failed: %v", err)
+	}
+	if p.GetResultCode() != protocol.StatusNotFound || p.GetResultMsg() != "invalid cmd pattern" {
+		t.Fatalf("unexpected result: %d %q", p.GetResultCode(), p.GetResultMsg())
+	}
+	if v, _ := p.GetExtKv(headerStatus); v != "12" {
+		t.Fatalf("unexpected grpc-status: %q", v)
+	}
+
+	// 业务返回码超出 gRPC 状态码范围时，通过扩展首部还原
+	p = NewRequest("demo.test.echo.send")
+	if err := c.Invoke(ctx, ln.Addr().String(), p, &pbMessage{Msg: "hi"}, &pbMessage{}); err != nil {
+		t.Fatalf("invoke failed: %v", err)
+	}
+	if p.GetResultCode() != 1100 {
+		t.Fatalf("unexpected result code: %d", p.GetResultCode())
+	}
+}
+
+// deadlineDispatcher 回包携带请求剩余的处理时长(毫秒)
+type deadlineDispatcher struct{}
+
+func (deadlineDispatcher) Dispatch(ctx context.Context, p protocol.Protocol) ([]byte, error) {
+	d, ok := ctx.Deadline()
+	if !ok {
+		p.SetResultCode(protocol.StatusBadRequest)
+		return nil, nil
+	}
+	p.SetExtKv("remain", strconv.FormatInt(int64(time.Until(d)/time.Millisecond), 10))
+	return p.MarshalBody(&pbMessage{})
+}
+
+func TestServeConnMsgTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			ctx := protocol.WithMsgTimeout(context.Background(), 200*time.Millisecond)
+			go ServeConn(ctx, conn, deadlineDispatcher{})
+		}
+	}()
+
+	c := NewClient()
+	defer c.CloseIdleConnections()
+	tests := []struct {
+		timeout time.Duration // 客户端超时，0 不携带 grpc-timeout
+		max     int64
+	}{
+		{0, 200},
+		{time.Second, 200},
+		{100 * time.Millisecond, 100},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if tt.timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+		}
+		p := NewRequest("demo.test.echo.send")
+		err := c.Invoke(ctx, ln.Addr().String(), p, &pbMessage{}, &pbMessage{})
+		cancel()
+		if err != nil || p.GetResultCode() != 0 {
+			t.Fatalf("timeout %v: invoke failed: %v, code:%d", tt.timeout, err, p.GetResultCode())
+		}
+		v, _ := p.GetExtKv("remain")
+		if remain, _ := strconv.ParseInt(v, 10, 64); remain <= 0 || remain > tt.max {
+			t.Errorf("timeout %v: remain %qms, want (0, %d]", tt.timeout, v, tt.max)
+		}
+	}
+}
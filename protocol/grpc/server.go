@@ -0,0 +1,223 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/erpc-go/erpc/protocol"
+	"golang.org/x/net/http2"
+)
+
+// ServeConn 以 h2c(明文 HTTP/2) 处理 gRPC 连接，实现 protocol.ConnServer
+// 同一连接上的 stream 并发处理，每个 stream 为一次一元调用
+// 服务关闭时发送 GOAWAY，处理中的 stream 完成后返回
+func ServeConn(ctx context.Context, conn net.Conn, d protocol.Dispatcher) {
+	hs := &http.Server{}
+	s := &http2.Server{}
+	http2.ConfigureServer(hs, s)
+	rc := &readNotifyConn{Conn: conn, read: make(chan struct{})}
+	done := make(chan struct{})
+	defer close(done)
+	go goAwayOnDrain(protocol.Draining(ctx), hs, rc.read, done)
+	s.ServeConn(rc, &http2.ServeConnOpts{
+		Context:    ctx,
+		BaseConfig: hs,
+		Handler:    &handler{d: d, msgTimeout: protocol.MsgTimeout(ctx)},
+	})
+}
+
+// readNotifyConn 首次读取时关闭 read
+// http2.Server 在连接注册之后才开始读取，据此判断 hs.Shutdown 可以通知到该连接
+type readNotifyConn struct {
+	net.Conn
+	once sync.Once
+	read chan struct{}
+}
+
+func (c *readNotifyConn) Read(b []byte) (int, error) {
+	c.once.Do(func() { close(c.read) })
+	return c.Conn.Read(b)
+}
+
+// goAwayOnDrain drain 关闭时通过 hs.Shutdown 向连接发送 GOAWAY
+// 等待连接注册(registered 关闭)后才调用，done 关闭时不再等待
+func goAwayOnDrain(drain <-chan struct{}, hs *http.Server, registered, done <-chan struct{}) {
+	for _, ch := range []<-chan struct{}{registered, drain} {
+		select {
+		case <-ch:
+		case <-done:
+			return
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	// 连接不由 hs 管理，Shutdown 发送 GOAWAY 后即返回，连接由 ServeConn 在 stream 完成后关闭
+	hs.Shutdown(ctx)
+}
+
+// handler gRPC 一元调用处理
+type handler struct {
+	d          protocol.Dispatcher
+	msgTimeout time.Duration // 服务端的最大处理时长，见 protocol.MsgTimeout
+}
+
+// ServeHTTP http.Handler interface
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t, ok := protoType(r.Header.Get(headerContentType))
+	if r.Method != http.MethodPost || !ok {
+		http.Error(w, "invalid grpc request", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	p, _ := protocol.Acquire(protocol.ProtocolGrpc).(*Package)
+	if p == nil {
+		writeStatus(w, CodeInternal, "grpc protocol not registered")
+		return
+	}
+	defer protocol.Release(protocol.ProtocolGrpc, p)
+
+	// 首部
+	p.method = r.URL.Path
+	p.protoType = t
+	p.encoding = r.Header.Get(headerEncoding)
+	for k, v := range r.Header {
+		p.metadata[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+
+	// 超时，取 grpc-timeout 及服务端最大处理时长中较小的
+	ctx := r.Context()
+	timeout := h.msgTimeout
+	if v := r.Header.Get(headerTimeout); v != "" {
+		t, err := parseTimeout(v)
+		if err != nil {
+			writeStatus(w, CodeInternal, err.Error())
+			return
+		}
+		p.timeout = t
+		if timeout <= 0 || t < timeout {
+			timeout = t
+		}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// 消息
+	data, err := readMessage(r.Body)
+	if err != nil {
+		writeStatus(w, CodeInternal, err.Error())
+		return
+	}
+	if err := p.UnmarshalHeader(data); err != nil {
+		if _, ok := encodings[p.encoding]; !ok && data[0] == 1 {
+			w.Header().Set(headerAcceptEncoding, acceptEncoding)
+			writeStatus(w, CodeUnimplemented, err.Error())
+			return
+		}
+		writeStatus(w, CodeInternal, err.Error())
+		return
+	}
+	p.encoding = negotiateEncoding(p.encoding)
+
+	// 业务处理
+	body, err := h.d.Dispatch(ctx, p)
+	if err != nil {
+		writeStatus(w, CodeInternal, err.Error())
+		return
+	}
+
+	header := w.Header()
+	writeMetadata(header, p.extends)
+	header.Set(headerContentType, contentType(p.protoType))
+	header.Set(headerAcceptEncoding, acceptEncoding)
+	// grpc-status 无法还原业务返回码时，携带原始返回码
+	status := StatusMapper(p.resultCode)
+	if resultCode(status) != p.resultCode {
+		header.Set(headerResultCode, strconv.FormatInt(int64(p.resultCode), 10))
+	}
+	if status != CodeOK {
+		// Trailers-Only: 无消息，状态放在首部中
+		writeStatus(w, status, p.resultMsg)
+		return
+	}
+
+	if p.compressed {
+		header.Set(headerEncoding, p.encoding)
+	}
+	p.SetBodyLen(uint32(len(body)))
+	prefix, _ := p.MarshalHeader()
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(append(prefix, body...)); err != nil {
+		return
+	}
+	header.Set(http.TrailerPrefix+headerStatus, strconv.Itoa(CodeOK))
+	if p.resultMsg != "" {
+		header.Set(http.TrailerPrefix+headerMessage, encodeMessage(p.resultMsg))
+	}
+}
+
+// readMessage 读取一元调用的请求消息
+func readMessage(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(PrefixLen+MaxMessageSize+1)))
+	if err != nil {
+		return nil, fmt.Errorf("read grpc message failed: %s", err)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("grpc message missing")
+	}
+	return data, nil
+}
+
+// writeStatus 以 Trailers-Only 形式返回状态
+func writeStatus(w http.ResponseWriter, status int, msg string) {
+	header := w.Header()
+	if header.Get(headerContentType) == "" {
+		header.Set(headerContentType, ContentType)
+	}
+	header.Set(headerStatus, strconv.Itoa(status))
+	if msg != "" {
+		header.Set(headerMessage, encodeMessage(msg))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeMetadata 写入自定义元数据，跳过协议保留首部
+func writeMetadata(header http.Header, md map[string]string) {
+	for k, v := range md {
+		if isReservedHeader(k) {
+			continue
+		}
+		if strings.HasSuffix(k, "-bin") {
+			v = encodeBinHeader(v)
+		}
+		header.Set(k, v)
+	}
+}
+
+// isReservedHeader gRPC 及 HTTP/2 保留首部，不允许业务设置
+func isReservedHeader(k string) bool {
+	if strings.HasPrefix(k, ":") || strings.HasPrefix(k, "grpc-") {
+		return true
+	}
+	switch k {
+	case headerContentType, "te", "connection", "content-length", "transfer-encoding", "user-agent", headerResultCode:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package grpc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/erpc-go/erpc/protocol"
+)
+
+// gRPC 状态码: https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	CodeOK               = 0
+	CodeCanceled         = 1
+	CodeUnknown          = 2
+	CodeInvalidArgument  = 3
+	CodeDeadlineExceeded = 4
+	CodeUnimplemented    = 12
+	CodeInternal         = 13
+	CodeUnavailable      = 14
+	CodeUnauthenticated  = 16
+)
+
+// 状态码最大值
+const maxCode = 16
+
+// StatusMapper 业务返回码到 grpc-status 的映射，可替换
+var StatusMapper = DefaultStatusMapper
+
+// DefaultStatusMapper 默认状态码映射
+// 0 为 OK，框架返回码映射为对应的 gRPC 状态码，业务返回码在 [1, 16] 之间时直接作为状态码，其余为 Unknown
+func DefaultStatusMapper(code int32) int {
+	switch {
+	case code == protocol.StatusOk:
+		return CodeOK
+	case code == protocol.StatusNotFound:
+		return CodeUnimplemented
+	case code == protocol.StatusBadRequest:
+		return CodeInvalidArgument
+	case code == protocol.StatusServerTimeout:
+		return CodeDeadlineExceeded
+	case code == protocol.StatusUnknownCodec:
+		return CodeInternal
+	case code > 0 && code <= maxCode:
+		return int(code)
+	default:
+		return CodeUnknown
+	}
+}
+
+// resultCode grpc-status 映射为 erpc 返回码，对端未携带原始返回码时使用
+func resultCode(status int) int32 {
+	switch status {
+	case CodeOK:
+		return protocol.StatusOk
+	case CodeUnimplemented:
+		return protocol.StatusNotFound
+	case CodeDeadlineExceeded:
+		return protocol.StatusServerTimeout
+	default:
+		return int32(status)
+	}
+}
+
+// parseTimeout 解析 grpc-timeout: 最多 8 位数字 + 单位(H/M/S/m/u/n)
+func parseTimeout(v string) (time.Duration, error) {
+	if len(v) < 2 || len(v) > 9 {
+		return 0, fmt.Errorf("invalid grpc-timeout:%q", v)
+	}
+	var unit time.Duration
+	switch v[len(v)-1] {
+	case 'H':
+		unit = time.Hour
+	case 'M':
+		unit = time.Minute
+	case 'S':
+		unit = time.Second
+	case 'm':
+		unit = time.Millisecond
+	case 'u':
+		unit = time.Microsecond
+	case 'n':
+		unit = time.Nanosecond
+	default:
+		return 0, fmt.Errorf("invalid grpc-timeout unit:%q", v)
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid grpc-timeout:%q", v)
+	}
+	// 8 位数字乘以小时单位不会溢出
+	return time.Duration(n) * unit, nil
+}
+
+// formatTimeout 编码 grpc-timeout，选择能以 8 位数字表示的最小单位
+func formatTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "0n"
+	}
+	const maxValue = 1e8 - 1
+	units := []struct {
+		d time.Duration
+		s string
+	}{
+		{time.Nanosecond, "n"},
+		{time.Microsecond, "u"},
+		{time.Millisecond, "m"},
+		{time.Second, "S"},
+		{time.Minute, "M"},
+		{time.Hour, "H"},
+	}
+	for _, u := range units {
+		// 向上取整，避免超时被截短为 0
+		if v := (d + u.d - 1) / u.d; v <= maxValue {
+			return strconv.FormatInt(int64(v), 10) + u.s
+		}
+	}
+	return strconv.Itoa(maxValue) + "H"
+}
+
+// encodeMessage grpc-message 百分号编码，可打印 ASCII 字符(除 %)原样保留
+func encodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// decodeMessage grpc-message 百分号解码，非法编码原样保留
+func decodeMessage(msg string) string {
+	if !strings.Contains(msg, "%") {
+		return msg
+	}
+	b := make([]byte, 0, len(msg))
+	for i := 0; i < len(msg); i++ {
+		if msg[i] == '%' && i+2 < len(msg) {
+			if v, err := strconv.ParseUint(msg[i+1:i+3], 16, 8); err == nil {
+				b = append(b, byte(v))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, msg[i])
+	}
+	return string(b)
+}
@@ -0,0 +1,148 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxHeaderBytes 请求行及首部最大长度
+var MaxHeaderBytes = 1 << 20
+
+var crlf = []byte("\r\n")
+
+// HTTPCheck HTTP 1.x协议包完整性校验，支持 Content-Length 及 Chunked
+// 约定同 server/net.Checker
+func HTTPCheck(data []byte) (int, error) {
+	// 请求行及首部以空行结束
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	if end < 0 {
+		if len(data) > MaxHeaderBytes {
+			return 0, fmt.Errorf("http header too large: %d", len(data))
+		}
+		return 0, nil
+	}
+	headerLength := end + 4
+
+	// 解析请求行
+	lineEnd := bytes.Index(data, crlf)
+	if lineEnd <= 0 || len(bytes.Fields(data[:lineEnd])) != 3 {
+		return 0, fmt.Errorf("invalid request line: %q", data[:lineEnd])
+	}
+
+	// 解析请求首部
+	var lines [][]byte
+	if lineEnd < end {
+		lines = bytes.Split(data[lineEnd+2:end], crlf)
+	}
+	contentLength, chunked := -1, false
+	for _, line := range lines {
+		k, v := mimeHeader(line)
+		if k == nil {
+			return 0, fmt.Errorf("invalid header line: %q", line)
+		}
+		switch strings.ToLower(string(k)) {
+		case "content-length":
+			length, err := strconv.Atoi(string(v))
+			if err != nil || length < 0 {
+				return 0, fmt.Errorf("invalid Content-Length: %q", v)
+			}
+			if contentLength >= 0 && contentLength != length {
+				return 0, fmt.Errorf("conflicting Content-Length: %d, %d", contentLength, length)
+			}
+			contentLength = length
+		case "transfer-encoding":
+			codings := strings.Split(strings.ToLower(string(v)), ",")
+			if strings.TrimSpace(codings[len(codings)-1]) != "chunked" {
+				return 0, fmt.Errorf("unsupported Transfer-Encoding: %q", v)
+			}
+			chunked = true
+		}
+	}
+
+	// Transfer-Encoding 优先于 Content-Length
+	if chunked {
+		n, err := chunkedLength(data[headerLength:])
+		if n == 0 || err != nil {
+			return 0, err
+		}
+		return headerLength + n, nil
+	}
+	if contentLength < 0 {
+		contentLength = 0
+	}
+	if contentLength > len(data[headerLength:]) {
+		return 0, nil
+	}
+	return headerLength + contentLength, nil
+}
+
+// chunkedLength 计算 chunked 编码 body 的总长度，未收完返回 0
+// chunk: size(hex)[;ext] CRLF data CRLF ... 0 CRLF [trailer CRLF] CRLF
+func chunkedLength(data []byte) (int, error) {
+	var index int
+	for {
+		lineEnd := bytes.Index(data[index:], crlf)
+		if lineEnd < 0 {
+			return 0, nil
+		}
+		sizeField := data[index : index+lineEnd]
+		if i := bytes.IndexByte(sizeField, ';'); i >= 0 {
+			sizeField = sizeField[:i]
+		}
+		size, err := strconv.ParseUint(string(bytes.TrimSpace(sizeField)), 16, 31)
+		if err != nil {
+			return 0, fmt.Errorf("invalid chunk size: %q", data[index:index+lineEnd])
+		}
+		index += lineEnd + 2
+
+		if size == 0 {
+			break
+		}
+		if len(data) < index+int(size)+2 {
+			return 0, nil
+		}
+		if !bytes.Equal(data[index+int(size):index+int(size)+2], crlf) {
+			return 0, fmt.Errorf("invalid chunk data terminator")
+		}
+		index += int(size) + 2
+	}
+
+	// trailer 以空行结束
+	for {
+		lineEnd := bytes.Index(data[index:], crlf)
+		if lineEnd < 0 {
+			return 0, nil
+		}
+		index += lineEnd + 2
+		if lineEnd == 0 {
+			return index, nil
+		}
+	}
+}
+
+// mimeHeader 拆分首部行，非法首部返回 nil
+func mimeHeader(line []byte) (k, v []byte) {
+	i := bytes.IndexByte(line, ':')
+	if i <= 0 {
+		return nil, nil
+	}
+	return bytes.TrimSpace(line[:i]), bytes.TrimSpace(line[i+1:])
+}
+
+// appendChunked 将 body 按 chunked 编码追加到 b 之后
+func appendChunked(b []byte, body []byte, chunkSize int) []byte {
+	for len(body) > 0 {
+		n := len(body)
+		if n > chunkSize {
+			n = chunkSize
+		}
+		b = strconv.AppendInt(b, int64(n), 16)
+		b = append(b, crlf...)
+		b = append(b, body[:n]...)
+		b = append(b, crlf...)
+		body = body[n:]
+	}
+	return append(b, "0\r\n\r\n"...)
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/erpc-go/erpc/codec"
+	"github.com/erpc-go/erpc/protocol"
+)
+
+// body MIME类型，取值同 erpc 协议首部 codec 字段，即 codec.ID
+// 其余在 codec 包注册了 MIME 类型的编码方式同样支持
+const (
+	ProtoTypeUnknown       uint8 = 0
+	ProtoTypeJce                 = uint8(codec.IDJce)
+	ProtoTypeJSON                = uint8(codec.IDJson)
+	ProtoTypePb                  = uint8(codec.IDPb)
+	ProtoTypeThrift              = uint8(codec.IDThrift)
+	ProtoTypeMsgpack             = uint8(codec.IDMsgpack)
+	ProtoTypeThriftCompact       = uint8(codec.IDThriftCompact)
+	ProtoTypeThriftJSON          = uint8(codec.IDThriftJSON)
+	ProtoTypeVarbin              = uint8(codec.IDVarbin)
+	ProtoTypeCBOR                = uint8(codec.IDCBOR)
+)
+
+// protoType 按 codec 包注册的 MIME 类型解析 Content-Type/Accept，*/* 及 application/* 视为 JSON
+func protoType(v string) uint8 {
+	mt, _, err := mime.ParseMediaType(strings.TrimSpace(v))
+	if err != nil {
+		return ProtoTypeUnknown
+	}
+	switch mt {
+	case "*/*", "application/*":
+		return ProtoTypeJSON
+	}
+	if r, ok := codec.GetByMIME(mt); ok {
+		return uint8(r.ID)
+	}
+	return ProtoTypeUnknown
+}
+
+// acceptType 按 Accept 首部选取 q 值最大的支持类型，q 值相同时取靠前的，q=0 表示不接受
+func acceptType(accept string) uint8 {
+	best, bestQ := ProtoTypeUnknown, 0.0
+	for _, v := range strings.Split(accept, ",") {
+		t := protoType(v)
+		if t == ProtoTypeUnknown {
+			continue
+		}
+		if q := quality(v); q > bestQ {
+			best, bestQ = t, q
+		}
+	}
+	return best
+}
+
+// quality Accept 中单个类型的 q 值，未声明时为 1，非法时视为 0
+func quality(v string) float64 {
+	_, params, err := mime.ParseMediaType(strings.TrimSpace(v))
+	if err != nil {
+		return 0
+	}
+	s, ok := params["q"]
+	if !ok {
+		return 1
+	}
+	q, err := strconv.ParseFloat(s, 64)
+	if err != nil || q < 0 || q > 1 {
+		return 0
+	}
+	return q
+}
+
+// mimeType body 类型对应的 Content-Type
+func mimeType(t uint8) string {
+	if r, ok := codec.Get(codec.ID(t)); ok && t != ProtoTypeJSON && r.MIME != "" {
+		return r.MIME
+	}
+	return "application/json; charset=utf-8"
+}
+
+func getCodec(t uint8) (codec.Codec, error) {
+	if t == ProtoTypeUnknown {
+		return nil, fmt.Errorf("%w: proto type %d", protocol.ErrUnknownCodec, t)
+	}
+	r, ok := codec.Get(codec.ID(t))
+	if !ok {
+		return nil, fmt.Errorf("%w: proto type %d not registered", protocol.ErrUnknownCodec, t)
+	}
+	return r.Codec, nil
+}
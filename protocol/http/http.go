@@ -4,28 +4,32 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/golang/protobuf/proto"
+	"github.com/erpc-go/erpc/codec"
+	"github.com/erpc-go/erpc/protocol"
 )
 
 // HTTP 1.x 扩展Header
 // 命名遵循HTTP首部规范: 驼峰+'-'字符分隔: https://cs.opensource.google/go/go/+/refs/tags/go1.17.1:src/net/textproto/reader.go;drc=refs%2Ftags%2Fgo1.17.1;bpv=0;bpt=0;l=635
 // golang源码自动将Header统一转成标准格式
 const (
-	ServiceName  = "Service-Name"
-	TraceID      = "Trace-Id"
-	SpanID       = "Span-Id"
-	ParentSpanID = "Parent-Span-Id"
-	Flag         = "Flag"
-	Env          = "Env"
+	ServiceName      = "Service-Name"
+	LocalServiceName = "Local-Service-Name"
+	TraceID          = "Trace-Id"
+	SpanID           = "Span-Id"
+	ParentSpanID     = "Parent-Span-Id"
+	Flag             = "Flag"
+	Env              = "Env"
+	ResultCode       = "Result-Code"
+	ResultMsg        = "Result-Msg"
 	// 以下为鉴权相关
 	Uid       = "Uid"
 	TokenType = "Token-Type"
@@ -36,16 +40,57 @@ const (
 	OpenAppID = "Open-App-Id"
 )
 
-// HTTP 1.x协议(暂不支持Chunked)
+// ChunkSize chunked 回包时单个 chunk 的最大长度
+var ChunkSize = 32 * 1024
+
+// StatusMapper 业务返回码到 HTTP 状态码的映射，可替换
+var StatusMapper = DefaultStatusMapper
+
+// DefaultStatusMapper 默认状态码映射
+// 0 为 200，框架返回码映射为对应的 HTTP 状态码(编码方式不支持为 415)，业务返回码在 [400, 600) 之间时直接作为状态码，其余非 0 返回码为 500
+func DefaultStatusMapper(code int32) int {
+	switch {
+	case code == protocol.StatusOk:
+		return http.StatusOK
+	case code == protocol.StatusNotFound:
+		return http.StatusNotFound
+	case code == protocol.StatusBadRequest:
+		return http.StatusBadRequest
+	case code == protocol.StatusServerTimeout:
+		return http.StatusGatewayTimeout
+	case code == protocol.StatusUnknownCodec:
+		return http.StatusUnsupportedMediaType
+	case code >= 400 && code < 600:
+		return int(code)
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func init() {
+	protocol.RegisterProtocol(protocol.ProtocolHttp, protocol.Registration{
+		Name:     "http",
+		Detector: protocol.HTTPMethodDetector(),
+		Checker:  protocol.CheckerFunc(HTTPCheck),
+		New: func() protocol.Protocol {
+			return NewHTTPHeader()
+		},
+	})
+}
+
+// HTTP 1.x协议，实现 protocol.Protocol
 // 以下所有的API, Getter操作的都是HTTP Request, Setter操作的都是HTTP Response
 // HTTPHeader HTTP 1.x协议首部
 type HTTPHeader struct {
 	request *http.Request
+	body    []byte // 已解码(去除 chunked)的请求 body
 	// response (net/http没有将写Response作为可导出方案)
 	responseCode          int32             // 返回码
 	responseMsg           string            // 提示语
 	responseContentLength int64             // HTTP响应Body长度
 	responseProtoType     uint8             // HTTP响应Body MIME类型
+	responseChunked       bool              // HTTP响应Body是否chunked编码
+	headContentLength     int64             // HEAD 请求对应 GET 回包的 Body 长度
 	extMap                map[string]string // k-v结构的协议扩展首部
 }
 
@@ -56,236 +101,273 @@ func NewHTTPHeader() *HTTPHeader {
 	}
 }
 
-// Marshal 构造HTTP首部
+// 响应首部值不允许换行
+var headerValueReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// MarshalHeader 构造HTTP响应状态行及首部，需在 MarshalBody、SetBodyLen 之后调用
 // golang官方未提供形如: http.WriteResponse的库, 自己实现
-func (h *HTTPHeader) Marshal() ([]byte, error) {
-	if h == nil || h.request == nil {
-		return nil, nil
+func (h *HTTPHeader) MarshalHeader() ([]byte, error) {
+	if h.request == nil {
+		return nil, fmt.Errorf("http request not unmarshaled")
 	}
+	code := StatusMapper(h.responseCode)
+
+	b := make([]byte, 0, 256)
 	// 状态栏(框架自动生成)
-	statusLine := fmt.Sprintf("HTTP/%d.%d 200 OK\r\n", h.request.ProtoMajor, h.request.ProtoMinor)
-	// 首部
-	var header string
-	// Date(预留)
-	header += fmt.Sprintf("Date: %s\r\n", time.Now().UTC().Format(http.TimeFormat))
-	// Content-Length(预留)
-	header += fmt.Sprintf("Content-Length: %d\r\n", h.GetResponseContentLength())
-	// Content-Type(预留, 但业务可通过API设置)
-	contentType := h.responseProtoType
-	if contentType != TmeProtoTypeJce ||
-		contentType != TmeProtoTypePb ||
-		contentType != TmeProtoTypeJSON {
-		contentType = h.GetProtoType()
-	}
-	switch contentType {
-	case TmeProtoTypeJce:
-		header += fmt.Sprintf("Content-Type: application/jce\r\n")
-	case TmeProtoTypePb:
-		header += fmt.Sprintf("Content-Type: application/pb\r\n")
-	case TmeProtoTypeJSON:
-		header += fmt.Sprintf("Content-Type: application/json\r\n")
+	b = append(b, fmt.Sprintf("HTTP/%d.%d %03d %s\r\n", h.request.ProtoMajor, h.request.ProtoMinor, code, http.StatusText(code))...)
+	// Date
+	b = appendHeader(b, "Date", time.Now().UTC().Format(http.TimeFormat))
+	// Content-Length / Transfer-Encoding，HEAD 回包与 GET 相同但没有 body
+	switch {
+	case h.responseChunked:
+		b = appendHeader(b, "Transfer-Encoding", "chunked")
+	case h.request.Method == http.MethodHead:
+		b = appendHeader(b, "Content-Length", strconv.FormatInt(h.headContentLength, 10))
 	default:
-		header += fmt.Sprintf("Content-Type: application/x-www-form-urlencoded\r\n")
+		b = appendHeader(b, "Content-Length", strconv.FormatInt(h.responseContentLength, 10))
+	}
+	// Content-Type
+	b = appendHeader(b, "Content-Type", mimeType(h.responseType()))
+	// Connection
+	if !h.KeepAlive() {
+		b = appendHeader(b, "Connection", "close")
+	} else if h.request.ProtoMajor == 1 && h.request.ProtoMinor == 0 {
+		b = appendHeader(b, "Connection", "keep-alive")
+	}
+	// 返回码
+	if h.responseCode != 0 {
+		b = appendHeader(b, ResultCode, strconv.FormatInt(int64(h.responseCode), 10))
+	}
+	if h.responseMsg != "" {
+		b = appendHeader(b, ResultMsg, h.responseMsg)
 	}
 	// 自定义
-	if h.extMap != nil {
-		for k, v := range h.extMap {
-			if k == "Date" || k == "Content-Length" || k == "Content-Type" {
-				continue
-			}
-			header += fmt.Sprintf("%s: %s\r\n", k, v)
+	for k, v := range h.extMap {
+		switch http.CanonicalHeaderKey(k) {
+		case "Date", "Content-Length", "Content-Type", "Transfer-Encoding", "Connection":
+			continue
 		}
+		b = appendHeader(b, k, v)
 	}
 	// CRLF
-	crlf := fmt.Sprintf("\r\n")
-	return []byte(statusLine + header + crlf), nil
+	return append(b, crlf...), nil
 }
 
-// Unmarshal 解析HTTP首部
-// golang官方提供http.ReadRequest库
-func (h *HTTPHeader) Unmarshal(data []byte) error {
-	var err error
-	h.request, err = http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+func appendHeader(b []byte, k, v string) []byte {
+	b = append(b, k...)
+	b = append(b, ": "...)
+	b = append(b, headerValueReplacer.Replace(v)...)
+	return append(b, crlf...)
+}
+
+// UnmarshalHeader 解析HTTP请求，data 为 HTTPCheck 拆出的完整请求包
+// golang官方提供http.ReadRequest库，chunked body 在此一并解码
+func (h *HTTPHeader) UnmarshalHeader(data []byte) error {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
 	if err != nil {
 		return err
 	}
+	defer req.Body.Close()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	h.request = req
+	h.body = body
 	return nil
 }
 
+// MarshalBody 按协商的 MIME 类型序列化响应 body
+// 协商的类型不支持 body 的类型时返回的错误包装 protocol.ErrUnknownCodec
+// HEAD 请求同样序列化以得到 Content-Length，返回空 body
+func (h *HTTPHeader) MarshalBody(m any) ([]byte, error) {
+	h.responseChunked = false
+	h.headContentLength = 0
+	head := h.request != nil && h.request.Method == http.MethodHead
+	var body []byte
+	if !protocol.IsNil(m) && h.request != nil {
+		c, err := getCodec(h.responseType())
+		if err != nil {
+			return nil, err
+		}
+		if body, err = c.Marshal(m); err != nil {
+			if errors.Is(err, codec.ErrUnsupportedType) {
+				err = fmt.Errorf("%w: %v", protocol.ErrUnknownCodec, err)
+			}
+			return nil, err
+		}
+	}
+
+	// 业务通过 SetExtKv 设置 Transfer-Encoding: chunked 时以 chunked 编码回包，仅 HTTP/1.1 支持
+	// HEAD 回包只有首部，没有 chunk 及结束标记
+	te := h.extMap["Transfer-Encoding"]
+	h.responseChunked = strings.EqualFold(te, "chunked") && h.request != nil && h.request.ProtoAtLeast(1, 1)
+	if head {
+		h.headContentLength = int64(len(body))
+		return nil, nil
+	}
+	if h.responseChunked {
+		return appendChunked(make([]byte, 0, len(body)+32), body, ChunkSize), nil
+	}
+	return body, nil
+}
+
+// UnmarshalBody 按请求 Content-Type 反序列化 body，data 参数未使用，body 已在 UnmarshalHeader 中解析
+func (h *HTTPHeader) UnmarshalBody(_ []byte, m any) error {
+	if protocol.IsNil(m) || len(h.body) == 0 {
+		return nil
+	}
+	t := h.GetProtoType()
+	if t == ProtoTypeUnknown {
+		return fmt.Errorf("%w: Content-Type %s", protocol.ErrUnknownCodec, h.request.Header.Get("Content-Type"))
+	}
+	c, err := getCodec(t)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(h.body, m)
+}
+
+// KeepAlive 回包后是否保持连接，实现 protocol.KeepAliver
+// HTTP/1.1 默认长连接，HTTP/1.0 需显式声明 Connection: keep-alive
+func (h *HTTPHeader) KeepAlive() bool {
+	if h.request == nil {
+		return true
+	}
+	if h.request.Close {
+		return false
+	}
+	if h.request.ProtoAtLeast(1, 1) {
+		return true
+	}
+	return strings.EqualFold(h.request.Header.Get("Connection"), "keep-alive")
+}
+
 // GetCmdPattern 构造CmdPattern
+// /demo.test.echo.send 映射为 demo.test.echo.send，多级路径如 /api/echo 原样返回
 func (h *HTTPHeader) GetCmdPattern() string {
-	if h == nil || h.request == nil || h.request.URL == nil {
+	if h.request == nil || h.request.URL == nil {
 		return ""
 	}
-	return h.request.URL.Path
+	path := h.request.URL.Path
+	if trimmed := strings.TrimPrefix(path, "/"); !strings.Contains(trimmed, "/") {
+		return trimmed
+	}
+	return path
+}
+
+// getHeader 获取请求首部
+func (h *HTTPHeader) getHeader(k string) string {
+	if h.request == nil || h.request.Header == nil {
+		return ""
+	}
+	return h.request.Header.Get(k)
+}
+
+func (h *HTTPHeader) getUint(k string) uint64 {
+	v, _ := strconv.ParseUint(h.getHeader(k), 10, 64)
+	return v
 }
 
 // GetUid 获取Uid
 func (h *HTTPHeader) GetUid() uint64 {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return 0
-	}
-	if len(h.request.Header[Uid]) == 0 {
-		return 0
-	}
-	id, _ := strconv.Atoi(h.request.Header[Uid][0])
-	return uint64(id)
+	return h.getUint(Uid)
 }
 
 // SetUid 设置Uid
 func (h *HTTPHeader) SetUid(uid uint64) {
-	if h == nil || h.extMap == nil {
-		return
-	}
 	h.SetExtKv(Uid, strconv.FormatUint(uid, 10))
 }
 
 // GetTokenType 获取TokenType
 func (h *HTTPHeader) GetTokenType() uint32 {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return 0
-	}
-	if len(h.request.Header[TokenType]) == 0 {
-		return 0
-	}
-	id, _ := strconv.Atoi(h.request.Header[TokenType][0])
-	return uint32(id)
+	return uint32(h.getUint(TokenType))
 }
 
 // SetTokenType 设置TokenType
 func (h *HTTPHeader) SetTokenType(v uint32) {
-	if h == nil || h.extMap == nil {
-		return
-	}
 	h.SetExtKv(TokenType, strconv.FormatUint(uint64(v), 10))
 }
 
 // GetAuthType 获取AuthType
 func (h *HTTPHeader) GetAuthType() uint32 {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return 0
-	}
-	if len(h.request.Header[AuthType]) == 0 {
-		return 0
-	}
-	id, _ := strconv.Atoi(h.request.Header[AuthType][0])
-	return uint32(id)
+	return uint32(h.getUint(AuthType))
 }
 
 // SetAuthType 设置AuthType
 func (h *HTTPHeader) SetAuthType(v uint32) {
-	if h == nil || h.extMap == nil {
-		return
-	}
 	h.SetExtKv(AuthType, strconv.FormatUint(uint64(v), 10))
 }
 
 // GetOpenID 获取OpenID
 func (h *HTTPHeader) GetOpenID() string {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return ""
-	}
-	if len(h.request.Header[OpenID]) == 0 {
-		return ""
-	}
-	return h.request.Header[OpenID][0]
+	return h.getHeader(OpenID)
 }
 
 // SetOpenID 设置OpenID
 func (h *HTTPHeader) SetOpenID(v string) {
-	if h == nil || h.extMap == nil {
-		return
-	}
 	h.SetExtKv(OpenID, v)
 }
 
 // GetTicket 获取Ticket
 func (h *HTTPHeader) GetTicket() string {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return ""
-	}
-	if len(h.request.Header[Ticket]) == 0 {
-		return ""
-	}
-	return h.request.Header[Ticket][0]
+	return h.getHeader(Ticket)
 }
 
 // SetTicket 设置Ticket
 func (h *HTTPHeader) SetTicket(v string) {
-	if h == nil || h.extMap == nil {
-		return
-	}
 	h.SetExtKv(Ticket, v)
 }
 
-// GetClientIP 获取客户端IP
+// GetClientIP 获取客户端IP，取 X-Forwarded-For 中的第一个地址
 func (h *HTTPHeader) GetClientIP() uint32 {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return 0
-	}
-	if len(h.request.Header["X-Forwarded-For"]) == 0 {
-		return 0
+	xff := h.getHeader("X-Forwarded-For")
+	if i := strings.IndexByte(xff, ','); i >= 0 {
+		xff = xff[:i]
 	}
-	clientIP := net.ParseIP(h.request.Header["X-Forwarded-For"][0])
-	if len(clientIP) == 0 {
+	clientIP := net.ParseIP(strings.TrimSpace(xff)).To4()
+	if clientIP == nil {
 		return 0
 	}
-	return binary.BigEndian.Uint32(clientIP)
+	return binary.LittleEndian.Uint32(clientIP)
 }
 
 // SetClientIP 设置ClientIP
 func (h *HTTPHeader) SetClientIP(v uint32) {
-	if h == nil || h.extMap == nil {
+	if v == 0 {
 		return
 	}
-	h.SetExtKv("X-Forwarded-For", strconv.FormatUint(uint64(v), 10))
+	ip := make(net.IP, net.IPv4len)
+	binary.LittleEndian.PutUint32(ip, v)
+	h.SetExtKv("X-Forwarded-For", ip.String())
 }
 
 // GetAppID 获取App ID
 func (h *HTTPHeader) GetAppID() uint32 {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return 0
-	}
-	if len(h.request.Header[Appid]) == 0 {
-		return 0
-	}
-	id, _ := strconv.Atoi(h.request.Header[Appid][0])
-	return uint32(id)
+	return uint32(h.getUint(Appid))
 }
 
 // SetAppID 设置AppID
 func (h *HTTPHeader) SetAppID(v uint32) {
-	if h == nil || h.extMap == nil {
-		return
-	}
 	h.SetExtKv(Appid, strconv.FormatUint(uint64(v), 10))
 }
 
 // GetOpenAppID 获取OpenAppID
 func (h *HTTPHeader) GetOpenAppID() string {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return ""
-	}
-	if len(h.request.Header[OpenAppID]) == 0 {
-		return ""
-	}
-	return h.request.Header[OpenAppID][0]
+	return h.getHeader(OpenAppID)
 }
 
 // SetOpenAppID 设置OpenAppID
 func (h *HTTPHeader) SetOpenAppID(v string) {
-	if h == nil || h.extMap == nil {
-		return
-	}
 	h.SetExtKv(OpenAppID, v)
 }
 
 // GetAuthInfo 获取AuthInfo
-func (h *HTTPHeader) GetAuthInfo() AuthInfo {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return AuthInfo{}
+func (h *HTTPHeader) GetAuthInfo() protocol.AuthInfo {
+	if h.request == nil {
+		return protocol.AuthInfo{}
 	}
-	return AuthInfo{
+	return protocol.AuthInfo{
 		UID:       h.GetUid(),
 		TokenType: h.GetTokenType(),
 		AuthType:  h.GetAuthType(),
@@ -294,385 +376,212 @@ func (h *HTTPHeader) GetAuthInfo() AuthInfo {
 		ClientIP:  h.GetClientIP(),
 		AppID:     h.GetAppID(),
 		OpenAppID: h.GetOpenAppID(),
+		TraceID:   h.GetTraceID(),
 	}
 }
 
 // SetAuthInfo 设置AuthInfo
-func (h *HTTPHeader) SetAuthInfo(v *AuthInfo) {
-	if h == nil || h.extMap == nil {
+func (h *HTTPHeader) SetAuthInfo(v *protocol.AuthInfo) {
+	if v == nil {
 		return
 	}
-	h.SetUid(v.UID)
-	h.SetTokenType(v.TokenType)
-	h.SetAuthType(v.AuthType)
-	h.SetOpenID(v.OpenID)
-	h.SetTicket(v.Ticket)
+	if v.UID != 0 {
+		h.SetUid(v.UID)
+	}
+	if v.TokenType != 0 {
+		h.SetTokenType(v.TokenType)
+	}
+	if v.AuthType != 0 {
+		h.SetAuthType(v.AuthType)
+	}
+	if v.OpenID != "" {
+		h.SetOpenID(v.OpenID)
+	}
+	if v.Ticket != "" {
+		h.SetTicket(v.Ticket)
+	}
 	h.SetClientIP(v.ClientIP)
-	h.SetAppID(v.AppID)
-	h.SetOpenAppID(v.OpenAppID)
+	if v.AppID != 0 {
+		h.SetAppID(v.AppID)
+	}
+	if v.OpenAppID != "" {
+		h.SetOpenAppID(v.OpenAppID)
+	}
 }
 
 // GetResultCode 获取业务错误码
 func (h *HTTPHeader) GetResultCode() int32 {
-	if h == nil {
-		return 0
-	}
 	return h.responseCode
 }
 
 // SetResultCode 设置业务错误码
 func (h *HTTPHeader) SetResultCode(code int32) {
-	if h == nil {
-		return
-	}
 	h.responseCode = code
 }
 
 // GetResultMsg 获取业务错误信息
 func (h *HTTPHeader) GetResultMsg() string {
-	if h == nil {
-		return ""
-	}
 	return h.responseMsg
 }
 
 // SetResultMsg 设置错误信息
 func (h *HTTPHeader) SetResultMsg(msg string) {
-	if h == nil {
-		return
-	}
 	h.responseMsg = msg
 }
 
 // GetResponseContentLength 获取HTTP相应Content-Length
 func (h *HTTPHeader) GetResponseContentLength() int64 {
-	if h == nil {
-		return 0
-	}
 	return h.responseContentLength
 }
 
 // SetResponseContentLength 设置HTTP相应Content-Length
 func (h *HTTPHeader) SetResponseContentLength(length int64) {
-	if h == nil {
-		return
-	}
 	h.responseContentLength = length
 }
 
+// SetBodyLen 设置HTTP相应Content-Length
+func (h *HTTPHeader) SetBodyLen(l uint32) {
+	h.responseContentLength = int64(l)
+}
+
 // GetLocalServiceName 获取Remote Service Name
 func (h *HTTPHeader) GetLocalServiceName() string {
-	return ""
+	return h.getHeader(LocalServiceName)
 }
 
 // SetLocalServiceName 设置Remote Service Name
-func (h *HTTPHeader) SetLocalServiceName(string) {
+func (h *HTTPHeader) SetLocalServiceName(v string) {
+	h.SetExtKv(LocalServiceName, v)
 }
 
 // GetServiceName 获取Local Service Name
 func (h *HTTPHeader) GetServiceName() string {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return ""
-	}
-	if len(h.request.Header[ServiceName]) == 0 {
-		return ""
-	}
-	return h.request.Header[ServiceName][0]
+	return h.getHeader(ServiceName)
 }
 
-// GetProtoType 获取body MIME类型
+// GetProtoType 获取请求body MIME类型，无body时为 JSON
 func (h *HTTPHeader) GetProtoType() uint8 {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return TmeProtoTypeUnknown
-	}
-	if len(h.request.Header["Content-Type"]) == 0 {
-		return TmeProtoTypeUnknown
-	}
-	cts := strings.Split(h.request.Header["Content-Type"][0], ";")
-	switch cts[0] {
-	case "application/json":
-		return TmeProtoTypeJSON
-	case "application/jce":
-		return TmeProtoTypeJce
-	case "application/pb":
-		return TmeProtoTypePb
-	default:
-		return TmeProtoTypeUnknown
+	ct := h.getHeader("Content-Type")
+	if ct == "" {
+		return ProtoTypeJSON
 	}
+	return protoType(ct)
 }
 
-// SetProtoType 设置body MIME类型
+// SetProtoType 设置响应body MIME类型
 func (h *HTTPHeader) SetProtoType(v uint8) {
-	if h == nil {
-		return
-	}
 	h.responseProtoType = v
 }
 
-// GetTraceID 获取TraceID
-func (h *HTTPHeader) GetTraceID() string {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return ""
+// responseType 响应 body 类型协商
+// 优先使用业务设置的类型，其次按 Accept 首部的 q 值选取，最后与请求类型一致
+func (h *HTTPHeader) responseType() uint8 {
+	if h.responseProtoType != ProtoTypeUnknown {
+		return h.responseProtoType
 	}
-	if len(h.request.Header[TraceID]) == 0 {
-		return ""
+	if t := acceptType(h.getHeader("Accept")); t != ProtoTypeUnknown {
+		return t
 	}
-	return h.request.Header[TraceID][0]
+	if t := h.GetProtoType(); t != ProtoTypeUnknown {
+		return t
+	}
+	return ProtoTypeJSON
+}
+
+// GetTraceID 获取TraceID
+func (h *HTTPHeader) GetTraceID() string {
+	return h.getHeader(TraceID)
 }
 
 // SetTraceID 设置TraceID
 func (h *HTTPHeader) SetTraceID(v string) {
-	if h == nil || h.extMap == nil {
-		return
-	}
 	h.SetExtKv(TraceID, v)
 }
 
 // GetSpanID 获取Span ID
 func (h *HTTPHeader) GetSpanID() uint64 {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return 0
-	}
-	if len(h.request.Header[SpanID]) == 0 {
-		return 0
-	}
-	id, _ := strconv.Atoi(h.request.Header[SpanID][0])
-	return uint64(id)
+	return h.getUint(SpanID)
 }
 
 // SetSpanID 设置Span ID
 func (h *HTTPHeader) SetSpanID(v uint64) {
-	if h == nil || h.extMap == nil {
-		return
-	}
 	h.SetExtKv(SpanID, strconv.FormatUint(v, 10))
 }
 
 // GetParentSpanID 获取ParentSpanID
 func (h *HTTPHeader) GetParentSpanID() uint64 {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return 0
-	}
-	if len(h.request.Header[ParentSpanID]) == 0 {
-		return 0
-	}
-	id, _ := strconv.Atoi(h.request.Header[ParentSpanID][0])
-	return uint64(id)
+	return h.getUint(ParentSpanID)
 }
 
 // SetParentSpanID 设置ParentSpanID
 func (h *HTTPHeader) SetParentSpanID(v uint64) {
-	if h == nil || h.extMap == nil {
-		return
-	}
 	h.SetExtKv(ParentSpanID, strconv.FormatUint(v, 10))
 }
 
 // GetFlag 获取Flag
 func (h *HTTPHeader) GetFlag() uint32 {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return 0
-	}
-	if len(h.request.Header[Flag]) == 0 {
-		return 0
-	}
-	id, _ := strconv.Atoi(h.request.Header[Flag][0])
-	return uint32(id)
+	return uint32(h.getUint(Flag))
 }
 
 // SetFlag 设置Flag
 func (h *HTTPHeader) SetFlag(v uint32) {
-	if h == nil || h.extMap == nil {
-		return
-	}
 	h.SetExtKv(Flag, strconv.FormatUint(uint64(v), 10))
 }
 
 // GetEnv 获取环境标识
 func (h *HTTPHeader) GetEnv() string {
-	if h == nil || h.request == nil || h.request.Header == nil {
-		return ""
-	}
-	if len(h.request.Header[Env]) == 0 {
-		return ""
-	}
-	return h.request.Header[Env][0]
+	return h.getHeader(Env)
 }
 
-// GetExtKv 获取HTTP Header
+// GetExtKv 获取HTTP请求Header，多值以 ", " 连接
 func (h *HTTPHeader) GetExtKv(k string) (string, bool) {
-	if h == nil || h.request == nil || h.request.Header == nil {
+	if h.request == nil || h.request.Header == nil {
 		return "", false
 	}
-	if len(h.request.Header[k]) == 0 {
+	v, ok := h.request.Header[http.CanonicalHeaderKey(k)]
+	if !ok {
 		return "", false
 	}
-	var v string = h.request.Header[k][0]
-	for i := 1; i < len(h.request.Header[k]); i++ {
-		v += ", " + h.request.Header[k][i]
-	}
-	return v, false
+	return strings.Join(v, ", "), true
 }
 
-// SetExtKv 设置HTTP Header
+// SetExtKv 设置HTTP响应Header
 func (h *HTTPHeader) SetExtKv(k string, v string) bool {
-	if h == nil || h.extMap == nil {
-		return false
+	if h.extMap == nil {
+		h.extMap = make(map[string]string)
 	}
-	h.extMap[k] = v
-	return false
+	h.extMap[http.CanonicalHeaderKey(k)] = v
+	return true
 }
 
 // GetExtends 获取所有扩展首部
 func (h *HTTPHeader) GetExtends() map[string]string {
-	if h == nil {
-		return nil
-	}
 	return h.extMap
 }
 
-// Clone HTTP首部深复制
-func (h *HTTPHeader) Clone() TMEHead {
-	newer := NewHTTPHeader()
-	// TODO
-	return newer
-}
-
-// HTTPCheck HTTP 1.x协议包完整性校验(暂不支持Chunked)
-func HTTPCheck(data []byte) (int, error) {
-	var index int = 0
-
-	// 解析请求行
-	for index < len(data) && data[index] != '\n' {
-		index++
-	}
-	if index == len(data) {
-		return 0, nil
-	}
-	if index <= 1 {
-		return 0, fmt.Errorf("invalid request line: %v", data[0:index])
-	}
-	if data[index-1] != '\r' {
-		return 0, fmt.Errorf("invalid request line: %v", data[0:index])
-	}
-	index++
-
-	var headerLength, contentLength int = index, 0
-	// 解析请求首部
-	var end int = index
-	for ; end < len(data); end++ {
-		if data[end] == '\n' && end > index && data[end-1] == '\r' {
-			k, v := mimeHeader(data[index:end])
-			if strings.ToLower(string(k)) == strings.ToLower("Content-Length") {
-				length, err := strconv.Atoi(string(v))
-				if err != nil {
-					cat.Logf("Content-Length Atoi failed, %s\n", err)
-					return 0, fmt.Errorf("Content-Length Atoi failed, %s", err)
-				}
-				contentLength = length
-			}
-			if end == index+1 {
-				headerLength = end + 1
-				break
-			}
-			index = end + 1
-			end = index
-		}
-	}
-	if end == len(data) {
-		return 0, nil
+// Clone HTTP首部深复制，请求只读共享
+func (h *HTTPHeader) Clone() protocol.Protocol {
+	newer := *h
+	newer.extMap = make(map[string]string, len(h.extMap))
+	for k, v := range h.extMap {
+		newer.extMap[k] = v
 	}
-
-	// 包长度
-	if contentLength > len(data[headerLength:]) {
-		return 0, nil
-	}
-
-	return headerLength + contentLength, nil
+	return &newer
 }
 
-// HTTPBodyMarshal 序列化包体
-func HTTPBodyMarshal(head *HTTPHeader, rsp interface{}) ([]byte, error) {
-	if head == nil {
-		return nil, fmt.Errorf("HTTPHeader is nil")
-	}
-	// Content-Type(预留, 但业务可通过API设置)
-	contentType := head.responseProtoType
-	if contentType != TmeProtoTypeJce ||
-		contentType != TmeProtoTypePb ||
-		contentType != TmeProtoTypeJSON {
-		contentType = head.GetProtoType()
-	}
-	var err error
-	var bodyBuf []byte
-	switch contentType {
-	case TmeProtoTypeJSON:
-		bodyBuf, err = json.Marshal(rsp)
-		if err != nil {
-			return nil, err
-		}
-	case TmeProtoTypeJce:
-		rsp, _ := rsp.(gojce.Message)
-		var b bytes.Buffer // TODO: 感觉这里可以预留 header 的长度 后面就不用复制了
-		err = rsp.Encode(&b)
-		if err != nil {
-			return nil, err
-		}
-		bodyBuf = b.Bytes()
-	case TmeProtoTypePb:
-		rsp, _ := rsp.(proto.Message)
-		bodyBuf, err = proto.Marshal(rsp)
-		if err != nil {
-			return nil, err
-		}
-	default:
-		return nil, fmt.Errorf("invalid Content-Type:%d", contentType)
-	}
-
-	return bodyBuf, nil
+// CloneEmpty 创建空HTTP首部
+func (h *HTTPHeader) CloneEmpty() protocol.Protocol {
+	return NewHTTPHeader()
 }
 
-// HTTPBodyUnmarshal 反序列化包体
-func HTTPBodyUnmarshal(head *HTTPHeader, data []byte, req interface{}) error {
-	var err error
-	if head == nil {
-		head = NewHTTPHeader()
+// Reset 重置为空首部，用于对象池复用
+func (h *HTTPHeader) Reset() {
+	extMap := h.extMap
+	for k := range extMap {
+		delete(extMap, k)
 	}
-	if head.request == nil {
-		err = head.Unmarshal(data)
-		if err != nil {
-			return err
-		}
-	}
-	// 读取HTTP Body
-	defer head.request.Body.Close()
-	body, err := ioutil.ReadAll(head.request.Body)
-	if err != nil {
-		return err
-	}
-
-	// Body协议解析
-	// https://cs.opensource.google/go/go/+/refs/tags/go1.17.1:src/net/textproto/reader.go;drc=refs%2Ftags%2Fgo1.17.1;bpv=0;bpt=0;l=635
-	// golang源码自动将Header统一转成标准格式
-	if len(head.request.Header) == 0 || len(head.request.Header["Content-Type"]) == 0 {
-		return fmt.Errorf("Content-Type empty")
-	}
-	cts := strings.Split(head.request.Header["Content-Type"][0], ";")
-	switch cts[0] {
-	case "application/json":
-		err = json.Unmarshal(body, req)
-		return err
-	case "application/jce":
-		if req, ok := req.(gojce.Message); ok {
-			err = req.Decode(bytes.NewBuffer(body))
-		}
-		return err
-	case "application/pb":
-		if req, ok := req.(proto.Message); ok {
-			err = proto.Unmarshal(body, req)
-		}
-		return err
-	default:
-		return fmt.Errorf("invalid Content-Type:%s", head.request.Header["Content-Type"][0])
+	*h = HTTPHeader{extMap: extMap}
+	if h.extMap == nil {
+		h.extMap = make(map[string]string)
 	}
 }
@@ -0,0 +1,204 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/erpc-go/erpc/codec"
+)
+
+type testMessage struct {
+	Msg string `json:"msg"`
+}
+
+func (m *testMessage) ReadFrom(r io.Reader) (int64, error) {
+	b, err := io.ReadAll(r)
+	m.Msg = string(b)
+	return int64(len(b)), err
+}
+
+func (m *testMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, m.Msg)
+	return int64(n), err
+}
+
+func TestHTTPCheck(t *testing.T) {
+	get := "GET /demo.test.echo.send HTTP/1.1\r\nHost: a\r\n\r\n"
+	post := "POST /x HTTP/1.1\r\nContent-Length: 5\r\n\r\nhello"
+	chunked := "POST /x HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5;ext=1\r\nhello\r\n3\r\nabc\r\n0\r\nTrailer: v\r\n\r\n"
+
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr bool
+	}{
+		{"get", get, len(get), false},
+		{"no header", "GET / HTTP/1.0\r\n\r\n", 18, false},
+		{"partial header", get[:10], 0, false},
+		{"content length", post, len(post), false},
+		{"partial body", post[:len(post)-1], 0, false},
+		{"sticky", post + get, len(post), false},
+		{"chunked", chunked, len(chunked), false},
+		{"partial chunked", chunked[:len(chunked)-2], 0, false},
+		{"chunked sticky", chunked + get, len(chunked), false},
+		{"bad length", "POST /x HTTP/1.1\r\nContent-Length: x\r\n\r\n", 0, true},
+		{"bad chunk", "POST /x HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n", 0, true},
+		{"bad request line", "GET /\r\n\r\n", 0, true},
+	}
+	for _, tt := range tests {
+		n, err := HTTPCheck([]byte(tt.data))
+		if n != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s: HTTPCheck = %d, %v, want %d", tt.name, n, err, tt.want)
+		}
+	}
+}
+
+func TestHTTPRoundTrip(t *testing.T) {
+	req := "POST /demo.test.echo.send HTTP/1.1\r\nHost: a\r\nContent-Type: application/json\r\n" +
+		"Accept: text/html, application/json\r\nTrace-Id: t1\r\nUid: 10\r\nTransfer-Encoding: chunked\r\n\r\n" +
+		"4\r\n{\"ms\r\n8\r\ng\":\"hi\"}\r\n0\r\n\r\n"
+
+	h := NewHTTPHeader()
+	if err := h.UnmarshalHeader([]byte(req)); err != nil {
+		t.Fatalf("UnmarshalHeader failed: %v", err)
+	}
+	if h.GetCmdPattern() != "demo.test.echo.send" || h.GetTraceID() != "t1" || h.GetUid() != 10 || !h.KeepAlive() {
+		t.Fatalf("unexpected header: %s %s %d", h.GetCmdPattern(), h.GetTraceID(), h.GetUid())
+	}
+	in := &testMessage{}
+	if err := h.UnmarshalBody(nil, in); err != nil || in.Msg != "hi" {
+		t.Fatalf("UnmarshalBody = %v, %+v", err, in)
+	}
+
+	h.SetResultCode(404)
+	h.SetResultMsg("not\r\nfound")
+	h.SetExtKv("x-custom", "v")
+	body, err := h.MarshalBody(&testMessage{Msg: "ok"})
+	if err != nil {
+		t.Fatalf("MarshalBody failed: %v", err)
+	}
+	h.SetBodyLen(uint32(len(body)))
+	head, err := h.MarshalHeader()
+	if err != nil {
+		t.Fatalf("MarshalHeader failed: %v", err)
+	}
+
+	rsp, err := http.ReadResponse(bufioReader(append(head, body...)), nil)
+	if err != nil {
+		t.Fatalf("ReadResponse failed: %v", err)
+	}
+	got, _ := io.ReadAll(rsp.Body)
+	if rsp.StatusCode != 404 || string(got) != `{"msg":"ok"}` ||
+		!strings.HasPrefix(rsp.Header.Get("Content-Type"), "application/json") ||
+		rsp.Header.Get(ResultMsg) != "not  found" || rsp.Header.Get("X-Custom") != "v" {
+		t.Fatalf("unexpected response: %d %q %v", rsp.StatusCode, got, rsp.Header)
+	}
+}
+
+func TestHTTPChunkedResponse(t *testing.T) {
+	h := NewHTTPHeader()
+	if err := h.UnmarshalHeader([]byte("GET /x HTTP/1.1\r\nHost: a\r\nConnection: close\r\n\r\n")); err != nil {
+		t.Fatalf("UnmarshalHeader failed: %v", err)
+	}
+	if h.KeepAlive() {
+		t.Fatalf("Connection: close should not keep alive")
+	}
+	ChunkSize = 4
+	defer func() { ChunkSize = 32 * 1024 }()
+	h.SetExtKv("Transfer-Encoding", "chunked")
+	body, _ := h.MarshalBody(&testMessage{Msg: strings.Repeat("a", 10)})
+	h.SetBodyLen(uint32(len(body)))
+	head, _ := h.MarshalHeader()
+
+	rsp, err := http.ReadResponse(bufioReader(append(head, body...)), nil)
+	if err != nil {
+		t.Fatalf("ReadResponse failed: %v", err)
+	}
+	got, _ := io.ReadAll(rsp.Body)
+	if rsp.StatusCode != 200 || len(rsp.TransferEncoding) == 0 || !rsp.Close || !bytes.Contains(got, []byte("aaaaaaaaaa")) {
+		t.Fatalf("unexpected response: %d %q %+v", rsp.StatusCode, got, rsp)
+	}
+}
+
+func TestHTTPResponseType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   uint8
+	}{
+		{"", ProtoTypeJSON},
+		{"text/html", ProtoTypeJSON},
+		{"application/x-protobuf, application/json", ProtoTypePb},
+		{"application/json;q=0.5, application/x-protobuf", ProtoTypePb},
+		{"application/x-protobuf;q=0.2, */*;q=0.8", ProtoTypeJSON},
+		{"application/x-protobuf;q=0, application/jce;q=0.1", ProtoTypeJce},
+		{"application/x-protobuf;q=x, application/jce;q=0.1", ProtoTypeJce},
+	}
+	for _, tt := range tests {
+		h := NewHTTPHeader()
+		req := "GET /x HTTP/1.1\r\nHost: a\r\nAccept: " + tt.accept + "\r\n\r\n"
+		if err := h.UnmarshalHeader([]byte(req)); err != nil {
+			t.Fatalf("UnmarshalHeader failed: %v", err)
+		}
+		if got := h.responseType(); got != tt.want {
+			t.Errorf("Accept %q: responseType = %d, want %d", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestHTTPHeadResponse(t *testing.T) {
+	h := NewHTTPHeader()
+	if err := h.UnmarshalHeader([]byte("HEAD /x HTTP/1.1\r\nHost: a\r\n\r\n")); err != nil {
+		t.Fatalf("UnmarshalHeader failed: %v", err)
+	}
+	// Content-Length 与 GET 回包相同
+	g := NewHTTPHeader()
+	if err := g.UnmarshalHeader([]byte("GET /x HTTP/1.1\r\nHost: a\r\n\r\n")); err != nil {
+		t.Fatalf("UnmarshalHeader failed: %v", err)
+	}
+	get, err := g.MarshalBody(&testMessage{Msg: "ok"})
+	if err != nil || len(get) == 0 {
+		t.Fatalf("GET MarshalBody = %q, %v", get, err)
+	}
+	body, err := h.MarshalBody(&testMessage{Msg: "ok"})
+	if err != nil || len(body) != 0 {
+		t.Fatalf("HEAD response should have no body: %q, %v", body, err)
+	}
+	h.SetBodyLen(uint32(len(body)))
+	head, err := h.MarshalHeader()
+	if want := fmt.Sprintf("Content-Length: %d\r\n", len(get)); err != nil || !bytes.Contains(head, []byte(want)) {
+		t.Fatalf("HEAD response header %q should contain %q, err:%v", head, want, err)
+	}
+
+	h.SetExtKv("Transfer-Encoding", "chunked")
+	body, err = h.MarshalBody(&testMessage{Msg: "ok"})
+	if err != nil || len(body) != 0 {
+		t.Fatalf("HEAD response should have no body: %q, %v", body, err)
+	}
+}
+
+func TestHTTPDynamicPb(t *testing.T) {
+	pb := []byte{0x0a, 0x02, 'h', 'i'} // field 1: "hi"
+	req := fmt.Sprintf("POST /x HTTP/1.1\r\nHost: a\r\nContent-Type: application/x-protobuf\r\nContent-Length: %d\r\n\r\n%s", len(pb), pb)
+	h := NewHTTPHeader()
+	if err := h.UnmarshalHeader([]byte(req)); err != nil {
+		t.Fatalf("UnmarshalHeader failed: %v", err)
+	}
+	d := &codec.Dynamic{}
+	if err := h.UnmarshalBody(nil, d); err != nil {
+		t.Fatalf("UnmarshalBody failed: %v", err)
+	}
+	body, err := h.MarshalBody(d)
+	if err != nil || !bytes.Equal(body, pb) {
+		t.Fatalf("MarshalBody = %x, %v", body, err)
+	}
+}
+
+func bufioReader(b []byte) *bufio.Reader {
+	return bufio.NewReader(bytes.NewReader(b))
+}
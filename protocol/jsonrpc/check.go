@@ -0,0 +1,99 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/erpc-go/erpc/protocol"
+	phttp "github.com/erpc-go/erpc/protocol/http"
+)
+
+// HTTPPath HTTP 承载时的请求路径，仅 POST 该路径的请求按 JSON-RPC 处理
+var HTTPPath = "/jsonrpc"
+
+// Detector JSON-RPC 协议探测
+// tcp 承载时报文为 JSON 对象或数组，允许前导空白；HTTP 承载时为 POST HTTPPath 的请求
+func Detector() protocol.Detector {
+	return protocol.DetectorFunc(func(data []byte) protocol.DetectResult {
+		if res := httpDetector().Detect(data); res != protocol.DetectNoMatch {
+			return res
+		}
+		trimmed := bytes.TrimLeft(data, whitespace)
+		if len(trimmed) == 0 {
+			return protocol.DetectMore
+		}
+		if trimmed[0] == '{' || trimmed[0] == '[' {
+			return protocol.DetectMatch
+		}
+		return protocol.DetectNoMatch
+	})
+}
+
+func httpDetector() protocol.Detector {
+	return protocol.PrefixDetector([]byte("POST "+HTTPPath+" "), []byte("POST "+HTTPPath+"?"))
+}
+
+// isHTTP 报文是否为 HTTP 承载
+func isHTTP(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("POST "))
+}
+
+// JSON 空白字符
+const whitespace = " \t\r\n"
+
+// Check JSON-RPC 包完整性检查，约定同 server/net.Checker
+// tcp 承载时以一个完整的 JSON 值为一个包，值之后已收到的空白字符一并计入
+func Check(data []byte) (int, error) {
+	if isHTTP(data) {
+		return phttp.HTTPCheck(data)
+	}
+	n, err := scanValue(data)
+	if n == 0 || err != nil {
+		return 0, err
+	}
+	for n < len(data) && bytes.IndexByte([]byte(whitespace), data[n]) >= 0 {
+		n++
+	}
+	return n, nil
+}
+
+// scanValue 扫描前导空白及之后的 JSON 对象或数组，返回其结束位置，未收完返回 0
+// 仅匹配括号及字符串，值的合法性由解析时校验
+func scanValue(data []byte) (int, error) {
+	var depth int
+	var inString, escaped bool
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth < 0 {
+				return 0, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			if depth == 0 {
+				return i + 1, nil
+			}
+		default:
+			if depth == 0 {
+				return 0, fmt.Errorf("invalid json-rpc message, offset %d: %q", i, c)
+			}
+		}
+	}
+	return 0, nil
+}
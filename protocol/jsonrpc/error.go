@@ -0,0 +1,62 @@
+package jsonrpc
+
+import "github.com/erpc-go/erpc/protocol"
+
+// JSON-RPC 2.0 预定义错误码
+const (
+	CodeParseError     = -32700 // 请求不是合法的 JSON
+	CodeInvalidRequest = -32600 // 请求不是合法的请求对象
+	CodeMethodNotFound = -32601 // 方法不存在
+	CodeInvalidParams  = -32602 // 参数不合法
+	CodeInternalError  = -32603 // 内部错误
+	CodeServerTimeout  = -32001 // 服务端超时，取自实现自定义的 [-32099, -32000]
+)
+
+var codeMessages = map[int]string{
+	CodeParseError:     "Parse error",
+	CodeInvalidRequest: "Invalid Request",
+	CodeMethodNotFound: "Method not found",
+	CodeInvalidParams:  "Invalid params",
+	CodeInternalError:  "Internal error",
+	CodeServerTimeout:  "Server timeout",
+}
+
+// Error JSON-RPC 标准错误对象
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// Error error interface
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// newError 创建错误对象，message 为空时使用错误码的默认信息
+func newError(code int, message string) *Error {
+	if message == "" {
+		message = codeMessages[code]
+	}
+	return &Error{Code: code, Message: message}
+}
+
+// ErrorMapper 业务返回码到 JSON-RPC 错误码的映射，可替换
+var ErrorMapper = DefaultErrorMapper
+
+// DefaultErrorMapper 默认错误码映射
+// 框架返回码映射为对应的预定义错误码，其余返回码直接作为错误码
+func DefaultErrorMapper(code int32) int {
+	switch code {
+	case protocol.StatusNotFound:
+		return CodeMethodNotFound
+	case protocol.StatusBadRequest:
+		return CodeInvalidParams
+	case protocol.StatusServerTimeout:
+		return CodeServerTimeout
+	case protocol.StatusError:
+		return CodeInternalError
+	default:
+		return int(code)
+	}
+}
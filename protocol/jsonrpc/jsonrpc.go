@@ -0,0 +1,482 @@
+package jsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/erpc-go/erpc/codec"
+	"github.com/erpc-go/erpc/protocol"
+)
+
+// Version 协议版本
+const Version = "2.0"
+
+func init() {
+	protocol.RegisterProtocol(protocol.ProtocolJson, protocol.Registration{
+		Name:     "json",
+		Detector: Detector(),
+		Checker:  protocol.CheckerFunc(Check),
+		New: func() protocol.Protocol {
+			return NewPackage()
+		},
+		Priority: 1, // HTTP 承载时先于 http 协议探测
+	})
+}
+
+// request JSON-RPC 请求对象
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// response JSON-RPC 响应对象
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Package JSON-RPC 2.0 报文，实现 protocol.Protocol
+// 一个请求包可以是单个调用或批量调用，每个调用为一个 Package，单个调用时请求包本身即为该调用
+// 报文整体为 JSON，MarshalBody 仅序列化 result，完整的响应对象在 MarshalHeader 中构造
+type Package struct {
+	method     string
+	params     json.RawMessage
+	id         json.RawMessage // 通知无 id
+	result     json.RawMessage
+	err        *Error // 调用本身不合法时的错误，不分发
+	resultCode int32
+	resultMsg  string
+	extends    map[string]string
+	header     http.Header // HTTP 承载时的请求首部，批量调用共享
+
+	// 请求包字段
+	httpRequest *http.Request // HTTP 承载时的请求
+	batch       bool          // 是否批量调用
+	calls       []*Package    // 请求包中的调用
+}
+
+// NewPackage 创建空报文
+func NewPackage() *Package {
+	return &Package{
+		extends: make(map[string]string),
+	}
+}
+
+// MarshalHeader 构造单个调用的响应对象，需在 MarshalBody 之后调用
+func (p *Package) MarshalHeader() ([]byte, error) {
+	rsp := response{JSONRPC: Version, ID: p.id}
+	switch {
+	case p.err != nil:
+		rsp.Error = p.err
+	case p.resultCode != protocol.StatusOk:
+		rsp.Error = newError(ErrorMapper(p.resultCode), p.resultMsg)
+		if rsp.Error.Code != int(p.resultCode) {
+			rsp.Error.Data = map[string]int32{"resultCode": p.resultCode}
+		}
+	default:
+		rsp.Result = p.result
+		if len(rsp.Result) == 0 {
+			rsp.Result = json.RawMessage("null")
+		}
+	}
+	return json.Marshal(rsp)
+}
+
+// UnmarshalHeader 解析请求包，data 为 Check 拆出的完整请求包
+// 请求不是合法 JSON 或请求对象不合法时不返回错误，由 MarshalBatch 返回对应的错误对象
+func (p *Package) UnmarshalHeader(data []byte) error {
+	if isHTTP(data) {
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			return err
+		}
+		defer req.Body.Close()
+		if data, err = io.ReadAll(req.Body); err != nil {
+			return err
+		}
+		p.httpRequest = req
+		p.header = req.Header
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			p.err = newError(CodeParseError, err.Error())
+		} else if len(items) == 0 {
+			p.err = newError(CodeInvalidRequest, "empty batch")
+		} else {
+			p.batch = true
+			p.calls = make([]*Package, 0, len(items))
+			for _, item := range items {
+				call := NewPackage()
+				call.header = p.header
+				call.parse(item)
+				p.calls = append(p.calls, call)
+			}
+			return nil
+		}
+	} else if !json.Valid(data) {
+		p.err = newError(CodeParseError, "")
+	} else {
+		p.parse(data)
+	}
+	p.calls = []*Package{p}
+	return nil
+}
+
+// parse 解析单个请求对象
+func (p *Package) parse(data []byte) {
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		p.err = newError(CodeInvalidRequest, err.Error())
+		return
+	}
+	p.id = req.ID
+	if req.JSONRPC != Version || req.Method == "" {
+		p.err = newError(CodeInvalidRequest, "")
+		return
+	}
+	if len(p.id) > 0 && p.id[0] != '"' && p.id[0] != 'n' && (p.id[0] < '0' || p.id[0] > '9') && p.id[0] != '-' {
+		p.id = nil
+		p.err = newError(CodeInvalidRequest, "invalid id")
+		return
+	}
+	p.method = req.Method
+	p.params = req.Params
+}
+
+// MarshalBody 序列化 result，返回空，result 由 MarshalHeader 写入响应对象
+func (p *Package) MarshalBody(m any) ([]byte, error) {
+	if protocol.IsNil(m) {
+		p.result = nil
+		return nil, nil
+	}
+	b, err := getCodec().Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	p.result = b
+	return nil, nil
+}
+
+// UnmarshalBody 反序列化 params，data 参数未使用，params 已在 UnmarshalHeader 中解析
+// 仅支持按名称传参，即 params 为 JSON 对象
+func (p *Package) UnmarshalBody(_ []byte, m any) error {
+	if protocol.IsNil(m) || len(p.params) == 0 {
+		return nil
+	}
+	return getCodec().Unmarshal(p.params, m)
+}
+
+// Notification 是否为通知，实现 protocol.Notifier
+func (p *Package) Notification() bool {
+	return p.id == nil
+}
+
+// Calls 需要分发的调用，实现 protocol.Batcher
+func (p *Package) Calls() []protocol.Protocol {
+	calls := make([]protocol.Protocol, 0, len(p.calls))
+	for _, call := range p.calls {
+		if call.err == nil {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// MarshalBatch 按请求顺序合并回包，实现 protocol.Batcher
+// 通知不回包；全部为通知时 tcp 承载不回包，HTTP 承载返回 204
+func (p *Package) MarshalBatch(rsps [][]byte) ([]byte, error) {
+	var objects [][]byte
+	extends := make(map[string]string)
+	var i int
+	for _, call := range p.calls {
+		if call.err != nil {
+			obj, err := call.MarshalHeader()
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, obj)
+			continue
+		}
+		rsp := rsps[i]
+		i++
+		for k, v := range call.extends {
+			extends[k] = v
+		}
+		if call.Notification() || len(rsp) == 0 {
+			continue
+		}
+		objects = append(objects, rsp)
+	}
+
+	var body []byte
+	switch {
+	case len(objects) == 0:
+	case p.batch:
+		body = append(append([]byte{'['}, bytes.Join(objects, []byte{','})...), ']')
+	default:
+		body = objects[0]
+	}
+	if p.httpRequest != nil {
+		return p.marshalHTTP(body, extends), nil
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	return append(body, '\n'), nil
+}
+
+// marshalHTTP HTTP 承载时构造响应
+func (p *Package) marshalHTTP(body []byte, extends map[string]string) []byte {
+	req := p.httpRequest
+	b := make([]byte, 0, 128+len(body))
+	if len(body) == 0 {
+		b = append(b, fmt.Sprintf("HTTP/%d.%d 204 No Content\r\n", req.ProtoMajor, req.ProtoMinor)...)
+	} else {
+		b = append(b, fmt.Sprintf("HTTP/%d.%d 200 OK\r\n", req.ProtoMajor, req.ProtoMinor)...)
+		b = append(b, "Content-Type: application/json\r\n"...)
+		b = append(b, "Content-Length: "+strconv.Itoa(len(body))+"\r\n"...)
+	}
+	if !p.KeepAlive() {
+		b = append(b, "Connection: close\r\n"...)
+	} else if !req.ProtoAtLeast(1, 1) {
+		b = append(b, "Connection: keep-alive\r\n"...)
+	}
+	for k, v := range extends {
+		switch k {
+		case "Content-Type", "Content-Length", "Connection", "Transfer-Encoding":
+			continue
+		}
+		b = append(b, k+": "+headerValueReplacer.Replace(v)+"\r\n"...)
+	}
+	b = append(b, "\r\n"...)
+	return append(b, body...)
+}
+
+// 响应首部值不允许换行
+var headerValueReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// KeepAlive 回包后是否保持连接，实现 protocol.KeepAliver
+func (p *Package) KeepAlive() bool {
+	req := p.httpRequest
+	if req == nil {
+		return true
+	}
+	if req.Close {
+		return false
+	}
+	if req.ProtoAtLeast(1, 1) {
+		return true
+	}
+	return strings.EqualFold(req.Header.Get("Connection"), "keep-alive")
+}
+
+// Clone 深复制
+func (p *Package) Clone() protocol.Protocol {
+	newer := *p
+	newer.extends = make(map[string]string, len(p.extends))
+	for k, v := range p.extends {
+		newer.extends[k] = v
+	}
+	return &newer
+}
+
+// CloneEmpty 创建同协议的空报文
+func (p *Package) CloneEmpty() protocol.Protocol {
+	return NewPackage()
+}
+
+// Reset 重置为空报文，保留 extends 已分配的空间
+func (p *Package) Reset() {
+	extends := p.extends
+	for k := range extends {
+		delete(extends, k)
+	}
+	*p = Package{extends: extends}
+	if p.extends == nil {
+		p.extends = make(map[string]string)
+	}
+}
+
+// GetCmdPattern 获取路由，即 method
+func (p *Package) GetCmdPattern() string {
+	return p.method
+}
+
+// GetID 获取请求 id 的原始 JSON，通知为 nil
+func (p *Package) GetID() json.RawMessage {
+	return p.id
+}
+
+// getHeader 获取 HTTP 承载时的请求首部
+func (p *Package) getHeader(k string) string {
+	if p.header == nil {
+		return ""
+	}
+	return p.header.Get(k)
+}
+
+func (p *Package) getUint(k string) uint64 {
+	v, _ := strconv.ParseUint(p.getHeader(k), 10, 64)
+	return v
+}
+
+// GetUid 获取Uid
+func (p *Package) GetUid() uint64 {
+	return p.getUint("Uid")
+}
+
+// GetAppID 获取App ID
+func (p *Package) GetAppID() uint32 {
+	return uint32(p.getUint("App-Id"))
+}
+
+// GetAuthInfo 获取AuthInfo
+func (p *Package) GetAuthInfo() protocol.AuthInfo {
+	return protocol.AuthInfo{
+		UID:    p.GetUid(),
+		AppID:  p.GetAppID(),
+		OpenID: p.getHeader("Open-Id"),
+		Ticket: p.getHeader("Ticket"),
+	}
+}
+
+// SetAuthInfo 不支持
+func (p *Package) SetAuthInfo(*protocol.AuthInfo) {}
+
+// GetResultCode 获取业务错误码
+func (p *Package) GetResultCode() int32 {
+	return p.resultCode
+}
+
+// SetResultCode 设置业务错误码，非 0 时以错误对象回包
+func (p *Package) SetResultCode(code int32) {
+	p.resultCode = code
+}
+
+// GetResultMsg 获取业务错误信息
+func (p *Package) GetResultMsg() string {
+	return p.resultMsg
+}
+
+// SetResultMsg 设置业务错误信息，作为错误对象的 message
+func (p *Package) SetResultMsg(msg string) {
+	p.resultMsg = msg
+}
+
+// GetLocalServiceName 获取主调服务名
+func (p *Package) GetLocalServiceName() string {
+	return p.getHeader("Local-Service-Name")
+}
+
+// SetLocalServiceName 设置主调服务名
+func (p *Package) SetLocalServiceName(v string) {
+	p.SetExtKv("Local-Service-Name", v)
+}
+
+// GetServiceName 获取被调服务名
+func (p *Package) GetServiceName() string {
+	return p.getHeader("Service-Name")
+}
+
+// GetProtoType 获取 body 编码方式，固定为 JSON
+func (p *Package) GetProtoType() uint8 {
+	return ProtoTypeJSON
+}
+
+// SetProtoType 不支持，body 固定为 JSON
+func (p *Package) SetProtoType(uint8) {}
+
+// GetTraceID 获取TraceID
+func (p *Package) GetTraceID() string {
+	return p.getHeader("Trace-Id")
+}
+
+// SetTraceID 设置TraceID
+func (p *Package) SetTraceID(v string) {
+	p.SetExtKv("Trace-Id", v)
+}
+
+// GetSpanID 获取Span ID
+func (p *Package) GetSpanID() uint64 {
+	return p.getUint("Span-Id")
+}
+
+// SetSpanID 设置Span ID
+func (p *Package) SetSpanID(v uint64) {
+	p.SetExtKv("Span-Id", strconv.FormatUint(v, 10))
+}
+
+// GetParentSpanID 获取Parent Span ID
+func (p *Package) GetParentSpanID() uint64 {
+	return p.getUint("Parent-Span-Id")
+}
+
+// SetParentSpanID 设置Parent Span ID
+func (p *Package) SetParentSpanID(v uint64) {
+	p.SetExtKv("Parent-Span-Id", strconv.FormatUint(v, 10))
+}
+
+// GetFlag 获取染色标志
+func (p *Package) GetFlag() uint32 {
+	return uint32(p.getUint("Flag"))
+}
+
+// SetFlag 设置染色标志
+func (p *Package) SetFlag(v uint32) {
+	p.SetExtKv("Flag", strconv.FormatUint(uint64(v), 10))
+}
+
+// GetEnv 获取环境标识
+func (p *Package) GetEnv() string {
+	return p.getHeader("Env")
+}
+
+// GetExtKv 获取 HTTP 承载时的请求首部，tcp 承载时无扩展首部
+func (p *Package) GetExtKv(k string) (string, bool) {
+	if p.header == nil {
+		return "", false
+	}
+	v, ok := p.header[http.CanonicalHeaderKey(k)]
+	if !ok {
+		return "", false
+	}
+	return strings.Join(v, ", "), true
+}
+
+// SetExtKv 设置 HTTP 承载时的响应首部，批量调用时各调用设置的首部合并后返回
+func (p *Package) SetExtKv(k string, v string) bool {
+	if p.extends == nil {
+		p.extends = make(map[string]string)
+	}
+	p.extends[http.CanonicalHeaderKey(k)] = v
+	return true
+}
+
+// GetExtends 获取所有扩展首部
+func (p *Package) GetExtends() map[string]string {
+	return p.extends
+}
+
+// SetBodyLen body 长度由 MarshalHeader 决定，忽略
+func (p *Package) SetBodyLen(uint32) {}
+
+// ProtoTypeJSON body 编码方式，取值同 erpc 协议首部 codec 字段
+const ProtoTypeJSON = uint8(codec.IDJson)
+
+func getCodec() codec.Codec {
+	r, _ := codec.Get(codec.IDJson)
+	return r.Codec
+}
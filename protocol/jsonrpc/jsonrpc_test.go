@@ -0,0 +1,177 @@
+package jsonrpc
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/erpc-go/erpc/protocol"
+)
+
+type testMessage struct {
+	Msg string `json:"msg"`
+}
+
+func (m *testMessage) ReadFrom(r io.Reader) (int64, error) {
+	b, err := io.ReadAll(r)
+	m.Msg = string(b)
+	return int64(len(b)), err
+}
+
+func (m *testMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, m.Msg)
+	return int64(n), err
+}
+
+func TestCheck(t *testing.T) {
+	obj := `{"jsonrpc":"2.0","method":"a.b.c.d","params":{"msg":"}]\"{"},"id":1}`
+	post := "POST /jsonrpc HTTP/1.1\r\nContent-Length: 2\r\n\r\n{}"
+
+	tests := []struct {
+		name    string
+		data    string
+		want    int
+		wantErr bool
+	}{
+		{"object", obj, len(obj), false},
+		{"newline", obj + "\r\n", len(obj) + 2, false},
+		{"leading space", "\n " + obj, len(obj) + 2, false},
+		{"partial", obj[:len(obj)-1], 0, false},
+		{"sticky", obj + "\n" + obj, len(obj) + 1, false},
+		{"batch", "[" + obj + "," + obj + "]", 2*len(obj) + 3, false},
+		{"http", post, len(post), false},
+		{"unbalanced", "{}}", 2, false},
+		{"garbage", "x", 0, true},
+		{"close first", "]", 0, true},
+	}
+	for _, tt := range tests {
+		n, err := Check([]byte(tt.data))
+		if n != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("%s: Check = %d, %v, want %d", tt.name, n, err, tt.want)
+		}
+	}
+}
+
+func TestDetector(t *testing.T) {
+	tests := []struct {
+		data string
+		want protocol.DetectResult
+	}{
+		{`{"jsonrpc"`, protocol.DetectMatch},
+		{" \n[", protocol.DetectMatch},
+		{"\r\n", protocol.DetectMore},
+		{"POST /json", protocol.DetectMore},
+		{"POST /jsonrpc HTTP/1.1", protocol.DetectMatch},
+		{"POST /jsonrpc?a=1 HTTP/1.1", protocol.DetectMatch},
+		{"POST /demo HTTP/1.1", protocol.DetectNoMatch},
+		{"\x95", protocol.DetectNoMatch},
+	}
+	for _, tt := range tests {
+		if got := Detector().Detect([]byte(tt.data)); got != tt.want {
+			t.Errorf("Detect(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+	if got := protocol.GetProtocolType([]byte("POST /jsonrpc HTTP/1.1\r\n")); got != protocol.ProtocolJson {
+		t.Fatalf("GetProtocolType = %v, want json", got)
+	}
+}
+
+// respond 模拟 server 处理单个调用并打包
+func respond(t *testing.T, call protocol.Protocol) []byte {
+	req := &testMessage{}
+	if err := call.UnmarshalBody(nil, req); err != nil {
+		call.SetResultCode(protocol.StatusBadRequest)
+		call.SetResultMsg(err.Error())
+	} else if call.GetCmdPattern() != "demo.test.echo.send" {
+		call.SetResultCode(protocol.StatusNotFound)
+	} else if _, err := call.MarshalBody(&testMessage{Msg: "echo:" + req.Msg}); err != nil {
+		t.Fatalf("marshal body failed: %v", err)
+	}
+	rsp, err := call.MarshalHeader()
+	if err != nil {
+		t.Fatalf("marshal header failed: %v", err)
+	}
+	return rsp
+}
+
+func serve(t *testing.T, data string) string {
+	p := NewPackage()
+	if err := p.UnmarshalHeader([]byte(data)); err != nil {
+		t.Fatalf("unmarshal header failed: %v", err)
+	}
+	calls := p.Calls()
+	rsps := make([][]byte, len(calls))
+	for i, call := range calls {
+		rsps[i] = respond(t, call)
+	}
+	rsp, err := p.MarshalBatch(rsps)
+	if err != nil {
+		t.Fatalf("marshal batch failed: %v", err)
+	}
+	return string(rsp)
+}
+
+func TestServe(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"call", `{"jsonrpc":"2.0","method":"demo.test.echo.send","params":{"msg":"hi"},"id":1}`,
+			`{"jsonrpc":"2.0","result":{"msg":"echo:hi"},"id":1}` + "\n"},
+		{"notification", `{"jsonrpc":"2.0","method":"demo.test.echo.send","params":{"msg":"hi"}}`, ""},
+		{"not found", `{"jsonrpc":"2.0","method":"none","id":"a"}`,
+			`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found","data":{"resultCode":1002}},"id":"a"}` + "\n"},
+		{"invalid params", `{"jsonrpc":"2.0","method":"demo.test.echo.send","params":[1],"id":null}`,
+			`"code":-32602`},
+		{"parse error", `{"jsonrpc":"2.0",}`,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}` + "\n"},
+		{"empty batch", `[]`, `"code":-32600`},
+		{"invalid request", `{"jsonrpc":"1.0","method":"x","id":2}`, `"code":-32600`},
+		{"invalid id", `{"jsonrpc":"2.0","method":"x","id":{}}`, `"id":null`},
+		{"batch", `[{"jsonrpc":"2.0","method":"demo.test.echo.send","params":{"msg":"a"},"id":1},` +
+			`{"jsonrpc":"2.0","method":"demo.test.echo.send","params":{"msg":"b"}},1,` +
+			`{"jsonrpc":"2.0","method":"demo.test.echo.send","params":{"msg":"c"},"id":3}]`,
+			`[{"jsonrpc":"2.0","result":{"msg":"echo:a"},"id":1},` +
+				`{"jsonrpc":"2.0","error":{"code":-32600,"message":"json: cannot unmarshal number into Go value of type jsonrpc.request"},"id":null},` +
+				`{"jsonrpc":"2.0","result":{"msg":"echo:c"},"id":3}]` + "\n"},
+	}
+	for _, tt := range tests {
+		got := serve(t, tt.data)
+		if got != tt.want && (tt.want == "" || !strings.Contains(got, tt.want)) {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	body := `{"jsonrpc":"2.0","method":"demo.test.echo.send","params":{"msg":"hi"},"id":1}`
+	req := "POST /jsonrpc HTTP/1.0\r\nContent-Length: " + itoa(len(body)) + "\r\nTrace-Id: t1\r\n\r\n" + body
+
+	p := NewPackage()
+	if err := p.UnmarshalHeader([]byte(req)); err != nil {
+		t.Fatalf("unmarshal header failed: %v", err)
+	}
+	if p.GetTraceID() != "t1" || p.KeepAlive() {
+		t.Fatalf("unexpected header: trace %q, keepalive %v", p.GetTraceID(), p.KeepAlive())
+	}
+	p.SetExtKv("x-cost", "1")
+	rsp, _ := p.MarshalBatch([][]byte{respond(t, p.Calls()[0])})
+	if !strings.HasPrefix(string(rsp), "HTTP/1.0 200 OK\r\n") || !strings.Contains(string(rsp), "X-Cost: 1\r\n") ||
+		!strings.Contains(string(rsp), "Connection: close\r\n") || !strings.HasSuffix(string(rsp), `"id":1}`) {
+		t.Fatalf("unexpected response: %q", rsp)
+	}
+
+	// 全部为通知时返回 204
+	body = `{"jsonrpc":"2.0","method":"demo.test.echo.send"}`
+	req = "POST /jsonrpc HTTP/1.1\r\nContent-Length: " + itoa(len(body)) + "\r\n\r\n" + body
+	if rsp := serve(t, req); !strings.HasPrefix(rsp, "HTTP/1.1 204 No Content\r\n") {
+		t.Fatalf("unexpected response: %q", rsp)
+	}
+}
+
+func itoa(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
@@ -1,12 +1,18 @@
 package protocol
 
-import "github.com/erpc-go/jce-codec"
+import (
+	"errors"
+	"reflect"
+
+	"github.com/erpc-go/erpc/compress"
+)
 
 type Protocol interface {
 	Header
 	Body
 	Clone() Protocol
 	CloneEmpty() Protocol
+	Reset() // 重置为空报文，用于对象池复用
 }
 
 // TME协议通用接口
@@ -43,7 +49,85 @@ type Header interface {
 	SetBodyLen(uint32)
 }
 
+// ErrUnknownCodec body 编码方式不支持，Body 实现返回的错误应包装该错误
+var ErrUnknownCodec = errors.New("unknown codec")
+
+// ErrUnknownCompress body 压缩方式不支持，Body 实现返回的错误应包装该错误
+var ErrUnknownCompress = errors.New("unknown compress")
+
+// Body 报文 body 编解码，body 为任意类型，按首部中的编码方式选择 codec.Codec
 type Body interface {
-	MarshalBody(jce.Messager) ([]byte, error)
-	UnmarshalBody([]byte, jce.Messager) error
+	MarshalBody(any) ([]byte, error)
+	UnmarshalBody([]byte, any) error
+}
+
+// KeepAliver 可选接口，由 HTTP 等支持短连接的协议实现
+// 返回 false 时 server 回包后关闭连接；实现该接口的协议没有请求标识，同一连接上按请求顺序回包
+type KeepAliver interface {
+	KeepAlive() bool
+}
+
+// Notifier 可选接口，由 JSON-RPC 等支持通知的协议实现
+// 返回 true 时请求为通知，server 处理前调用 Context.SetNoResponse
+type Notifier interface {
+	Notification() bool
+}
+
+// Compressible 可选接口，由首部携带 body 压缩方式的协议实现
+// MarshalBody 时 body 编码后不小于阈值才压缩，否则将压缩方式置为 None
+type Compressible interface {
+	GetCompress() compress.CompressType
+	SetCompress(compress.CompressType)
+	// GetAcceptCompress 对端可接受的回包压缩方式
+	GetAcceptCompress() []compress.CompressType
+	SetAcceptCompress(...compress.CompressType)
+	SetCompressThreshold(int)
+}
+
+// DictCompressible 可选接口，由支持预置字典压缩(compress.ZlibDict)的协议实现
+// 字典 ID 位于压缩数据的首部，AcceptDict 为发送方已有的字典，对端只使用其中的字典压缩，否则不使用字典
+type DictCompressible interface {
+	SetCompressDict(id uint32)
+	GetAcceptDict() []uint32
+	SetAcceptDict(ids ...uint32)
+}
+
+// Batcher 可选接口，由 JSON-RPC 等一个请求包可包含多个调用的协议实现
+// server 并发分发 Calls 返回的各个调用，再由 MarshalBatch 合并回包
+type Batcher interface {
+	// Calls 请求包中需要分发的调用
+	Calls() []Protocol
+	// MarshalBatch 合并回包，rsps 与 Calls 一一对应，不回包的调用为 nil
+	// 返回空时不回包
+	MarshalBatch(rsps [][]byte) ([]byte, error)
+}
+
+// Appender 可选接口，由 body 长度位于首部的协议实现，用于减少回包的分配及复制
+// AppendPackage 将首部及 body 组成的完整报文追加到 dst，body 直接编码到预留的首部之后
+// 错误语义同 MarshalBody，出错时返回原 dst
+type Appender interface {
+	AppendPackage(dst []byte, body any) ([]byte, error)
+}
+
+// CopyResult 将 src 中处理函数设置的结果(返回码、返回信息、标志位及扩展首部)写入 dst，用于以副本处理请求后写回
+func CopyResult(dst, src Protocol) {
+	dst.SetResultCode(src.GetResultCode())
+	dst.SetResultMsg(src.GetResultMsg())
+	if f := src.GetFlag(); f != dst.GetFlag() {
+		dst.SetFlag(f)
+	}
+	for k, v := range src.GetExtends() {
+		if old, ok := dst.GetExtKv(k); !ok || old != v {
+			dst.SetExtKv(k, v)
+		}
+	}
+}
+
+// IsNil 判断 body 是否为空，包括 (*T)(nil) 形式的空指针
+func IsNil(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
 }
@@ -0,0 +1,268 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DetectResult 协议探测结果
+type DetectResult int
+
+const (
+	DetectNoMatch DetectResult = iota // 不属于该协议
+	DetectMatch                       // 属于该协议
+	DetectMore                        // 数据不足以判断，需继续读取
+)
+
+// Detector 协议探测器，根据报文前缀判断报文是否属于该协议
+type Detector interface {
+	Detect(prefix []byte) DetectResult
+}
+
+// DetectorFunc 适配器，将原生函数适配为 Detector
+type DetectorFunc func([]byte) DetectResult
+
+// Detect Detector interface
+func (f DetectorFunc) Detect(prefix []byte) DetectResult {
+	return f(prefix)
+}
+
+// Checker 包完整性检查，约定同 server/net.Checker
+// 返回值：
+//
+//	0, nil: 包未接收完
+//	>0, nil: 包已接收完并返回对应的包长度
+//	0, err: 包错误
+type Checker interface {
+	Check([]byte) (int, error)
+}
+
+// CheckerFunc 适配器，将原生函数适配为 Checker
+type CheckerFunc func([]byte) (int, error)
+
+// Check Checker interface
+func (f CheckerFunc) Check(data []byte) (int, error) {
+	return f(data)
+}
+
+// Dispatcher 请求分发，由 server 实现
+// 连接级协议解析出请求首部及 body 后，通过 Dispatch 回调业务处理
+type Dispatcher interface {
+	// Dispatch 处理请求 p，返回序列化后的响应 body，返回码等写入 p
+	Dispatch(ctx context.Context, p Protocol) ([]byte, error)
+}
+
+// ConnServer 连接级协议处理，如基于 HTTP/2 的 gRPC，协议自行管理连接上的读写
+// 服务关闭时 Draining(ctx) 关闭，协议应停止接收新请求，处理中的请求完成后返回
+type ConnServer func(ctx context.Context, conn net.Conn, d Dispatcher)
+
+type drainKey struct{}
+
+// WithDraining 设置 ConnServer 的服务关闭通知
+func WithDraining(ctx context.Context, drain <-chan struct{}) context.Context {
+	return context.WithValue(ctx, drainKey{}, drain)
+}
+
+// Draining ConnServer 获取服务关闭通知，服务关闭时 channel 关闭，未设置时返回 nil
+func Draining(ctx context.Context) <-chan struct{} {
+	drain, _ := ctx.Value(drainKey{}).(<-chan struct{})
+	return drain
+}
+
+type msgTimeoutKey struct{}
+
+// WithMsgTimeout 设置 ConnServer 上消息处理的最大时长
+func WithMsgTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, msgTimeoutKey{}, d)
+}
+
+// MsgTimeout ConnServer 获取消息处理的最大时长，协议应以此及请求携带的超时中较小的作为请求的截止时间
+// 未设置时返回 0，不限制
+func MsgTimeout(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(msgTimeoutKey{}).(time.Duration)
+	return d
+}
+
+// Registration 协议注册信息
+type Registration struct {
+	Name      string          // 协议名
+	Detector  Detector        // 协议探测
+	Checker   Checker         // 包完整性检查，连接级协议可为空
+	New       func() Protocol // 创建空报文，报文通过对象池复用，归还时调用 Reset
+	ServeConn ConnServer      // 连接级协议处理，非空时探测命中后整个连接交由其处理
+	Priority  int             // 探测优先级，数值大的先探测，同优先级按注册顺序
+}
+
+type registryEntry struct {
+	Registration
+	t    ProtocolType
+	pool sync.Pool
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      []*registryEntry // 按优先级及注册顺序探测
+)
+
+// RegisterProtocol 注册协议，同类型重复注册时覆盖
+func RegisterProtocol(t ProtocolType, r Registration) {
+	if r.Detector == nil || r.New == nil || (r.Checker == nil && r.ServeConn == nil) {
+		panic(fmt.Sprintf("invalid protocol registration: %s", t))
+	}
+	e := &registryEntry{Registration: r, t: t}
+	e.pool.New = func() any {
+		return e.New()
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	defer func() {
+		sort.SliceStable(registry, func(i, j int) bool {
+			return registry[i].Priority > registry[j].Priority
+		})
+	}()
+	for i, v := range registry {
+		if v.t == t {
+			registry[i] = e
+			return
+		}
+	}
+	registry = append(registry, e)
+}
+
+// UnRegisterProtocol 注销协议
+func UnRegisterProtocol(t ProtocolType) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	for i, v := range registry {
+		if v.t == t {
+			registry = append(registry[:i:i], registry[i+1:]...)
+			return
+		}
+	}
+}
+
+func lookup(t ProtocolType) *registryEntry {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	for _, v := range registry {
+		if v.t == t {
+			return v
+		}
+	}
+	return nil
+}
+
+// Detect 依次探测已注册协议
+// 任一协议匹配则返回该协议；否则只要有协议需要更多数据即返回 DetectMore
+func Detect(prefix []byte) (ProtocolType, DetectResult) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	res := DetectNoMatch
+	for _, v := range registry {
+		switch v.Detector.Detect(prefix) {
+		case DetectMatch:
+			return v.t, DetectMatch
+		case DetectMore:
+			res = DetectMore
+		}
+	}
+	return ProtocolUnkown, res
+}
+
+// GetChecker 获取协议的包完整性检查
+func GetChecker(t ProtocolType) Checker {
+	e := lookup(t)
+	if e == nil {
+		return nil
+	}
+	return e.Checker
+}
+
+// GetConnServer 获取连接级协议处理，非连接级协议返回 nil
+func GetConnServer(t ProtocolType) ConnServer {
+	e := lookup(t)
+	if e == nil {
+		return nil
+	}
+	return e.ServeConn
+}
+
+// Acquire 从对象池中获取协议报文，协议未注册时返回 nil
+func Acquire(t ProtocolType) Protocol {
+	e := lookup(t)
+	if e == nil {
+		return nil
+	}
+	p, _ := e.pool.Get().(Protocol)
+	return p
+}
+
+// Release 重置报文并归还对象池
+func Release(t ProtocolType, p Protocol) {
+	if p == nil {
+		return
+	}
+	e := lookup(t)
+	if e == nil {
+		return
+	}
+	p.Reset()
+	e.pool.Put(p)
+}
+
+// MagicDetector 魔数前缀探测
+func MagicDetector(magic ...byte) Detector {
+	return PrefixDetector(magic)
+}
+
+// PrefixDetector 前缀探测，报文以任一前缀开头即匹配
+func PrefixDetector(prefixes ...[]byte) Detector {
+	return DetectorFunc(func(data []byte) DetectResult {
+		res := DetectNoMatch
+		for _, p := range prefixes {
+			if len(data) >= len(p) {
+				if bytes.HasPrefix(data, p) {
+					return DetectMatch
+				}
+				continue
+			}
+			if bytes.HasPrefix(p, data) {
+				res = DetectMore
+			}
+		}
+		return res
+	})
+}
+
+// HTTP/1.x 请求方法，方法名后带空格以避免误判
+var httpMethods = [][]byte{
+	[]byte("GET "),
+	[]byte("POST "),
+	[]byte("PUT "),
+	[]byte("DELETE "),
+	[]byte("HEAD "),
+	[]byte("OPTIONS "),
+	[]byte("PATCH "),
+	[]byte("CONNECT "),
+	[]byte("TRACE "),
+}
+
+// HTTPMethodDetector HTTP/1.x 请求方法探测
+func HTTPMethodDetector() Detector {
+	return PrefixDetector(httpMethods...)
+}
+
+// HTTP2Preface HTTP/2 连接前言
+const HTTP2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// HTTP2PrefaceDetector HTTP/2 连接前言探测
+func HTTP2PrefaceDetector() Detector {
+	return PrefixDetector([]byte(HTTP2Preface))
+}
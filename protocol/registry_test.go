@@ -0,0 +1,98 @@
+package protocol
+
+import "testing"
+
+func TestPrefixDetector(t *testing.T) {
+	tests := []struct {
+		d    Detector
+		data string
+		want DetectResult
+	}{
+		{MagicDetector(0x95), "\x95\x01", DetectMatch},
+		{MagicDetector(0x95), "\x02", DetectNoMatch},
+		{MagicDetector(0x95), "", DetectMore},
+		{HTTPMethodDetector(), "GET / HTTP/1.1\r\n", DetectMatch},
+		{HTTPMethodDetector(), "POS", DetectMore},
+		{HTTPMethodDetector(), "GETX", DetectNoMatch},
+		{HTTPMethodDetector(), "PRI * HTTP/2.0", DetectNoMatch},
+		{HTTP2PrefaceDetector(), HTTP2Preface + "\x00\x00", DetectMatch},
+		{HTTP2PrefaceDetector(), "PRI * HT", DetectMore},
+	}
+	for _, tt := range tests {
+		if got := tt.d.Detect([]byte(tt.data)); got != tt.want {
+			t.Errorf("Detect(%q) = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+type resetProtocol struct {
+	Protocol
+	reset bool
+}
+
+func (p *resetProtocol) Reset() {
+	p.reset = true
+}
+
+func TestRegisterProtocol(t *testing.T) {
+	const custom = ProtocolUnkown + 1
+	RegisterProtocol(custom, Registration{
+		Name:     "custom",
+		Detector: MagicDetector(0xfe, 0xef),
+		Checker: CheckerFunc(func(data []byte) (int, error) {
+			return len(data), nil
+		}),
+		New: func() Protocol {
+			return &resetProtocol{}
+		},
+	})
+	defer UnRegisterProtocol(custom)
+
+	if got := GetProtocolType([]byte{0xfe, 0xef, 0x01}); got != custom {
+		t.Fatalf("GetProtocolType = %v, want %v", got, custom)
+	}
+	if custom.String() != "custom" {
+		t.Fatalf("String = %s", custom.String())
+	}
+	if _, res := Detect([]byte{0xfe}); res != DetectMore {
+		t.Fatalf("Detect = %v, want DetectMore", res)
+	}
+	if n, err := GetChecker(custom).Check([]byte{0xfe, 0xef}); n != 2 || err != nil {
+		t.Fatalf("Check = %d, %v", n, err)
+	}
+
+	p := Acquire(custom).(*resetProtocol)
+	Release(custom, p)
+	if !p.reset {
+		t.Fatalf("Release should reset protocol")
+	}
+
+	UnRegisterProtocol(custom)
+	if Acquire(custom) != nil {
+		t.Fatalf("Acquire unregistered protocol should return nil")
+	}
+}
+
+func TestRegisterPriority(t *testing.T) {
+	const low, high = ProtocolUnkown + 1, ProtocolUnkown + 2
+	newRegistration := func(priority int) Registration {
+		return Registration{
+			Detector: MagicDetector(0xfe),
+			Checker: CheckerFunc(func(data []byte) (int, error) {
+				return len(data), nil
+			}),
+			New: func() Protocol {
+				return &resetProtocol{}
+			},
+			Priority: priority,
+		}
+	}
+	RegisterProtocol(low, newRegistration(0))
+	defer UnRegisterProtocol(low)
+	RegisterProtocol(high, newRegistration(1))
+	defer UnRegisterProtocol(high)
+
+	if got := GetProtocolType([]byte{0xfe}); got != high {
+		t.Fatalf("GetProtocolType = %v, want %v", got, high)
+	}
+}
@@ -0,0 +1,12 @@
+package protocol
+
+// 框架返回码，业务返回码应避开该区间
+const (
+	StatusOk              = 0
+	StatusError           = 1000 // 框架内部错误
+	StatusServerTimeout   = 1001 // 服务处理超时
+	StatusNotFound        = 1002 // 路由不存在
+	StatusBadRequest      = 1003 // 请求包解析失败
+	StatusUnknownCodec    = 1004 // body 编码方式不支持
+	StatusUnknownCompress = 1005 // body 压缩方式不支持
+)
@@ -2,11 +2,23 @@ package test
 
 import (
 	"github.com/erpc-go/erpc/protocol"
-	"github.com/erpc-go/jce-codec"
 )
 
 type TestProtocol struct{}
 
+func init() {
+	protocol.RegisterProtocol(protocol.ProtocolTest, protocol.Registration{
+		Name:     "test",
+		Detector: protocol.MagicDetector(0x2),
+		Checker: protocol.CheckerFunc(func(data []byte) (int, error) {
+			return len(data), nil
+		}),
+		New: func() protocol.Protocol {
+			return &TestProtocol{}
+		},
+	})
+}
+
 func (te *TestProtocol) MarshalHeader() ([]byte, error) {
 	panic("not implemented") // TODO: Implement
 }
@@ -124,11 +136,11 @@ func (te *TestProtocol) SetBodyLen(_ uint32) {
 	panic("not implemented") // TODO: Implement
 }
 
-func (te *TestProtocol) MarshalBody(_ jce.Messager) ([]byte, error) {
+func (te *TestProtocol) MarshalBody(_ any) ([]byte, error) {
 	panic("not implemented") // TODO: Implement
 }
 
-func (te *TestProtocol) UnmarshalBody(_ []byte, _ jce.Messager) error {
+func (te *TestProtocol) UnmarshalBody(_ []byte, _ any) error {
 	panic("not implemented") // TODO: Implement
 }
 
@@ -139,3 +151,6 @@ func (te *TestProtocol) Clone() protocol.Protocol {
 func (te *TestProtocol) CloneEmpty() protocol.Protocol {
 	panic("not implemented") // TODO: Implement
 }
+
+func (te *TestProtocol) Reset() {
+}
@@ -10,9 +10,16 @@ func (p ProtocolType) String() string {
 		return "http"
 	case ProtocolGrpc:
 		return "grpc"
-	default:
-		return "unkown"
+	case ProtocolJson:
+		return "json"
+	case ProtocolTest:
+		return "test"
 	}
+	// 自定义协议
+	if e := lookup(p); e != nil && e.Name != "" {
+		return e.Name
+	}
+	return "unkown"
 }
 
 const (
@@ -24,10 +31,11 @@ const (
 	ProtocolUnkown
 )
 
+// GetProtocolType 根据报文前缀探测协议类型，未匹配或数据不足时返回 ProtocolUnkown
 func GetProtocolType(req []byte) ProtocolType {
-	if req[0] == 0x2 {
-		return ProtocolTest
+	t, res := Detect(req)
+	if res != DetectMatch {
+		return ProtocolUnkown
 	}
-
-	return ProtocolUnkown
+	return t
 }
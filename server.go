@@ -2,20 +2,34 @@ package erpc
 
 import (
 	"github.com/erpc-go/erpc/server"
-	"github.com/erpc-go/jce-codec"
 )
 
 // GlobalServerMutex 全局唯一入口配置
 var GlobalServeMutex server.ServeMutex
 
 // HandlerFunc 注册处理函数，函数形式
-func HandleFunc(pattern, token string, handler func(*server.Context), reqType, rspType jce.Messager) {
-	GlobalServeMutex.HandleFunc(pattern, token, server.HandlerFunc(handler), reqType, rspType)
+func HandleFunc(pattern, token string, handler func(*server.Context), reqType, rspType any, mw ...server.Middleware) {
+	GlobalServeMutex.HandleFunc(pattern, token, server.HandlerFunc(handler), reqType, rspType, mw...)
 }
 
 // Handle 注册处理函数，接口形式
-func Handle(pattern, token string, handler server.Handler, reqType, rspType jce.Messager) {
-	GlobalServeMutex.Handle(pattern, token, handler, reqType, rspType)
+func Handle(pattern, token string, handler server.Handler, reqType, rspType any, mw ...server.Middleware) {
+	GlobalServeMutex.Handle(pattern, token, handler, reqType, rspType, mw...)
+}
+
+// HandleTyped 注册类型化的处理函数，见 server.HandleTyped
+func HandleTyped[Req, Rsp any](pattern string, handler func(*server.Context, *Req, *Rsp) error, mw ...server.Middleware) {
+	server.HandleTyped(&GlobalServeMutex, pattern, handler, mw...)
+}
+
+// Use 注册全局中间件
+func Use(mw ...server.Middleware) {
+	GlobalServeMutex.Use(mw...)
+}
+
+// Group 创建命令字组
+func Group(prefix string, mw ...server.Middleware) *server.Group {
+	return GlobalServeMutex.Group(prefix, mw...)
 }
 
 // Alias 服务别名绑定，将src服务名对应的func依次绑定到dst对应的服务名上
@@ -23,6 +37,7 @@ func Alias(src string, dst ...string) {
 	GlobalServeMutex.Alias(src, dst...)
 }
 
-func ListenAndServe() {
-	GlobalServeMutex.Listen()
+// ListenAndServe 按 GlobalServeMutex 的配置监听并处理请求，收到退出信号后返回，见 server.ServeMutex.Listen
+func ListenAndServe() error {
+	return GlobalServeMutex.Listen()
 }
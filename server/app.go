@@ -0,0 +1,223 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	gonet "net"
+	"sync"
+	"time"
+
+	"github.com/erpc-go/erpc/server/net"
+	"github.com/erpc-go/erpc/server/workpool"
+	"github.com/erpc-go/log"
+	limit "github.com/erpc-go/ratelimit"
+)
+
+// Endpoint 监听地址，Network 为 tcp、udp 或 unix，Address 为 ip:port 或 unix socket 路径
+type Endpoint struct {
+	Network string
+	Address string
+}
+
+// transport 单个监听地址上的服务，见 net.TCPServer、net.UDPServer、net.UnixServer
+type transport interface {
+	Addr() gonet.Addr
+	Serve() error
+	Serving() <-chan struct{}
+	Shutdown(ctx context.Context) error
+}
+
+// Server 在一组监听地址上提供 Mux 的服务
+// 不依赖全局状态，同一进程(如测试)中可以同时运行多个 Server
+type Server struct {
+	Mux       *ServeMutex
+	Endpoints []Endpoint
+
+	mu         sync.Mutex
+	started    bool
+	transports []transport
+	pool       *workpool.WorkerPool
+}
+
+// NewServer 创建服务，Start 后开始处理请求
+func NewServer(sm *ServeMutex, endpoints ...Endpoint) *Server {
+	return &Server{Mux: sm, Endpoints: endpoints}
+}
+
+// Start 监听所有地址，各地址开始接收请求后返回，不阻塞
+// 任一地址监听失败时关闭已监听的地址并返回错误；ctx 只用于监听，不影响之后的服务
+func (s *Server) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return errors.New("server already started")
+	}
+	if len(s.Endpoints) == 0 {
+		return errors.New("server has no endpoint")
+	}
+
+	opts := s.options()
+	var transports []transport
+	for _, ep := range s.Endpoints {
+		t, err := listen(ctx, ep, opts)
+		if err != nil {
+			for _, t := range transports {
+				t.Shutdown(context.Background())
+			}
+			return fmt.Errorf("listen %s %s: %w", ep.Network, ep.Address, err)
+		}
+		transports = append(transports, t)
+	}
+
+	s.pool = opts.WorkerPool
+	s.pool.Start()
+	for _, t := range transports {
+		go func(t transport) {
+			if err := t.Serve(); err != nil {
+				log.Error("serve %s %s failed: %v", t.Addr().Network(), t.Addr(), err)
+			}
+		}(t)
+	}
+	for _, t := range transports {
+		<-t.Serving()
+	}
+	s.transports = transports
+	s.started = true
+	return nil
+}
+
+// options 根据 Mux 的配置生成各个监听地址共用的参数
+func (s *Server) options() net.Options {
+	sm := s.Mux
+	opts := net.Options{
+		Handler:     sm,
+		Checker:     NewChecker(sm.MaxFrameSize),
+		MsgTimeout:  sm.MsgTimeout,
+		IdleTimeout: sm.IdleTimeout,
+	}
+	switch {
+	case sm.Ratelimit > 0:
+		opts.Limiter = &syncLimiter{l: limit.New(sm.Ratelimit)}
+	case sm.Ratelimit == 0:
+		opts.Limiter = &syncLimiter{l: limit.New(defaultRatelimit)}
+	}
+	maxWorkerCount := sm.MaxWorkerCount
+	if maxWorkerCount <= 0 {
+		maxWorkerCount = defaultMaxWorkerCount
+	}
+	opts.WorkerPool = workpool.New(maxWorkerCount, time.Minute)
+	return opts
+}
+
+// defaultRatelimit 未配置 Ratelimit 时每秒的限频
+const defaultRatelimit = 999
+
+// syncLimiter 串行调用 Allow，limit.New 返回的滑动窗口不支持并发，而各个连接共用同一个限频器
+type syncLimiter struct {
+	mu sync.Mutex
+	l  limit.Limiter
+}
+
+func (s *syncLimiter) Allow() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.l.Allow()
+}
+
+func (s *syncLimiter) Wait() {
+	s.l.Wait()
+}
+
+// defaultMaxWorkerCount 未配置 MaxWorkerCount 时 udp 的最大并发请求数
+const defaultMaxWorkerCount = 10000
+
+// listen 监听地址，热重启的子进程使用从父进程继承的 socket，见 net.Listen
+func listen(ctx context.Context, ep Endpoint, opts net.Options) (transport, error) {
+	switch ep.Network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		ln, err := net.Listen(ctx, ep.Network, ep.Address)
+		if err != nil {
+			return nil, err
+		}
+		switch ln := ln.(type) {
+		case *gonet.TCPListener:
+			return net.NewTCPServer(ln, opts), nil
+		case *gonet.UnixListener:
+			return net.NewUnixServer(ln, opts), nil
+		}
+		ln.Close()
+		return nil, fmt.Errorf("unexpected listener %T", ln)
+	case "udp", "udp4", "udp6":
+		conn, err := net.ListenPacket(ctx, ep.Network, ep.Address)
+		if err != nil {
+			return nil, err
+		}
+		udp, ok := conn.(*gonet.UDPConn)
+		if !ok {
+			conn.Close()
+			return nil, fmt.Errorf("unexpected packet conn %T", conn)
+		}
+		return net.NewUDPServer(udp, opts), nil
+	default:
+		return nil, fmt.Errorf("unsupported network %q", ep.Network)
+	}
+}
+
+// Addrs 实际监听的地址，顺序同 Endpoints，端口为 0 时可以据此获取分配的端口
+func (s *Server) Addrs() []gonet.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addrs := make([]gonet.Addr, 0, len(s.transports))
+	for _, t := range s.transports {
+		addrs = append(addrs, t.Addr())
+	}
+	return addrs
+}
+
+// Shutdown 停止接收新连接及请求，关闭空闲连接，等待处理中的请求回包
+// ctx 结束时强制关闭剩余的连接，返回 *net.ShutdownError，记录所有监听地址上中断的连接数及请求数
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	transports := s.transports
+	s.transports = nil
+	s.mu.Unlock()
+
+	errs := make([]error, len(transports))
+	var wg sync.WaitGroup
+	for i, t := range transports {
+		wg.Add(1)
+		go func(i int, t transport) {
+			defer wg.Done()
+			errs[i] = t.Shutdown(ctx)
+		}(i, t)
+	}
+	wg.Wait()
+	if len(transports) > 0 {
+		s.pool.Stop()
+	}
+
+	var aborted *net.ShutdownError
+	var err error
+	for _, e := range errs {
+		var se *net.ShutdownError
+		switch {
+		case e == nil:
+		case errors.As(e, &se):
+			if aborted == nil {
+				aborted = &net.ShutdownError{Err: se.Err}
+			}
+			aborted.Conns += se.Conns
+			aborted.Requests += se.Requests
+		case err == nil:
+			err = e
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if aborted != nil {
+		return aborted
+	}
+	return nil
+}
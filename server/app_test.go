@@ -0,0 +1,293 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/erpc-go/erpc/client"
+	"github.com/erpc-go/erpc/protocol"
+	erpc "github.com/erpc-go/erpc/protocol/erpc"
+	snet "github.com/erpc-go/erpc/server/net"
+)
+
+// callEcho 在 conn 上发送 echo 请求并读取回包
+func callEcho(conn net.Conn, data string) (string, error) {
+	req := erpc.NewRequest("demo.test.echo.send")
+	body, _ := req.MarshalBody(&echoMessage{data: []byte(data)})
+	req.SetBodyLen(uint32(len(body)))
+	head, _ := req.MarshalHeader()
+	if _, err := conn.Write(append(head, body...)); err != nil {
+		return "", err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var buf []byte
+	tmp := make([]byte, 4096)
+	for {
+		n, err := conn.Read(tmp)
+		if err != nil {
+			return "", err
+		}
+		buf = append(buf, tmp[:n]...)
+		if l, err := erpc.Check(buf); err != nil || l > 0 {
+			if err != nil {
+				return "", err
+			}
+			rsp := erpc.NewPackage()
+			got := &echoMessage{}
+			if err := rsp.UnmarshalHeader(buf[:l]); err != nil {
+				return "", err
+			}
+			if err := rsp.UnmarshalBody(buf[:l], got); err != nil {
+				return "", err
+			}
+			return string(got.data), nil
+		}
+	}
+}
+
+// startServer 启动服务，测试结束时关闭
+func startServer(t *testing.T, sm *ServeMutex, endpoints ...Endpoint) *Server {
+	srv := NewServer(sm, endpoints...)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("start server failed: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return srv
+}
+
+// blockingEcho 通知 started 后等待 release 再回包
+func blockingEcho(started chan<- struct{}, release <-chan struct{}) HandlerFunc {
+	return func(c *Context) {
+		if string(c.Req.(*echoMessage).data) == "slow" {
+			started <- struct{}{}
+			<-release
+		}
+		handleEcho(c)
+	}
+}
+
+// TestServerShutdown 关闭时空闲连接立即关闭，处理中的请求回包后返回
+func TestServerShutdown(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	sm := &ServeMutex{MsgTimeout: 5 * time.Second}
+	sm.HandleFunc("demo.test.echo.send", "", blockingEcho(started, release), &echoMessage{}, &echoMessage{})
+	srv := startServer(t, sm, Endpoint{Network: "tcp", Address: "127.0.0.1:0"})
+	addr := srv.Addrs()[0].String()
+
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer idle.Close()
+	if rsp, err := callEcho(idle, "hi"); err != nil || rsp != "echo:hi" {
+		t.Fatalf("call failed, rsp:%q, err:%v", rsp, err)
+	}
+
+	busy, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer busy.Close()
+	result := make(chan error, 1)
+	go func() {
+		rsp, err := callEcho(busy, "slow")
+		if err == nil && rsp != "echo:slow" {
+			err = errors.New("unexpected response " + rsp)
+		}
+		result <- err
+	}()
+	<-started
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- srv.Shutdown(ctx)
+	}()
+
+	// 空闲连接被关闭，不再接收新连接
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := idle.Read(make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("idle connection should be closed, err:%v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		conn.Close()
+		t.Fatalf("dial should fail after shutdown")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("shutdown returned before in-flight request finished: %v", err)
+	default:
+	}
+
+	close(release)
+	if err := <-result; err != nil {
+		t.Fatalf("in-flight request failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+}
+
+// TestServerShutdownTimeout ctx 结束时强制关闭并返回中断的请求
+func TestServerShutdownTimeout(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	sm := &ServeMutex{MsgTimeout: 5 * time.Second}
+	sm.HandleFunc("demo.test.echo.send", "", blockingEcho(started, release), &echoMessage{}, &echoMessage{})
+	srv := startServer(t, sm, Endpoint{Network: "tcp", Address: "127.0.0.1:0"})
+
+	conn, err := net.Dial("tcp", srv.Addrs()[0].String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	go callEcho(conn, "slow")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	var se *snet.ShutdownError
+	if !errors.As(err, &se) || se.Conns != 1 || se.Requests != 1 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("unexpected shutdown error: %#v", err)
+	}
+}
+
+// TestServerShutdownGrpc 接管的 gRPC 连接发送 GOAWAY，等待处理中的 stream 完成，ctx 结束时计入中断的请求
+func TestServerShutdownGrpc(t *testing.T) {
+	for _, timeout := range []bool{false, true} {
+		started, release := make(chan struct{}), make(chan struct{})
+		sm := &ServeMutex{MsgTimeout: 5 * time.Second}
+		sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+			started <- struct{}{}
+			<-release
+			c.Rsp.(*pbMessage).Msg = "echo:" + c.Req.(*pbMessage).Msg
+		}, &pbMessage{}, &pbMessage{})
+		srv := startServer(t, sm, Endpoint{Network: "tcp", Address: "127.0.0.1:0"})
+
+		rsp := &pbMessage{}
+		c, _ := client.New(client.CallDesc{
+			LocalServiceName: "demo.test.client.send",
+			ServiceName:      "demo.test.echo.send",
+			Protocol:         client.AppProtocolGrpc,
+			Address:          "ip://" + srv.Addrs()[0].String(),
+			Timeout:          5 * time.Second,
+		}, protocol.AuthInfo{}, &pbMessage{Msg: "slow"}, rsp)
+		result := make(chan error, 1)
+		go func() { result <- c.Do(context.Background()) }()
+		<-started
+
+		if timeout {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			err := srv.Shutdown(ctx)
+			cancel()
+			close(release)
+			var se *snet.ShutdownError
+			if !errors.As(err, &se) || se.Conns != 1 || se.Requests != 1 {
+				t.Fatalf("unexpected shutdown error: %#v", err)
+			}
+			<-result
+			continue
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			done <- srv.Shutdown(ctx)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		select {
+		case err := <-done:
+			t.Fatalf("shutdown returned before in-flight stream finished: %v", err)
+		default:
+		}
+		close(release)
+		if err := <-result; err != nil || rsp.Msg != "echo:slow" {
+			t.Fatalf("in-flight stream failed, rsp:%q, err:%v", rsp.Msg, err)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("shutdown failed: %v", err)
+		}
+	}
+}
+
+// TestMultipleServers 同一进程中的多个服务互不影响
+func TestMultipleServers(t *testing.T) {
+	dir := t.TempDir()
+	var servers []*Server
+	for i, name := range []string{"a", "b"} {
+		name := name
+		sm := &ServeMutex{}
+		sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+			handleEcho(c)
+			c.Rsp.(*echoMessage).data = append([]byte(name+":"), c.Rsp.(*echoMessage).data...)
+		}, &echoMessage{}, &echoMessage{})
+		servers = append(servers, startServer(t, sm,
+			Endpoint{Network: "tcp", Address: "127.0.0.1:0"},
+			Endpoint{Network: "udp", Address: "127.0.0.1:0"},
+			Endpoint{Network: "unix", Address: filepath.Join(dir, name+".sock")},
+		))
+		if len(servers[i].Addrs()) != 3 {
+			t.Fatalf("unexpected addrs %v", servers[i].Addrs())
+		}
+	}
+
+	for i, srv := range servers {
+		want := []string{"a", "b"}[i] + ":echo:hi"
+		for _, addr := range srv.Addrs() {
+			conn, err := net.Dial(addr.Network(), addr.String())
+			if err != nil {
+				t.Fatalf("dial %s failed: %v", addr, err)
+			}
+			rsp, err := callEcho(conn, "hi")
+			conn.Close()
+			if err != nil || rsp != want {
+				t.Fatalf("%s %s: rsp:%q, err:%v", addr.Network(), addr, rsp, err)
+			}
+		}
+	}
+
+	if err := servers[0].Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	addr := servers[1].Addrs()[0]
+	conn, err := net.Dial(addr.Network(), addr.String())
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	if rsp, err := callEcho(conn, "hi"); err != nil || rsp != "b:echo:hi" {
+		t.Fatalf("rsp:%q, err:%v", rsp, err)
+	}
+}
+
+func TestServerStartError(t *testing.T) {
+	sm := &ServeMutex{}
+	srv := startServer(t, sm, Endpoint{Network: "tcp", Address: "127.0.0.1:0"})
+	addr := srv.Addrs()[0].String()
+
+	// 第二个地址监听失败时关闭已监听的地址
+	other := NewServer(sm, Endpoint{Network: "udp", Address: "127.0.0.1:0"}, Endpoint{Network: "tcp", Address: addr})
+	if err := other.Start(context.Background()); err == nil {
+		t.Fatalf("start should fail on used address")
+	}
+	if len(other.Addrs()) != 0 {
+		t.Fatalf("unexpected addrs %v", other.Addrs())
+	}
+	if err := NewServer(sm, Endpoint{Network: "sctp", Address: ":0"}).Start(context.Background()); err == nil {
+		t.Fatalf("start should fail on unsupported network")
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -10,7 +11,6 @@ import (
 	"time"
 
 	"github.com/erpc-go/erpc/protocol"
-	"github.com/erpc-go/jce-codec"
 	"github.com/erpc-go/log"
 )
 
@@ -26,11 +26,11 @@ var (
 
 // Context 上下文
 type Context struct {
-	Req        jce.Messager // 请求包
-	Rsp        jce.Messager // 响应包
-	startTime  time.Time    // 创建时间
-	endTime    time.Time    //
-	noResponse bool         // 是否需要回包
+	Req        any       // 请求包
+	Rsp        any       // 响应包
+	startTime  time.Time // 创建时间
+	endTime    time.Time //
+	noResponse bool      // 是否需要回包
 	Protocol   protocol.Protocol
 	jsonFormat bool // response是否进行格式化输出
 	fromWNS    bool // 是否WNS协议
@@ -51,12 +51,18 @@ type Context struct {
 	writer        io.Writer
 	buffer        *bytes.Buffer
 	level         int
+
+	// 以下用于 Timeout 为处理函数创建请求及响应的副本，见 dispatch
+	reqBody []byte // 请求 body，只在 dispatch 期间有效
+	newReq  func() any
+	newRsp  func() any
 }
 
 // NewContext 创建新上下文
 func NewContext(ctx context.Context) *Context {
 	newCtx := Context{
 		startTime: time.Now(),
+		Context:   ctx,
 	}
 	newCtx.LogLevel = 0
 	return &newCtx
@@ -95,6 +101,19 @@ func (ctx *Context) SetResult(resultCode int32) {
 	ctx.Protocol.SetResultCode(resultCode)
 }
 
+// SetError 以错误设置返回码及错误信息
+// err 为 *Error 时使用其返回码，否则未设置返回码时为 StatusError
+func (ctx *Context) SetError(err error) {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		ctx.SetResult(e.Code)
+	case ctx.Result() == protocol.StatusOk:
+		ctx.SetResult(protocol.StatusError)
+	}
+	ctx.SetResultMsg(err.Error())
+}
+
 // ResultMsg 获取错误信息
 func (ctx *Context) ResultMsg() string {
 	if ctx.Protocol == nil {
@@ -292,3 +311,30 @@ func (ctx *Context) AsyncProcess(f func(*Context)) {
 		f(c)
 	}()
 }
+
+// copyMessages 为处理函数创建请求及响应的副本：请求由原始 body 重新解析，响应为新的实例
+// 副本持有 body 的复制，超时后外层返回时 body 所在的缓冲区可能被复用，嵌套的 Timeout 仍需重新解析
+// 不是由 dispatch 创建的 Context 没有原始 body，沿用原来的请求及响应
+func (ctx *Context) copyMessages() error {
+	if ctx.newReq == nil || ctx.Protocol == nil {
+		return nil
+	}
+	req := ctx.newReq()
+	if err := ctx.Protocol.UnmarshalBody(ctx.reqBody, req); err != nil {
+		return err
+	}
+	ctx.Req, ctx.Rsp = req, ctx.newRsp()
+	ctx.reqBody = append([]byte(nil), ctx.reqBody...)
+	return nil
+}
+
+// copyResult 写回副本 from 的处理结果，包括响应、是否回包、报文中的返回码等，见 protocol.CopyResult
+func (ctx *Context) copyResult(from *Context) {
+	ctx.Req, ctx.Rsp = from.Req, from.Rsp
+	ctx.noResponse = from.noResponse
+	ctx.jsonFormat = from.jsonFormat
+	ctx.ExtData = from.ExtData
+	if ctx.Protocol != nil {
+		protocol.CopyResult(ctx.Protocol, from.Protocol)
+	}
+}
@@ -1,11 +1,13 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
+
+	"github.com/erpc-go/erpc/protocol"
+	"github.com/erpc-go/erpc/server/net"
 )
 
 // HandlerFunc 定义命令字对应处理函数类型
@@ -21,6 +23,35 @@ type Handler interface {
 	Process(ctx *Context)
 }
 
+// HandleTyped 以类型化的处理函数注册命令字，处理函数直接获得 *Req、*Rsp，无需类型断言
+// Req、Rsp 为消息的结构体类型，每个请求创建新的实例；处理函数返回 error 时设置返回码及错误信息，见 Error
+func HandleTyped[Req, Rsp any](sm *ServeMutex, pattern string, h func(*Context, *Req, *Rsp) error, mw ...Middleware) {
+	sm.Handle(pattern, "", typedHandler(h), (*Req)(nil), (*Rsp)(nil), mw...)
+}
+
+func typedHandler[Req, Rsp any](h func(*Context, *Req, *Rsp) error) HandlerFunc {
+	return func(ctx *Context) {
+		if err := h(ctx, ctx.Req.(*Req), ctx.Rsp.(*Rsp)); err != nil {
+			ctx.SetError(err)
+		}
+	}
+}
+
+// Error 带返回码的业务错误
+type Error struct {
+	Code int32
+	Msg  string
+}
+
+// Errorf 构造带返回码的业务错误
+func Errorf(code int32, format string, args ...any) error {
+	return &Error{Code: code, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
 func GetPackageName() (string, error) {
 	pwd, _ := os.Getwd()
 	s := strings.Split(pwd, "/")
@@ -109,25 +140,56 @@ func GetPackageName() (string, error) {
 // 	}
 // }
 
-func handleSignal(succ chan *Service, stop chan<- struct{}) {
-	chanSignal := make(chan os.Signal)
-	signal.Notify(chanSignal, syscall.SIGTERM)
-	for {
-		sig := <-chanSignal
-		switch sig {
-		case syscall.SIGTERM:
-			// 另开一个协程进行stop信号同步
-			go func() {
-				stop <- struct{}{}
-			}()
-			// 只有触发kill -TREM信号后才主动执行解注册
-			// serviceDeregister(succ)
-		default:
-		}
+// DefaultMaxFrameSize 默认单个请求包最大长度
+const DefaultMaxFrameSize = 64 * 1024 * 1024
+
+var (
+	ErrUnknownProtocol = errors.New("unknown protocol")
+	ErrFrameTooLarge   = errors.New("frame too large")
+)
+
+// Check 多协议包头判断，按探测到的协议检查包完整性，包长度上限为 DefaultMaxFrameSize
+func Check(data []byte) (int, error) {
+	return check(data, DefaultMaxFrameSize)
+}
+
+// NewChecker 创建指定包长度上限的多协议包完整性检查
+func NewChecker(maxFrameSize int) net.Checker {
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultMaxFrameSize
 	}
+	return net.CheckerFunc(func(data []byte) (int, error) {
+		return check(data, maxFrameSize)
+	})
 }
 
-// Check 多协议包头判断
-func Check(data []byte) (int, error) {
-	return 0, nil
+func check(data []byte, maxFrameSize int) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	t, res := protocol.Detect(data)
+	switch res {
+	case protocol.DetectMore:
+		return 0, nil
+	case protocol.DetectNoMatch:
+		return 0, fmt.Errorf("%w, first byte:0x%x", ErrUnknownProtocol, data[0])
+	}
+	checker := protocol.GetChecker(t)
+	if checker == nil {
+		return 0, fmt.Errorf("%w:%s", ErrUnknownProtocol, t)
+	}
+
+	n, err := checker.Check(data)
+	if err != nil {
+		return 0, err
+	}
+	if n > len(data) || n < 0 {
+		return 0, fmt.Errorf("%s check returns invalid length %d, data len:%d", t, n, len(data))
+	}
+	// 包未收完时，已收数据超限同样拒绝，避免缓冲区无限增长
+	if n > maxFrameSize || (n == 0 && len(data) > maxFrameSize) {
+		return 0, fmt.Errorf("%w, %s packet exceeds %d bytes", ErrFrameTooLarge, t, maxFrameSize)
+	}
+	return n, nil
 }
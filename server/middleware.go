@@ -0,0 +1,309 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/erpc-go/erpc/compress"
+	"github.com/erpc-go/erpc/protocol"
+	"github.com/erpc-go/log"
+)
+
+// Middleware 包装 Handler，在处理函数前后执行公共逻辑
+// 执行顺序由外到内为：全局(Use) -> 命令字组(Group.Use) -> 单个命令字(Handle 的 mw 参数) -> 处理函数，
+// 同一级按注册顺序，先注册的在外层
+type Middleware func(next Handler) Handler
+
+// Use 注册全局中间件，作用于所有命令字，包括已注册的命令字
+func (sm *ServeMutex) Use(mw ...Middleware) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.middlewares = append(sm.middlewares, mw...)
+	sm.rebuild()
+}
+
+// Group 命令字组，组内中间件及配置作用于以 prefix 开头的所有命令字
+type Group struct {
+	sm          *ServeMutex
+	prefix      string
+	middlewares []Middleware
+	notFound    Handler
+	opts        GroupOptions
+}
+
+// GroupOptions 命令字组的配置，零值字段沿用外层组及 ServeMutex 的配置，多个组都设置时前缀最长的组优先
+type GroupOptions struct {
+	MsgTimeout time.Duration    // 处理时长上限，超时以 StatusServerTimeout 回包，见 Timeout；ServeMutex.MsgTimeout 更小时使用后者
+	Compress   *compress.Policy // 回包压缩策略，替代 ServeMutex.Compress
+}
+
+// Group 创建命令字组，prefix 包含分隔符，如 "demo.test." 或 "/rif/room/"
+func (sm *ServeMutex) Group(prefix string, mw ...Middleware) *Group {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	g := &Group{sm: sm, prefix: prefix, middlewares: mw}
+	sm.groups = append(sm.groups, g)
+	sm.rebuild()
+	return g
+}
+
+// Group 创建子组，前缀为 g.prefix+prefix，外层组的中间件同样作用于子组
+func (g *Group) Group(prefix string, mw ...Middleware) *Group {
+	return g.sm.Group(g.prefix+prefix, mw...)
+}
+
+// Use 注册组内中间件
+func (g *Group) Use(mw ...Middleware) {
+	g.sm.mutex.Lock()
+	defer g.sm.mutex.Unlock()
+	g.middlewares = append(g.middlewares, mw...)
+	g.sm.rebuild()
+}
+
+// SetOptions 设置组的配置，作用于组内的所有命令字，包括已注册的命令字
+func (g *Group) SetOptions(opts GroupOptions) {
+	g.sm.mutex.Lock()
+	defer g.sm.mutex.Unlock()
+	g.opts = opts
+	g.sm.rebuild()
+}
+
+// Handle 注册组内命令字，命令字为 prefix+pattern
+func (g *Group) Handle(pattern, token string, handler Handler, reqType, rspType any, mw ...Middleware) {
+	g.sm.Handle(g.prefix+pattern, token, handler, reqType, rspType, mw...)
+}
+
+// HandleFunc 注册组内命令字，函数形式
+func (g *Group) HandleFunc(pattern, token string, handler HandlerFunc, reqType, rspType any, mw ...Middleware) {
+	g.sm.Handle(g.prefix+pattern, token, handler, reqType, rspType, mw...)
+}
+
+// rebuild 重新组装所有命令字及命令字不存在时的中间件链及组配置，调用方持有写锁
+func (sm *ServeMutex) rebuild() {
+	for k, e := range sm.mapEntries {
+		sm.mapEntries[k] = sm.build(e)
+	}
+	sm.rebuildNotFound()
+}
+
+// build 组装命令字的中间件链及组配置，调用方持有锁
+func (sm *ServeMutex) build(e mutexEntry) mutexEntry {
+	e.opts = sm.groupOptions(e.pattern)
+	e.chain = sm.chain(e)
+	return e
+}
+
+// groupOptions 命令字所在各组的配置，每个字段使用前缀最长的组的设置
+func (sm *ServeMutex) groupOptions(pattern string) GroupOptions {
+	var opts GroupOptions
+	timeoutPrefix, compressPrefix := -1, -1
+	for _, g := range sm.groups {
+		if !strings.HasPrefix(pattern, g.prefix) {
+			continue
+		}
+		if g.opts.MsgTimeout > 0 && len(g.prefix) > timeoutPrefix {
+			opts.MsgTimeout, timeoutPrefix = g.opts.MsgTimeout, len(g.prefix)
+		}
+		if g.opts.Compress != nil && len(g.prefix) > compressPrefix {
+			opts.Compress, compressPrefix = g.opts.Compress, len(g.prefix)
+		}
+	}
+	return opts
+}
+
+// chain 按执行顺序组装命令字的中间件链，组配置了 MsgTimeout 时在组内中间件之后加入 Timeout
+func (sm *ServeMutex) chain(e mutexEntry) Handler {
+	mws := append([]Middleware(nil), sm.middlewares...)
+	for _, g := range sm.groups {
+		if strings.HasPrefix(e.pattern, g.prefix) {
+			mws = append(mws, g.middlewares...)
+		}
+	}
+	if e.opts.MsgTimeout > 0 {
+		mws = append(mws, sm.groupTimeout(e.opts.MsgTimeout))
+	}
+	mws = append(mws, e.middlewares...)
+
+	h := e.h
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// groupTimeout 组配置的 Timeout，不超过 ServeMutex.MsgTimeout
+// MsgTimeout 可能在注册命令字之后设置，因此在处理请求时比较，按 MsgTimeout 缓存组装后的处理函数
+func (sm *ServeMutex) groupTimeout(d time.Duration) Middleware {
+	type capped struct {
+		d time.Duration
+		h Handler
+	}
+	return func(next Handler) Handler {
+		group := Timeout(d)(next)
+		var cache atomic.Pointer[capped]
+		return HandlerFunc(func(ctx *Context) {
+			max := sm.MsgTimeout
+			if max <= 0 || max >= d {
+				group.Process(ctx)
+				return
+			}
+			c := cache.Load()
+			if c == nil || c.d != max {
+				c = &capped{d: max, h: Timeout(max)(next)}
+				cache.Store(c)
+			}
+			c.h.Process(ctx)
+		})
+	}
+}
+
+// Recovery 捕获处理函数的 panic，记录堆栈并以 StatusError 回包
+func Recovery() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			defer func() {
+				if e := recover(); e != nil {
+					dataBuf := make([]byte, stackSize)
+					dataBuf = dataBuf[:runtime.Stack(dataBuf, false)]
+					log.Panic("%v\n>> %s", e, dataBuf)
+					ctx.Rsp = nil
+					ctx.SetResult(protocol.StatusError)
+					ctx.SetResultMsg(fmt.Sprintf("panic:%v", e))
+				}
+			}()
+			next.Process(ctx)
+		})
+	}
+}
+
+// AccessLog 记录每个请求的命令字、主调服务、返回码及耗时
+func AccessLog() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			next.Process(ctx)
+			var pattern string
+			if ctx.Protocol != nil {
+				pattern = ctx.Protocol.GetCmdPattern()
+			}
+			log.Info("access cmd:%s, remote:%s, code:%d, msg:%s, cost:%v",
+				pattern, ctx.RemoteServiceName(), ctx.Result(), ctx.ResultMsg(), time.Since(ctx.Now()))
+		})
+	}
+}
+
+// Timeout 限制处理时间，超过 d 时立即以 StatusServerTimeout 回包
+// 处理函数在另外的 goroutine 中以 Context、报文及请求、响应的副本执行，按时返回时写回结果，超时后继续执行的修改不再生效；
+// 处理函数的 ctx 在 d 后取消，应响应 ctx.Done() 尽快返回以释放资源
+// 报文的 Clone 返回不同类型时记录错误日志，退化为等待处理函数返回后再判断是否超时
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			parent := ctx.Context
+			c, cancel := context.WithTimeout(parent, d)
+			defer cancel()
+
+			inner := *ctx
+			inner.Context = c
+			if ctx.Protocol != nil {
+				inner.Protocol = ctx.Protocol.Clone()
+				if reflect.TypeOf(inner.Protocol) != reflect.TypeOf(ctx.Protocol) {
+					logCloneMismatch(ctx.Protocol, inner.Protocol)
+					ctx.Context = c
+					next.Process(ctx)
+					ctx.Context = parent
+					if c.Err() == context.DeadlineExceeded && parent.Err() == nil {
+						timeout(ctx, d)
+					}
+					return
+				}
+			}
+			if err := inner.copyMessages(); err != nil {
+				log.Error("timeout middleware copy request of %s failed: %v", inner.Protocol.GetCmdPattern(), err)
+				ctx.Rsp = nil
+				ctx.SetResult(protocol.StatusError)
+				ctx.SetResultMsg(fmt.Sprintf("copy request failed:%s", err))
+				return
+			}
+
+			done := make(chan *handlerPanic, 1)
+			go func() {
+				defer func() {
+					var hp *handlerPanic
+					if e := recover(); e != nil {
+						buf := make([]byte, stackSize)
+						hp = &handlerPanic{value: e, stack: buf[:runtime.Stack(buf, false)]}
+					}
+					done <- hp
+				}()
+				next.Process(&inner)
+			}()
+
+			select {
+			case hp := <-done:
+				if hp != nil {
+					// 交由外层的 Recovery 处理
+					panic(hp.value)
+				}
+				ctx.copyResult(&inner)
+			case <-c.Done():
+				timeout(ctx, d)
+				go func() {
+					if hp := <-done; hp != nil {
+						log.Panic("%v after timeout\n>> %s", hp.value, hp.stack)
+					}
+				}()
+			}
+		})
+	}
+}
+
+// handlerPanic Timeout 中处理函数的 panic 及堆栈
+type handlerPanic struct {
+	value any
+	stack []byte
+}
+
+// cloneMismatch 已记录 Clone 返回类型不同的报文类型，每种类型只记录一次
+var cloneMismatch sync.Map
+
+// logCloneMismatch 记录报文 Clone 返回不同类型的错误，此时 Timeout 无法在超时时立即回包
+func logCloneMismatch(p, clone protocol.Protocol) {
+	if _, loaded := cloneMismatch.LoadOrStore(reflect.TypeOf(p), struct{}{}); !loaded {
+		log.Error("timeout middleware: %T.Clone returns %T, process timeout is checked after the handler returns", p, clone)
+	}
+}
+
+// timeout 以 StatusServerTimeout 回包，丢弃已写入的响应
+func timeout(ctx *Context, d time.Duration) {
+	ctx.Rsp = nil
+	ctx.SetResult(protocol.StatusServerTimeout)
+	ctx.SetResultMsg(fmt.Sprintf("process timeout:%v", d))
+}
+
+// Validator 可选接口，由需要校验的请求实现
+type Validator interface {
+	Validate() error
+}
+
+// Validate 请求实现 Validator 时先校验，校验失败时以 StatusBadRequest 回包，不执行处理函数
+func Validate() Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			if v, ok := ctx.Req.(Validator); ok {
+				if err := v.Validate(); err != nil {
+					ctx.Rsp = nil
+					ctx.SetResult(protocol.StatusBadRequest)
+					ctx.SetResultMsg(fmt.Sprintf("invalid request:%s", err))
+					return
+				}
+			}
+			next.Process(ctx)
+		})
+	}
+}
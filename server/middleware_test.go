@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/erpc-go/erpc/protocol"
+	erpc "github.com/erpc-go/erpc/protocol/erpc"
+)
+
+// serveRoute 以 echoMessage 请求 route 并解析回包
+func serveRoute(t *testing.T, sm *ServeMutex, route, data string) (*erpc.Package, string) {
+	req := erpc.NewRequest(route)
+	body, err := req.MarshalBody(&echoMessage{data: []byte(data)})
+	if err != nil {
+		t.Fatalf("marshal body failed: %v", err)
+	}
+	req.SetBodyLen(uint32(len(body)))
+	head, _ := req.MarshalHeader()
+	rspBuf, err := sm.Serve(context.Background(), append(head, body...))
+	if err != nil {
+		t.Fatalf("serve failed: %v", err)
+	}
+	rsp := erpc.NewPackage()
+	got := &echoMessage{}
+	if err := rsp.UnmarshalHeader(rspBuf); err != nil {
+		t.Fatalf("unmarshal rsp header failed: %v", err)
+	}
+	if err := rsp.UnmarshalBody(rspBuf, got); err != nil {
+		t.Fatalf("unmarshal rsp body failed: %v", err)
+	}
+	return rsp, string(got.data)
+}
+
+// recordMiddleware 记录中间件的执行顺序
+func recordMiddleware(trace *[]string, name string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx *Context) {
+			*trace = append(*trace, name)
+			next.Process(ctx)
+			*trace = append(*trace, "/"+name)
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var trace []string
+	sm := &ServeMutex{}
+	sm.Use(recordMiddleware(&trace, "g1"))
+	g := sm.Group("demo.test.", recordMiddleware(&trace, "group"))
+	g.HandleFunc("echo.send", "", func(c *Context) {
+		trace = append(trace, "handler")
+		handleEcho(c)
+	}, &echoMessage{}, &echoMessage{}, recordMiddleware(&trace, "p1"), recordMiddleware(&trace, "p2"))
+	sm.HandleFunc("demo.other.echo.send", "", handleEcho, &echoMessage{}, &echoMessage{})
+	// 后注册的全局中间件同样作用于已注册的命令字
+	sm.Use(recordMiddleware(&trace, "g2"))
+
+	if _, body := serveRoute(t, sm, "demo.test.echo.send", "hi"); body != "echo:hi" {
+		t.Fatalf("unexpected body %q", body)
+	}
+	want := "g1,g2,group,p1,p2,handler,/p2,/p1,/group,/g2,/g1"
+	if got := strings.Join(trace, ","); got != want {
+		t.Fatalf("order = %s, want %s", got, want)
+	}
+
+	// 组外的命令字只经过全局中间件
+	trace = nil
+	serveRoute(t, sm, "demo.other.echo.send", "hi")
+	if got := strings.Join(trace, ","); got != "g1,g2,/g2,/g1" {
+		t.Fatalf("order = %s", got)
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.Use(Recovery(), AccessLog())
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		c.Rsp.(*echoMessage).data = []byte("partial")
+		panic("boom")
+	}, &echoMessage{}, &echoMessage{})
+
+	rsp, body := serveRoute(t, sm, "demo.test.echo.send", "hi")
+	if rsp.GetResultCode() != protocol.StatusError || rsp.GetResultMsg() != "panic:boom" || body != "" {
+		t.Fatalf("unexpected rsp, code:%d, msg:%s, body:%q", rsp.GetResultCode(), rsp.GetResultMsg(), body)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		if string(c.Req.(*echoMessage).data) == "slow" {
+			<-c.Done()
+		}
+		handleEcho(c)
+	}, &echoMessage{}, &echoMessage{}, Timeout(20*time.Millisecond))
+
+	rsp, body := serveRoute(t, sm, "demo.test.echo.send", "slow")
+	if rsp.GetResultCode() != protocol.StatusServerTimeout || body != "" {
+		t.Fatalf("unexpected rsp, code:%d, body:%q", rsp.GetResultCode(), body)
+	}
+	if rsp, body = serveRoute(t, sm, "demo.test.echo.send", "fast"); rsp.GetResultCode() != 1 || body != "echo:fast" {
+		t.Fatalf("unexpected rsp, code:%d, body:%q", rsp.GetResultCode(), body)
+	}
+}
+
+// TestTimeoutIgnoredCtx 处理函数不响应 ctx 时同样按时回包，超时后的修改不影响回包
+func TestTimeoutIgnoredCtx(t *testing.T) {
+	release, finished := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(release)
+		<-finished
+	}()
+	sm := &ServeMutex{}
+	sm.Use(Recovery())
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		switch string(c.Req.(*echoMessage).data) {
+		case "slow":
+			<-release
+			handleEcho(c)
+			c.Protocol.SetExtKv("late", "1")
+			close(finished)
+		case "panic":
+			panic("boom")
+		default:
+			handleEcho(c)
+			c.Protocol.SetExtKv("k", "v")
+		}
+	}, &echoMessage{}, &echoMessage{}, Timeout(20*time.Millisecond))
+
+	start := time.Now()
+	rsp, body := serveRoute(t, sm, "demo.test.echo.send", "slow")
+	if rsp.GetResultCode() != protocol.StatusServerTimeout || body != "" || time.Since(start) > time.Second {
+		t.Fatalf("unexpected rsp, code:%d, body:%q, cost:%v", rsp.GetResultCode(), body, time.Since(start))
+	}
+	// 按时返回时处理函数对报文的修改写回
+	rsp, body = serveRoute(t, sm, "demo.test.echo.send", "fast")
+	if v, _ := rsp.GetExtKv("k"); rsp.GetResultCode() != 1 || rsp.GetResultMsg() != "done" || body != "echo:fast" || v != "v" {
+		t.Fatalf("unexpected rsp, code:%d, msg:%s, body:%q, ext:%q", rsp.GetResultCode(), rsp.GetResultMsg(), body, v)
+	}
+	// panic 交由外层的 Recovery 处理
+	if rsp, _ = serveRoute(t, sm, "demo.test.echo.send", "panic"); rsp.GetResultCode() != protocol.StatusError {
+		t.Fatalf("unexpected rsp, code:%d", rsp.GetResultCode())
+	}
+}
+
+// TestTimeoutLateWrite 处理函数超时后继续修改请求、响应及报文，与外层中间件读取时不产生数据竞争，需以 -race 运行
+func TestTimeoutLateWrite(t *testing.T) {
+	finished := make(chan struct{})
+	sm := &ServeMutex{}
+	sm.Use(func(next Handler) Handler {
+		return HandlerFunc(func(c *Context) {
+			next.Process(c)
+			// 外层在超时回包后读取请求、响应及报文
+			if req, ok := c.Req.(*echoMessage); !ok || string(req.data) != "slow" || c.Rsp != nil {
+				t.Errorf("unexpected ctx, req:%v, rsp:%v", c.Req, c.Rsp)
+			}
+			if _, ok := c.Protocol.GetExtKv("late"); ok || c.Result() != protocol.StatusServerTimeout {
+				t.Errorf("late write leaked, code:%d", c.Result())
+			}
+		})
+	})
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		<-c.Done()
+		defer close(finished)
+		c.Req.(*echoMessage).data = []byte("late")
+		handleEcho(c)
+		c.Rsp = &echoMessage{data: []byte("late")}
+		c.Protocol.SetExtKv("late", "1")
+	}, &echoMessage{}, &echoMessage{}, Timeout(20*time.Millisecond))
+
+	rsp, body := serveRoute(t, sm, "demo.test.echo.send", "slow")
+	<-finished
+	if rsp.GetResultCode() != protocol.StatusServerTimeout || body != "" {
+		t.Fatalf("unexpected rsp, code:%d, body:%q", rsp.GetResultCode(), body)
+	}
+}
+
+// validMessage 数据为空时校验失败
+type validMessage struct {
+	echoMessage
+}
+
+func (m *validMessage) Validate() error {
+	if len(m.data) == 0 {
+		return errors.New("empty data")
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.Use(Validate())
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		c.Rsp.(*echoMessage).data = c.Req.(*validMessage).data
+	}, &validMessage{}, &echoMessage{})
+
+	rsp, _ := serveRoute(t, sm, "demo.test.echo.send", "")
+	if rsp.GetResultCode() != protocol.StatusBadRequest || rsp.GetResultMsg() != "invalid request:empty data" {
+		t.Fatalf("unexpected rsp, code:%d, msg:%s", rsp.GetResultCode(), rsp.GetResultMsg())
+	}
+	if rsp, body := serveRoute(t, sm, "demo.test.echo.send", "hi"); rsp.GetResultCode() != 0 || body != "hi" {
+		t.Fatalf("unexpected rsp, code:%d, body:%q", rsp.GetResultCode(), body)
+	}
+}
@@ -1,36 +1,367 @@
 package net
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/erpc-go/log"
 )
 
 // graceful const
+// 热重启时父进程通过 ExtraFiles 将监听 socket 依次传递给子进程(fd 从 3 开始，0 stdin 1 stdout 2 stderr)，
+// 名字按同样的顺序以 JSON 数组记录在 GracefulListenersKey 中(unix socket 路径可能包含逗号)，最后一个 fd 为通知父进程就绪的管道写端
 const (
-	GracefulEnvironKey     = "IsGracefulCat"
-	GracefulEnvironStr     = GracefulEnvironKey + "=1"
-	GracefulTCPListenerFd  = 3 // 0 stdin 1 stdout 2 stderr
-	GracefulUDPListenerFd  = 4
-	GracefulUnixListenerFd = 5
+	GracefulEnvironKey   = "IsGracefulCat"
+	GracefulEnvironStr   = GracefulEnvironKey + "=1"
+	GracefulListenersKey = "GracefulListeners" // 继承的监听 socket 名字，JSON 字符串数组
+	GracefulReadyFdKey   = "GracefulReadyFd"   // 就绪管道写端的 fd
 )
 
+// RestartTimeout 热重启时等待子进程就绪的最长时间，超时后杀死子进程，父进程继续服务
+var RestartTimeout = 30 * time.Second
+
+// socket 可以传递给子进程的监听 socket，*net.TCPListener、*net.UDPConn、*net.UnixListener
+type socket interface {
+	syscall.Conn
+}
+
+// dupSocket 复制 socket 的 fd 用于传递给子进程
+// 不使用 File()，File() 会将 socket 置为阻塞模式，之后关闭 listener 时无法唤醒阻塞在 accept 上的协程
+func dupSocket(l socket) (int, error) {
+	rc, err := l.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+	fd, dupErr := -1, error(nil)
+	err = rc.Control(func(s uintptr) {
+		syscall.ForkLock.RLock()
+		defer syscall.ForkLock.RUnlock()
+		if fd, dupErr = syscall.Dup(int(s)); dupErr == nil {
+			syscall.CloseOnExec(fd)
+		}
+	})
+	if err != nil {
+		return -1, err
+	}
+	return fd, dupErr
+}
+
+type namedListener struct {
+	name string
+	l    socket
+}
+
+// listeners 进程的监听 socket，名字为 network://address，同名(如端口为 0)时按监听顺序对应
+var listeners struct {
+	sync.Mutex
+	loadOnce   sync.Once
+	inherited  map[string][]*os.File // 从父进程继承、尚未使用的 socket
+	ready      *os.File              // 通知父进程就绪的管道写端
+	readyOnce  sync.Once
+	active     []namedListener // 使用中的 socket，热重启时传递给子进程
+	restarting bool
+}
+
+// loadInherited 解析父进程传递的 socket，非热重启启动的进程没有继承的 socket
+func loadInherited() {
+	listeners.loadOnce.Do(func() {
+		listeners.inherited = make(map[string][]*os.File)
+		if os.Getenv(GracefulEnvironKey) == "" {
+			return
+		}
+		var names []string
+		if v := os.Getenv(GracefulListenersKey); v != "" {
+			if err := json.Unmarshal([]byte(v), &names); err != nil {
+				log.Raw("invalid %s %q: %v", GracefulListenersKey, v, err)
+			}
+		}
+		for i, name := range names {
+			f := os.NewFile(uintptr(3+i), name)
+			listeners.inherited[name] = append(listeners.inherited[name], f)
+		}
+		if fd, err := strconv.Atoi(os.Getenv(GracefulReadyFdKey)); err == nil {
+			listeners.ready = os.NewFile(uintptr(fd), "ready")
+		}
+		log.Raw("inherit listeners from parent: %s", names)
+	})
+}
+
+// takeInherited 取出继承的同名 socket，没有时返回 nil
+func takeInherited(name string) *os.File {
+	loadInherited()
+	listeners.Lock()
+	defer listeners.Unlock()
+	files := listeners.inherited[name]
+	if len(files) == 0 {
+		return nil
+	}
+	listeners.inherited[name] = files[1:]
+	return files[0]
+}
+
+// listenFile 优先使用继承的同名 socket，否则调用 listen 监听，并记录以便热重启时传递给子进程
+func listenFile(name string, fromFile func(*os.File) (socket, error), listen func() (socket, error)) (socket, error) {
+	var l socket
+	var err error
+	if f := takeInherited(name); f != nil {
+		log.Raw("use inherited listener %s", name)
+		l, err = fromFile(f)
+		f.Close()
+	} else {
+		l, err = listen()
+	}
+	if err != nil {
+		return nil, err
+	}
+	listeners.Lock()
+	listeners.active = append(listeners.active, namedListener{name: name, l: l})
+	listeners.Unlock()
+	return l, nil
+}
+
+// release 服务关闭后不再传递给子进程
+func release(l socket) {
+	listeners.Lock()
+	defer listeners.Unlock()
+	for i, nl := range listeners.active {
+		if nl.l == l {
+			listeners.active = append(listeners.active[:i], listeners.active[i+1:]...)
+			return
+		}
+	}
+}
+
+func fileListener(f *os.File) (socket, error) {
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("net.FileListener error: %v", err)
+	}
+	return ln.(socket), nil
+}
+
+func filePacketConn(f *os.File) (socket, error) {
+	conn, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, fmt.Errorf("net.FilePacketConn error: %v", err)
+	}
+	return conn.(socket), nil
+}
+
+// Listen 监听 tcp、unix 地址，热重启的子进程使用从父进程继承的同名 socket
+// unix 地址的 socket 文件已存在时先删除
+func Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	l, err := listenFile(network+"://"+address, fileListener, func() (socket, error) {
+		if network == "unix" {
+			if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		var lc net.ListenConfig
+		ln, err := lc.Listen(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return ln.(socket), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ln, ok := l.(net.Listener)
+	if !ok {
+		return nil, fmt.Errorf("inherited %s://%s is not a listener", network, address)
+	}
+	return ln, nil
+}
+
+// ListenPacket 监听 udp 地址，同 Listen
+func ListenPacket(ctx context.Context, network, address string) (net.PacketConn, error) {
+	l, err := listenFile(network+"://"+address, filePacketConn, func() (socket, error) {
+		var lc net.ListenConfig
+		conn, err := lc.ListenPacket(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return conn.(socket), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	conn, ok := l.(net.PacketConn)
+	if !ok {
+		return nil, fmt.Errorf("inherited %s://%s is not a packet conn", network, address)
+	}
+	return conn, nil
+}
+
+// Ready 所有服务启动后调用，热重启的子进程据此通知父进程退出，并关闭未使用的继承 socket
+// 非热重启启动的进程调用时无操作
+func Ready() error {
+	loadInherited()
+	var err error
+	listeners.readyOnce.Do(func() {
+		listeners.Lock()
+		for name, files := range listeners.inherited {
+			for _, f := range files {
+				log.Raw("close unused inherited listener %s", name)
+				f.Close()
+			}
+		}
+		listeners.inherited = map[string][]*os.File{}
+		ready := listeners.ready
+		listeners.ready = nil
+		listeners.Unlock()
+
+		if ready != nil {
+			_, err = ready.Write([]byte{1})
+			ready.Close()
+		}
+	})
+	return err
+}
+
+// Restart 热重启，启动子进程并传递所有监听 socket，等待子进程调用 Ready
+// 子进程就绪后返回 nil，调用方随后关闭服务(等待处理中的请求)并退出；
+// 子进程启动失败、未就绪即退出或超过 RestartTimeout 时返回 error，父进程继续服务
+func Restart() (pid int, err error) {
+	listeners.Lock()
+	if listeners.restarting {
+		listeners.Unlock()
+		return 0, errors.New("restart in progress")
+	}
+	listeners.restarting = true
+	active := append([]namedListener(nil), listeners.active...)
+	listeners.Unlock()
+	defer func() {
+		listeners.Lock()
+		listeners.restarting = err == nil
+		listeners.Unlock()
+	}()
+
+	var names []string
+	var fds []int
+	defer func() {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+	}()
+	for _, nl := range active {
+		fd, err := dupSocket(nl.l)
+		if err != nil {
+			return 0, fmt.Errorf("dup socket of %s: %w", nl.name, err)
+		}
+		names = append(names, nl.name)
+		fds = append(fds, fd)
+	}
+
+	encoded, err := json.Marshal(names)
+	if err != nil {
+		return 0, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	var envs []string
+	for _, env := range os.Environ() {
+		if k, _, _ := strings.Cut(env, "="); k != GracefulEnvironKey && k != GracefulListenersKey && k != GracefulReadyFdKey {
+			envs = append(envs, env)
+		}
+	}
+	envs = append(envs, GracefulEnvironStr,
+		GracefulListenersKey+"="+string(encoded),
+		GracefulReadyFdKey+"="+strconv.Itoa(3+len(fds)))
+	files := []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()}
+	for _, fd := range fds {
+		files = append(files, uintptr(fd))
+	}
+	files = append(files, w.Fd())
+
+	log.Raw("graceful start new process, listeners:%v", names)
+	pid, err = syscall.ForkExec(os.Args[0], os.Args, &syscall.ProcAttr{Env: envs, Files: files})
+	w.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to forkexec: %v", err)
+	}
+	child, _ := os.FindProcess(pid)
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		ready <- err
+	}()
+	timer := time.NewTimer(RestartTimeout)
+	defer timer.Stop()
+	select {
+	case err = <-ready:
+		if err != nil {
+			// 子进程未调用 Ready 即关闭了管道，通常已经退出
+			child.Kill()
+			state, _ := child.Wait()
+			err = fmt.Errorf("new process exited before ready: %v", state)
+		}
+	case <-timer.C:
+		child.Kill()
+		child.Wait()
+		err = fmt.Errorf("new process not ready in %v", RestartTimeout)
+	}
+	if err != nil {
+		return 0, err
+	}
+	go child.Wait()
+
+	// socket 已交给子进程，关闭时不删除 unix socket 文件
+	for _, nl := range active {
+		if ul, ok := nl.l.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	return pid, nil
+}
+
 // GracefulRestart 支持热重启服务需实现的接口
 type GracefulRestart interface {
-	Fork() (int, error)
-	Shutdown() error
+	Shutdown(ctx context.Context) error
+}
+
+// shutdownTimeout 收到退出信号后等待处理中请求的最长时间
+const shutdownTimeout = 10 * time.Second
+
+func shutdown(srvs []GracefulRestart) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, srv := range srvs {
+		wg.Add(1)
+		go func(srv GracefulRestart) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Raw("shutdown server: %v", err)
+			}
+		}(srv)
+	}
+	wg.Wait()
 }
 
-// HandleSignals 监听信号
-func HandleSignals(srv GracefulRestart) {
-	signalChan := make(chan os.Signal)
+// HandleSignals 监听信号，SIGTERM、SIGINT 关闭服务，SIGUSR2 热重启，子进程就绪后关闭服务
+// 服务关闭后返回
+func HandleSignals(srvs ...GracefulRestart) {
+	signalChan := make(chan os.Signal, 1)
 
 	signal.Ignore(syscall.SIGPIPE) // 忽略 SIGPIPE 信号，避免对端 crash 导致本服务异常退出
 	signal.Notify(signalChan, syscall.SIGTERM, syscall.SIGUSR2, syscall.SIGSEGV, syscall.SIGINT)
+	defer signal.Stop(signalChan)
 	log.Raw("server notify signal: SIGTERM SIGUSR2 SIGSEGV SIGINT")
 
 	for {
@@ -38,136 +369,85 @@ func HandleSignals(srv GracefulRestart) {
 		switch sig {
 		case syscall.SIGTERM:
 			log.Raw("receive SIGTERM signal, shutdown server")
-			srv.Shutdown()
+			shutdown(srvs)
+			return
 		case syscall.SIGSEGV:
 			log.Raw("receive SIGSEGV signal, shutdown server")
 		case syscall.SIGUSR2:
 			log.Raw("receive SIGUSR2 signal, graceful restarting server")
-			if pid, err := srv.Fork(); err != nil {
+			pid, err := Restart()
+			if err != nil {
 				log.Raw("start new process failed: %v, continue serving", err)
-			} else {
-				log.Raw("start new process succeed, the new pid is %d", pid)
-				// 不再主动退出了，由子进程来触发TERM
-				// srv.Shutdown()
+				continue
 			}
+			log.Raw("new process %d ready, shutdown server", pid)
+			shutdown(srvs)
+			return
 		case syscall.SIGINT:
 			log.Raw("receive SIGINT signal, shutdown server")
-			srv.Shutdown()
+			shutdown(srvs)
+			return
 		default:
 		}
 	}
 }
 
-// StartNewProcess fork子进程，传入listener复用fd
-func StartNewProcess(tcpfd, udpfd, unixfd uintptr) (int, error) {
-	log.Raw("graceful start new process, tcp fd:%v, udp fd:%v, unix fd:%v",
-		tcpfd, udpfd, unixfd)
-	envs := []string{}
-	for _, value := range os.Environ() {
-		if value != GracefulEnvironStr {
-			envs = append(envs, value)
-		}
-	}
-	envs = append(envs, GracefulEnvironStr)
-
-	execSpec := &syscall.ProcAttr{
-		Env:   envs,
-		Files: []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd(), tcpfd, udpfd, unixfd},
-	}
-
-	fork, err := syscall.ForkExec(os.Args[0], os.Args, execSpec)
-	if err != nil {
-		return 0, fmt.Errorf("failed to forkexec: %v", err)
-	}
-
-	return fork, nil
-}
-
-// GetTCPListener 获取tcp listener
+// GetTCPListener 获取tcp listener，热重启的子进程使用继承的 socket
 func GetTCPListener(addr *net.TCPAddr) (*net.TCPListener, error) {
-	var ln *net.TCPListener
-	var err error
-
-	if os.Getenv(GracefulEnvironKey) != "" {
-		log.Raw("tcp server get listener from os file")
-		file := os.NewFile(GracefulTCPListenerFd, "")
-		var listener net.Listener
-		listener, err = net.FileListener(file)
-		if err != nil {
-			err = fmt.Errorf("net.FileListener error: %v", err)
-			return nil, err
-		}
-		var ok bool
-		if ln, ok = listener.(*net.TCPListener); !ok {
-			return nil, fmt.Errorf("net.FileListener is not TCPListener")
-		}
-	} else {
-		log.Raw("tcp server create listener from tcpaddr")
-		ln, err = net.ListenTCP("tcp", addr)
+	l, err := listenFile("tcp://"+addr.String(), fileListener, func() (socket, error) {
+		ln, err := net.ListenTCP("tcp", addr)
 		if err != nil {
-			err = fmt.Errorf("net.ListenTCP error: %v", err)
-			return nil, err
+			return nil, fmt.Errorf("net.ListenTCP error: %v", err)
 		}
+		return ln, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ln, ok := l.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("net.FileListener is not TCPListener")
 	}
 	return ln, nil
 }
 
-// GetUDPListener 获取udp listener
+// GetUDPListener 获取udp listener，热重启的子进程使用继承的 socket
 func GetUDPListener(addr *net.UDPAddr) (*net.UDPConn, error) {
-	var ln *net.UDPConn
-	var err error
-
-	if os.Getenv(GracefulEnvironKey) != "" {
-		log.Raw("udp server get listener from os file")
-		file := os.NewFile(GracefulUDPListenerFd, "")
-		var listener net.Conn
-		listener, err = net.FileConn(file)
+	l, err := listenFile("udp://"+addr.String(), filePacketConn, func() (socket, error) {
+		ln, err := net.ListenUDP("udp", addr)
 		if err != nil {
-			err = fmt.Errorf("net.FileConn error: %v", err)
-			return nil, err
-		}
-		var ok bool
-		if ln, ok = listener.(*net.UDPConn); !ok {
-			return nil, fmt.Errorf("net.FileConn is not UDPConn")
-		}
-	} else {
-		log.Raw("udp server create listener from udpaddr")
-		ln, err = net.ListenUDP("udp", addr)
-		if err != nil {
-			err = fmt.Errorf("net.ListenUDP error: %v", err)
-			return nil, err
+			return nil, fmt.Errorf("net.ListenUDP error: %v", err)
 		}
+		return ln, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ln, ok := l.(*net.UDPConn)
+	if !ok {
+		return nil, fmt.Errorf("net.FilePacketConn is not UDPConn")
 	}
 	return ln, nil
 }
 
+// GetUnixListener 获取unix listener，热重启的子进程使用继承的 socket
 func GetUnixListener(addr *net.UnixAddr) (*net.UnixListener, error) {
-	var ln *net.UnixListener
-	var err error
-
-	if os.Getenv(GracefulEnvironKey) != "" {
-		log.Raw("unix server get listener from os file")
-		file := os.NewFile(GracefulUnixListenerFd, "")
-		var listener net.Listener
-		listener, err = net.FileListener(file)
-		if err != nil {
-			err = fmt.Errorf("net.FileConn error: %v", err)
-			return nil, err
-		}
-		var ok bool
-		if ln, ok = listener.(*net.UnixListener); !ok {
-			return nil, fmt.Errorf("net.FileConn is not UnixListener")
-		}
-	} else {
-		log.Raw("unix server create listener from unixaddr")
+	l, err := listenFile("unix://"+addr.Name, fileListener, func() (socket, error) {
 		if err := os.Remove(addr.Name); err != nil && !os.IsNotExist(err) {
-			panic(fmt.Sprintf("remove unix socket file %q: %s", addr.Name, err))
+			return nil, fmt.Errorf("remove unix socket file %q: %s", addr.Name, err)
 		}
-		ln, err = net.ListenUnix("unix", addr)
+		ln, err := net.ListenUnix("unix", addr)
 		if err != nil {
-			err = fmt.Errorf("net.ListenUnix error: %v", err)
-			return nil, err
+			return nil, fmt.Errorf("net.ListenUnix error: %v", err)
 		}
+		return ln, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	ln, ok := l.(*net.UnixListener)
+	if !ok {
+		return nil, fmt.Errorf("net.FileListener is not UnixListener")
 	}
 	return ln, nil
 }
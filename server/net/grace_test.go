@@ -0,0 +1,174 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// restartChildKey 热重启测试中子进程的行为：serve 监听并就绪，fail 就绪前退出，hang 不就绪
+const restartChildKey = "GRACE_TEST_CHILD"
+
+// restartUnixKey 测试用 unix socket 路径
+const restartUnixKey = "GRACE_TEST_UNIX"
+
+// restartEndpoints 父子进程监听同样的地址，其中两个 tcp 地址同名
+func restartEndpoints() [][2]string {
+	return [][2]string{
+		{"tcp", "127.0.0.1:0"},
+		{"tcp", "127.0.0.1:0"},
+		{"udp", "127.0.0.1:0"},
+		{"unix", os.Getenv(restartUnixKey)},
+	}
+}
+
+// pidHandler 回包为 name:pid
+func pidHandler(name string) Handler {
+	return HandlerFunc(func(context.Context, []byte) ([]byte, error) {
+		return []byte(fmt.Sprintf("%s:%d", name, os.Getpid())), nil
+	})
+}
+
+// startRestartServers 监听 restartEndpoints 并开始服务
+func startRestartServers(h Handler) ([]net.Addr, []GracefulRestart, error) {
+	var addrs []net.Addr
+	var srvs []GracefulRestart
+	for _, ep := range restartEndpoints() {
+		var addr net.Addr
+		var srv interface {
+			servable
+			Addr() net.Addr
+		}
+		if ep[0] == "udp" {
+			conn, err := ListenPacket(context.Background(), ep[0], ep[1])
+			if err != nil {
+				return nil, nil, err
+			}
+			srv = NewUDPServer(conn.(*net.UDPConn), Options{Handler: h})
+		} else {
+			ln, err := Listen(context.Background(), ep[0], ep[1])
+			if err != nil {
+				return nil, nil, err
+			}
+			if tl, ok := ln.(*net.TCPListener); ok {
+				srv = NewTCPServer(tl, Options{Handler: h})
+			} else {
+				srv = NewUnixServer(ln.(*net.UnixListener), Options{Handler: h})
+			}
+		}
+		addr = srv.Addr()
+		go srv.Serve()
+		addrs = append(addrs, addr)
+		srvs = append(srvs, srv)
+	}
+	return addrs, srvs, nil
+}
+
+// call 发送请求并返回回包
+func call(addr net.Addr) (string, error) {
+	conn, err := net.DialTimeout(addr.Network(), addr.String(), time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte("hi")); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	return string(buf[:n]), err
+}
+
+// restartChild 热重启测试的子进程，继承父进程的 socket，每个地址处理一个请求后退出
+func restartChild(mode string) {
+	switch mode {
+	case "fail":
+		os.Exit(1)
+	case "hang":
+		time.Sleep(time.Minute)
+		os.Exit(1)
+	}
+	served := make(chan struct{}, len(restartEndpoints()))
+	h := HandlerFunc(func(ctx context.Context, req []byte) ([]byte, error) {
+		served <- struct{}{}
+		return pidHandler("child").Serve(ctx, req)
+	})
+	_, srvs, err := startRestartServers(h)
+	if err != nil {
+		os.Exit(2)
+	}
+	for _, srv := range srvs {
+		<-srv.(servable).Serving()
+	}
+	if err := Ready(); err != nil {
+		os.Exit(2)
+	}
+	timeout := time.After(10 * time.Second)
+	for i := 0; i < cap(served); i++ {
+		select {
+		case <-served:
+		case <-timeout:
+			os.Exit(3)
+		}
+	}
+	shutdown(srvs)
+	os.Exit(0)
+}
+
+func TestRestart(t *testing.T) {
+	if mode := os.Getenv(restartChildKey); mode != "" && os.Getenv(GracefulEnvironKey) != "" {
+		restartChild(mode)
+		return
+	}
+	// 路径中的逗号不影响传递给子进程的 socket 名字
+	t.Setenv(restartUnixKey, filepath.Join(t.TempDir(), "grace,1.sock"))
+	addrs, srvs, err := startRestartServers(pidHandler("parent"))
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer shutdown(srvs)
+	defer func() { listeners.restarting = false }()
+	parent := fmt.Sprintf("parent:%d", os.Getpid())
+
+	// 子进程失败或超时未就绪时父进程继续服务
+	RestartTimeout = 500 * time.Millisecond
+	defer func() { RestartTimeout = 30 * time.Second }()
+	for _, mode := range []string{"fail", "hang"} {
+		t.Setenv(restartChildKey, mode)
+		if _, err := Restart(); err == nil {
+			t.Fatalf("%s: restart should fail", mode)
+		}
+		for _, addr := range addrs {
+			if rsp, err := call(addr); err != nil || rsp != parent {
+				t.Fatalf("%s: %s %s rsp:%q, err:%v", mode, addr.Network(), addr, rsp, err)
+			}
+		}
+	}
+
+	t.Setenv(restartChildKey, "serve")
+	RestartTimeout = 10 * time.Second
+	pid, err := Restart()
+	if err != nil {
+		t.Fatalf("restart failed: %v", err)
+	}
+	if _, err := Restart(); err == nil {
+		t.Fatalf("restart should fail after handover")
+	}
+	shutdown(srvs)
+
+	// 父进程关闭后所有地址(包括同名地址)由子进程服务
+	child := fmt.Sprintf("child:%d", pid)
+	for _, addr := range addrs {
+		if rsp, err := call(addr); err != nil || rsp != child {
+			t.Fatalf("%s %s rsp:%q, err:%v", addr.Network(), addr, rsp, err)
+		}
+	}
+	if _, err := os.Stat(os.Getenv(restartUnixKey)); err != nil {
+		t.Fatalf("unix socket file removed by parent: %v", err)
+	}
+}
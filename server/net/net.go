@@ -3,9 +3,7 @@ package net
 import (
 	"context"
 	"net"
-	"os"
 	"sync"
-	"syscall"
 	"time"
 
 	"github.com/erpc-go/erpc/server/workpool"
@@ -13,9 +11,6 @@ import (
 	limit "github.com/erpc-go/ratelimit"
 )
 
-// 父进程id
-var ppid = os.Getppid()
-
 // 消息处理的最大超时时间
 var defaultMsgTimeout = 800 * time.Millisecond
 
@@ -37,10 +32,103 @@ type Server interface {
 }
 
 // Handler server请求处理器
+// req 来自缓冲池，Serve 返回后即被复用，Handler 不能在返回后继续持有
 type Handler interface {
 	Serve(context.Context, []byte) ([]byte, error)
 }
 
+// ConnHijacker 可选接口，由 Handler 实现，用于 HTTP/2 等需要接管整个连接的协议
+type ConnHijacker interface {
+	// Hijack 根据连接上已读取的数据判断是否接管连接
+	// 返回非 nil 时连接交由返回的函数处理，函数返回后连接关闭
+	// 函数通过 BeginRequest 报告处理中的请求，Draining 通知时停止接收新请求，以便服务关闭时等待
+	Hijack(prefix []byte) func(ctx context.Context, conn net.Conn)
+}
+
+// Sequencer 可选接口，由 Handler 实现，用于 HTTP/1.x 等要求按请求顺序回包的协议
+type Sequencer interface {
+	// InOrder 请求包是否需要按顺序回包
+	// 返回 true 时等待连接上之前的请求回包后再处理，处理完后才处理后续的请求包
+	InOrder(req []byte) bool
+}
+
+// response 回包及回包后的连接控制
+type response struct {
+	data    []byte
+	close   bool // 回包后关闭连接
+	release bool // 回包后 data 归还缓冲池
+}
+
+type connControlKey struct{}
+
+// connControl 单个请求对所属连接的控制
+type connControl struct {
+	packet            bool // 非面向连接，如 udp
+	closeAfterWrite   bool
+	releaseAfterWrite bool
+}
+
+func withConnControl(ctx context.Context) (context.Context, *connControl) {
+	ctl := &connControl{}
+	return context.WithValue(ctx, connControlKey{}, ctl), ctl
+}
+
+// CloseAfterWrite 标记当前请求回包后关闭连接，用于 HTTP 短连接等场景
+// 非面向连接的请求(如 udp)返回 false
+func CloseAfterWrite(ctx context.Context) bool {
+	ctl, ok := ctx.Value(connControlKey{}).(*connControl)
+	if !ok || ctl.packet {
+		return false
+	}
+	ctl.closeAfterWrite = true
+	return true
+}
+
+// ReleaseAfterWrite 标记当前请求的回包由 bufpool.Get 获取，写完后归还缓冲池
+// 回包不经过 server/net 发送(如直接调用 Handler)时返回 false，回包由 GC 回收
+func ReleaseAfterWrite(ctx context.Context) bool {
+	ctl, ok := ctx.Value(connControlKey{}).(*connControl)
+	if !ok {
+		return false
+	}
+	ctl.releaseAfterWrite = true
+	return true
+}
+
+type hijackKey struct{}
+
+// Draining 接管连接的服务关闭通知，服务关闭时 channel 关闭，非接管的连接返回 nil
+// 协议应停止接收新请求(如 HTTP/2 发送 GOAWAY)，处理中的请求完成后返回
+func Draining(ctx context.Context) <-chan struct{} {
+	c, ok := ctx.Value(hijackKey{}).(*conn)
+	if !ok {
+		return nil
+	}
+	return c.drain
+}
+
+// MsgTimeout 接管连接上消息处理的最大时长，同 Options.MsgTimeout，非接管的连接返回 0
+func MsgTimeout(ctx context.Context) time.Duration {
+	c, ok := ctx.Value(hijackKey{}).(*conn)
+	if !ok {
+		return 0
+	}
+	return c.server.opts.MsgTimeout
+}
+
+// BeginRequest 接管的连接上开始处理一个请求，返回的函数在请求结束时调用
+// 服务关闭时等待这些请求，ctx 结束时计入 ShutdownError 的中断请求数；非接管的连接上不计数
+func BeginRequest(ctx context.Context) (end func()) {
+	c, ok := ctx.Value(hijackKey{}).(*conn)
+	if !ok {
+		return func() {}
+	}
+	c.mu.Lock()
+	c.pending++
+	c.mu.Unlock()
+	return c.end
+}
+
 // Limiter
 type Limiter interface {
 	Wait()       // 同步睡眠
@@ -102,133 +190,97 @@ func (w *CheckerWrapper) Check(data []byte) (int, error) {
 	return n, err
 }
 
-func killParentProcess() {
-	// 如果是热重启，通知父进程退出
-	if ppid != 1 && os.Getenv(GracefulEnvironKey) != "" {
-		if err := syscall.Kill(ppid, syscall.SIGINT); err != nil {
-			log.Raw("failed to close parent: %+v\n", err)
+// servable ListenAndServe* 启动的服务
+type servable interface {
+	GracefulRestart
+	Serve() error
+	Serving() <-chan struct{}
+}
+
+// serve 处理请求直到服务关闭，所有服务开始处理请求后通知父进程(热重启时)
+func serve(srvs ...servable) {
+	if defaultEnableGracefulRestart {
+		log.Raw("server EnableGracefulRestart\n")
+		grs := make([]GracefulRestart, 0, len(srvs))
+		for _, srv := range srvs {
+			grs = append(grs, srv)
 		}
+		go HandleSignals(grs...)
+	}
+	var wg sync.WaitGroup
+	for _, srv := range srvs {
+		wg.Add(1)
+		go func(srv servable) {
+			defer wg.Done()
+			if err := srv.Serve(); err != nil {
+				log.Raw("serve failed: %v", err)
+			}
+		}(srv)
+	}
+	for _, srv := range srvs {
+		<-srv.Serving()
+	}
+	if err := Ready(); err != nil {
+		log.Raw("notify parent process failed: %v", err)
 	}
+	wg.Wait()
 }
 
-// ListenAndServeUDP 监听UDP地址addr，内部调用checker进行包完整性检查和拆包
-// 调用handler处理请求，msgTimeout为消息的超时时间
-func ListenAndServeUDP(addr string, checker Checker, handler Handler, limiter limit.Limiter) {
+func listenUDP(addr string, checker Checker, handler Handler, limiter Limiter) *UDPServer {
 	listenAddr, e := net.ResolveUDPAddr("udp4", addr)
 	log.Raw("udp addr: %s\n", addr)
 	if e != nil {
 		panic("invalid listen addr")
 	}
-	server := &UDPServer{
-		addr:       listenAddr,
-		handler:    handler,
-		checker:    checker,
-		limiter:    limiter,
-		msgTimeout: defaultMsgTimeout,
-		workerpool: defaultWorkerPool,
-		closing:    false,
-		stop:       make(chan int),
-	}
-	if defaultEnableGracefulRestart {
-		log.Raw("udp server EnableGracefulRestart\n")
-		go HandleSignals(server)
-		ln, e := GetUDPListener(listenAddr)
-		if e != nil {
-			panic(e)
-		}
-		server.conn = ln
-
-		go killParentProcess()
-
-		server.Serve()
-	} else {
-		server.ListenAndServe()
+	ln, e := GetUDPListener(listenAddr)
+	if e != nil {
+		panic(e)
 	}
+	return NewUDPServer(ln, Options{Handler: handler, Checker: checker, Limiter: limiter})
 }
 
-// ListenAndServeTCP 监听TCP地址addr，内部调用checker进行包完整性检查和拆包
-// 调用handler处理请求，msgTimeout为消息的超时时间
-func ListenAndServeTCP(addr string, checker Checker, handler Handler, limiter Limiter) {
+func listenTCP(addr string, checker Checker, handler Handler, limiter Limiter) *TCPServer {
 	listenAddr, e := net.ResolveTCPAddr("tcp4", addr)
 	log.Raw("tcp addr: %s\n", listenAddr)
 	if e != nil {
 		panic("invalid listen addr")
 	}
-	server := &TCPServer{
-		addr:        listenAddr,
-		handler:     handler,
-		checker:     checker,
-		msgTimeout:  defaultMsgTimeout,
-		idleTimeout: defaultIdleTimeout,
-		limiter:     limiter,
-		closing:     false,
-		stop:        make(chan int),
+	ln, e := GetTCPListener(listenAddr)
+	if e != nil {
+		panic(e)
 	}
-	if defaultEnableGracefulRestart {
-		log.Raw("tcp server EnableGracefulRestart\n")
-		go HandleSignals(server)
-		ln, e := GetTCPListener(listenAddr)
-		if e != nil {
-			panic(e)
-		}
+	return NewTCPServer(ln, Options{Handler: handler, Checker: checker, Limiter: limiter})
+}
 
-		go killParentProcess()
+// ListenAndServeUDP 监听UDP地址addr，内部调用checker进行包完整性检查和拆包
+// 调用handler处理请求，msgTimeout为消息的超时时间
+func ListenAndServeUDP(addr string, checker Checker, handler Handler, limiter limit.Limiter) {
+	serve(listenUDP(addr, checker, handler, limiter))
+}
 
-		server.conn = tcpKeepAliveListener{ln}
-		server.Serve(server.conn)
-	} else {
-		server.ListenAndServe()
-	}
+// ListenAndServeTCP 监听TCP地址addr，内部调用checker进行包完整性检查和拆包
+// 调用handler处理请求，msgTimeout为消息的超时时间
+func ListenAndServeTCP(addr string, checker Checker, handler Handler, limiter Limiter) {
+	serve(listenTCP(addr, checker, handler, limiter))
 }
 
+// ListenAndServeUnix 监听unix socket地址addr，参数同 ListenAndServeTCP
 func ListenAndServeUnix(addr string, checker Checker, handler Handler, limiter Limiter, IdleTimeout time.Duration) {
 	listenAddr, e := net.ResolveUnixAddr("unix", addr)
 	log.Raw("unix socket addr: %s\n", addr)
 	if e != nil {
 		panic("invalid listen addr")
 	}
-	server := &UnixServer{
-		addr:        listenAddr,
-		handler:     handler,
-		checker:     checker,
-		limiter:     limiter,
-		msgTimeout:  defaultMsgTimeout,
-		idleTimeout: IdleTimeout,
-	}
-	if defaultEnableGracefulRestart {
-		log.Raw("unix server EnableGracefulRestart\n")
-		go HandleSignals(server)
-		ln, e := GetUnixListener(listenAddr)
-		if e != nil {
-			panic(e)
-		}
-
-		go killParentProcess()
-
-		server.conn = ln
-		server.Serve(server.conn)
-	} else {
-		server.ListenAndServe()
+	ln, e := GetUnixListener(listenAddr)
+	if e != nil {
+		panic(e)
 	}
+	serve(NewUnixServer(ln, Options{Handler: handler, Checker: checker, Limiter: limiter, IdleTimeout: IdleTimeout}))
 }
 
-// ListenAndServe 同时监听TCP和UDP地址addr， 内部调用ListenAndServeUDP，ListenAndServeTCP
+// ListenAndServe 同时监听TCP和UDP地址addr，两者都监听后才通知热重启的父进程
 func ListenAndServe(addr string, checker Checker, handler Handler, limiter limit.Limiter) {
-	if defaultEnableGracefulRestart {
-		defaultEnableGracefulRestart = false // 同时监听tcp udp，不支持热重启
-		log.Raw("tcp/udp all server do not support EnableGracefulRestart\n")
-	}
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() {
-		ListenAndServeUDP(addr, checker, handler, limiter)
-		wg.Done()
-	}()
-	go func() {
-		ListenAndServeTCP(addr, checker, handler, limiter)
-		wg.Done()
-	}()
-	wg.Wait()
+	serve(listenTCP(addr, checker, handler, limiter), listenUDP(addr, checker, handler, limiter))
 }
 
 // Init 服务初始化，设置msg总超时，开启调试模式，日志等级，创建协程池
@@ -236,6 +288,6 @@ func Init(msgTimeout time.Duration, IdleTimeout time.Duration, enableDebugMode b
 	defaultMsgTimeout = msgTimeout
 	defaultEnableDebugmode = enableDebugMode
 	defaultWorkerPool = workpool.New(MaxWorkerCount, time.Minute)
-	defaultEnableGracefulRestart = enableDebugMode
+	defaultEnableGracefulRestart = EnableGracefulRestart
 	defaultIdleTimeout = IdleTimeout
 }
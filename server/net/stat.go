@@ -22,6 +22,9 @@ var SendBytes uint64
 // SendPkgs 回包个数
 var SendPkgs uint64
 
+// CheckFailPkgs 包完整性检查失败次数
+var CheckFailPkgs uint64
+
 func stat(path string) {
 	f, e := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
 	if e != nil {
@@ -29,9 +32,9 @@ func stat(path string) {
 		return
 	}
 
-	f.WriteString("RX bytes / packets  TX bytes / packets")
+	f.WriteString("RX bytes / packets  TX bytes / packets  check fail")
 	f.WriteString("\n")
-	f.WriteString("--------------------------------------")
+	f.WriteString("--------------------------------------------------")
 	f.WriteString("\n")
 
 	for {
@@ -45,22 +48,23 @@ func stat(path string) {
 				fmt.Printf("open stat log file fail:%v\n", e)
 				return
 			}
-			f.WriteString("RX bytes / packets  TX bytes / packets")
+			f.WriteString("RX bytes / packets  TX bytes / packets  check fail")
 			f.WriteString("\n")
-			f.WriteString("--------------------------------------")
+			f.WriteString("--------------------------------------------------")
 			f.WriteString("\n")
 		} else if fileInfo.Size() > 1024*1024*1024*2 { // 大于2G重新新建文件
 			f.Truncate(0)
-			f.WriteString("RX bytes / packets  TX bytes / packets")
+			f.WriteString("RX bytes / packets  TX bytes / packets  check fail")
 			f.WriteString("\n")
-			f.WriteString("--------------------------------------")
+			f.WriteString("--------------------------------------------------")
 			f.WriteString("\n")
 		}
 
-		f.WriteString(fmt.Sprintf("%d %d %d %d\n", RecvBytes, RecvPkgs, SendBytes, SendPkgs))
+		f.WriteString(fmt.Sprintf("%d %d %d %d %d\n", RecvBytes, RecvPkgs, SendBytes, SendPkgs, CheckFailPkgs))
 		atomic.StoreUint64(&RecvBytes, 0)
 		atomic.StoreUint64(&RecvPkgs, 0)
 		atomic.StoreUint64(&SendBytes, 0)
 		atomic.StoreUint64(&SendPkgs, 0)
+		atomic.StoreUint64(&CheckFailPkgs, 0)
 	}
 }
@@ -0,0 +1,236 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/erpc-go/erpc/server/workpool"
+	"github.com/erpc-go/log"
+)
+
+// Options 单个服务的参数，零值字段使用 Init 设置的默认值
+type Options struct {
+	Handler     Handler
+	Checker     Checker
+	Limiter     Limiter              // 按请求包限频，默认不限频
+	MsgTimeout  time.Duration        // 消息处理的最大时长
+	IdleTimeout time.Duration        // 长链接空闲时间
+	WorkerPool  *workpool.WorkerPool // udp 处理请求的协程池
+}
+
+// defaultMaxWorkerCount 未指定协程池时 udp 服务的最大并发请求数
+const defaultMaxWorkerCount = 10000
+
+func (o Options) withDefaults() Options {
+	if o.Checker == nil {
+		o.Checker = DefaultChecker
+	}
+	if o.Limiter == nil {
+		o.Limiter = noLimit{}
+	}
+	if o.MsgTimeout <= 0 {
+		o.MsgTimeout = defaultMsgTimeout
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = defaultIdleTimeout
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = 3 * time.Minute
+	}
+	if o.WorkerPool == nil {
+		o.WorkerPool = defaultWorkerPool
+	}
+	if o.WorkerPool == nil || o.WorkerPool.MaxWorkersCount <= 0 {
+		o.WorkerPool = workpool.New(defaultMaxWorkerCount, time.Minute)
+	}
+	return o
+}
+
+type noLimit struct{}
+
+func (noLimit) Wait()       {}
+func (noLimit) Allow() bool { return true }
+
+// ShutdownError 关闭服务时 ctx 已结束，仍未处理完的连接及请求被强制中断
+type ShutdownError struct {
+	Conns    int   // 强制关闭的连接数
+	Requests int   // 中断的请求数
+	Err      error // ctx.Err()
+}
+
+func (e *ShutdownError) Error() string {
+	return fmt.Sprintf("shutdown aborted %d requests on %d connections: %v", e.Requests, e.Conns, e.Err)
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// shutdownPollInterval 关闭服务时检查连接是否空闲的间隔
+const shutdownPollInterval = 10 * time.Millisecond
+
+// stream 面向连接的服务(tcp、unix)，管理连接及请求的生命周期
+type stream struct {
+	opts      Options
+	ln        net.Listener
+	file      socket // 热重启时传递给子进程的 socket
+	closing   atomic.Bool
+	mu        sync.Mutex
+	conns     map[*conn]struct{}
+	stopOnce  sync.Once
+	stopped   chan struct{} // Shutdown 完成
+	serving   chan struct{} // Serve 开始接收连接
+	startOnce sync.Once
+}
+
+func newStream(ln net.Listener, file socket, opts Options) stream {
+	return stream{
+		opts:    opts.withDefaults(),
+		ln:      ln,
+		file:    file,
+		conns:   make(map[*conn]struct{}),
+		stopped: make(chan struct{}),
+		serving: make(chan struct{}),
+	}
+}
+
+// Serving 返回的 channel 在 Serve 开始接收连接后关闭
+func (s *stream) Serving() <-chan struct{} {
+	return s.serving
+}
+
+// Addr 监听地址
+func (s *stream) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+// Serve 接收连接并处理请求，Shutdown 后等待关闭完成再返回 nil
+func (s *stream) Serve() error {
+	ctx := context.WithValue(context.Background(), ServerAddr, s.ln.Addr().String())
+	var tempDelay time.Duration // how long to sleep on accept failure
+	s.startOnce.Do(func() { close(s.serving) })
+	for {
+		rw, e := s.ln.Accept()
+		if e != nil {
+			if s.closing.Load() {
+				break
+			}
+			log.Raw(e.Error())
+			if ne, ok := e.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if max := 1 * time.Second; tempDelay > max {
+					tempDelay = max
+				}
+				log.Raw("%s: Accept error: %v; retrying in %v", s.ln.Addr().Network(), e, tempDelay)
+				time.Sleep(tempDelay)
+				continue
+			}
+			return e
+		}
+		tempDelay = 0
+		c := s.newConn(rw)
+		if !s.track(c) {
+			rw.Close()
+			break
+		}
+		go c.serve(ctx)
+	}
+
+	log.Raw("%s server closing", s.ln.Addr().Network())
+	<-s.stopped
+	log.Raw("%s server stopped", s.ln.Addr().Network())
+	return nil
+}
+
+func (s *stream) newConn(rwc net.Conn) *conn {
+	return &conn{
+		server: s,
+		rwc:    rwc,
+		drain:  make(chan struct{}),
+		cin:    make(chan []byte, 10),
+		cout:   make(chan response, 11),
+	}
+}
+
+// track 记录新连接，服务关闭中时返回 false
+func (s *stream) track(c *conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing.Load() {
+		return false
+	}
+	s.conns[c] = struct{}{}
+	return true
+}
+
+func (s *stream) untrack(c *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+}
+
+// Shutdown 停止接收连接，关闭空闲连接并等待处理中的请求回包
+// ctx 结束时强制关闭剩余的连接，返回 *ShutdownError
+// 接管的连接(如 HTTP/2)通过 Draining 通知协议，等待协议处理完处理中的请求后返回
+func (s *stream) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing.Store(true)
+	s.mu.Unlock()
+	release(s.file)
+	s.ln.Close()
+	defer s.stopOnce.Do(func() { close(s.stopped) })
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for !s.closeIdle() {
+		select {
+		case <-ctx.Done():
+			conns, reqs := s.closeAll()
+			err := &ShutdownError{Conns: conns, Requests: reqs, Err: ctx.Err()}
+			log.Raw("%s server %v", s.ln.Addr().Network(), err)
+			return err
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// closeIdle 关闭空闲连接，所有连接都已关闭时返回 true
+func (s *stream) closeIdle() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := 0
+	for c := range s.conns {
+		if !c.closeIfIdle() {
+			active++
+		}
+	}
+	if active > 0 {
+		return false
+	}
+	for c := range s.conns {
+		c.rwc.Close()
+	}
+	return true
+}
+
+// closeAll 强制关闭所有连接，返回关闭的连接数及中断的请求数
+func (s *stream) closeAll() (conns, reqs int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		if n, aborted := c.forceClose(); aborted {
+			conns++
+			reqs += n
+		}
+	}
+	return conns, reqs
+}
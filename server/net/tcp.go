@@ -1,48 +1,92 @@
 package net
 
 import (
+	"bytes"
 	"context"
-	"fmt"
+	"io"
 	"net"
 	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/erpc-go/erpc/utils/bufpool"
 	"github.com/erpc-go/log"
 )
 
-func init() {
-	TCPRecvBufPool = &sync.Pool{
-		New: func() interface{} {
-			return make([]byte, defaultRecvBufSize)
-		},
-	}
-}
-
+// defaultRecvBufSize 连接接收缓冲区初始大小，缓冲区及请求包均从 bufpool 获取
 const defaultRecvBufSize = 64 * 1024
 
-// TCPRecvBufPool tcp接收缓冲队列
-var TCPRecvBufPool *sync.Pool
-
-// conn 支持Pipeline
+// conn 面向连接的服务(tcp、unix)上的连接，支持Pipeline
 // 每个conn对应三个goroutine
 // 处理流程： client -> read_co -> work_co -> write_co -> client
 // read_co: 读取客户端请求并放入cin
 // work_co: 从cin读取请求处理并将结果写入cout
 // write_co：从cout读取响应并发送给客户端
 type conn struct {
-	server     *TCPServer
+	server     *stream
 	rwc        net.Conn
-	checker    Checker
 	cancelCtx  context.CancelFunc
 	remoteAddr string
 	mu         sync.Mutex
+	pending    int           // 已读取未回包的请求数，受 mu 保护
+	closed     bool          // 受 mu 保护
+	hijacked   bool          // 受 mu 保护
+	drain      chan struct{} // 接管的连接在服务关闭时关闭，见 Draining
+	drainOnce  sync.Once
 	cin        chan []byte
-	cout       chan []byte
+	cout       chan response
 	wg         sync.WaitGroup
 }
 
+// begin 读取到完整请求包时计数，连接已关闭时返回 false
+func (c *conn) begin() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	c.pending++
+	return true
+}
+
+// end 请求已回包或不回包
+func (c *conn) end() {
+	c.mu.Lock()
+	c.pending--
+	c.mu.Unlock()
+}
+
+// closeIfIdle 没有处理中的请求时关闭连接，返回连接是否不再需要等待
+// 接管的连接通知协议停止接收新请求，由协议处理完后返回时关闭
+func (c *conn) closeIfIdle() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return true
+	}
+	if c.hijacked {
+		c.drainOnce.Do(func() { close(c.drain) })
+		return false
+	}
+	if c.pending > 0 {
+		return false
+	}
+	c.closed = true
+	c.rwc.Close()
+	return true
+}
+
+// forceClose 关闭连接，返回中断的请求数及连接是否被中断
+// 接管的连接未等到协议返回，即使没有处理中的请求也视为中断
+func (c *conn) forceClose() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	c.rwc.Close()
+	return c.pending, c.pending > 0 || c.hijacked
+}
+
 // CtxKey ctx内部存放客户端地址的key
 type CtxKey string
 
@@ -60,22 +104,25 @@ func (c *conn) readRequests(ctx context.Context) {
 		c.wg.Done()
 	}()
 
-	buffer := TCPRecvBufPool.Get().([]byte)
+	buffer := bufpool.Get(defaultRecvBufSize)
+	buffer = buffer[:cap(buffer)]
 	defer func() {
-		TCPRecvBufPool.Put(buffer)
+		// 超过最大分级的缓冲区由 bufpool 丢弃，避免对象池常驻大内存
+		bufpool.Put(buffer)
 	}()
 
+	opts := &c.server.opts
+	hijacker, _ := opts.Handler.(ConnHijacker)
+	var dispatched bool // 连接上是否已分发过请求包
+
 	var nRead int
-	for !c.server.closing {
-		c.rwc.SetDeadline(time.Now().Add(c.server.idleTimeout))
+	for {
+		c.rwc.SetDeadline(time.Now().Add(opts.IdleTimeout))
 		n, err := c.rwc.Read(buffer[nRead:])
 		atomic.AddUint64(&RecvBytes, uint64(n))
 		atomic.AddUint64(&RecvPkgs, 1)
 		if err != nil {
 			log.Raw("tcp read fail: ", n, err)
-			if c.server.closing {
-				break
-			}
 			log.Raw("tcp read routine canceled context")
 			return
 		}
@@ -83,24 +130,25 @@ func (c *conn) readRequests(ctx context.Context) {
 
 		if nRead >= cap(buffer) {
 			log.Raw("tcp read too big, read %d bytes, expand twice", nRead)
-			tmpBuffer := make([]byte, nRead*2)
-			copy(tmpBuffer, buffer[:nRead])
-			buffer = tmpBuffer
+			buffer = bufpool.Grow(buffer[:nRead], nRead)
+			buffer = buffer[:cap(buffer)]
 		}
 
-		var readIndex int
-		for {
-			pkgLen, err := c.server.checker.Check(buffer[readIndex:nRead])
-			if err != nil || pkgLen < 0 {
-				log.Raw("tcp check fail: ", pkgLen, err)
+		// 连接级协议(如 HTTP/2)在分发首个请求包前接管整个连接
+		if hijacker != nil && !dispatched {
+			if serve := hijacker.Hijack(buffer[:nRead]); serve != nil {
+				c.hijack(ctx, serve, buffer[:nRead])
 				return
 			}
+		}
 
-			if readIndex+pkgLen > nRead {
-				log.Raw("tcp check fail, pkglen:%d > nRead:%d", readIndex+pkgLen, nRead)
-				return
-			}
-			if !c.server.limiter.Allow() {
+		// 按 Checker 约定拆包：0 未收完，>0 完整包长度，err 包错误
+		var readIndex int
+		for readIndex < nRead {
+			pkgLen, err := opts.Checker.Check(buffer[readIndex:nRead])
+			if err != nil || pkgLen < 0 || readIndex+pkgLen > nRead {
+				atomic.AddUint64(&CheckFailPkgs, 1)
+				log.Raw("tcp check fail, pkglen:%d, remain:%d, err:%v", pkgLen, nRead-readIndex, err)
 				return
 			}
 
@@ -110,25 +158,34 @@ func (c *conn) readRequests(ctx context.Context) {
 				break
 			}
 
-			// 接收完成
-			req := make([]byte, pkgLen)
-			copy(req, buffer[readIndex:readIndex+pkgLen])
+			// 只有完整的包才计入限频
+			if !opts.Limiter.Allow() {
+				log.Raw("tcp over ratelimit, close connection:%s", c.remoteAddr)
+				return
+			}
+			// 服务关闭中，连接已作为空闲连接关闭
+			if !c.begin() {
+				return
+			}
+
+			// 接收完成，请求包处理完后归还缓冲池
+			req := append(bufpool.Get(pkgLen), buffer[readIndex:readIndex+pkgLen]...)
 			select {
 			case <-ctx.Done():
 				log.Raw("tcp read routine context done:", ctx.Err())
+				bufpool.Put(req)
+				c.end()
 				return
 			case c.cin <- req:
 				readIndex += pkgLen
+				dispatched = true
 				log.Raw("read %v bytes from %v", pkgLen, c.remoteAddr)
 			}
 
-			if readIndex >= nRead {
-				// 正常包
-				break
+			if readIndex < nRead {
+				// 多收，粘包, 继续check
+				log.Raw("tcp stick packet: ", readIndex, nRead)
 			}
-
-			// 多收，粘包, 继续check
-			log.Raw("tcp stick packet: ", readIndex, nRead)
 		}
 
 		if readIndex > 0 {
@@ -138,11 +195,31 @@ func (c *conn) readRequests(ctx context.Context) {
 			nRead -= readIndex
 		}
 	}
+}
 
-	if c.server.closing {
-		log.Raw("tcp connection closing, sleep 5 seconds")
-		time.Sleep(time.Second * 5)
-	}
+// hijack 连接交由连接级协议处理，已读取的数据在连接上重放
+func (c *conn) hijack(ctx context.Context, serve func(context.Context, net.Conn), prefix []byte) {
+	log.Raw("tcp connection hijacked:%s", c.remoteAddr)
+	c.mu.Lock()
+	c.hijacked = true
+	c.mu.Unlock()
+	c.rwc.SetDeadline(time.Time{})
+	replay := make([]byte, len(prefix))
+	copy(replay, prefix)
+	serve(context.WithValue(ctx, hijackKey{}, c), &prefixConn{
+		Conn: c.rwc,
+		r:    io.MultiReader(bytes.NewReader(replay), c.rwc),
+	})
+}
+
+// prefixConn 先读取已缓存数据再读取连接
+type prefixConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *prefixConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
 }
 
 func (c *conn) handle(ctx context.Context) {
@@ -159,36 +236,55 @@ func (c *conn) handle(ctx context.Context) {
 		}
 	}()
 
+	// 需要按顺序回包的请求等待之前的请求写入 cout 后在本协程处理，
+	// 写协程按 cout 的顺序回包，Connection: close 等回包后关闭连接时之前的回包均已发送
+	seq, _ := c.server.opts.Handler.(Sequencer)
+	var inflight sync.WaitGroup
 	for {
 		select {
 		case <-ctx.Done():
 			log.Raw("tcp handle routine context done:", ctx.Err())
 			return
 		case req := <-c.cin:
+			if seq != nil && seq.InOrder(req) {
+				inflight.Wait()
+				c.serveRequest(ctx, req)
+				continue
+			}
+			inflight.Add(1)
 			go func() {
-				log.Raw("tcp handle business goroutine start")
-				defer func() {
-					log.Raw("tcp handle business goroutine return")
-				}()
-				subCtx, cancel := context.WithTimeout(ctx, c.server.msgTimeout)
-				rsp, err := c.server.handler.Serve(subCtx, req)
-				cancel()
-				if err != nil {
-					log.Raw(err.Error())
-					return
-				}
-				select {
-				case <-ctx.Done():
-					log.Raw("tcp handle business goroutine context done")
-					return
-				case c.cout <- rsp:
-					log.Raw("tcp handle business goroutine write rsp to cout channel")
-				}
+				defer inflight.Done()
+				c.serveRequest(ctx, req)
 			}()
 		}
 	}
 }
 
+// serveRequest 处理请求包并将回包写入 cout
+func (c *conn) serveRequest(ctx context.Context, req []byte) {
+	log.Raw("tcp handle business goroutine start")
+	defer func() {
+		log.Raw("tcp handle business goroutine return")
+	}()
+	subCtx, cancel := context.WithTimeout(ctx, c.server.opts.MsgTimeout)
+	subCtx, ctl := withConnControl(subCtx)
+	rsp, err := c.server.opts.Handler.Serve(subCtx, req)
+	cancel()
+	bufpool.Put(req)
+	if err != nil {
+		log.Raw(err.Error())
+		c.end()
+		return
+	}
+	select {
+	case <-ctx.Done():
+		log.Raw("tcp handle business goroutine context done")
+		c.end()
+	case c.cout <- response{data: rsp, close: ctl.closeAfterWrite, release: ctl.releaseAfterWrite}:
+		log.Raw("tcp handle business goroutine write rsp to cout channel")
+	}
+}
+
 func (c *conn) writeResponses(ctx context.Context) {
 	log.Raw("tcp write goroutine start")
 	defer func() {
@@ -203,7 +299,11 @@ func (c *conn) writeResponses(ctx context.Context) {
 			log.Raw("tcp write routine context done:", ctx.Err())
 			return
 		case rsp := <-c.cout:
-			n, err := c.rwc.Write(rsp)
+			n, err := c.rwc.Write(rsp.data)
+			c.end()
+			if rsp.release {
+				bufpool.Put(rsp.data)
+			}
 			if err != nil {
 				log.Raw(err.Error())
 				return
@@ -211,6 +311,12 @@ func (c *conn) writeResponses(ctx context.Context) {
 			log.Raw("write %v bytes to %v", n, c.remoteAddr)
 			atomic.AddUint64(&SendBytes, uint64(n))
 			atomic.AddUint64(&SendPkgs, 1)
+			if rsp.close {
+				// 关闭连接以唤醒阻塞在 Read 上的读协程
+				log.Raw("tcp close connection after write:%s", c.remoteAddr)
+				c.rwc.Close()
+				return
+			}
 		}
 	}
 }
@@ -221,6 +327,7 @@ func (c *conn) serve(ctx context.Context) {
 	ctx, cancelCtx := context.WithCancel(ctx)
 	c.cancelCtx = cancelCtx
 	log.Raw("accept tcp connection from:", c.remoteAddr)
+	defer c.server.untrack(c)
 	defer c.rwc.Close()
 
 	c.wg.Add(3)
@@ -248,101 +355,10 @@ func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
 
 // TCPServer tcp服务结构体
 type TCPServer struct {
-	addr        *net.TCPAddr // TCP address to listen on, ":http" if empty
-	handler     Handler      // handler to invoke, http.DefaultServeMux if nil
-	checker     Checker
-	limiter     Limiter
-	conn        tcpKeepAliveListener
-	msgTimeout  time.Duration // 消息处理的最大时长
-	idleTimeout time.Duration // 长链接空闲时间
-	closing     bool
-	stop        chan int
+	stream
 }
 
-// ListenAndServe 启动tcp服务
-func (srv *TCPServer) ListenAndServe() error {
-	ln, err := net.ListenTCP("tcp", srv.addr)
-	if err != nil {
-		panic(err)
-	}
-	defer ln.Close()
-	return srv.Serve(tcpKeepAliveListener{ln})
-}
-
-// Serve 处理请求
-func (srv *TCPServer) Serve(l net.Listener) error {
-	ctx := context.WithValue(context.Background(), ServerAddr, srv.addr.String())
-	var tempDelay time.Duration // how long to sleep on accept failure
-	for !srv.closing {
-		rw, e := l.Accept()
-		if e != nil {
-			log.Raw(e.Error())
-			if srv.closing {
-				break
-			}
-			if ne, ok := e.(net.Error); ok && ne.Temporary() {
-				if tempDelay == 0 {
-					tempDelay = 5 * time.Millisecond
-				} else {
-					tempDelay *= 2
-				}
-				if max := 1 * time.Second; tempDelay > max {
-					tempDelay = max
-				}
-				log.Raw("tcp: Accept error: %v; retrying in %v", e, tempDelay)
-				time.Sleep(tempDelay)
-				continue
-			}
-			return e
-		}
-		tempDelay = 0
-		c := srv.newConn(rw)
-		go c.serve(ctx)
-	}
-
-	log.Raw("tcp server closing")
-	<-srv.stop
-	log.Raw("tcp server stopped")
-	time.Sleep(time.Second)
-	return nil
-}
-
-func (srv *TCPServer) newConn(rwc net.Conn) *conn {
-	c := &conn{
-		server: srv,
-		rwc:    rwc,
-		cin:    make(chan []byte, 10),
-		cout:   make(chan []byte, 11),
-	}
-	return c
-}
-
-// Fork 热重启fork子进程，老进程停止接收请求
-func (srv *TCPServer) Fork() (int, error) {
-	log.Raw("fork tcp server")
-	if srv.closing {
-		return 0, fmt.Errorf("tcp server already forked")
-	}
-	file, err := srv.conn.File()
-	if err != nil {
-		return 0, fmt.Errorf("tcp server get conn file fail:%s", err)
-	}
-	// ! remember to release it
-	defer file.Close()
-	return StartNewProcess(file.Fd(), 0, 0)
-}
-
-// Shutdown 热重启，让老进程退出
-func (srv *TCPServer) Shutdown() error {
-	log.Raw("shutdown tcp server, wait for 10 seconds")
-	if !srv.closing {
-		srv.closing = true
-		srv.idleTimeout = 0
-		srv.conn.SetDeadline(time.Now())
-		log.Raw("tcp listener set deadline")
-	}
-	time.Sleep(time.Second * 10)
-	srv.stop <- 1
-
-	return nil
+// NewTCPServer 在已监听的 ln 上创建 tcp 服务
+func NewTCPServer(ln *net.TCPListener, opts Options) *TCPServer {
+	return &TCPServer{stream: newStream(tcpKeepAliveListener{ln}, ln, opts)}
 }
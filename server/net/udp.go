@@ -2,13 +2,13 @@ package net
 
 import (
 	"context"
-	"fmt"
 	"net"
 	"runtime"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/erpc-go/erpc/server/workpool"
+	"github.com/erpc-go/erpc/utils/bufpool"
 	"github.com/erpc-go/log"
 )
 
@@ -24,6 +24,7 @@ type UDPRequest struct {
 	handler             Handler
 	msgTimeout          time.Duration
 	conn                *net.UDPConn
+	done                func() // 请求处理完成
 }
 
 // Handle 处理udp请求
@@ -31,6 +32,12 @@ func (r *UDPRequest) Handle() error {
 	ctx, cancel := context.WithTimeout(context.Background(), r.msgTimeout)
 	defer cancel()
 	ctx = context.WithValue(ctx, ClientAddr, r.peerAddr.String())
+	ctx, ctl := withConnControl(ctx)
+	ctl.packet = true
+	defer bufpool.Put(r.req)
+	if r.done != nil {
+		defer r.done()
+	}
 	defer func() {
 		if e := recover(); e != nil {
 			buf := make([]byte, RecoverStackSize)
@@ -40,14 +47,16 @@ func (r *UDPRequest) Handle() error {
 	}()
 	rsp, e := r.handler.Serve(ctx, r.req)
 	if e == nil && len(rsp) > 0 {
-		if len(rsp) >= MaxUDPPkg {
+		n, err := r.conn.WriteToUDP(rsp, r.peerAddr)
+		if ctl.releaseAfterWrite {
+			bufpool.Put(rsp)
 		}
-		if n, err := r.conn.WriteToUDP(rsp, r.peerAddr); err == nil {
+		if err == nil {
 			log.Raw("write %v bytes\n", n)
 			atomic.AddUint64(&SendBytes, uint64(n))
 			atomic.AddUint64(&SendPkgs, 1)
 		} else {
-			log.Raw(e.Error())
+			log.Raw(err.Error())
 		}
 	} else {
 		log.Raw("rsp err %v, rsp len %v", e, len(rsp))
@@ -57,46 +66,46 @@ func (r *UDPRequest) Handle() error {
 
 // UDPServer defines parameters for running an UDP server.
 type UDPServer struct {
-	addr       *net.UDPAddr // UDP address to listen on
-	handler    Handler      // handler to invoke
-	checker    Checker
-	limiter    Limiter
-	conn       *net.UDPConn
-	msgTimeout time.Duration // 消息处理的最大时长
-	workerpool *workpool.WorkerPool
-	closing    bool
-	stop       chan int
+	opts      Options
+	conn      *net.UDPConn
+	closing   atomic.Bool
+	pending   atomic.Int64 // 处理中的请求数
+	stopOnce  sync.Once
+	stopped   chan struct{} // Shutdown 完成
+	serving   chan struct{} // Serve 开始读取请求
+	startOnce sync.Once
 }
 
-// ListenAndServe listens on the UDP network address srv.Addr and then
-// calls Serve to handle requests on incoming connections.  If
-// srv.Addr is blank, ":http" is used.
-func (srv *UDPServer) ListenAndServe() error {
-	conn, e := net.ListenUDP("udp", srv.addr)
-	if e != nil {
-		panic(e)
-	}
-	srv.conn = conn
-	defer srv.conn.Close()
+// NewUDPServer 在已监听的 conn 上创建 udp 服务
+func NewUDPServer(conn *net.UDPConn, opts Options) *UDPServer {
+	return &UDPServer{opts: opts.withDefaults(), conn: conn, stopped: make(chan struct{}), serving: make(chan struct{})}
+}
 
-	return srv.Serve()
+// Serving 返回的 channel 在 Serve 开始读取请求后关闭
+func (srv *UDPServer) Serving() <-chan struct{} {
+	return srv.serving
 }
 
-// Serve accepts incoming connections on the Listener l, creating a
-// new service thread for each.  The service threads read requests and
-// then call srv.Handler to reply to them.
+// Addr 监听地址
+func (srv *UDPServer) Addr() net.Addr {
+	return srv.conn.LocalAddr()
+}
+
+// Serve 读取请求包并交由协程池处理，Shutdown 后等待关闭完成再返回 nil
 func (srv *UDPServer) Serve() error {
 	var tempDelay time.Duration // how long to sleep on accept failure
 	recvBuf := make([]byte, MaxUDPPkg)
-	for !srv.closing {
+	localAddr, _ := srv.conn.LocalAddr().(*net.UDPAddr)
+	srv.startOnce.Do(func() { close(srv.serving) })
+	for {
 		n, raddr, e := srv.conn.ReadFromUDP(recvBuf)
 		atomic.AddUint64(&RecvBytes, uint64(n))
 		atomic.AddUint64(&RecvPkgs, 1)
 		if e != nil {
-			log.Raw(e.Error())
-			if srv.closing {
+			if srv.closing.Load() {
 				break
 			}
+			log.Raw(e.Error())
 			if ne, ok := e.(net.Error); ok && ne.Temporary() {
 				if tempDelay == 0 {
 					tempDelay = 5 * time.Millisecond
@@ -114,59 +123,59 @@ func (srv *UDPServer) Serve() error {
 		}
 
 		log.Raw("read %v bytes\n", n)
-		if !srv.limiter.Allow() {
+		// udp 一个报文即一个完整请求包，不完整同样视为包错误
+		num, e := srv.opts.Checker.Check(recvBuf[:n])
+		if num <= 0 || num > n || e != nil {
+			atomic.AddUint64(&CheckFailPkgs, 1)
+			log.Raw("bad pkg, recv %d, error %v, num %d", n, e, num)
 			continue
 		}
-		if num, e := srv.checker.Check(recvBuf[:n]); num == 0 || e != nil {
-			log.Raw("bad pkg, recv %d, error %v, num %d", n, e, num)
+		if !srv.opts.Limiter.Allow() {
 			continue
 		}
+		srv.pending.Add(1)
 		request := &UDPRequest{
-			req:        make([]byte, n, n),
-			localAddr:  srv.addr,
+			req:        append(bufpool.Get(num), recvBuf[:num]...),
+			localAddr:  localAddr,
 			peerAddr:   raddr,
-			handler:    srv.handler,
-			msgTimeout: srv.msgTimeout,
+			handler:    srv.opts.Handler,
+			msgTimeout: srv.opts.MsgTimeout,
 			conn:       srv.conn,
+			done:       func() { srv.pending.Add(-1) },
 		}
-		copy(request.req, recvBuf[:n])
-		if !srv.workerpool.Serve(request) {
+		if !srv.opts.WorkerPool.Serve(request) {
 			log.Raw("workerpool over ratelimit")
+			srv.pending.Add(-1)
+			bufpool.Put(request.req)
 			srv.conn.WriteToUDP([]byte("over ratelimit"), raddr)
 		}
 	}
 
 	log.Raw("udp server closing")
-	<-srv.stop
+	<-srv.stopped
 	log.Raw("udp server stopped")
-	time.Sleep(time.Second)
 	return nil
 }
 
-// Fork 热重启fork子进程，老进程停止接收请求
-func (srv *UDPServer) Fork() (int, error) {
-	log.Raw("fork udp server")
-	if srv.closing {
-		return 0, fmt.Errorf("udp server already forked")
-	}
-
-	file, err := srv.conn.File()
-	if err != nil {
-		return 0, fmt.Errorf("udp server get conn file fail:%s", err)
-	}
-	// ! remember to release it
-	defer file.Close()
-	return StartNewProcess(0, file.Fd(), 0)
-}
+// Shutdown 停止读取请求包，等待处理中的请求回包后关闭 socket
+// ctx 结束时直接关闭 socket，返回 *ShutdownError，处理中的请求无法再回包
+func (srv *UDPServer) Shutdown(ctx context.Context) error {
+	srv.closing.Store(true)
+	release(srv.conn)
+	srv.conn.SetReadDeadline(time.Now())
+	defer srv.stopOnce.Do(func() { close(srv.stopped) })
+	defer srv.conn.Close()
 
-// Shutdown 热重启，让老进程退出
-func (srv *UDPServer) Shutdown() error {
-	log.Raw("shutdown udp server, wait for 10 seconds")
-	if !srv.closing {
-		srv.closing = true
-		srv.conn.SetReadDeadline(time.Now())
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for srv.pending.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			err := &ShutdownError{Requests: int(srv.pending.Load()), Err: ctx.Err()}
+			log.Raw("udp server %v", err)
+			return err
+		case <-ticker.C:
+		}
 	}
-	time.Sleep(time.Second * 10)
-	srv.stop <- 1
 	return nil
 }
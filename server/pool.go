@@ -1,43 +1,20 @@
 package server
 
 import (
-	"sync"
-
 	"github.com/erpc-go/erpc/protocol"
-	"github.com/erpc-go/erpc/protocol/test"
+	_ "github.com/erpc-go/erpc/protocol/erpc"
+	_ "github.com/erpc-go/erpc/protocol/grpc"
+	_ "github.com/erpc-go/erpc/protocol/http"
+	_ "github.com/erpc-go/erpc/protocol/jsonrpc"
+	_ "github.com/erpc-go/erpc/protocol/test"
 )
 
-var pools = map[protocol.ProtocolType]sync.Pool{
-	protocol.ProtocolErpc: {
-		New: func() any {
-			return nil
-		},
-	},
-	protocol.ProtocolHttp: {
-		New: func() any {
-			return nil
-		},
-	},
-	protocol.ProtocolTest: {
-		New: func() any {
-			return test.TestProtocol{}
-		},
-	},
-	protocol.ProtocolGrpc: {
-		New: func() any {
-			return nil
-		},
-	},
+// GetProtocolStruct 从协议对象池中获取空报文，协议未注册时返回 nil
+func GetProtocolStruct(t protocol.ProtocolType) protocol.Protocol {
+	return protocol.Acquire(t)
 }
 
-func GetProtocolStruct(t protocol.ProtocolType) (p protocol.Protocol) {
-	a, ok := pools[t]
-	if !ok {
-		return
-	}
-	b, ok := a.Get().(protocol.Protocol)
-	if !ok {
-		return
-	}
-	return b
+// PutProtocolStruct 报文归还协议对象池
+func PutProtocolStruct(t protocol.ProtocolType, p protocol.Protocol) {
+	protocol.Release(t, p)
 }
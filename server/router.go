@@ -0,0 +1,168 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/erpc-go/erpc/protocol"
+)
+
+// route 带通配符的命令字
+// 命令字按 "." 分段，以 "/" 开头的 HTTP 路径按 "/" 分段；"*" 匹配任意一段，位于末尾时匹配其后的所有段(至少一段)
+type route struct {
+	pattern  string
+	sep      string
+	sections []string
+}
+
+func patternSep(pattern string) string {
+	if strings.HasPrefix(pattern, "/") {
+		return "/"
+	}
+	return "."
+}
+
+func isWildcard(pattern string) bool {
+	for _, s := range strings.Split(pattern, patternSep(pattern)) {
+		if s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func newRoute(pattern string) route {
+	sep := patternSep(pattern)
+	return route{pattern: pattern, sep: sep, sections: strings.Split(pattern, sep)}
+}
+
+func (r route) match(sections []string) bool {
+	last := len(r.sections) - 1
+	if len(sections) < len(r.sections) || (len(sections) > len(r.sections) && r.sections[last] != "*") {
+		return false
+	}
+	for i, s := range r.sections {
+		if s != "*" && s != sections[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// moreSpecific 逐段比较，先出现确定值的更具体，都相同时段数多的更具体
+func (r route) moreSpecific(o route) bool {
+	for i := 0; i < len(r.sections) && i < len(o.sections); i++ {
+		if a, b := r.sections[i] == "*", o.sections[i] == "*"; a != b {
+			return b
+		}
+	}
+	return len(r.sections) > len(o.sections)
+}
+
+// register 注册命令字，调用方持有写锁
+func (sm *ServeMutex) register(entry mutexEntry) {
+	if sm.mapEntries == nil {
+		sm.mapEntries = make(map[string]mutexEntry)
+	}
+	if _, ok := sm.mapEntries[entry.pattern]; !ok && isWildcard(entry.pattern) {
+		sm.routes = append(sm.routes, newRoute(entry.pattern))
+		sort.SliceStable(sm.routes, func(i, j int) bool { return sm.routes[i].moreSpecific(sm.routes[j]) })
+	}
+	sm.mapEntries[entry.pattern] = sm.build(entry)
+}
+
+// lookup 查找请求命令字对应的处理函数，先精确匹配，再按通配命令字从具体到宽泛匹配
+func (sm *ServeMutex) lookup(pattern string) (mutexEntry, bool) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	if entry, ok := sm.mapEntries[pattern]; ok {
+		return entry, true
+	}
+	if len(sm.routes) == 0 {
+		return mutexEntry{}, false
+	}
+	sep := patternSep(pattern)
+	sections := strings.Split(pattern, sep)
+	for _, r := range sm.routes {
+		if r.sep == sep && r.match(sections) {
+			return sm.mapEntries[r.pattern], true
+		}
+	}
+	return mutexEntry{}, false
+}
+
+// SetNotFound 设置命令字不存在时的处理函数
+// 调用前已设置 StatusNotFound 返回码，处理函数可以修改返回码或设置 ctx.Rsp 回包；ctx.Req 为 nil
+func (sm *ServeMutex) SetNotFound(h Handler) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.notFound = h
+	sm.rebuildNotFound()
+}
+
+// SetNotFound 设置组内命令字不存在时的处理函数，优先于 ServeMutex.SetNotFound
+func (g *Group) SetNotFound(h Handler) {
+	g.sm.mutex.Lock()
+	defer g.sm.mutex.Unlock()
+	g.notFound = h
+	g.sm.rebuildNotFound()
+}
+
+// notFoundHandler 命令字不存在时的处理函数，同样经过中间件，按所在的组取 rebuildNotFound 组装的处理链
+func (sm *ServeMutex) notFoundHandler(pattern string) Handler {
+	sm.mutex.RLock()
+	h, ok := sm.notFoundChains[sm.groupPrefix(pattern)]
+	sm.mutex.RUnlock()
+	if ok {
+		return h
+	}
+	// 未注册过中间件、组及 notFound 时尚未组装
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	if sm.notFoundChains == nil {
+		sm.rebuildNotFound()
+	}
+	return sm.notFoundChains[sm.groupPrefix(pattern)]
+}
+
+// groupPrefix 命令字所在的前缀最长的组的前缀，不在任何组内时为空，调用方持有锁
+// 命令字所在的其他组均为该组的外层组，前缀是其前缀
+func (sm *ServeMutex) groupPrefix(pattern string) string {
+	var prefix string
+	for _, g := range sm.groups {
+		if len(g.prefix) > len(prefix) && strings.HasPrefix(pattern, g.prefix) {
+			prefix = g.prefix
+		}
+	}
+	return prefix
+}
+
+// rebuildNotFound 按组组装命令字不存在时的处理链，使用前缀最长的组的 notFound，调用方持有写锁
+func (sm *ServeMutex) rebuildNotFound() {
+	chains := make(map[string]Handler, len(sm.groups)+1)
+	prefixes := []string{""}
+	for _, g := range sm.groups {
+		prefixes = append(prefixes, g.prefix)
+	}
+	for _, prefix := range prefixes {
+		h, longest := sm.notFound, -1
+		for _, g := range sm.groups {
+			if g.notFound != nil && len(g.prefix) > longest && strings.HasPrefix(prefix, g.prefix) {
+				h, longest = g.notFound, len(g.prefix)
+			}
+		}
+		if h == nil {
+			h = HandlerFunc(func(*Context) {})
+		}
+		chains[prefix] = sm.build(mutexEntry{h: h, pattern: prefix}).chain
+	}
+	sm.notFoundChains = chains
+}
+
+// serveNotFound 设置 StatusNotFound 后执行 notFoundHandler
+func (sm *ServeMutex) serveNotFound(ctx *Context, pattern string) {
+	ctx.SetResult(protocol.StatusNotFound)
+	ctx.SetResultMsg(fmt.Sprintf("invalid cmd pattern:%s", pattern))
+	sm.notFoundHandler(pattern).Process(ctx)
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erpc-go/erpc/compress"
+	"github.com/erpc-go/erpc/protocol"
+	erpc "github.com/erpc-go/erpc/protocol/erpc"
+)
+
+// routeHandler 回包为命中的命令字
+func routeHandler(pattern string) HandlerFunc {
+	return func(c *Context) {
+		c.Rsp.(*echoMessage).data = []byte(pattern)
+	}
+}
+
+func TestRouteMatch(t *testing.T) {
+	sm := &ServeMutex{}
+	for _, p := range []string{
+		"svc.user.get.send", "svc.user.*", "svc.*.get.send", "*.*.*.*", "svc.user.*.send", "/rif/room/*",
+	} {
+		sm.HandleFunc(p, "", routeHandler(p), &echoMessage{}, &echoMessage{})
+	}
+
+	tests := []struct {
+		route string
+		want  string
+	}{
+		{"svc.user.get.send", "svc.user.get.send"},
+		{"svc.user.set.send", "svc.user.*.send"},
+		{"svc.user.set.recv", "svc.user.*"},
+		{"svc.user.list", "svc.user.*"},
+		{"svc.order.get.send", "svc.*.get.send"},
+		{"demo.test.echo.send", "*.*.*.*"},
+		{"/rif/room/get_list", "/rif/room/*"},
+		{"/rif/room/a/b", "/rif/room/*"},
+	}
+	for _, tt := range tests {
+		rsp, body := serveRoute(t, sm, tt.route, "")
+		if rsp.GetResultCode() != 0 || body != tt.want {
+			t.Errorf("%s: code:%d, matched %q, want %q", tt.route, rsp.GetResultCode(), body, tt.want)
+		}
+	}
+
+	for _, route := range []string{"svc.user", "demo.test", "/rif/room", "/rif/user/get"} {
+		if rsp, _ := serveRoute(t, sm, route, ""); rsp.GetResultCode() != protocol.StatusNotFound {
+			t.Errorf("%s: code:%d, want not found", route, rsp.GetResultCode())
+		}
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	sm := &ServeMutex{}
+	var logged []string
+	sm.Use(func(next Handler) Handler {
+		return HandlerFunc(func(c *Context) {
+			next.Process(c)
+			logged = append(logged, c.Protocol.GetCmdPattern())
+		})
+	})
+	sm.HandleFunc("demo.test.echo.send", "", handleEcho, &echoMessage{}, &echoMessage{})
+
+	rsp, _ := serveRoute(t, sm, "demo.test.none.send", "")
+	if rsp.GetResultCode() != protocol.StatusNotFound || rsp.GetResultMsg() != "invalid cmd pattern:demo.test.none.send" {
+		t.Fatalf("unexpected rsp, code:%d, msg:%s", rsp.GetResultCode(), rsp.GetResultMsg())
+	}
+	if len(logged) != 1 {
+		t.Fatalf("middleware should run for not found, got %v", logged)
+	}
+
+	sm.SetNotFound(HandlerFunc(func(c *Context) {
+		c.SetResult(404)
+		c.Rsp = &echoMessage{data: []byte("global")}
+	}))
+	g := sm.Group("demo.user.")
+	g.SetNotFound(HandlerFunc(func(c *Context) {
+		c.Rsp = &echoMessage{data: []byte("group")}
+	}))
+	if rsp, body := serveRoute(t, sm, "demo.test.none.send", ""); rsp.GetResultCode() != 404 || body != "global" {
+		t.Fatalf("unexpected rsp, code:%d, body:%q", rsp.GetResultCode(), body)
+	}
+	if rsp, body := serveRoute(t, sm, "demo.user.none.send", ""); rsp.GetResultCode() != protocol.StatusNotFound || body != "group" {
+		t.Fatalf("unexpected rsp, code:%d, body:%q", rsp.GetResultCode(), body)
+	}
+}
+
+func TestAlias(t *testing.T) {
+	var trace []string
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", handleEcho, &echoMessage{}, &echoMessage{}, recordMiddleware(&trace, "p"))
+	sm.Alias("demo.test.echo.send", "/qza0x80/4", "demo.test.echo.*")
+
+	for _, route := range []string{"/qza0x80/4", "demo.test.echo.recv"} {
+		trace = nil
+		if rsp, body := serveRoute(t, sm, route, "hi"); rsp.GetResultCode() != 1 || body != "echo:hi" || len(trace) != 2 {
+			t.Errorf("%s: code:%d, body:%q, trace:%v", route, rsp.GetResultCode(), body, trace)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("alias of unknown pattern should panic")
+		}
+	}()
+	sm.Alias("demo.test.none.send", "demo.test.other.send")
+}
+
+// TestGroupOptions 组配置作用于组内命令字，子组的设置优先
+func TestGroupOptions(t *testing.T) {
+	release := make(chan struct{})
+	sm := &ServeMutex{}
+	slow := func(c *Context) {
+		if string(c.Req.(*echoMessage).data) == "slow" {
+			<-release
+		}
+		c.Rsp.(*echoMessage).data = c.Req.(*echoMessage).data
+	}
+	g := sm.Group("demo.test.")
+	g.HandleFunc("echo.send", "", slow, &echoMessage{}, &echoMessage{})
+	sub := g.Group("zip.")
+	sub.HandleFunc("echo.send", "", slow, &echoMessage{}, &echoMessage{})
+	sm.HandleFunc("demo.other.echo.send", "", slow, &echoMessage{}, &echoMessage{})
+	// 已注册的命令字同样生效
+	g.SetOptions(GroupOptions{MsgTimeout: 20 * time.Millisecond})
+	sub.SetOptions(GroupOptions{Compress: &compress.Policy{Type: compress.Gzip}})
+
+	for _, route := range []string{"demo.test.echo.send", "demo.test.zip.echo.send"} {
+		if rsp, _ := serveRoute(t, sm, route, "slow"); rsp.GetResultCode() != protocol.StatusServerTimeout {
+			t.Errorf("%s: code:%d, want timeout", route, rsp.GetResultCode())
+		}
+	}
+
+	for _, tt := range []struct {
+		route string
+		want  compress.CompressType
+	}{
+		{"demo.test.echo.send", compress.None},
+		{"demo.test.zip.echo.send", compress.Gzip},
+	} {
+		req := erpc.NewRequest(tt.route)
+		req.SetAcceptCompress(compress.Gzip)
+		body, _ := req.MarshalBody(&echoMessage{data: []byte("hi")})
+		req.SetBodyLen(uint32(len(body)))
+		head, _ := req.MarshalHeader()
+		rspBuf, err := sm.Serve(context.Background(), append(head, body...))
+		if err != nil {
+			t.Fatalf("%s: serve failed: %v", tt.route, err)
+		}
+		rsp := erpc.NewPackage()
+		if err := rsp.UnmarshalHeader(rspBuf); err != nil || rsp.GetCompress() != tt.want {
+			t.Errorf("%s: rsp compress = %d, want %d, err:%v", tt.route, rsp.GetCompress(), tt.want, err)
+		}
+	}
+
+	// 组外的命令字不受影响
+	done := make(chan struct{})
+	go func() {
+		serveRoute(t, sm, "demo.other.echo.send", "slow")
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatalf("command outside the group should not time out")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-done
+}
+
+// TestGroupTimeoutCapped 组的 MsgTimeout 不超过 ServeMutex.MsgTimeout，后者可在注册后设置
+func TestGroupTimeoutCapped(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	sm := &ServeMutex{}
+	g := sm.Group("demo.test.")
+	g.SetOptions(GroupOptions{MsgTimeout: time.Minute})
+	g.HandleFunc("echo.send", "", func(c *Context) { <-release }, &echoMessage{}, &echoMessage{})
+	sm.MsgTimeout = 20 * time.Millisecond
+
+	start := time.Now()
+	if rsp, _ := serveRoute(t, sm, "demo.test.echo.send", ""); rsp.GetResultCode() != protocol.StatusServerTimeout {
+		t.Fatalf("code:%d, want timeout", rsp.GetResultCode())
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Fatalf("group timeout not capped by MsgTimeout, cost %v", cost)
+	}
+}
+
+// TestNotFoundChainCached 命令字不存在时的处理链在注册时组装，不在每个请求中组装
+func TestNotFoundChainCached(t *testing.T) {
+	sm := &ServeMutex{}
+	var built int
+	sm.Use(func(next Handler) Handler {
+		built++
+		return next
+	})
+	g := sm.Group("demo.user.")
+	g.SetNotFound(HandlerFunc(func(c *Context) {
+		c.Rsp = &echoMessage{data: []byte("group")}
+	}))
+	before := built
+	for i := 0; i < 3; i++ {
+		serveRoute(t, sm, "demo.test.none.send", "")
+		if _, body := serveRoute(t, sm, "demo.user.none.send", ""); body != "group" {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+	if built != before {
+		t.Fatalf("not found chain built %d times while serving", built-before)
+	}
+}
+
+// TestRegisterWhileServing 服务运行中注册命令字及中间件
+func TestRegisterWhileServing(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", handleEcho, &echoMessage{}, &echoMessage{})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			p := fmt.Sprintf("demo.test%d.*", i)
+			sm.HandleFunc(p, "", routeHandler(p), &echoMessage{}, &echoMessage{})
+			sm.Use(func(next Handler) Handler { return next })
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if _, body := serveRoute(t, sm, "demo.test.echo.send", "hi"); body != "echo:hi" {
+				t.Errorf("unexpected body %q", body)
+			}
+			serveRoute(t, sm, fmt.Sprintf("demo.test%d.echo.send", i), "")
+		}
+	}()
+	wg.Wait()
+	if _, body := serveRoute(t, sm, "demo.test49.echo.send", ""); body != "demo.test49.*" {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
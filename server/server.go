@@ -4,16 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	gonet "net"
+	"os"
+	"os/signal"
+	"reflect"
 	"runtime"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/erpc-go/erpc/compress"
 	"github.com/erpc-go/erpc/protocol"
 	"github.com/erpc-go/erpc/server/net"
-	"github.com/erpc-go/erpc/utils"
-	"github.com/erpc-go/jce-codec"
+	"github.com/erpc-go/erpc/utils/bufpool"
 	"github.com/erpc-go/log"
-	limit "github.com/erpc-go/ratelimit"
 )
 
 const (
@@ -21,44 +25,65 @@ const (
 )
 
 type mutexEntry struct {
-	h       Handler
-	pattern string
-	token   string
-	reqType jce.Messager
-	rspType jce.Messager
+	h           Handler
+	pattern     string
+	token       string
+	newReq      func() any
+	newRsp      func() any
+	middlewares []Middleware // 命令字级中间件
+	chain       Handler      // 组装中间件后的处理函数，见 rebuild
+	opts        GroupOptions // 所在组的配置
+}
+
+// newMessage 根据注册的消息类型为每个请求创建新的实例
+// 指针类型(包括类型化的 nil 指针)每次创建新的零值，并发请求之间不共享；其他类型直接使用注册的值
+func newMessage(v any) func() any {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Pointer {
+		return func() any { return v }
+	}
+	elem := t.Elem()
+	return func() any { return reflect.New(elem).Interface() }
 }
 
 // ServerMutex 带读写锁的server入口配置
 type ServeMutex struct {
-	mutex      sync.RWMutex
-	mapEntries map[string]mutexEntry
-
-	Addr                  string        // 网卡:端口/协议，0.0.0.0对应的网卡是all, 如 eth1:10100/udp
-	Name                  string        `default:"going-svr"` // 服务名字
-	User                  string        `default:"going"`     // 服务负责人
-	MsgTimeout            time.Duration `default:"800ms"`     // 当前请求全局超时时间，默认800ms
-	IdleTimeout           time.Duration `default:"3m"`        // tcp server长链接最大空闲时间，默认3min
-	EnableGracefulRestart bool          `default:"true"`      // 是否支持热重启
-	MaxWorkerCount        int           `default:"10000"`     // 协程池最大协程数，并发请求数，用于过载保护
-	Ratelimit             int64         // 限频，默认不开启
-	EnableDebugMode       bool          // 开启调试模式，打印更详细日志
-	MasterID              int           // 模调主调模块id
-	StartAttr             int           // 启动量监控属性id,通过 going attr config.toml自动生成
-	PanicAttr             int           // panic次数
-	EnterAttr             int           // 进入量
-	SuccAttr              int           // 成功量
-	FailAttr              int           // 失败量
-	LogicFailAttr         [][]int       // 逻辑失败属性，这里配置了就不会上报到FailAttr, [[errcode, attrid], [1, 2], [3, 4]]
-	CostAttr200           int           // 耗时小于200ms的请求量
-	CostAttr800           int           // 耗时200-800ms的请求量
-	CostAttr800p          int           // 耗时大于800ms的请求量
-	GoroutineCountAttr    int           // goroutine协程数 属性必须是时刻量
-	ThreadCountAttr       int           // thread线程数 属性必须是时刻量
-	AllocHeapAttr         int           // Alloc已分配且在使用中的内存字节数(单位:M) 属性必须是时刻量
-	NumGCAttr             int           // NumGC已经完成的GC循环次数(单位:千) 属性必须是时刻量
-	PauseTotalNsAttr      int           // PauseTotalNs自程序启动后的GC总暂停时间(单位:秒) 属性必须是时刻量
-	PauseNsAttr           int           // PauseNs最近256次GC的平均暂停时间(单位:纳秒) 属性必须是时刻量
-	LogicFailAttrMap      map[int]int   // 这里不允许配置，通过LogicFailAttr生成
+	mutex          sync.RWMutex
+	mapEntries     map[string]mutexEntry
+	routes         []route      // 带通配符的命令字，从具体到宽泛排序
+	middlewares    []Middleware // 全局中间件，见 Use
+	groups         []*Group
+	notFound       Handler
+	notFoundChains map[string]Handler // 按组前缀组装的 notFound 处理链，见 rebuildNotFound
+
+	Addr                  string          // 网卡:端口/协议，0.0.0.0对应的网卡是all, 如 eth1:10100/udp
+	Name                  string          `default:"going-svr"` // 服务名字
+	User                  string          `default:"going"`     // 服务负责人
+	MsgTimeout            time.Duration   `default:"800ms"`     // 当前请求全局超时时间，默认800ms
+	IdleTimeout           time.Duration   `default:"3m"`        // tcp server长链接最大空闲时间，默认3min
+	EnableGracefulRestart bool            `default:"true"`      // 是否支持热重启
+	MaxWorkerCount        int             `default:"10000"`     // 协程池最大协程数，并发请求数，用于过载保护
+	MaxFrameSize          int             `default:"67108864"`  // 单个请求包最大长度，默认64M
+	Ratelimit             int64           // 每秒限频，为 0 时默认 999，小于 0 不限频
+	Compress              compress.Policy // 回包压缩策略，请求已压缩时沿用请求的压缩方式
+	EnableDebugMode       bool            // 开启调试模式，打印更详细日志
+	MasterID              int             // 模调主调模块id
+	StartAttr             int             // 启动量监控属性id,通过 going attr config.toml自动生成
+	PanicAttr             int             // panic次数
+	EnterAttr             int             // 进入量
+	SuccAttr              int             // 成功量
+	FailAttr              int             // 失败量
+	LogicFailAttr         [][]int         // 逻辑失败属性，这里配置了就不会上报到FailAttr, [[errcode, attrid], [1, 2], [3, 4]]
+	CostAttr200           int             // 耗时小于200ms的请求量
+	CostAttr800           int             // 耗时200-800ms的请求量
+	CostAttr800p          int             // 耗时大于800ms的请求量
+	GoroutineCountAttr    int             // goroutine协程数 属性必须是时刻量
+	ThreadCountAttr       int             // thread线程数 属性必须是时刻量
+	AllocHeapAttr         int             // Alloc已分配且在使用中的内存字节数(单位:M) 属性必须是时刻量
+	NumGCAttr             int             // NumGC已经完成的GC循环次数(单位:千) 属性必须是时刻量
+	PauseTotalNsAttr      int             // PauseTotalNs自程序启动后的GC总暂停时间(单位:秒) 属性必须是时刻量
+	PauseNsAttr           int             // PauseNs最近256次GC的平均暂停时间(单位:纳秒) 属性必须是时刻量
+	LogicFailAttrMap      map[int]int     // 这里不允许配置，通过LogicFailAttr生成
 
 	ListenIP   string // 通过解析addr生成
 	ListenPort uint16 // 通过解析addr生成
@@ -67,36 +92,32 @@ type ServeMutex struct {
 }
 
 // HandleFunc 自动转化成Handler即可
-func (sm *ServeMutex) HandleFunc(pattern, token string, handler HandlerFunc, reqType, rspType jce.Messager) {
-	sm.Handle(pattern, token, handler, reqType, rspType)
+func (sm *ServeMutex) HandleFunc(pattern, token string, handler HandlerFunc, reqType, rspType any, mw ...Middleware) {
+	sm.Handle(pattern, token, handler, reqType, rspType, mw...)
 }
 
 // Handle 注册相应的cmd pattern，token和处理函数到map中
-func (sm *ServeMutex) Handle(pattern, token string, handler Handler, reqType, rspType jce.Messager) {
+// pattern 可以包含通配符 "*"，请求时匹配，见 route；服务运行中也可以注册
+// reqType、rspType 只用于确定消息类型，每个请求创建新的实例，见 newMessage；mw 为只作用于该命令字的中间件
+func (sm *ServeMutex) Handle(pattern, token string, handler Handler, reqType, rspType any, mw ...Middleware) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
 	if handler == nil {
 		panic("invalid handler")
 	}
-
-	if sm.mapEntries == nil {
-		sm.mapEntries = make(map[string]mutexEntry)
-	}
-
-	// 命令字通配
-	pattern, err := utils.ReplacePattern(pattern, "mesh")
-	if err != nil {
+	if pattern == "" {
 		panic("invalid pattern")
 	}
 
-	sm.mapEntries[pattern] = mutexEntry{
-		h:       handler,
-		pattern: pattern,
-		token:   token,
-		reqType: reqType,
-		rspType: rspType,
-	}
+	sm.register(mutexEntry{
+		h:           handler,
+		pattern:     pattern,
+		token:       token,
+		newReq:      newMessage(reqType),
+		newRsp:      newMessage(rspType),
+		middlewares: mw,
+	})
 }
 
 // Alias 服务别名绑定，将src服务名对应的func依次绑定到dst对应的服务名上
@@ -104,28 +125,26 @@ func (sm *ServeMutex) Alias(src string, dst ...string) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
-	// 命令字通配
-	src, err := utils.ReplacePattern("")
-	if err != nil {
-		panic("invalid pattern")
-	}
-
-	if _, ok := sm.mapEntries[src]; !ok {
+	entry, ok := sm.mapEntries[src]
+	if !ok {
 		panic("pattern not find")
 	}
 
 	for _, v := range dst {
-		entry := mutexEntry{
-			h:       sm.mapEntries[src].h,
-			pattern: v,
-			token:   "",
-			reqType: sm.mapEntries[src].reqType,
-			rspType: sm.mapEntries[src].rspType,
+		if v == "" {
+			panic("invalid pattern")
 		}
-		sm.mapEntries[v] = entry
+		alias := entry
+		alias.pattern = v
+		alias.token = ""
+		sm.register(alias)
 	}
 }
 
+// ErrNoResponse 业务设置不回包
+var ErrNoResponse = errors.New("no response")
+
+// Serve 实现 net.Handler，处理完整的请求包并返回回包
 func (sm *ServeMutex) Serve(baseCtx context.Context, reqBuf []byte) (b []byte, err error) {
 	// step1
 	defer func() {
@@ -138,35 +157,176 @@ func (sm *ServeMutex) Serve(baseCtx context.Context, reqBuf []byte) (b []byte, e
 
 	pt := protocol.GetProtocolType(reqBuf)
 	p := GetProtocolStruct(pt)
+	if p == nil {
+		log.Raw("protocol %s not support", pt.String())
+		return nil, fmt.Errorf("unsupported protocol:%s", pt.String())
+	}
+	defer PutProtocolStruct(pt, p)
 	if err := p.UnmarshalHeader(reqBuf); err != nil {
 		log.Raw("%s header Unmarshal failed, msg:%v", pt.String(), err)
 		return nil, err
 	}
 
+	// 短连接协议回包后关闭连接
+	if k, ok := p.(protocol.KeepAliver); ok && !k.KeepAlive() {
+		net.CloseAfterWrite(baseCtx)
+	}
+
+	// 一个请求包包含多个调用时由协议拆分
+	if b, ok := p.(protocol.Batcher); ok {
+		return sm.serveBatch(baseCtx, b)
+	}
+
+	rsp, err := sm.dispatch(baseCtx, p, reqBuf)
+	if err != nil {
+		return nil, err
+	}
+	return packResponse(baseCtx, p, rsp)
+}
+
+// serveBatch 并发分发请求包中的各个调用并合并回包
+func (sm *ServeMutex) serveBatch(baseCtx context.Context, b protocol.Batcher) ([]byte, error) {
+	calls := b.Calls()
+	rsps := make([][]byte, len(calls))
+	serve := func(i int, call protocol.Protocol) {
+		bodyBuf, err := sm.Dispatch(baseCtx, call)
+		if errors.Is(err, ErrNoResponse) {
+			return
+		}
+		if err != nil {
+			call.SetResultCode(protocol.StatusError)
+			call.SetResultMsg(err.Error())
+			bodyBuf = nil
+		}
+		if rsps[i], err = pack(call, bodyBuf); err != nil {
+			log.Raw("batch call %s pack failed, msg:%v", call.GetCmdPattern(), err)
+		}
+	}
+
+	if len(calls) == 1 {
+		serve(0, calls[0])
+	} else {
+		var wg sync.WaitGroup
+		for i, call := range calls {
+			wg.Add(1)
+			go func(i int, call protocol.Protocol) {
+				defer wg.Done()
+				serve(i, call)
+			}(i, call)
+		}
+		wg.Wait()
+	}
+
+	pkgBuf, err := b.MarshalBatch(rsps)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgBuf) == 0 {
+		return nil, ErrNoResponse
+	}
+	return pkgBuf, nil
+}
+
+// Dispatch 实现 protocol.Dispatcher，供连接级协议在解析出请求后回调
+func (sm *ServeMutex) Dispatch(baseCtx context.Context, p protocol.Protocol) (b []byte, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			dataBuf := make([]byte, stackSize)
+			dataBuf = dataBuf[:runtime.Stack(dataBuf, false)]
+			log.Panic("%v\n>> %s", e, dataBuf)
+			p.SetResultCode(protocol.StatusError)
+			p.SetResultMsg(fmt.Sprintf("panic:%v", e))
+			b, err = nil, nil
+		}
+	}()
+	// 接管的连接上计入处理中的请求，服务关闭时等待
+	defer net.BeginRequest(baseCtx)()
+	rsp, err := sm.dispatch(baseCtx, p, nil)
+	if err != nil {
+		return nil, err
+	}
+	return marshalBody(p, rsp)
+}
+
+// InOrder 实现 net.Sequencer，HTTP/1.x 等实现 protocol.KeepAliver 的协议不支持乱序回包，按请求顺序处理
+func (sm *ServeMutex) InOrder(req []byte) bool {
+	pt := protocol.GetProtocolType(req)
+	p := GetProtocolStruct(pt)
+	if p == nil {
+		return false
+	}
+	defer PutProtocolStruct(pt, p)
+	_, ok := p.(protocol.KeepAliver)
+	return ok
+}
+
+// Hijack 实现 net.ConnHijacker，连接级协议探测命中后接管整个连接
+func (sm *ServeMutex) Hijack(prefix []byte) func(context.Context, gonet.Conn) {
+	t, res := protocol.Detect(prefix)
+	if res != protocol.DetectMatch {
+		return nil
+	}
+	serve := protocol.GetConnServer(t)
+	if serve == nil {
+		return nil
+	}
+	return func(ctx context.Context, conn gonet.Conn) {
+		ctx = protocol.WithDraining(ctx, net.Draining(ctx))
+		serve(protocol.WithMsgTimeout(ctx, net.MsgTimeout(ctx)), conn, sm)
+	}
+}
+
+// dispatch 路由并处理已解析首部的请求，返回待序列化的响应
+// 路由不存在、请求 body 解析失败时设置框架返回码并返回空响应
+func (sm *ServeMutex) dispatch(baseCtx context.Context, p protocol.Protocol, reqBuf []byte) (any, error) {
 	ctx := NewContext(baseCtx)
 
 	// 设置协议首部
 	ctx.Protocol = p
 
+	// 通知类请求不回包，包括出错时
+	if n, ok := p.(protocol.Notifier); ok && n.Notification() {
+		ctx.SetNoResponse()
+	}
+
 	// 映射handler
-	entry, ok := sm.mapEntries[p.GetCmdPattern()]
+	entry, ok := sm.lookup(p.GetCmdPattern())
 	if !ok {
 		log.Raw("cmd pattern[%s] not find the entry!", p.GetCmdPattern())
-		return nil, fmt.Errorf("invalid cmd patrern:%s", p.GetCmdPattern())
+		sm.serveNotFound(ctx, p.GetCmdPattern())
+		if ctx.NoResponse() {
+			return nil, ErrNoResponse
+		}
+		return ctx.Rsp, nil
 	}
 
-	// 应用协议解析
-	ctx.Req = entry.reqType
-	ctx.Rsp = entry.rspType
+	// 应用协议解析，每个请求使用新的消息实例
+	ctx.Req = entry.newReq()
+	ctx.Rsp = entry.newRsp()
+	ctx.reqBody, ctx.newReq, ctx.newRsp = reqBuf, entry.newReq, entry.newRsp
 
 	// body
 	if err := p.UnmarshalBody(reqBuf, ctx.Req); err != nil {
 		log.Raw("protocol body Decode buf failed, msg:%v", err)
-		return nil, err
+		p.SetResultCode(protocol.StatusBadRequest)
+		if errors.Is(err, protocol.ErrUnknownCodec) {
+			p.SetResultCode(protocol.StatusUnknownCodec)
+		}
+		if errors.Is(err, protocol.ErrUnknownCompress) {
+			p.SetResultCode(protocol.StatusUnknownCompress)
+			if c, ok := p.(protocol.Compressible); ok {
+				c.SetCompress(compress.None)
+			}
+		}
+		p.SetResultMsg(fmt.Sprintf("decode request body failed:%s", err))
+		if ctx.NoResponse() {
+			return nil, ErrNoResponse
+		}
+		return nil, nil
 	}
 
-	// 业务处理逻辑
-	entry.h.Process(ctx)
+	// 业务处理逻辑，包括中间件
+	entry.chain.Process(ctx)
 
 	// 处理耗时
 	ctx.Cost()
@@ -176,15 +336,128 @@ func (sm *ServeMutex) Serve(baseCtx context.Context, reqBuf []byte) (b []byte, e
 
 	// 不回包
 	if ctx.NoResponse() {
-		return nil, errors.New("no response")
+		return nil, ErrNoResponse
+	}
+
+	// 回包使用请求的编码方式，压缩方式协商见 negotiateCompress
+	policy := sm.Compress
+	if entry.opts.Compress != nil {
+		policy = *entry.opts.Compress
+	}
+	negotiateCompress(p, policy)
+	return ctx.Rsp, nil
+}
+
+// marshalBody 序列化响应 body，失败时以空 body 回包，见 encodeFailed
+func marshalBody(p protocol.Protocol, rsp any) ([]byte, error) {
+	bodyBuf, err := p.MarshalBody(rsp)
+	if encodeFailed(p, err) {
+		return p.MarshalBody(nil)
+	}
+	return bodyBuf, nil
+}
+
+// encodeFailed 响应 body 编码失败时设置框架返回码，以空 body 回包
+// 编码方式、压缩方式不支持时为对应的返回码，其余错误为 StatusError
+func encodeFailed(p protocol.Protocol, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, protocol.ErrUnknownCodec):
+		p.SetResultCode(protocol.StatusUnknownCodec)
+		p.SetResultMsg(fmt.Sprintf("encode response body failed:%s", err))
+	case errors.Is(err, protocol.ErrUnknownCompress):
+		p.SetResultCode(protocol.StatusUnknownCompress)
+		p.SetResultMsg(fmt.Sprintf("compress response body failed:%s", err))
+		if c, ok := p.(protocol.Compressible); ok {
+			c.SetCompress(compress.None)
+		}
+	default:
+		log.Raw("protocol body Encode buf failed, msg:%v", err)
+		p.SetResultCode(protocol.StatusError)
+		p.SetResultMsg(fmt.Sprintf("encode response body failed:%s", err))
 	}
+	return true
+}
 
-	// 打包
-	bodyBuf, err := p.MarshalBody(ctx.Rsp)
+// negotiateCompress 协商回包压缩方式
+// 请求已压缩时沿用请求的压缩方式，否则按服务或命令字组配置的压缩方式，对端不接受时改用对端声明可接受的压缩方式
+func negotiateCompress(p protocol.Protocol, policy compress.Policy) {
+	c, ok := p.(protocol.Compressible)
+	if !ok {
+		return
+	}
+	c.SetCompressThreshold(policy.Threshold)
+	if c.GetCompress() == compress.None && policy.Type != compress.None {
+		c.SetCompress(chooseCompress(policy.Type, c.GetAcceptCompress()))
+	}
+	negotiateDict(p, c.GetCompress())
+}
+
+// chooseCompress 对端接受 t 时使用 t，否则使用对端可接受的任一已注册压缩方式
+func chooseCompress(t compress.CompressType, accept []compress.CompressType) compress.CompressType {
+	for _, a := range accept {
+		if a == t {
+			return t
+		}
+	}
+	for _, a := range accept {
+		if _, ok := compress.GetCompressor(a); ok && a != compress.None {
+			return a
+		}
+	}
+	return compress.None
+}
+
+// negotiateDict 协商回包使用的预置字典
+// 只使用请求方已有的字典，否则不使用字典；同时在回包中声明本端服务的字典，请求方据此在后续请求中使用
+func negotiateDict(p protocol.Protocol, t compress.CompressType) {
+	d, ok := p.(protocol.DictCompressible)
+	if !ok {
+		return
+	}
+	service := p.GetServiceName()
+	if t == compress.ZlibDict {
+		d.SetCompressDict(compress.SelectDictionary(service, d.GetAcceptDict()))
+	}
+	if own, ok := compress.ServiceDictionary(service); ok {
+		d.SetAcceptDict(own.ID)
+	} else {
+		d.SetAcceptDict()
+	}
+}
+
+// defaultPackSize 回包缓冲区初始大小，超出时由 append 扩容
+const defaultPackSize = 4 << 10
+
+// packResponse 序列化并打包回包
+// 协议实现 protocol.Appender 时首部及 body 直接编码到 bufpool 缓冲区，由 server/net 写完后归还
+func packResponse(ctx context.Context, p protocol.Protocol, rsp any) ([]byte, error) {
+	a, ok := p.(protocol.Appender)
+	if !ok {
+		bodyBuf, err := marshalBody(p, rsp)
+		if err != nil {
+			return nil, err
+		}
+		return pack(p, bodyBuf)
+	}
+
+	buf := bufpool.Get(defaultPackSize)
+	pkgBuf, err := a.AppendPackage(buf, rsp)
+	if encodeFailed(p, err) {
+		pkgBuf, err = a.AppendPackage(buf, nil)
+	}
 	if err != nil {
-		log.Raw("protocol body Decode buf failed, msg:%v", err)
+		bufpool.Put(buf)
+		log.Raw("protocol package marshal buf failed, msg:%v", err)
 		return nil, err
 	}
+	net.ReleaseAfterWrite(ctx)
+	return pkgBuf, nil
+}
+
+// pack 打包回包
+func pack(p protocol.Protocol, bodyBuf []byte) ([]byte, error) {
 	p.SetBodyLen(uint32(len(bodyBuf)))
 	headBuf, err := p.MarshalHeader()
 	if err != nil {
@@ -197,21 +470,18 @@ func (sm *ServeMutex) Serve(baseCtx context.Context, reqBuf []byte) (b []byte, e
 	return pkgBuf, nil
 }
 
-func (sm *ServeMutex) Listen() {
+// Listen 按 Addr 的配置监听并处理请求，收到 SIGTERM、SIGINT 后关闭服务并返回
+// 开启 EnableGracefulRestart 时收到 SIGUSR2 热重启，子进程就绪后关闭服务并返回，子进程失败时继续服务
+// 需要控制启动和关闭时使用 Server
+func (sm *ServeMutex) Listen() error {
 	// 初始化
 	log.Raw("==>-----------------erpc start at %s-----------------\n==>\n", time.Now())
 
-	// 速率限制，按请求个数
-	var limiter limit.Limiter
-	limiter = limit.New(999)
-
 	// 解析环境变量,获取父进程已注册服务列表
 	parentServices := ParseServiceFromEnv()
 	log.Raw("parent' services:%+v\n", parentServices)
 	// 当前进程待写入环境变量的服务列表
 	var registeredServices []*Service
-	// 进程停止信号
-	stop := make(chan struct{})
 
 	// 遍历父进程已注册服务列表
 	// 若子进程无此服务/前进程更换了端口, 则进行解注册
@@ -247,9 +517,6 @@ func (sm *ServeMutex) Listen() {
 	}
 	log.Raw("[service register]Need Register Service Size:%d\n", len(mapEntries))
 
-	// 子进程需进行服务注册的channel
-	chanNeedRegister := make(chan *Service, len(mapEntries)+len(registeredServices))
-
 	// 服务注册异步调用
 	go func() {
 		// 延迟启动时间支持可配,默认5s
@@ -261,25 +528,55 @@ func (sm *ServeMutex) Listen() {
 		// serviceRegister(stop, registeredServices, mapEntries, chanNeedRegister)
 	}()
 
-	// 监听信号
-	go handleSignal(chanNeedRegister, stop)
-
 	log.Raw("[handlers]%+v\n", sm.mapEntries)
 
 	// 端口监听
-	net.Init(sm.MsgTimeout, sm.IdleTimeout, sm.EnableDebugMode, 0, 0, false)
+	var endpoints []Endpoint
 	switch sm.ListenNet {
-	case "tcp":
-		net.ListenAndServeTCP(sm.Address, net.CheckerFunc(Check), sm, limiter)
-	case "udp":
-		net.ListenAndServeUDP(sm.Address, net.CheckerFunc(Check), sm, limiter)
+	case "tcp", "udp":
+		endpoints = []Endpoint{{Network: sm.ListenNet, Address: sm.Address}}
 	case "all":
-		net.ListenAndServe(sm.Address, net.CheckerFunc(Check), sm, limiter)
+		endpoints = []Endpoint{{Network: "tcp", Address: sm.Address}, {Network: "udp", Address: sm.Address}}
 	default:
-		panic("invalid listening network config!")
+		return fmt.Errorf("invalid listening network config:%q", sm.ListenNet)
+	}
+	srv := NewServer(sm, endpoints...)
+	if err := srv.Start(context.Background()); err != nil {
+		return err
+	}
+
+	// 热重启的子进程在所有地址监听后通知父进程退出
+	if err := net.Ready(); err != nil {
+		log.Raw("notify parent process failed: %v", err)
+	}
+
+	chanSignal := make(chan os.Signal, 1)
+	signals := []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+	if sm.EnableGracefulRestart {
+		signals = append(signals, syscall.SIGUSR2)
 	}
+	signal.Notify(chanSignal, signals...)
+	defer signal.Stop(chanSignal)
+	for sig := range chanSignal {
+		if sig == syscall.SIGUSR2 {
+			pid, err := net.Restart()
+			if err != nil {
+				log.Raw("graceful restart failed: %v, continue serving", err)
+				continue
+			}
+			log.Raw("new process %d ready", pid)
+		}
+		log.Raw("receive %v signal, shutdown server", sig)
+		break
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
 }
 
+// shutdownTimeout Listen 收到退出信号后等待处理中请求的最长时间
+const shutdownTimeout = 10 * time.Second
+
 func isValidPattern(p string) (b bool) {
 	return true
 }
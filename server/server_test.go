@@ -0,0 +1,758 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/erpc-go/erpc/client"
+	"github.com/erpc-go/erpc/compress"
+	"github.com/erpc-go/erpc/protocol"
+	erpc "github.com/erpc-go/erpc/protocol/erpc"
+	"github.com/erpc-go/erpc/utils/bufpool"
+)
+
+// echoMessage 测试用 body，直接读写原始字节
+type echoMessage struct {
+	data []byte
+}
+
+func (m *echoMessage) ReadFrom(r io.Reader) (int64, error) {
+	b, err := io.ReadAll(r)
+	m.data = b
+	return int64(len(b)), err
+}
+
+func (m *echoMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(m.data)
+	return int64(n), err
+}
+
+func handleEcho(c *Context) {
+	req := c.Req.(*echoMessage)
+	rsp := c.Rsp.(*echoMessage)
+	rsp.data = append([]byte("echo:"), req.data...)
+	c.SetResult(1)
+	c.SetResultMsg("done")
+}
+
+func newEchoRequest(t *testing.T, data string) (*erpc.Package, []byte) {
+	req := erpc.NewRequest("demo.test.echo.send")
+	body, err := req.MarshalBody(&echoMessage{data: []byte(data)})
+	if err != nil {
+		t.Fatalf("marshal body failed: %v", err)
+	}
+	req.SetBodyLen(uint32(len(body)))
+	head, err := req.MarshalHeader()
+	if err != nil {
+		t.Fatalf("marshal header failed: %v", err)
+	}
+	return req, append(head, body...)
+}
+
+func TestCheck(t *testing.T) {
+	_, pkg := newEchoRequest(t, "hi")
+	sticky := append(append([]byte{}, pkg...), pkg[:5]...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		max     int
+		want    int
+		wantErr error
+	}{
+		{"empty", nil, 0, 0, nil},
+		{"partial", pkg[:len(pkg)-1], 0, 0, nil},
+		{"complete", pkg, 0, len(pkg), nil},
+		{"sticky", sticky, 0, len(pkg), nil},
+		{"garbage", []byte("\x00\x01\x02"), 0, 0, ErrUnknownProtocol},
+		{"too large", pkg, len(pkg) - 1, 0, ErrFrameTooLarge},
+		{"partial too large", pkg[:len(pkg)-1], len(pkg) - 2, 0, ErrFrameTooLarge},
+	}
+	for _, tt := range tests {
+		n, err := NewChecker(tt.max).Check(tt.data)
+		if n != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Check = %d, %v, want %d, %v", tt.name, n, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestServeErpc(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", handleEcho, &echoMessage{}, &echoMessage{})
+
+	req, reqBuf := newEchoRequest(t, "hi")
+
+	if n, err := Check(reqBuf); err != nil || n != len(reqBuf) {
+		t.Fatalf("check failed, n:%d, err:%v", n, err)
+	}
+
+	rspBuf, err := sm.Serve(context.Background(), reqBuf)
+	if err != nil {
+		t.Fatalf("serve failed: %v", err)
+	}
+	rsp := erpc.NewPackage()
+	if err := rsp.UnmarshalHeader(rspBuf); err != nil {
+		t.Fatalf("unmarshal rsp header failed: %v", err)
+	}
+	got := &echoMessage{}
+	if err := rsp.UnmarshalBody(rspBuf, got); err != nil {
+		t.Fatalf("unmarshal rsp body failed: %v", err)
+	}
+	if string(got.data) != "echo:hi" || rsp.GetResultCode() != 1 || rsp.GetResultMsg() != "done" ||
+		rsp.GetSequence() != req.GetSequence() || rsp.GetMessageType() != erpc.MessageTypeResponse {
+		t.Fatalf("unexpected response, body:%q, head:%+v", got.data, rsp)
+	}
+}
+
+// plainMessage 普通结构体 body，不实现 jce.Messager
+type plainMessage struct {
+	Msg string `json:"msg"`
+}
+
+// TestServeConcurrent 每个请求使用新的消息实例，并发请求之间互不影响
+func TestServeConcurrent(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", handleEcho, (*echoMessage)(nil), (*echoMessage)(nil))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := fmt.Sprintf("hello-%d", i)
+			_, reqBuf := newEchoRequest(t, data)
+			rspBuf, err := sm.Serve(context.Background(), reqBuf)
+			if err != nil {
+				t.Errorf("serve failed: %v", err)
+				return
+			}
+			rsp := erpc.NewPackage()
+			got := &echoMessage{}
+			if err := rsp.UnmarshalHeader(rspBuf); err != nil {
+				t.Errorf("unmarshal rsp header failed: %v", err)
+				return
+			}
+			if err := rsp.UnmarshalBody(rspBuf, got); err != nil || string(got.data) != "echo:"+data {
+				t.Errorf("unexpected rsp body %q, err:%v", got.data, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestHandleTyped(t *testing.T) {
+	sm := &ServeMutex{}
+	HandleTyped(sm, "demo.test.echo.send", func(c *Context, req *echoMessage, rsp *echoMessage) error {
+		switch string(req.data) {
+		case "fail":
+			return Errorf(403, "forbidden")
+		case "error":
+			return errors.New("internal")
+		}
+		rsp.data = append([]byte("echo:"), req.data...)
+		return nil
+	})
+
+	tests := []struct {
+		data string
+		code int32
+		msg  string
+		body string
+	}{
+		{"hello", 0, "", "echo:hello"},
+		{"fail", 403, "forbidden", ""},
+		{"error", protocol.StatusError, "internal", ""},
+	}
+	for _, tt := range tests {
+		_, reqBuf := newEchoRequest(t, tt.data)
+		rspBuf, err := sm.Serve(context.Background(), reqBuf)
+		if err != nil {
+			t.Fatalf("serve failed: %v", err)
+		}
+		rsp := erpc.NewPackage()
+		got := &echoMessage{}
+		if err := rsp.UnmarshalHeader(rspBuf); err != nil {
+			t.Fatalf("unmarshal rsp header failed: %v", err)
+		}
+		if err := rsp.UnmarshalBody(rspBuf, got); err != nil {
+			t.Fatalf("unmarshal rsp body failed: %v", err)
+		}
+		if rsp.GetResultCode() != tt.code || rsp.GetResultMsg() != tt.msg || string(got.data) != tt.body {
+			t.Errorf("%s: got code:%d, msg:%s, body:%q", tt.data, rsp.GetResultCode(), rsp.GetResultMsg(), got.data)
+		}
+	}
+}
+
+func TestServeCodec(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		c.Rsp.(*plainMessage).Msg = "echo:" + c.Req.(*plainMessage).Msg
+	}, &plainMessage{}, &plainMessage{})
+
+	serve := func(codec uint8) (*erpc.Package, []byte) {
+		req := erpc.NewRequest("demo.test.echo.send")
+		req.SetProtoType(erpc.CodecJson)
+		body, err := req.MarshalBody(&plainMessage{Msg: "hi"})
+		if err != nil {
+			t.Fatalf("marshal body failed: %v", err)
+		}
+		req.SetProtoType(codec)
+		req.SetBodyLen(uint32(len(body)))
+		head, _ := req.MarshalHeader()
+		rspBuf, err := sm.Serve(context.Background(), append(head, body...))
+		if err != nil {
+			t.Fatalf("serve failed: %v", err)
+		}
+		rsp := erpc.NewPackage()
+		if err := rsp.UnmarshalHeader(rspBuf); err != nil {
+			t.Fatalf("unmarshal rsp header failed: %v", err)
+		}
+		return rsp, rspBuf
+	}
+
+	// 按请求的编码方式回包
+	rsp, rspBuf := serve(erpc.CodecJson)
+	got := &plainMessage{}
+	if err := rsp.UnmarshalBody(rspBuf, got); err != nil {
+		t.Fatalf("unmarshal rsp body failed: %v", err)
+	}
+	if rsp.GetProtoType() != erpc.CodecJson || rsp.GetResultCode() != 0 || got.Msg != "echo:hi" {
+		t.Fatalf("unexpected response, codec:%d, code:%d, body:%+v", rsp.GetProtoType(), rsp.GetResultCode(), got)
+	}
+
+	if rsp, _ := serve(200); rsp.GetResultCode() != protocol.StatusUnknownCodec || rsp.GetBodyLen() != 0 {
+		t.Fatalf("unexpected response, code:%d, msg:%s", rsp.GetResultCode(), rsp.GetResultMsg())
+	}
+}
+
+func TestServeCompress(t *testing.T) {
+	sm := &ServeMutex{Compress: compress.Policy{Type: compress.Zlib, Threshold: 64}}
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		c.Rsp.(*echoMessage).data = c.Req.(*echoMessage).data
+	}, &echoMessage{}, &echoMessage{})
+
+	data := []byte(strings.Repeat("hello", 100))
+	tests := []struct {
+		name     string
+		compress compress.CompressType
+		accept   []compress.CompressType
+		data     []byte
+		want     compress.CompressType
+	}{
+		{"follow request", compress.Gzip, nil, data, compress.Gzip},
+		{"server policy", compress.None, []compress.CompressType{compress.Gzip, compress.Zlib}, data, compress.Zlib},
+		{"advertised", compress.None, []compress.CompressType{compress.Gzip}, data, compress.Gzip},
+		{"not accepted", compress.None, nil, data, compress.None},
+		{"below threshold", compress.Gzip, nil, data[:10], compress.None},
+	}
+	for _, tt := range tests {
+		req := erpc.NewRequest("demo.test.echo.send")
+		req.SetCompress(tt.compress)
+		req.SetAcceptCompress(tt.accept...)
+		body, _ := req.MarshalBody(&echoMessage{data: tt.data})
+		req.SetBodyLen(uint32(len(body)))
+		head, _ := req.MarshalHeader()
+
+		rspBuf, err := sm.Serve(context.Background(), append(head, body...))
+		if err != nil {
+			t.Fatalf("%s: serve failed: %v", tt.name, err)
+		}
+		rsp := erpc.NewPackage()
+		got := &echoMessage{}
+		if err := rsp.UnmarshalHeader(rspBuf); err != nil {
+			t.Fatalf("%s: unmarshal rsp header failed: %v", tt.name, err)
+		}
+		if err := rsp.UnmarshalBody(rspBuf, got); err != nil || string(got.data) != string(tt.data) {
+			t.Fatalf("%s: unmarshal rsp body failed: %v", tt.name, err)
+		}
+		if rsp.GetCompress() != tt.want {
+			t.Errorf("%s: rsp compress = %d, want %d", tt.name, rsp.GetCompress(), tt.want)
+		}
+	}
+
+	// 压缩方式不支持
+	req := erpc.NewRequest("demo.test.echo.send")
+	body, _ := req.MarshalBody(&echoMessage{data: data})
+	req.SetCompress(200)
+	req.SetBodyLen(uint32(len(body)))
+	head, _ := req.MarshalHeader()
+	rspBuf, _ := sm.Serve(context.Background(), append(head, body...))
+	rsp := erpc.NewPackage()
+	if err := rsp.UnmarshalHeader(rspBuf); err != nil || rsp.GetResultCode() != protocol.StatusUnknownCompress ||
+		rsp.GetCompress() != compress.None {
+		t.Fatalf("unexpected response, code:%d, compress:%d, err:%v", rsp.GetResultCode(), rsp.GetCompress(), err)
+	}
+}
+
+func TestServeCompressDict(t *testing.T) {
+	sm := &ServeMutex{Compress: compress.Policy{Type: compress.ZlibDict}}
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		c.Rsp.(*echoMessage).data = c.Req.(*echoMessage).data
+	}, &echoMessage{}, &echoMessage{})
+
+	data := []byte(`{"service":"demo.test.echo.send","status":"STATUS_OK","region":"ap-guangzhou"}`)
+	d := compress.NewDictionary(data)
+	compress.RegisterDictionary("demo.test.echo", d)
+	defer compress.UnRegisterDictionary(d.ID)
+
+	serve := func(accept ...uint32) *erpc.Package {
+		req := erpc.NewRequest("demo.test.echo.send")
+		req.SetServiceName("demo.test.echo")
+		req.SetAcceptCompress(compress.ZlibDict)
+		req.SetAcceptDict(accept...)
+		body, _ := req.MarshalBody(&echoMessage{data: data})
+		req.SetBodyLen(uint32(len(body)))
+		head, _ := req.MarshalHeader()
+		rspBuf, err := sm.Serve(context.Background(), append(head, body...))
+		if err != nil {
+			t.Fatalf("serve failed: %v", err)
+		}
+		rsp := erpc.NewPackage()
+		got := &echoMessage{}
+		if err := rsp.UnmarshalHeader(rspBuf); err != nil {
+			t.Fatalf("unmarshal rsp header failed: %v", err)
+		}
+		if err := rsp.UnmarshalBody(rspBuf, got); err != nil || string(got.data) != string(data) {
+			t.Fatalf("unmarshal rsp body failed: %v", err)
+		}
+		if rsp.GetCompress() != compress.ZlibDict {
+			t.Fatalf("rsp compress = %d, want %d", rsp.GetCompress(), compress.ZlibDict)
+		}
+		if accept := rsp.GetAcceptDict(); len(accept) != 1 || accept[0] != d.ID {
+			t.Fatalf("server should advertise its dictionary, got %v", accept)
+		}
+		return rsp
+	}
+	withDict, withoutDict := serve(d.ID), serve()
+	if withDict.GetBodyLen() >= withoutDict.GetBodyLen() {
+		t.Fatalf("dictionary not used, len:%d, without dict:%d", withDict.GetBodyLen(), withoutDict.GetBodyLen())
+	}
+
+	// 请求使用了服务端没有的字典
+	other := compress.NewDictionary([]byte(`"status":"STATUS_OK"`))
+	req := erpc.NewRequest("demo.test.echo.send")
+	req.SetCompress(compress.ZlibDict)
+	body, _ := (&compress.DictCompressor{}).PackDict(data, other)
+	req.SetBodyLen(uint32(len(body)))
+	head, _ := req.MarshalHeader()
+	rspBuf, _ := sm.Serve(context.Background(), append(head, body...))
+	rsp := erpc.NewPackage()
+	if err := rsp.UnmarshalHeader(rspBuf); err != nil || rsp.GetResultCode() != protocol.StatusUnknownCompress {
+		t.Fatalf("unexpected response, code:%d, err:%v", rsp.GetResultCode(), err)
+	}
+}
+
+// startTCPServer 在随机端口启动 tcp 服务，测试结束时关闭
+func startTCPServer(t *testing.T, sm *ServeMutex) string {
+	sm.MsgTimeout = time.Second
+	return startServer(t, sm, Endpoint{Network: "tcp", Address: "127.0.0.1:0"}).Addrs()[0].String()
+}
+
+func TestServeErpcOverTCP(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", handleEcho, &echoMessage{}, &echoMessage{})
+	addr := startTCPServer(t, sm)
+
+	desc := client.CallDesc{
+		LocalServiceName: "demo.test.client.send",
+		ServiceName:      "demo.test.echo.send",
+		Address:          "ip://" + addr,
+		Timeout:          time.Second,
+	}
+	rsp := &echoMessage{}
+	c, _ := client.New(desc, protocol.AuthInfo{}, &echoMessage{data: []byte("hi")}, rsp)
+	if err := c.Do(context.Background()); err != nil && c.GetCommuErrCode() != 0 {
+		t.Fatalf("call failed: %v", err)
+	}
+	if string(rsp.data) != "echo:hi" {
+		t.Fatalf("unexpected response %q", rsp.data)
+	}
+
+	// 路由不存在时回包返回码
+	desc.ServiceName = "demo.test.echo.none"
+	c, _ = client.New(desc, protocol.AuthInfo{}, &echoMessage{data: []byte("hi")}, &echoMessage{})
+	c.Do(context.Background())
+	if c.GetCommuErrCode() != 0 || c.GetServiceErrCode() != protocol.StatusNotFound {
+		t.Fatalf("unexpected error code, commu:%d, service:%d", c.GetCommuErrCode(), c.GetServiceErrCode())
+	}
+}
+
+// TestServeAutoCodecOverTCP client 未指定编码方式时按 body 类型选择，server 按请求的编码方式回包
+func TestServeAutoCodecOverTCP(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.plain.send", "", func(c *Context) {
+		c.Rsp.(*plainMessage).Msg = "echo:" + c.Req.(*plainMessage).Msg
+	}, &plainMessage{}, &plainMessage{})
+	sm.HandleFunc("demo.test.pb.send", "", func(c *Context) {
+		c.Rsp.(*pbMessage).Msg = "echo:" + c.Req.(*pbMessage).Msg
+	}, &pbMessage{}, &pbMessage{})
+	addr := startTCPServer(t, sm)
+
+	desc := client.CallDesc{
+		LocalServiceName: "demo.test.client.send",
+		ServiceName:      "demo.test.plain.send",
+		Address:          "ip://" + addr,
+		Timeout:          time.Second,
+	}
+	plain := &plainMessage{}
+	c, _ := client.New(desc, protocol.AuthInfo{}, &plainMessage{Msg: "hi"}, plain)
+	if err := c.Do(context.Background()); err != nil || plain.Msg != "echo:hi" {
+		t.Fatalf("json call failed, err:%v, code:%d, rsp:%+v", err, c.GetServiceErrCode(), plain)
+	}
+
+	// pbMessage 同时实现 jce.Messager，优先使用 pb
+	desc.ServiceName = "demo.test.pb.send"
+	pb := &pbMessage{}
+	c, _ = client.New(desc, protocol.AuthInfo{}, &pbMessage{Msg: "hi"}, pb)
+	if err := c.Do(context.Background()); err != nil || pb.Msg != "echo:hi" {
+		t.Fatalf("pb call failed, err:%v, code:%d, rsp:%+v", err, c.GetServiceErrCode(), pb)
+	}
+}
+
+func TestServePipelinedOverTCP(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", handleEcho, &echoMessage{}, &echoMessage{})
+	addr := startTCPServer(t, sm)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// erpc 回包按请求序号匹配，同一连接上的请求并发处理，允许乱序回包，HTTP 按序回包见 TestServeHTTPPipelined
+	// 两个完整包加半个包一次写入，剩余半个包稍后写入
+	_, p1 := newEchoRequest(t, "a")
+	_, p2 := newEchoRequest(t, "b")
+	_, p3 := newEchoRequest(t, "c")
+	first := append(append(append([]byte{}, p1...), p2...), p3[:7]...)
+	if _, err := conn.Write(first); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := conn.Write(p3[7:]); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	got := map[string]bool{}
+	var buf []byte
+	tmp := make([]byte, 4096)
+	for len(got) < 3 {
+		n, err := conn.Read(tmp)
+		if err != nil {
+			t.Fatalf("read failed: %v, got:%v", err, got)
+		}
+		buf = append(buf, tmp[:n]...)
+		for {
+			l, err := erpc.Check(buf)
+			if err != nil {
+				t.Fatalf("check rsp failed: %v", err)
+			}
+			if l == 0 {
+				break
+			}
+			rsp := erpc.NewPackage()
+			body := &echoMessage{}
+			if err := rsp.UnmarshalHeader(buf[:l]); err != nil {
+				t.Fatalf("unmarshal rsp failed: %v", err)
+			}
+			if err := rsp.UnmarshalBody(buf[:l], body); err != nil {
+				t.Fatalf("unmarshal rsp failed: %v", err)
+			}
+			got[string(body.data)] = true
+			buf = buf[l:]
+		}
+	}
+	for _, want := range []string{"echo:a", "echo:b", "echo:c"} {
+		if !got[want] {
+			t.Fatalf("missing response %s, got:%v", want, got)
+		}
+	}
+}
+
+// jsonMessage 测试用 json body
+type jsonMessage struct {
+	Msg string `json:"msg"`
+}
+
+func (m *jsonMessage) ReadFrom(r io.Reader) (int64, error) {
+	b, err := io.ReadAll(r)
+	m.Msg = string(b)
+	return int64(len(b)), err
+}
+
+func (m *jsonMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, m.Msg)
+	return int64(n), err
+}
+
+// TestServeHTTPPipelined HTTP/1.1 pipelining 按请求顺序回包，Connection: close 在之前的回包发送后才关闭连接
+func TestServeHTTPPipelined(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		msg := c.Req.(*jsonMessage).Msg
+		if msg == "slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		c.Rsp.(*jsonMessage).Msg = "echo:" + msg
+	}, &jsonMessage{}, &jsonMessage{})
+	addr := startTCPServer(t, sm)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	request := func(msg, connection string) string {
+		body := fmt.Sprintf(`{"msg":%q}`, msg)
+		return fmt.Sprintf("POST /demo.test.echo.send HTTP/1.1\r\nHost: a\r\nContent-Type: application/json\r\n"+
+			"Content-Length: %d\r\nConnection: %s\r\n\r\n%s", len(body), connection, body)
+	}
+	// 慢请求在前，快请求在后，最后一个请求要求回包后关闭连接
+	pipelined := request("slow", "keep-alive") + request("fast", "keep-alive") + request("last", "close")
+	if _, err := conn.Write([]byte(pipelined)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"echo:slow", "echo:fast", "echo:last"} {
+		rsp, err := http.ReadResponse(r, nil)
+		if err != nil {
+			t.Fatalf("read %s failed: %v", want, err)
+		}
+		body, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if got := fmt.Sprintf(`{"msg":%q}`, want); rsp.StatusCode != http.StatusOK || string(body) != got {
+			t.Fatalf("response out of order: %d %s, want %s", rsp.StatusCode, body, got)
+		}
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Fatalf("connection should be closed after the last response, got %v", err)
+	}
+}
+
+func TestServeHTTPOverTCP(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		c.Rsp.(*jsonMessage).Msg = "echo:" + c.Req.(*jsonMessage).Msg
+	}, &jsonMessage{}, &jsonMessage{})
+	sm.HandleFunc("demo.test.echo.fail", "", func(c *Context) {
+		c.SetResult(403)
+		c.SetResultMsg("forbidden")
+	}, &jsonMessage{}, &jsonMessage{})
+	sm.HandleFunc("demo.test.echo.bad", "", func(c *Context) {}, &jsonMessage{}, &struct{ C chan int }{})
+	addr := startTCPServer(t, sm)
+
+	cli := &http.Client{Timeout: time.Second}
+	for i := 0; i < 2; i++ {
+		rsp, err := cli.Post("http://"+addr+"/demo.test.echo.send", "application/json", strings.NewReader(`{"msg":"hi"}`))
+		if err != nil {
+			t.Fatalf("post failed: %v", err)
+		}
+		body, _ := io.ReadAll(rsp.Body)
+		rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK || string(body) != `{"msg":"echo:hi"}` {
+			t.Fatalf("unexpected response: %d %s", rsp.StatusCode, body)
+		}
+	}
+
+	rsp, err := cli.Get("http://" + addr + "/demo.test.echo.fail")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusForbidden || rsp.Header.Get("Result-Msg") != "forbidden" {
+		t.Fatalf("unexpected response: %d %v", rsp.StatusCode, rsp.Header)
+	}
+
+	rsp, err = cli.Get("http://" + addr + "/demo.test.echo.none")
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unexpected status: %d", rsp.StatusCode)
+	}
+
+	// 回包编码失败时以框架返回码回包：Accept 的类型不支持回包类型为 415，其余为 500
+	for _, tt := range []struct {
+		path, accept string
+		status       int
+	}{
+		{"/demo.test.echo.send", "application/x-protobuf", http.StatusUnsupportedMediaType},
+		{"/demo.test.echo.send", "application/x-protobuf;q=0.5, application/json", http.StatusOK},
+		{"/demo.test.echo.bad", "application/json", http.StatusInternalServerError},
+	} {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr+tt.path, nil)
+		req.Header.Set("Accept", tt.accept)
+		rsp, err := cli.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tt.path, tt.accept, err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != tt.status {
+			t.Fatalf("%s %s: unexpected status %d", tt.path, tt.accept, rsp.StatusCode)
+		}
+	}
+
+	// 短连接回包后服务端关闭连接
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /demo.test.echo.send HTTP/1.0\r\n\r\n"))
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	raw, err := io.ReadAll(conn)
+	if err != nil || !strings.HasPrefix(string(raw), "HTTP/1.0 200 OK") {
+		t.Fatalf("unexpected raw response: %q, err:%v", raw, err)
+	}
+}
+
+// pbMessage 测试用 pb body
+type pbMessage struct {
+	Msg string `protobuf:"bytes,1,opt,name=msg,proto3" json:"msg,omitempty"`
+}
+
+func (m *pbMessage) Reset()         { *m = pbMessage{} }
+func (m *pbMessage) String() string { return m.Msg }
+func (*pbMessage) ProtoMessage()    {}
+
+func (m *pbMessage) ReadFrom(r io.Reader) (int64, error) {
+	b, err := io.ReadAll(r)
+	m.Msg = string(b)
+	return int64(len(b)), err
+}
+
+func (m *pbMessage) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, m.Msg)
+	return int64(n), err
+}
+
+func TestServeGrpcOverTCP(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		if _, ok := c.Deadline(); !ok {
+			c.SetResult(protocol.StatusBadRequest)
+			return
+		}
+		c.Rsp.(*pbMessage).Msg = "echo:" + c.Req.(*pbMessage).Msg
+	}, &pbMessage{}, &pbMessage{})
+	addr := startTCPServer(t, sm)
+
+	desc := client.CallDesc{
+		LocalServiceName: "demo.test.client.send",
+		ServiceName:      "demo.test.echo.send",
+		Protocol:         client.AppProtocolGrpc,
+		Address:          "ip://" + addr,
+		Timeout:          time.Second,
+	}
+	rsp := &pbMessage{}
+	c, _ := client.New(desc, protocol.AuthInfo{}, &pbMessage{Msg: "hi"}, rsp)
+	if err := c.Do(context.Background()); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if rsp.Msg != "echo:hi" {
+		t.Fatalf("unexpected response %q", rsp.Msg)
+	}
+
+	desc.ServiceName = "demo.test.echo.none"
+	c, _ = client.New(desc, protocol.AuthInfo{}, &pbMessage{Msg: "hi"}, &pbMessage{})
+	c.Do(context.Background())
+	if c.GetCommuErrCode() != 0 || c.GetServiceErrCode() != protocol.StatusNotFound {
+		t.Fatalf("unexpected error code, commu:%d, service:%d", c.GetCommuErrCode(), c.GetServiceErrCode())
+	}
+
+	// 同一端口上的 erpc 请求不受影响
+	desc.ServiceName = "demo.test.echo.send"
+	desc.Protocol = ""
+	c, _ = client.New(desc, protocol.AuthInfo{}, &pbMessage{Msg: "hi"}, &pbMessage{})
+	c.Do(context.Background())
+	if c.GetCommuErrCode() != 0 {
+		t.Fatalf("erpc call failed: %d", c.GetCommuErrCode())
+	}
+}
+
+func TestServeJSONRPCOverTCP(t *testing.T) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", func(c *Context) {
+		c.Rsp.(*jsonMessage).Msg = "echo:" + c.Req.(*jsonMessage).Msg
+	}, &jsonMessage{}, &jsonMessage{})
+	sm.HandleFunc("demo.test.echo.fail", "", func(c *Context) {
+		c.SetResult(403)
+		c.SetResultMsg("forbidden")
+	}, &jsonMessage{}, &jsonMessage{})
+	addr := startTCPServer(t, sm)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	// 通知不回包，之后的批量请求按请求顺序回包
+	conn.Write([]byte(`{"jsonrpc":"2.0","method":"demo.test.echo.fail"}` + "\n" +
+		`[{"jsonrpc":"2.0","method":"demo.test.echo.send","params":{"msg":"a"},"id":1},` +
+		`{"jsonrpc":"2.0","method":"demo.test.echo.fail","id":2},` +
+		`{"jsonrpc":"2.0","method":"demo.test.echo.none","id":3}]` + "\n"))
+	want := `[{"jsonrpc":"2.0","result":{"msg":"echo:a"},"id":1},` +
+		`{"jsonrpc":"2.0","error":{"code":403,"message":"forbidden"},"id":2},` +
+		`{"jsonrpc":"2.0","error":{"code":-32601,"message":"invalid cmd pattern:demo.test.echo.none","data":{"resultCode":1002}},"id":3}]` + "\n"
+	buf := make([]byte, 0, len(want))
+	for len(buf) < len(want) {
+		tmp := make([]byte, 1024)
+		n, err := conn.Read(tmp)
+		if err != nil {
+			t.Fatalf("read failed: %v, got %q", err, buf)
+		}
+		buf = append(buf, tmp[:n]...)
+	}
+	if string(buf) != want {
+		t.Fatalf("unexpected response:\n%s\nwant:\n%s", buf, want)
+	}
+
+	// HTTP 承载
+	rsp, err := http.Post("http://"+addr+"/jsonrpc", "application/json",
+		strings.NewReader(`{"jsonrpc":"2.0","method":"demo.test.echo.send","params":{"msg":"hi"},"id":"x"}`))
+	if err != nil {
+		t.Fatalf("post failed: %v", err)
+	}
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK || string(body) != `{"jsonrpc":"2.0","result":{"msg":"echo:hi"},"id":"x"}` {
+		t.Fatalf("unexpected response: %d %s", rsp.StatusCode, body)
+	}
+}
+
+// BenchmarkServe 单次 RPC 服务端的分配，不含网络收发
+func BenchmarkServe(b *testing.B) {
+	sm := &ServeMutex{}
+	sm.HandleFunc("demo.test.echo.send", "", handleEcho, &echoMessage{}, &echoMessage{})
+	req := erpc.NewRequest("demo.test.echo.send")
+	reqBuf, err := req.AppendPackage(nil, &echoMessage{data: []byte("hello")})
+	if err != nil {
+		b.Fatalf("marshal request failed: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rsp, err := sm.Serve(context.Background(), reqBuf)
+		if err != nil {
+			b.Fatalf("serve failed: %v", err)
+		}
+		bufpool.Put(rsp)
+	}
+}
@@ -0,0 +1,73 @@
+// Package bufpool 按容量分级的字节缓冲池，供 codec、protocol、server/net 共用
+package bufpool
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	minShift = 9  // 最小分级 512B
+	maxShift = 24 // 最大分级 16MB，更大的缓冲区不进入对象池
+)
+
+// 每一级缓存容量为 1<<(minShift+i) 的缓冲区
+// 对象池中存放 *[]byte，holders 复用切片头指针，避免 Put 时装箱分配
+var (
+	classes [maxShift - minShift + 1]sync.Pool
+	holders = sync.Pool{New: func() any { return new([]byte) }}
+)
+
+func init() {
+	for i := range classes {
+		size := 1 << (minShift + i)
+		classes[i].New = func() any {
+			b := make([]byte, 0, size)
+			return &b
+		}
+	}
+}
+
+// Get 获取长度为 0、容量不小于 size 的缓冲区，size 超过最大分级时直接分配
+func Get(size int) []byte {
+	i := classOf(size)
+	if i >= len(classes) {
+		return make([]byte, 0, size)
+	}
+	h := classes[i].Get().(*[]byte)
+	b := *h
+	*h = nil
+	holders.Put(h)
+	return b[:0]
+}
+
+// Put 归还缓冲区，归还后调用方不能再使用
+// 按容量向下归入分级，容量不在分级范围内的直接丢弃
+func Put(b []byte) {
+	c := cap(b)
+	if c < 1<<minShift || c > 1<<maxShift {
+		return
+	}
+	i := bits.Len(uint(c)) - 1 - minShift
+	h := holders.Get().(*[]byte)
+	*h = b[:0]
+	classes[i].Put(h)
+}
+
+// Grow 保证 b 至少还能追加 n 字节，扩容时从对象池获取新缓冲区并归还旧缓冲区
+func Grow(b []byte, n int) []byte {
+	if cap(b)-len(b) >= n {
+		return b
+	}
+	nb := append(Get(2*cap(b)+n), b...)
+	Put(b)
+	return nb
+}
+
+// classOf 容量不小于 size 的最小分级
+func classOf(size int) int {
+	if size <= 1<<minShift {
+		return 0
+	}
+	return bits.Len(uint(size-1)) - minShift
+}
@@ -0,0 +1,75 @@
+package bufpool
+
+import (
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	for _, tt := range []struct {
+		size, cap int
+	}{
+		{0, 512},
+		{1, 512},
+		{512, 512},
+		{513, 1024},
+		{64 << 10, 64 << 10},
+		{64<<10 + 1, 128 << 10},
+		{16 << 20, 16 << 20},
+		{16<<20 + 1, 16<<20 + 1},
+	} {
+		b := Get(tt.size)
+		if len(b) != 0 || cap(b) != tt.cap {
+			t.Errorf("Get(%d) len %d cap %d, want 0 %d", tt.size, len(b), cap(b), tt.cap)
+		}
+		Put(b)
+	}
+}
+
+func TestPutClass(t *testing.T) {
+	// 容量向下归入分级，取出的缓冲区容量仍满足请求
+	Put(make([]byte, 100, 1500))
+	for i := 0; i < 10; i++ {
+		if b := Get(1024); cap(b) < 1024 {
+			t.Fatalf("Get(1024) cap %d", cap(b))
+		}
+	}
+	Put(make([]byte, 10))
+	Put(nil)
+}
+
+func TestGrow(t *testing.T) {
+	b := append(Get(10), "hello"...)
+	b = Grow(b, 4096)
+	if string(b) != "hello" || cap(b)-len(b) < 4096 {
+		t.Fatalf("Grow: %q cap %d", b, cap(b))
+	}
+	if c := Grow(b, 1); cap(c) != cap(b) {
+		t.Fatalf("Grow reallocated with enough space")
+	}
+	Put(b)
+}
+
+func TestAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops objects randomly under race detector")
+	}
+	Put(Get(4096))
+	n := testing.AllocsPerRun(100, func() {
+		b := Get(4096)
+		b = append(b, "data"...)
+		Put(b)
+	})
+	if n != 0 {
+		t.Fatalf("Get/Put allocs %v, want 0", n)
+	}
+}
+
+func BenchmarkGetPut(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			buf := Get(4096)
+			Put(append(buf, 1))
+		}
+	})
+}
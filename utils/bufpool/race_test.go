@@ -0,0 +1,6 @@
+//go:build race
+
+package bufpool
+
+// 开启 race 检测时 sync.Pool 会随机丢弃对象
+const raceEnabled = true